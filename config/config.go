@@ -17,12 +17,21 @@ type Config struct {
 	JWTSecret      string
 	WSTokenTTL     int // WebSocket Token 有效期（秒）
 	MaxVideoSizeMB int // 视频文件最大尺寸（MB）
+	MaxFileSizeMB  int // 其他文件最大尺寸（MB）
+
+	StorageBackend  string // 文件存储后端：'oss' | 'local'
+	LocalStorageDir string // 本地存储目录（local 后端）
+	PublicBaseURL   string // 服务对外地址（local 后端生成文件访问和上传地址）
+
+	LinkPreviewFetcher string // 链接预览抓取器：'http' | 'fake'（测试环境，不访问网络）
 
 	OSS struct {
 		Endpoint        string
+		Region          string // SigV4 签名使用的区域（S3 兼容接口）
 		AccessKeyID     string
 		AccessKeySecret string
 		Bucket          string
+		PublicURL       string // 文件访问地址前缀（为空时使用 https://{bucket}.{endpoint}）
 	}
 }
 
@@ -35,6 +44,7 @@ func Load() *Config {
 	redisDB, _ := strconv.Atoi(getEnv("REDIS_DB", "0"))
 	wsTokenTTL, _ := strconv.Atoi(getEnv("WS_TOKEN_TTL", "300"))
 	maxVideoSizeMB, _ := strconv.Atoi(getEnv("MAX_VIDEO_SIZE_MB", "5"))
+	maxFileSizeMB, _ := strconv.Atoi(getEnv("MAX_FILE_SIZE_MB", "20"))
 
 	cfg := &Config{
 		Port:           getEnv("PORT", "8080"),
@@ -45,12 +55,25 @@ func Load() *Config {
 		JWTSecret:      os.Getenv("JWT_SECRET"),
 		WSTokenTTL:     wsTokenTTL,
 		MaxVideoSizeMB: maxVideoSizeMB,
+		MaxFileSizeMB:  maxFileSizeMB,
 	}
 
 	cfg.OSS.Endpoint = os.Getenv("OSS_ENDPOINT")
+	cfg.OSS.Region = os.Getenv("OSS_REGION")
 	cfg.OSS.AccessKeyID = os.Getenv("OSS_ACCESS_KEY_ID")
 	cfg.OSS.AccessKeySecret = os.Getenv("OSS_ACCESS_KEY_SECRET")
 	cfg.OSS.Bucket = getEnv("OSS_BUCKET", "dinq")
+	cfg.OSS.PublicURL = os.Getenv("OSS_PUBLIC_URL")
+
+	// 配置了 OSS 密钥时默认使用 OSS，否则使用本地存储（开发和测试环境）
+	defaultBackend := "local"
+	if cfg.OSS.AccessKeyID != "" {
+		defaultBackend = "oss"
+	}
+	cfg.StorageBackend = getEnv("STORAGE_BACKEND", defaultBackend)
+	cfg.LocalStorageDir = getEnv("LOCAL_STORAGE_DIR", "./uploads")
+	cfg.PublicBaseURL = getEnv("PUBLIC_BASE_URL", "http://localhost:"+cfg.Port)
+	cfg.LinkPreviewFetcher = getEnv("LINK_PREVIEW_FETCHER", "http")
 
 	return cfg
 }
@@ -1,7 +1,10 @@
 package handler
 
 import (
+	"fmt"
 	"strconv"
+	"strings"
+	"time"
 
 	"dinq_message/middleware"
 	"dinq_message/service"
@@ -55,13 +58,26 @@ func (h *ConversationHandler) GetMessages(c *gin.Context) {
 		return
 	}
 
-	// 分页参数
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
-	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	// 分页参数（游标优先，兼容 offset）
+	page, err := parseMessagePageQuery(c)
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
 
-	result, err := h.convSvc.GetMessages(userID, conversationID, limit, offset)
+	result, err := h.convSvc.GetMessages(userID, conversationID, page)
 	if err != nil {
-		utils.Forbidden(c, err.Error())
+		errMsg := err.Error()
+		switch {
+		case errMsg == "user is not a member of this conversation":
+			utils.Forbidden(c, errMsg)
+		case errMsg == "cursor message not found":
+			utils.NotFound(c, errMsg)
+		case strings.HasPrefix(errMsg, "failed to"):
+			utils.InternalServerError(c, errMsg)
+		default:
+			utils.BadRequest(c, errMsg)
+		}
 		return
 	}
 
@@ -69,6 +85,71 @@ func (h *ConversationHandler) GetMessages(c *gin.Context) {
 	utils.SuccessResponse(c, result)
 }
 
+// parseMessagePageQuery 解析消息分页参数：limit、offset、before/after/around（消息ID）、before_time/after_time（RFC3339）、after_seq/before_seq（序号）
+func parseMessagePageQuery(c *gin.Context) (*service.MessagePageQuery, error) {
+	page := &service.MessagePageQuery{}
+	page.Limit, _ = strconv.Atoi(c.DefaultQuery("limit", "50"))
+	page.Offset, _ = strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	for name, target := range map[string]**uuid.UUID{"before": &page.Before, "after": &page.After, "around": &page.Around} {
+		value := c.Query(name)
+		if value == "" {
+			continue
+		}
+		id, err := uuid.Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s", name)
+		}
+		*target = &id
+	}
+	for name, target := range map[string]**time.Time{"before_time": &page.BeforeTime, "after_time": &page.AfterTime} {
+		value := c.Query(name)
+		if value == "" {
+			continue
+		}
+		at, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s, expected RFC3339", name)
+		}
+		*target = &at
+	}
+	for name, target := range map[string]**int64{"after_seq": &page.AfterSeq, "before_seq": &page.BeforeSeq} {
+		value := c.Query(name)
+		if value == "" {
+			continue
+		}
+		seq, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s", name)
+		}
+		*target = &seq
+	}
+	return page, nil
+}
+
+// GetConversationDetail 获取会话详情（成员、在线状态、置顶消息）
+func (h *ConversationHandler) GetConversationDetail(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		utils.Unauthorized(c, "unauthorized")
+		return
+	}
+
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.BadRequest(c, "invalid conversation id")
+		return
+	}
+
+	detail, err := h.convSvc.GetConversationDetailWithMembers(conversationID, userID)
+	if err != nil {
+		utils.NotFound(c, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{"conversation": detail})
+}
+
 // CreateGroup 创建群聊
 func (h *ConversationHandler) CreateGroup(c *gin.Context) {
 	userID, exists := middleware.GetUserID(c)
@@ -0,0 +1,228 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"dinq_message/middleware"
+	"dinq_message/service"
+	"dinq_message/storage"
+	"dinq_message/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// multipartOverheadBytes multipart 请求除文件内容外的额外开销上限
+const multipartOverheadBytes = 1024 * 1024
+
+type FileHandler struct {
+	fileSvc *service.FileService
+}
+
+func NewFileHandler(fileSvc *service.FileService) *FileHandler {
+	return &FileHandler{fileSvc: fileSvc}
+}
+
+// UploadFile 上传文件（multipart/form-data，字段名 file）
+// POST /api/v1/files
+func (h *FileHandler) UploadFile(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		utils.Unauthorized(c, "unauthorized")
+		return
+	}
+
+	// 限制请求体大小，超大文件不会被完整读取
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.fileSvc.MaxUploadBytes()+multipartOverheadBytes)
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			utils.ErrorResponse(c, http.StatusRequestEntityTooLarge, "file size exceeds limit")
+			return
+		}
+		utils.BadRequest(c, "file is required")
+		return
+	}
+
+	f, err := fileHeader.Open()
+	if err != nil {
+		utils.BadRequest(c, "failed to read file")
+		return
+	}
+	defer f.Close()
+
+	// fileHeader.Size 为实际接收到的字节数
+	file, err := h.fileSvc.UploadFile(userID, fileHeader.Filename, f, fileHeader.Size)
+	if err != nil {
+		respondFileError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{"file": file})
+}
+
+// PresignUpload 获取客户端直传地址
+// POST /api/v1/files/presign
+func (h *FileHandler) PresignUpload(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		utils.Unauthorized(c, "unauthorized")
+		return
+	}
+
+	var req service.PresignUploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	result, err := h.fileSvc.PresignUpload(userID, &req)
+	if err != nil {
+		respondFileError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, result)
+}
+
+// CompleteUpload 确认客户端直传已完成
+// POST /api/v1/files/:id/complete
+func (h *FileHandler) CompleteUpload(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		utils.Unauthorized(c, "unauthorized")
+		return
+	}
+
+	fileID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.BadRequest(c, "invalid file id")
+		return
+	}
+
+	file, err := h.fileSvc.CompleteUpload(userID, fileID)
+	if err != nil {
+		respondFileError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{"file": file})
+}
+
+// GetFile 获取自己上传的文件信息
+// GET /api/v1/files/:id
+func (h *FileHandler) GetFile(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		utils.Unauthorized(c, "unauthorized")
+		return
+	}
+
+	fileID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.BadRequest(c, "invalid file id")
+		return
+	}
+
+	file, err := h.fileSvc.GetFile(userID, fileID)
+	if err != nil {
+		respondFileError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{"file": file})
+}
+
+// Download 访问本地存储的文件
+// GET /files/local/*key
+// Content-Type 由存储 key 的扩展名决定（与上传时校验的类型一致）并禁止浏览器嗅探；图片和音视频以外的文件强制下载，避免在本服务域名下执行脚本
+func (h *LocalStorageHandler) Download(c *gin.Context) {
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	f, info, err := h.store.Open(key)
+	if err != nil {
+		utils.NotFound(c, "file not found")
+		return
+	}
+	defer f.Close()
+
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("X-Content-Type-Options", "nosniff")
+	if !isInlineContentType(contentType) {
+		c.Header("Content-Disposition", "attachment")
+	}
+	http.ServeContent(c.Writer, c.Request, "", info.ModTime(), f)
+}
+
+// isInlineContentType 可以在浏览器中直接展示的类型（图片、视频、音频，不包括可以执行脚本的 SVG）
+func isInlineContentType(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	if strings.HasPrefix(contentType, "image/svg") {
+		return false
+	}
+	return strings.HasPrefix(contentType, "image/") ||
+		strings.HasPrefix(contentType, "video/") ||
+		strings.HasPrefix(contentType, "audio/")
+}
+
+// respondFileError 根据错误类型返回不同的状态码
+func respondFileError(c *gin.Context, err error) {
+	errMsg := err.Error()
+	switch {
+	case errMsg == "file not found":
+		utils.NotFound(c, errMsg)
+	case strings.Contains(errMsg, "size exceeds limit"):
+		utils.ErrorResponse(c, http.StatusRequestEntityTooLarge, errMsg)
+	case strings.HasPrefix(errMsg, "failed to"):
+		utils.InternalServerError(c, errMsg)
+	default:
+		utils.BadRequest(c, errMsg)
+	}
+}
+
+// LocalStorageHandler 本地存储的预签名上传接口（仅 local 存储后端注册）
+type LocalStorageHandler struct {
+	store    *storage.LocalStorage
+	maxBytes int64
+}
+
+func NewLocalStorageHandler(store *storage.LocalStorage, maxBytes int64) *LocalStorageHandler {
+	return &LocalStorageHandler{
+		store:    store,
+		maxBytes: maxBytes,
+	}
+}
+
+// Upload 接收预签名地址的上传
+// PUT /files/local/*key?expires=&signature=
+func (h *LocalStorageHandler) Upload(c *gin.Context) {
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	if err := h.store.VerifyUpload(key, c.ContentType(), c.Query("expires"), c.Query("signature")); err != nil {
+		utils.Forbidden(c, err.Error())
+		return
+	}
+
+	// 超过所有类型上限的请求直接拒绝，具体类型的上限在 CompleteUpload 时按实际字节数校验
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, h.maxBytes)
+	if err := h.store.Put(context.Background(), key, body, c.Request.ContentLength, c.ContentType()); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			utils.ErrorResponse(c, http.StatusRequestEntityTooLarge, "file size exceeds limit")
+			return
+		}
+		utils.InternalServerError(c, "failed to save file")
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"strings"
+
+	"dinq_message/middleware"
+	"dinq_message/service"
+	"dinq_message/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type LocationHandler struct {
+	locationSvc *service.LocationService
+	hub         *Hub
+}
+
+func NewLocationHandler(locationSvc *service.LocationService, hub *Hub) *LocationHandler {
+	return &LocationHandler{
+		locationSvc: locationSvc,
+		hub:         hub,
+	}
+}
+
+// StopLiveLocation 停止实时位置共享，并广播 live_location_stopped 事件
+func (h *LocationHandler) StopLiveLocation(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		utils.Unauthorized(c, "unauthorized")
+		return
+	}
+
+	messageID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.BadRequest(c, "invalid message id")
+		return
+	}
+
+	location, err := h.locationSvc.StopLiveLocation(userID, messageID)
+	if err != nil {
+		respondLocationError(c, err)
+		return
+	}
+
+	h.hub.SendLiveLocationStopped(location, "stopped")
+
+	utils.SuccessResponse(c, gin.H{"live_location": location})
+}
+
+// respondLocationError 根据错误类型返回不同的状态码
+func respondLocationError(c *gin.Context, err error) {
+	errMsg := err.Error()
+	switch {
+	case errMsg == "live location not found":
+		utils.NotFound(c, errMsg)
+	case errMsg == "only the sender can update a live location":
+		utils.Forbidden(c, errMsg)
+	case errMsg == "live location has ended":
+		utils.Conflict(c, errMsg)
+	case strings.HasPrefix(errMsg, "failed to"):
+		utils.InternalServerError(c, errMsg)
+	default:
+		utils.BadRequest(c, errMsg)
+	}
+}
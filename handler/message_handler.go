@@ -1,7 +1,6 @@
 package handler
 
 import (
-	"encoding/json"
 	"strconv"
 	"strings"
 
@@ -24,6 +23,45 @@ func NewMessageHandler(msgSvc *service.MessageService, hub *Hub) *MessageHandler
 	}
 }
 
+// SendMessage 通过 HTTP 发送消息（与 WebSocket 的 message 相同；使用同一 client_msg_id 重试时返回原消息，duplicate=true）
+// POST /api/v1/messages
+func (h *MessageHandler) SendMessage(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.Unauthorized(c, "Unauthorized")
+		return
+	}
+
+	var req service.SendMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "Invalid message format")
+		return
+	}
+
+	message, err := h.msgSvc.SendMessage(userID.(uuid.UUID), &req)
+	if err != nil {
+		errMsg := err.Error()
+		switch {
+		case errMsg == "user is not a member of this conversation" || errMsg == "you are blocked by this user":
+			utils.Forbidden(c, errMsg)
+		case errMsg == "client_msg_id has already been used in another conversation":
+			utils.Conflict(c, errMsg)
+		case strings.HasPrefix(errMsg, "failed to"):
+			utils.InternalServerError(c, errMsg)
+		default:
+			utils.BadRequest(c, errMsg)
+		}
+		return
+	}
+
+	// 重试时不再推送，避免其他成员收到重复的消息
+	if !message.Duplicate {
+		h.hub.BroadcastNewMessage(message)
+	}
+
+	utils.SuccessResponse(c, message)
+}
+
 // RecallMessage 撤回消息
 func (h *MessageHandler) RecallMessage(c *gin.Context) {
 	// 从URL参数获取消息ID
@@ -41,22 +79,16 @@ func (h *MessageHandler) RecallMessage(c *gin.Context) {
 		return
 	}
 
-	// 先查询消息获取conversation_id（用于广播）
-	message, err := h.msgSvc.GetMessageByID(msgID)
-	if err != nil {
-		utils.NotFound(c, "Message not found")
-		return
-	}
-
 	// 撤回消息
-	if err := h.msgSvc.RecallMessage(userID.(uuid.UUID), msgID); err != nil {
+	result, err := h.msgSvc.RecallMessage(userID.(uuid.UUID), msgID)
+	if err != nil {
 		// 根据错误类型返回不同的状态码
 		errMsg := err.Error()
 		if errMsg == "message not found" {
 			utils.NotFound(c, errMsg)
 		} else if errMsg == "you can only recall your own messages" {
 			utils.Forbidden(c, errMsg)
-		} else if strings.Contains(errMsg, "can only recall messages within 2 minutes") {
+		} else if strings.HasPrefix(errMsg, "can only recall messages within") {
 			utils.BadRequest(c, errMsg)
 		} else if errMsg == "message already recalled" {
 			utils.BadRequest(c, errMsg)
@@ -66,25 +98,193 @@ func (h *MessageHandler) RecallMessage(c *gin.Context) {
 		return
 	}
 
-	// 广播撤回通知给会话中的所有在线成员
-	response := map[string]interface{}{
-		"type": "recalled",
-		"data": map[string]interface{}{
-			"message_id": msgID,
-		},
+	// 广播撤回通知给会话中的所有成员
+	h.hub.SendMessageRecalled(result, userID.(uuid.UUID))
+
+	utils.SuccessWithMessage(c, "Message recalled successfully", nil)
+}
+
+// AdminRecallMessage 超管撤回任意消息（内容审核）
+// POST /api/admin/messages/:id/recall
+func (h *MessageHandler) AdminRecallMessage(c *gin.Context) {
+	msgID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.BadRequest(c, "Invalid message ID")
+		return
+	}
+
+	adminID, exists := c.Get("user_id")
+	if !exists {
+		utils.Unauthorized(c, "Unauthorized")
+		return
 	}
-	responseData, _ := json.Marshal(response)
 
-	members, err := h.msgSvc.GetConversationMembers(message.ConversationID)
-	if err == nil {
-		for _, memberID := range members {
-			h.hub.BroadcastToUser(memberID, responseData)
+	result, err := h.msgSvc.AdminRecallMessage(msgID)
+	if err != nil {
+		errMsg := err.Error()
+		if errMsg == "message not found" {
+			utils.NotFound(c, errMsg)
+		} else if errMsg == "message already recalled" {
+			utils.BadRequest(c, errMsg)
+		} else {
+			utils.InternalServerError(c, errMsg)
 		}
+		return
 	}
 
+	// 广播撤回通知给会话中的所有成员
+	h.hub.SendMessageRecalled(result, adminID.(uuid.UUID))
+
 	utils.SuccessWithMessage(c, "Message recalled successfully", nil)
 }
 
+// EditMessage 编辑消息
+func (h *MessageHandler) EditMessage(c *gin.Context) {
+	msgID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.BadRequest(c, "Invalid message ID")
+		return
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.Unauthorized(c, "Unauthorized")
+		return
+	}
+
+	var req struct {
+		Content string `json:"content" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	message, err := h.msgSvc.EditMessage(userID.(uuid.UUID), msgID, req.Content)
+	if err != nil {
+		// 根据错误类型返回不同的状态码
+		errMsg := err.Error()
+		if errMsg == "message not found" {
+			utils.NotFound(c, errMsg)
+		} else if errMsg == "you can only edit your own messages" {
+			utils.Forbidden(c, errMsg)
+		} else if strings.HasPrefix(errMsg, "failed to") {
+			utils.InternalServerError(c, errMsg)
+		} else {
+			utils.BadRequest(c, errMsg)
+		}
+		return
+	}
+
+	// 广播编辑通知给会话中的所有成员
+	h.hub.SendMessageEdited(message)
+
+	utils.SuccessResponse(c, gin.H{"message": message})
+}
+
+// GetMessageEdits 获取消息编辑历史
+func (h *MessageHandler) GetMessageEdits(c *gin.Context) {
+	msgID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.BadRequest(c, "Invalid message ID")
+		return
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.Unauthorized(c, "Unauthorized")
+		return
+	}
+
+	edits, err := h.msgSvc.GetMessageEdits(userID.(uuid.UUID), msgID)
+	if err != nil {
+		errMsg := err.Error()
+		if errMsg == "message not found" {
+			utils.NotFound(c, errMsg)
+		} else if errMsg == "you are not a member of this conversation" {
+			utils.Forbidden(c, errMsg)
+		} else {
+			utils.InternalServerError(c, errMsg)
+		}
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{"edits": edits})
+}
+
+// GetMessageReceipts 获取消息每个接收者的送达/已读状态（仅发送者）
+func (h *MessageHandler) GetMessageReceipts(c *gin.Context) {
+	msgID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.BadRequest(c, "Invalid message ID")
+		return
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.Unauthorized(c, "Unauthorized")
+		return
+	}
+
+	receipts, err := h.msgSvc.GetMessageReceipts(userID.(uuid.UUID), msgID)
+	if err != nil {
+		errMsg := err.Error()
+		if errMsg == "message not found" {
+			utils.NotFound(c, errMsg)
+		} else if errMsg == "only the sender can view message receipts" {
+			utils.Forbidden(c, errMsg)
+		} else {
+			utils.InternalServerError(c, errMsg)
+		}
+		return
+	}
+
+	utils.SuccessResponse(c, receipts)
+}
+
+// ForwardMessages 转发消息到一个或多个会话
+// POST /api/v1/messages/forward
+func (h *MessageHandler) ForwardMessages(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.Unauthorized(c, "Unauthorized")
+		return
+	}
+
+	var req struct {
+		MessageIDs      []uuid.UUID `json:"message_ids" binding:"required"`
+		ConversationIDs []uuid.UUID `json:"conversation_ids" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	results, err := h.msgSvc.ForwardMessages(userID.(uuid.UUID), req.MessageIDs, req.ConversationIDs)
+	if err != nil {
+		errMsg := err.Error()
+		if errMsg == "message not found" {
+			utils.NotFound(c, errMsg)
+		} else if errMsg == "user is not a member of this conversation" {
+			utils.Forbidden(c, errMsg)
+		} else if strings.HasPrefix(errMsg, "failed to") {
+			utils.InternalServerError(c, errMsg)
+		} else {
+			utils.BadRequest(c, errMsg)
+		}
+		return
+	}
+
+	// 广播转发产生的新消息
+	for _, result := range results {
+		for _, message := range result.Messages {
+			h.hub.BroadcastNewMessage(message)
+		}
+	}
+
+	utils.SuccessResponse(c, gin.H{"results": results})
+}
+
 // SearchMessages 搜索消息
 func (h *MessageHandler) SearchMessages(c *gin.Context) {
 	// 从上下文获取用户ID
@@ -130,13 +330,26 @@ func (h *MessageHandler) SearchMessages(c *gin.Context) {
 		}
 	}
 
+	// 游标分页（before 为上一页最后一条结果的ID）
+	var before *uuid.UUID
+	if beforeStr := c.Query("before"); beforeStr != "" {
+		id, err := uuid.Parse(beforeStr)
+		if err != nil {
+			utils.BadRequest(c, "Invalid before")
+			return
+		}
+		before = &id
+	}
+
 	// 调用 service 层搜索消息
-	messages, err := h.msgSvc.SearchMessages(userID.(uuid.UUID), keyword, conversationID, limit, offset)
+	messages, hasMore, err := h.msgSvc.SearchMessages(userID.(uuid.UUID), keyword, conversationID, limit, offset, before)
 	if err != nil {
 		// 根据错误类型返回不同的状态码
 		errMsg := err.Error()
 		if errMsg == "you are not a member of this conversation" {
 			utils.Forbidden(c, errMsg)
+		} else if errMsg == "cursor message not found" {
+			utils.NotFound(c, errMsg)
 		} else {
 			utils.InternalServerError(c, errMsg)
 		}
@@ -145,5 +358,6 @@ func (h *MessageHandler) SearchMessages(c *gin.Context) {
 
 	utils.SuccessResponse(c, gin.H{
 		"messages": messages,
+		"has_more": hasMore,
 	})
 }
@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"strings"
+
+	"dinq_message/middleware"
+	"dinq_message/service"
+	"dinq_message/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type PinHandler struct {
+	pinSvc *service.PinService
+	hub    *Hub
+}
+
+func NewPinHandler(pinSvc *service.PinService, hub *Hub) *PinHandler {
+	return &PinHandler{
+		pinSvc: pinSvc,
+		hub:    hub,
+	}
+}
+
+// PinMessage 置顶消息
+func (h *PinHandler) PinMessage(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		utils.Unauthorized(c, "unauthorized")
+		return
+	}
+
+	messageID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.BadRequest(c, "invalid message id")
+		return
+	}
+
+	result, err := h.pinSvc.PinMessage(userID, messageID)
+	if err != nil {
+		respondPinError(c, err)
+		return
+	}
+
+	// 重复置顶不产生变化，无需广播
+	if result.Changed {
+		h.hub.SendMessagePinned(result.Pin)
+	}
+
+	utils.SuccessResponse(c, gin.H{"pin": result.Pin})
+}
+
+// UnpinMessage 取消置顶
+func (h *PinHandler) UnpinMessage(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		utils.Unauthorized(c, "unauthorized")
+		return
+	}
+
+	messageID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.BadRequest(c, "invalid message id")
+		return
+	}
+
+	result, err := h.pinSvc.UnpinMessage(userID, messageID)
+	if err != nil {
+		respondPinError(c, err)
+		return
+	}
+
+	if result.Changed {
+		h.hub.SendMessageUnpinned(result.Message, userID)
+	}
+
+	utils.SuccessResponse(c, gin.H{"message_id": messageID})
+}
+
+// GetPinnedMessages 获取会话的置顶消息列表
+func (h *PinHandler) GetPinnedMessages(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		utils.Unauthorized(c, "unauthorized")
+		return
+	}
+
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.BadRequest(c, "invalid conversation id")
+		return
+	}
+
+	pins, err := h.pinSvc.GetPinnedMessages(userID, conversationID)
+	if err != nil {
+		respondPinError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{"pinned_messages": pins})
+}
+
+// respondPinError 根据错误类型返回不同的状态码
+func respondPinError(c *gin.Context, err error) {
+	errMsg := err.Error()
+	switch {
+	case errMsg == "message not found" || errMsg == "conversation not found":
+		utils.NotFound(c, errMsg)
+	case errMsg == "user is not a member of this conversation" || errMsg == "only group owner or admin can pin messages":
+		utils.Forbidden(c, errMsg)
+	case strings.HasPrefix(errMsg, "failed to"):
+		utils.InternalServerError(c, errMsg)
+	default:
+		utils.BadRequest(c, errMsg)
+	}
+}
@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"strings"
+
+	"dinq_message/middleware"
+	"dinq_message/service"
+	"dinq_message/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type PollHandler struct {
+	pollSvc *service.PollService
+	hub     *Hub
+}
+
+func NewPollHandler(pollSvc *service.PollService, hub *Hub) *PollHandler {
+	return &PollHandler{
+		pollSvc: pollSvc,
+		hub:     hub,
+	}
+}
+
+// Vote 投票（option_ids 为空表示撤回投票）并广播最新结果
+func (h *PollHandler) Vote(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		utils.Unauthorized(c, "unauthorized")
+		return
+	}
+
+	messageID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.BadRequest(c, "invalid message id")
+		return
+	}
+
+	var req struct {
+		OptionIDs []uuid.UUID `json:"option_ids"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	result, err := h.pollSvc.Vote(userID, messageID, req.OptionIDs)
+	if err != nil {
+		respondPollError(c, err)
+		return
+	}
+
+	h.hub.SendPollUpdate(userID, "vote", result)
+
+	utils.SuccessResponse(c, gin.H{"poll": result.Poll})
+}
+
+// ClosePoll 关闭投票并广播最终结果
+func (h *PollHandler) ClosePoll(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		utils.Unauthorized(c, "unauthorized")
+		return
+	}
+
+	messageID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.BadRequest(c, "invalid message id")
+		return
+	}
+
+	result, err := h.pollSvc.ClosePoll(userID, messageID)
+	if err != nil {
+		respondPollError(c, err)
+		return
+	}
+
+	h.hub.SendPollUpdate(userID, "close", result)
+
+	utils.SuccessResponse(c, gin.H{"poll": result.Poll})
+}
+
+// GetPoll 获取投票结果
+func (h *PollHandler) GetPoll(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		utils.Unauthorized(c, "unauthorized")
+		return
+	}
+
+	messageID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.BadRequest(c, "invalid message id")
+		return
+	}
+
+	poll, err := h.pollSvc.GetPoll(userID, messageID)
+	if err != nil {
+		respondPollError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{"poll": poll})
+}
+
+// respondPollError 根据错误类型返回不同的状态码
+func respondPollError(c *gin.Context, err error) {
+	errMsg := err.Error()
+	switch {
+	case errMsg == "poll not found":
+		utils.NotFound(c, errMsg)
+	case errMsg == "user is not a member of this conversation" || errMsg == "only the poll creator or group admin can close the poll":
+		utils.Forbidden(c, errMsg)
+	case errMsg == "poll is closed":
+		utils.Conflict(c, errMsg)
+	case strings.HasPrefix(errMsg, "failed to"):
+		utils.InternalServerError(c, errMsg)
+	default:
+		utils.BadRequest(c, errMsg)
+	}
+}
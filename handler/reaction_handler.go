@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"dinq_message/middleware"
+	"dinq_message/service"
+	"dinq_message/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type ReactionHandler struct {
+	reactionSvc *service.ReactionService
+	hub         *Hub
+}
+
+func NewReactionHandler(reactionSvc *service.ReactionService, hub *Hub) *ReactionHandler {
+	return &ReactionHandler{
+		reactionSvc: reactionSvc,
+		hub:         hub,
+	}
+}
+
+// AddReaction 添加表情回应
+// POST /api/v1/messages/:id/reactions {"emoji": "👍"}
+func (h *ReactionHandler) AddReaction(c *gin.Context) {
+	var req struct {
+		Emoji string `json:"emoji" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	h.updateReaction(c, "add", req.Emoji)
+}
+
+// RemoveReaction 取消表情回应
+// DELETE /api/v1/messages/:id/reactions/:emoji（表情需要 URL 编码）
+func (h *ReactionHandler) RemoveReaction(c *gin.Context) {
+	h.updateReaction(c, "remove", c.Param("emoji"))
+}
+
+// updateReaction 添加/取消表情回应并广播给会话成员
+func (h *ReactionHandler) updateReaction(c *gin.Context, action, emoji string) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		utils.Unauthorized(c, "unauthorized")
+		return
+	}
+
+	messageID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.BadRequest(c, "invalid message id")
+		return
+	}
+
+	var result *service.ReactionResult
+	if action == "add" {
+		result, err = h.reactionSvc.AddReaction(userID, messageID, emoji)
+	} else {
+		result, err = h.reactionSvc.RemoveReaction(userID, messageID, emoji)
+	}
+	if err != nil {
+		respondReactionError(c, err)
+		return
+	}
+
+	// 重复操作不产生变化，无需广播
+	if result.Changed {
+		h.hub.SendReactionUpdate(userID, action, result)
+	}
+
+	utils.SuccessResponse(c, gin.H{
+		"message_id": messageID,
+		"reactions":  result.Reactions,
+	})
+}
+
+// GetReactions 获取消息的表情回应列表
+func (h *ReactionHandler) GetReactions(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		utils.Unauthorized(c, "unauthorized")
+		return
+	}
+
+	messageID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.BadRequest(c, "invalid message id")
+		return
+	}
+
+	reactions, err := h.reactionSvc.GetReactions(userID, messageID)
+	if err != nil {
+		respondReactionError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{
+		"message_id": messageID,
+		"reactions":  reactions,
+	})
+}
+
+// respondReactionError 根据错误类型返回不同的状态码
+func respondReactionError(c *gin.Context, err error) {
+	errMsg := err.Error()
+	switch errMsg {
+	case "message not found":
+		utils.NotFound(c, errMsg)
+	case "user is not a member of this conversation":
+		utils.Forbidden(c, errMsg)
+	case "emoji is required", "emoji is too long", "emoji is not a valid emoji", "cannot react to a recalled message":
+		utils.BadRequest(c, errMsg)
+	default:
+		utils.InternalServerError(c, errMsg)
+	}
+}
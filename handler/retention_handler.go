@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"strings"
+
+	"dinq_message/middleware"
+	"dinq_message/service"
+	"dinq_message/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type RetentionHandler struct {
+	retentionSvc *service.RetentionService
+	hub          *Hub
+}
+
+func NewRetentionHandler(retentionSvc *service.RetentionService, hub *Hub) *RetentionHandler {
+	return &RetentionHandler{
+		retentionSvc: retentionSvc,
+		hub:          hub,
+	}
+}
+
+// SetMessageTTL 设置会话的消息保留时长（阅后即焚）
+// POST /api/v1/conversations/:id/retention
+func (h *RetentionHandler) SetMessageTTL(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		utils.Unauthorized(c, "unauthorized")
+		return
+	}
+
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.BadRequest(c, "invalid conversation id")
+		return
+	}
+
+	var req struct {
+		MessageTTLSeconds *int `json:"message_ttl_seconds" binding:"required"` // 0 表示关闭
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	conversation, err := h.retentionSvc.SetMessageTTL(userID, conversationID, *req.MessageTTLSeconds)
+	if err != nil {
+		errMsg := err.Error()
+		switch {
+		case errMsg == "conversation not found":
+			utils.NotFound(c, errMsg)
+		case errMsg == "user is not a member of this conversation" || errMsg == "only group owner or admin can change message retention":
+			utils.Forbidden(c, errMsg)
+		case strings.HasPrefix(errMsg, "failed to"):
+			utils.InternalServerError(c, errMsg)
+		default:
+			utils.BadRequest(c, errMsg)
+		}
+		return
+	}
+
+	h.hub.SendRetentionUpdated(conversation, userID)
+
+	utils.SuccessResponse(c, gin.H{
+		"conversation_id":     conversation.ID,
+		"message_ttl_seconds": conversation.MessageTTLSeconds,
+	})
+}
@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"strconv"
+	"strings"
+
+	"dinq_message/middleware"
+	"dinq_message/service"
+	"dinq_message/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type ScheduledMessageHandler struct {
+	scheduledSvc *service.ScheduledMessageService
+}
+
+func NewScheduledMessageHandler(scheduledSvc *service.ScheduledMessageService) *ScheduledMessageHandler {
+	return &ScheduledMessageHandler{scheduledSvc: scheduledSvc}
+}
+
+// CreateScheduledMessage 创建定时消息
+func (h *ScheduledMessageHandler) CreateScheduledMessage(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		utils.Unauthorized(c, "unauthorized")
+		return
+	}
+
+	var req service.ScheduleMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	scheduled, err := h.scheduledSvc.CreateScheduledMessage(userID, &req)
+	if err != nil {
+		respondScheduledMessageError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{"scheduled_message": scheduled})
+}
+
+// ListScheduledMessages 获取定时消息列表（可按 status 过滤）
+func (h *ScheduledMessageHandler) ListScheduledMessages(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		utils.Unauthorized(c, "unauthorized")
+		return
+	}
+
+	status := c.Query("status")
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	scheduled, err := h.scheduledSvc.ListScheduledMessages(userID, status, limit, offset)
+	if err != nil {
+		utils.InternalServerError(c, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{"scheduled_messages": scheduled})
+}
+
+// UpdateScheduledMessage 修改定时消息
+func (h *ScheduledMessageHandler) UpdateScheduledMessage(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		utils.Unauthorized(c, "unauthorized")
+		return
+	}
+
+	scheduledID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.BadRequest(c, "invalid scheduled message id")
+		return
+	}
+
+	var req service.UpdateScheduledMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	scheduled, err := h.scheduledSvc.UpdateScheduledMessage(userID, scheduledID, &req)
+	if err != nil {
+		respondScheduledMessageError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{"scheduled_message": scheduled})
+}
+
+// CancelScheduledMessage 取消定时消息
+func (h *ScheduledMessageHandler) CancelScheduledMessage(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		utils.Unauthorized(c, "unauthorized")
+		return
+	}
+
+	scheduledID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.BadRequest(c, "invalid scheduled message id")
+		return
+	}
+
+	if err := h.scheduledSvc.CancelScheduledMessage(userID, scheduledID); err != nil {
+		respondScheduledMessageError(c, err)
+		return
+	}
+
+	utils.SuccessWithMessage(c, "Scheduled message cancelled", nil)
+}
+
+// respondScheduledMessageError 根据错误类型返回不同的状态码
+func respondScheduledMessageError(c *gin.Context, err error) {
+	errMsg := err.Error()
+	switch {
+	case errMsg == "scheduled message not found":
+		utils.NotFound(c, errMsg)
+	case errMsg == "user is not a member of this conversation":
+		utils.Forbidden(c, errMsg)
+	case errMsg == "scheduled message is no longer pending":
+		utils.Conflict(c, errMsg)
+	case strings.HasPrefix(errMsg, "failed to"):
+		utils.InternalServerError(c, errMsg)
+	default:
+		utils.BadRequest(c, errMsg)
+	}
+}
@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"strings"
+
+	"dinq_message/middleware"
+	"dinq_message/service"
+	"dinq_message/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SyncHandler struct {
+	syncSvc *service.SyncService
+	hub     *Hub
+}
+
+func NewSyncHandler(syncSvc *service.SyncService, hub *Hub) *SyncHandler {
+	return &SyncHandler{
+		syncSvc: syncSvc,
+		hub:     hub,
+	}
+}
+
+// Sync 同步自检查点以来的变化（与 WebSocket 的 sync 相同，用于后台拉取）
+// GET /api/v1/sync?checkpoint=...
+func (h *SyncHandler) Sync(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		utils.Unauthorized(c, "unauthorized")
+		return
+	}
+
+	result, err := h.syncSvc.Sync(userID, c.Query("checkpoint"))
+	if err != nil {
+		errMsg := err.Error()
+		if strings.HasPrefix(errMsg, "failed to") {
+			utils.InternalServerError(c, errMsg)
+		} else {
+			utils.BadRequest(c, errMsg)
+		}
+		return
+	}
+
+	h.hub.recordSyncDelivery(userID, result.Messages)
+
+	utils.SuccessResponse(c, result)
+}
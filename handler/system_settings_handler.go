@@ -1,6 +1,11 @@
 package handler
 
 import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
 	"dinq_message/middleware"
 	"dinq_message/service"
 	"dinq_message/utils"
@@ -8,6 +13,15 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// domainPattern 域名列表配置中的单个域名（不含协议和路径）
+var domainPattern = regexp.MustCompile(`^(?i)[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?(\.[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?)*$`)
+
+// intSettingRanges 有取值范围的数值类配置 map[配置项]{最小值, 最大值}
+var intSettingRanges = map[string][2]int{
+	"ws_ack_timeout_seconds": {minAckTimeoutSeconds, maxAckTimeoutSeconds},
+	"ws_ack_max_retries":     {0, maxAckRetries},
+}
+
 type SystemSettingsHandler struct {
 	sysSvc *service.SystemSettingsService
 }
@@ -38,7 +52,7 @@ func (h *SystemSettingsHandler) UpdateSystemSetting(c *gin.Context) {
 	key := c.Param("key")
 
 	var req struct {
-		Value string `json:"value" binding:"required"`
+		Value *string `json:"value" binding:"required"` // 指针类型：允许空字符串（清空域名列表）
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -46,13 +60,13 @@ func (h *SystemSettingsHandler) UpdateSystemSetting(c *gin.Context) {
 		return
 	}
 
-	// 验证配置值（只允许 "true" 或 "false"）
-	if req.Value != "true" && req.Value != "false" {
-		utils.BadRequest(c, "value must be 'true' or 'false'")
+	// 验证配置值（开关类只允许 "true" 或 "false"，数值类只允许非负整数且部分有取值范围，域名列表可以为空）
+	if err := validateSettingValue(key, *req.Value); err != nil {
+		utils.BadRequest(c, err.Error())
 		return
 	}
 
-	if err := h.sysSvc.UpdateSetting(key, req.Value); err != nil {
+	if err := h.sysSvc.UpdateSetting(key, *req.Value); err != nil {
 		utils.BadRequest(c, err.Error())
 		return
 	}
@@ -60,10 +74,40 @@ func (h *SystemSettingsHandler) UpdateSystemSetting(c *gin.Context) {
 	utils.SuccessResponse(c, gin.H{
 		"message": "setting updated successfully",
 		"key":     key,
-		"value":   req.Value,
+		"value":   *req.Value,
 	})
 }
 
+// validateSettingValue 根据配置项类型校验配置值
+// enable_* 为开关类配置，*_domains 为逗号分隔的域名列表，其余为数值类配置（如 max_video_size_mb、message_edit_window_seconds），
+// 部分数值类配置有取值范围（intSettingRanges）
+func validateSettingValue(key, value string) error {
+	if strings.HasPrefix(key, "enable_") {
+		if value != "true" && value != "false" {
+			return fmt.Errorf("value must be 'true' or 'false'")
+		}
+		return nil
+	}
+
+	if strings.HasSuffix(key, "_domains") {
+		for _, domain := range strings.Split(value, ",") {
+			if domain = strings.TrimSpace(domain); domain != "" && !domainPattern.MatchString(domain) {
+				return fmt.Errorf("invalid domain: %s", domain)
+			}
+		}
+		return nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return fmt.Errorf("value must be a non-negative integer")
+	}
+	if bounds, ok := intSettingRanges[key]; ok && (n < bounds[0] || n > bounds[1]) {
+		return fmt.Errorf("value must be between %d and %d", bounds[0], bounds[1])
+	}
+	return nil
+}
+
 // ReloadSystemSettings 重新加载系统配置（从数据库）
 // POST /api/admin/settings/reload
 func (h *SystemSettingsHandler) ReloadSystemSettings(c *gin.Context) {
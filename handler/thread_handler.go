@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"strconv"
+
+	"dinq_message/middleware"
+	"dinq_message/service"
+	"dinq_message/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type ThreadHandler struct {
+	threadSvc *service.ThreadService
+}
+
+func NewThreadHandler(threadSvc *service.ThreadService) *ThreadHandler {
+	return &ThreadHandler{threadSvc: threadSvc}
+}
+
+// GetThread 获取话题（根消息 + 回复列表 + 未读数）
+func (h *ThreadHandler) GetThread(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		utils.Unauthorized(c, "unauthorized")
+		return
+	}
+
+	messageID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.BadRequest(c, "invalid message id")
+		return
+	}
+
+	// 分页参数
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	thread, err := h.threadSvc.GetThread(userID, messageID, limit, offset)
+	if err != nil {
+		respondThreadError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, thread)
+}
+
+// MarkThreadRead 将话题标记为已读
+func (h *ThreadHandler) MarkThreadRead(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		utils.Unauthorized(c, "unauthorized")
+		return
+	}
+
+	messageID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.BadRequest(c, "invalid message id")
+		return
+	}
+
+	root, err := h.threadSvc.MarkThreadRead(userID, messageID)
+	if err != nil {
+		respondThreadError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{
+		"thread_root_id": root.ID,
+		"unread_count":   0,
+	})
+}
+
+// respondThreadError 根据错误类型返回不同的状态码
+func respondThreadError(c *gin.Context, err error) {
+	errMsg := err.Error()
+	switch errMsg {
+	case "message not found":
+		utils.NotFound(c, errMsg)
+	case "user is not a member of this conversation":
+		utils.Forbidden(c, errMsg)
+	default:
+		utils.InternalServerError(c, errMsg)
+	}
+}
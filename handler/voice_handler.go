@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"strings"
+
+	"dinq_message/middleware"
+	"dinq_message/service"
+	"dinq_message/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type VoiceHandler struct {
+	voiceSvc *service.VoiceService
+	hub      *Hub
+}
+
+func NewVoiceHandler(voiceSvc *service.VoiceService, hub *Hub) *VoiceHandler {
+	return &VoiceHandler{
+		voiceSvc: voiceSvc,
+		hub:      hub,
+	}
+}
+
+// MarkListened 标记语音消息已播放，首次标记时广播 voice_listened 事件
+func (h *VoiceHandler) MarkListened(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		utils.Unauthorized(c, "unauthorized")
+		return
+	}
+
+	messageID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.BadRequest(c, "invalid message id")
+		return
+	}
+
+	result, err := h.voiceSvc.MarkListened(userID, messageID)
+	if err != nil {
+		respondVoiceError(c, err)
+		return
+	}
+
+	if result.Created {
+		h.hub.SendVoiceListened(result)
+	}
+
+	utils.SuccessResponse(c, gin.H{"listen": result.Listen})
+}
+
+// respondVoiceError 根据错误类型返回不同的状态码
+func respondVoiceError(c *gin.Context, err error) {
+	errMsg := err.Error()
+	switch {
+	case errMsg == "message not found":
+		utils.NotFound(c, errMsg)
+	case errMsg == "user is not a member of this conversation":
+		utils.Forbidden(c, errMsg)
+	case strings.HasPrefix(errMsg, "failed to"):
+		utils.InternalServerError(c, errMsg)
+	default:
+		utils.BadRequest(c, errMsg)
+	}
+}
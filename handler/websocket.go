@@ -6,10 +6,12 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
 
 	"dinq_message/middleware"
+	"dinq_message/model"
 	"dinq_message/service"
 	"dinq_message/utils"
 
@@ -32,11 +34,18 @@ type Client struct {
 	ID                    uuid.UUID
 	UserID                uuid.UUID
 	Conn                  *websocket.Conn
-	Send                  chan []byte
+	Send                  chan queuedEvent
 	Hub                   *Hub
 	CurrentConversationID *uuid.UUID // 用户当前正在查看的会话ID
+	AckEnabled            bool       // 客户端确认 message 推送（连接参数 ack=1），收到确认才记录送达
+	ProtocolVersion       int        // 握手时协商的协议版本
+	Encoding              string     // 握手时协商的帧编码（json | msgpack），Send 中的事件写入时按该编码编码
 	mu                    sync.RWMutex
 	closed                bool // Send channel 是否已关闭
+
+	// 等待确认的新消息推送 map[messageID]*pendingDelivery（仅 AckEnabled）
+	pending   map[uuid.UUID]*pendingDelivery
+	pendingMu sync.Mutex
 }
 
 // Hub WebSocket 连接管理中心
@@ -54,6 +63,15 @@ type Hub struct {
 	// 消息服务
 	msgSvc *service.MessageService
 
+	// 表情回应服务
+	reactionSvc *service.ReactionService
+
+	// 位置服务（实时位置共享）
+	locationSvc *service.LocationService
+
+	// 同步服务（断线重连）
+	syncSvc *service.SyncService
+
 	// 通知服务
 	notifSvc *service.NotificationService
 
@@ -65,16 +83,37 @@ type Hub struct {
 
 	// 停止 Pub/Sub 订阅
 	stopPubSub chan struct{}
+
+	// 等待记录的送达（按接收者和会话合并）
+	deliveries *deliveryBatcher
+}
+
+// queuedEvent Send 中等待写入的事件，delivery 不为空时写入成功后记录送达
+type queuedEvent struct {
+	event    *outboundEvent
+	delivery *DeliveryTarget
 }
 
 // Redis Pub/Sub channel 名称
 const redisBroadcastChannel = "ws:broadcast"
 
 // BroadcastMessage 跨 Pod 广播消息格式
+// 同一事件发给多个用户时只发布一次；事件只携带 JSON，接收的 Pod 按本地设备的帧编码按需转换
 type BroadcastMessage struct {
-	UserID  string `json:"user_id"`
-	PodID   string `json:"pod_id"` // 发送方 Pod ID，用于去重
-	Payload []byte `json:"payload"`
+	UserIDs  []uuid.UUID             `json:"user_ids"`           // 接收者
+	PodID    string                  `json:"pod_id"`             // 发送方 Pod ID，用于去重
+	Payload  json.RawMessage         `json:"payload"`            // 协议 v1 的事件（JSON）
+	Versions map[int]json.RawMessage `json:"versions,omitempty"` // 更高协议版本的专用事件（key 为起始版本）
+	Delivery *DeliveryTarget         `json:"delivery,omitempty"` // 新消息：写入接收者连接的 Pod 负责记录送达
+}
+
+// DeliveryTarget 需要记录送达的新消息
+type DeliveryTarget struct {
+	MessageID      uuid.UUID `json:"message_id"`
+	ConversationID uuid.UUID `json:"conversation_id"`
+	SenderID       uuid.UUID `json:"sender_id"`
+	Seq            int64     `json:"seq"` // 会话内序号，送达进度按序号记录
+	CreatedAt      time.Time `json:"created_at"`
 }
 
 // NewHub 创建 Hub
@@ -84,10 +123,12 @@ func NewHub(db *gorm.DB, rdb *redis.Client, sysSvc *service.SystemSettingsServic
 		MaxConnectionsPerUser: 18, // 默认每个用户最多 18 个设备
 		rdb:                   rdb,
 		msgSvc:                service.NewMessageService(db, rdb, sysSvc),
+		reactionSvc:           service.NewReactionService(db),
 		notifSvc:              service.NewNotificationService(db),
 		sysSvc:                sysSvc,
 		podID:                 uuid.New().String(), // 每个 Pod 实例唯一 ID
 		stopPubSub:            make(chan struct{}),
+		deliveries:            newDeliveryBatcher(),
 	}
 }
 
@@ -98,10 +139,12 @@ func NewHubWithConfig(db *gorm.DB, rdb *redis.Client, sysSvc *service.SystemSett
 		MaxConnectionsPerUser: 18, // 默认每个用户最多 18 个设备
 		rdb:                   rdb,
 		msgSvc:                service.NewMessageServiceWithConfig(db, rdb, sysSvc, maxVideoSizeMB),
+		reactionSvc:           service.NewReactionService(db),
 		notifSvc:              service.NewNotificationService(db),
 		sysSvc:                sysSvc,
 		podID:                 uuid.New().String(), // 每个 Pod 实例唯一 ID
 		stopPubSub:            make(chan struct{}),
+		deliveries:            newDeliveryBatcher(),
 	}
 }
 
@@ -122,15 +165,15 @@ func (h *Hub) Register(client *Client) {
 			client.UserID, h.MaxConnectionsPerUser, client.ID)
 
 		// 先发送结构化错误消息，方便前端友好提示
-		errPayload := map[string]interface{}{
-			"type": "error",
-			"data": map[string]interface{}{
-				"code":    "too_many_devices",
-				"message": fmt.Sprintf("Maximum %d devices allowed", h.MaxConnectionsPerUser),
+		errEvent := Event{
+			Type: "error",
+			Data: ErrorData{
+				Code:    wsErrTooManyDevices,
+				Message: fmt.Sprintf("Maximum %d devices allowed", h.MaxConnectionsPerUser),
 			},
 		}
-		if msg, err := json.Marshal(errPayload); err == nil {
-			_ = client.Conn.WriteMessage(websocket.TextMessage, msg)
+		if msg, err := encodeEvent(errEvent, client.Encoding); err == nil {
+			_ = client.Conn.WriteMessage(client.frameType(), msg)
 		}
 
 		// 拒绝连接（不持有锁的情况下进行网络操作）
@@ -208,8 +251,14 @@ func (h *Hub) Unregister(client *Client) {
 	client.mu.Unlock()
 }
 
-// SendToUser 发送消息给指定用户的所有设备
-func (h *Hub) SendToUser(userID uuid.UUID, message []byte) bool {
+// SendToUser 发送事件给指定用户的所有设备
+func (h *Hub) SendToUser(userID uuid.UUID, event Event) bool {
+	return h.sendToUser(userID, versionedPayload{ProtocolV1: newOutboundEvent(event)}, nil)
+}
+
+// sendToUser 发送事件给指定用户的所有设备（每个设备收到其协议版本对应的内容，写入时按设备的帧编码编码），delivery 不为空时（新消息）记录送达：
+// 未开启确认的设备写入连接成功后记录，开启确认的设备登记为待确认，收到 ack 后再记录
+func (h *Hub) sendToUser(userID uuid.UUID, payload versionedPayload, delivery *DeliveryTarget) bool {
 	h.mu.RLock()
 	userClients, exists := h.Clients[userID]
 	if !exists || len(userClients) == 0 {
@@ -228,30 +277,89 @@ func (h *Hub) SendToUser(userID uuid.UUID, message []byte) bool {
 	// 发送给该用户的所有设备
 	sentToAny := false
 	for _, client := range clientsCopy {
+		event := payload[payload.versionFor(client.ProtocolVersion)]
+
+		// 先登记再写入，避免确认先于登记到达
+		queued := queuedEvent{event: event}
+		if delivery != nil {
+			if client.AckEnabled {
+				client.trackDelivery(event, delivery)
+			} else {
+				queued.delivery = delivery
+			}
+		}
+
 		select {
-		case client.Send <- message:
+		case client.Send <- queued:
 			sentToAny = true
 		default:
-			// 发送通道满了，关闭该设备连接
+			// 发送通道满了，关闭该设备连接（待确认的消息在连接关闭时放回离线队列）
 			log.Printf("[ERROR] Send channel FULL: user=%s, client=%s, closing connection", userID, client.ID)
 			go h.Unregister(client)
 		}
 	}
-
 	return sentToAny
 }
 
-// BroadcastToUser 广播消息给用户（支持跨 Pod）
+// BroadcastToUser 广播事件给用户（支持跨 Pod）
 // 先尝试本地发送，同时 publish 到 Redis 让其他 Pod 也能收到
-func (h *Hub) BroadcastToUser(userID uuid.UUID, message []byte) {
+func (h *Hub) BroadcastToUser(userID uuid.UUID, event Event) {
+	h.broadcastToUser(userID, versionedPayload{ProtocolV1: newOutboundEvent(event)}, nil)
+}
+
+// broadcastToUsers 广播同一事件给多个用户（所有接收者共用编码结果，跨 Pod 只发布一次）
+func (h *Hub) broadcastToUsers(userIDs []uuid.UUID, event Event) {
+	if len(userIDs) == 0 {
+		return
+	}
+	payload := versionedPayload{ProtocolV1: newOutboundEvent(event)}
+	for _, userID := range userIDs {
+		h.sendToUser(userID, payload, nil)
+	}
+	h.publishBroadcast(userIDs, payload, nil)
+}
+
+// otherMembers 排除指定用户后的会话成员
+func otherMembers(members []uuid.UUID, excluded uuid.UUID) []uuid.UUID {
+	others := make([]uuid.UUID, 0, len(members))
+	for _, memberID := range members {
+		if memberID != excluded {
+			others = append(others, memberID)
+		}
+	}
+	return others
+}
+
+// broadcastToUser 广播消息给用户（按设备的协议版本选择内容），delivery 不为空时由持有接收者连接的 Pod 记录送达（或等待确认）
+func (h *Hub) broadcastToUser(userID uuid.UUID, payload versionedPayload, delivery *DeliveryTarget) {
 	// 1. 先尝试本地发送
-	h.SendToUser(userID, message)
+	h.sendToUser(userID, payload, delivery)
 
 	// 2. 发布到 Redis，让其他 Pod 也能推送
+	h.publishBroadcast([]uuid.UUID{userID}, payload, delivery)
+}
+
+// publishBroadcast 发布事件到 Redis（只携带各协议版本的 JSON，其他 Pod 按需转换为本地设备的帧编码）
+func (h *Hub) publishBroadcast(userIDs []uuid.UUID, payload versionedPayload, delivery *DeliveryTarget) {
 	broadcastMsg := BroadcastMessage{
-		UserID:  userID.String(),
-		PodID:   h.podID,
-		Payload: message,
+		UserIDs:  userIDs,
+		PodID:    h.podID,
+		Delivery: delivery,
+	}
+	for version, event := range payload {
+		frame, err := event.encoded(EncodingJSON)
+		if err != nil {
+			log.Printf("[ERROR] Failed to encode broadcast message: %v", err)
+			return
+		}
+		if version == ProtocolV1 {
+			broadcastMsg.Payload = frame
+			continue
+		}
+		if broadcastMsg.Versions == nil {
+			broadcastMsg.Versions = make(map[int]json.RawMessage)
+		}
+		broadcastMsg.Versions[version] = frame
 	}
 	msgBytes, err := json.Marshal(broadcastMsg)
 	if err != nil {
@@ -308,14 +416,367 @@ func (h *Hub) handleBroadcastMessage(data []byte) {
 		return
 	}
 
-	// 推送给本地用户
-	userID, err := uuid.Parse(msg.UserID)
+	// 推送给本地用户（所有接收者共用转换结果）
+	payload := versionedPayload{ProtocolV1: newEncodedEvent(msg.Payload)}
+	for version, frame := range msg.Versions {
+		payload[version] = newEncodedEvent(frame)
+	}
+	for _, userID := range msg.UserIDs {
+		h.sendToUser(userID, payload, msg.Delivery)
+	}
+}
+
+// SendDelivered 推送送达事件给本次新送达的消息的发送者（message_id 及之前的消息均已送达给 user_id）
+func (h *Hub) SendDelivered(result *service.DeliveryResult) {
+	h.broadcastToUsers(result.SenderIDs, Event{
+		Type: "delivered",
+		Data: DeliveredData{
+			ConversationID: result.ConversationID,
+			MessageID:      result.MessageID,
+			UserID:         result.UserID,
+			DeliveredAt:    result.DeliveredAt,
+		},
+	})
+}
+
+// BroadcastToConversation 广播消息给会话中的所有成员（支持跨 Pod）
+func (h *Hub) BroadcastToConversation(conversationID uuid.UUID, event Event) {
+	members, err := h.msgSvc.GetConversationMembers(conversationID)
+	if err != nil {
+		log.Printf("[ERROR] Failed to get conversation members: %v", err)
+		return
+	}
+
+	h.broadcastToUsers(members, event)
+}
+
+// SendReactionUpdate 推送表情回应变化给会话所有成员
+func (h *Hub) SendReactionUpdate(userID uuid.UUID, action string, result *service.ReactionResult) {
+	h.BroadcastToConversation(result.Message.ConversationID, Event{
+		Type: "reaction",
+		Data: ReactionData{
+			MessageID:      result.Message.ID,
+			ConversationID: result.Message.ConversationID,
+			UserID:         userID,
+			Emoji:          result.Emoji,
+			Action:         action,
+			Reactions:      result.Reactions,
+		},
+	})
+}
+
+// SendMessageRecalled 推送消息撤回事件给会话所有成员；撤回同时取消了置顶、结束了实时位置共享时
+// 一并推送 unpinned（unpinned_by 为撤回者）和 live_location_stopped（reason 为 stopped）
+func (h *Hub) SendMessageRecalled(result *service.RecallResult, recalledBy uuid.UUID) {
+	message := result.Message
+	h.BroadcastToConversation(message.ConversationID, Event{
+		Type: "recalled",
+		Data: RecalledData{
+			MessageID:      message.ID,
+			ConversationID: message.ConversationID,
+			Seq:            message.Seq,
+			RecalledBy:     recalledBy,
+		},
+	})
+	if result.Unpinned {
+		h.SendMessageUnpinned(message, recalledBy)
+	}
+	if result.StoppedLocation != nil {
+		h.SendLiveLocationStopped(result.StoppedLocation, "stopped")
+	}
+}
+
+// SendMessageEdited 推送消息编辑事件给会话所有成员（富文本消息附带重新生成的 HTML）
+func (h *Hub) SendMessageEdited(message *model.Message) {
+	h.BroadcastToConversation(message.ConversationID, Event{
+		Type: "edited",
+		Data: EditedData{
+			MessageID:      message.ID,
+			ConversationID: message.ConversationID,
+			Seq:            message.Seq,
+			Content:        message.Content,
+			PlainText:      message.PlainText,
+			Metadata:       rawMetadata(message.Metadata),
+			EditedAt:       message.EditedAt,
+		},
+	})
+}
+
+// BroadcastNewMessage 推送新消息给会话中的所有成员（每个成员附带各自的 can_send 状态）
+func (h *Hub) BroadcastNewMessage(message *model.Message) {
+	// 获取会话中的所有在线成员
+	members, err := h.msgSvc.GetConversationMembers(message.ConversationID)
+	if err != nil {
+		log.Printf("[ERROR] Failed to get conversation members: %v", err)
+		members = []uuid.UUID{} // 空数组，避免后续panic
+	}
+
+	// 为每个成员计算 can_send 状态并发送消息（can_send 相同的成员共用编码结果）
+	delivery := &DeliveryTarget{
+		MessageID:      message.ID,
+		ConversationID: message.ConversationID,
+		SenderID:       message.SenderID,
+		Seq:            message.Seq,
+		CreatedAt:      message.CreatedAt,
+	}
+	payloads := make(map[bool]versionedPayload, 2)
+	for _, memberID := range members {
+		// 计算该成员是否可以发送消息
+		canSend := h.msgSvc.CheckCanSend(memberID, message.ConversationID)
+		payload, ok := payloads[canSend]
+		if !ok {
+			payload = buildNewMessagePayload(message, canSend)
+			payloads[canSend] = payload
+		}
+
+		h.broadcastToUser(memberID, payload, delivery)
+
+		// 注意：会话更新推送已经在 message_service.SendMessage() 中完成
+		// 不需要在这里重复推送，避免竞态条件和重复查询数据库
+	}
+
+	// 话题回复：推送根消息的最新回复数
+	h.SendThreadReply(message)
+}
+
+// buildNewMessagePayload 构造各协议版本的新消息推送
+func buildNewMessagePayload(message *model.Message, canSend bool) versionedPayload {
+	return versionedPayload{
+		ProtocolV1: newOutboundEvent(buildNewMessageEvent(message, canSend)),
+		ProtocolV2: newOutboundEvent(buildNewMessageEventV2(message, canSend)),
+	}
+}
+
+// buildNewMessageEventV2 构造新消息推送（v2）：完整的消息对象（与 HTTP 接口一致）和会话级的 can_send 分开
+func buildNewMessageEventV2(message *model.Message, canSend bool) Event {
+	return Event{
+		Type: "message",
+		Data: NewMessageDataV2{
+			Message: message,
+			CanSend: canSend,
+		},
+	}
+}
+
+// buildNewMessageEvent 构造新消息推送（v1，包含 can_send 和发送者的 client_msg_id）
+func buildNewMessageEvent(message *model.Message, canSend bool) Event {
+	return Event{
+		Type: "message",
+		Data: buildNewMessageData(message, canSend),
+	}
+}
+
+// buildNewMessageData 构造 v1 新消息推送的 data（metadata 原样推送，不再解析）
+func buildNewMessageData(message *model.Message, canSend bool) NewMessageData {
+	return NewMessageData{
+		ID:               message.ID,
+		ConversationID:   message.ConversationID,
+		Seq:              message.Seq,
+		SenderID:         message.SenderID,
+		MessageType:      message.MessageType,
+		Content:          message.Content,
+		PlainText:        message.PlainText,
+		Metadata:         rawMetadata(message.Metadata),
+		Status:           message.Status,
+		ClientMsgID:      message.ClientMsgID,
+		CreatedAt:        message.CreatedAt,
+		ReplyToMessageID: message.ReplyToMessageID,
+		ThreadRootID:     message.ThreadRootID,
+		ExpiresAt:        message.ExpiresAt,
+		CanSend:          canSend,
+		Poll:             message.Poll,
+		LiveLocation:     message.LiveLocation,
+	}
+}
+
+// SendThreadReply 推送话题回复事件给会话所有成员（包含根消息最新的回复数和最后回复时间）
+func (h *Hub) SendThreadReply(reply *model.Message) {
+	if reply.ThreadRootID == nil {
+		return
+	}
+
+	root, err := h.msgSvc.GetMessageByID(*reply.ThreadRootID)
 	if err != nil {
-		log.Printf("[ERROR] Invalid user ID in broadcast message: %v", err)
+		log.Printf("[ERROR] Failed to get thread root: %v", err)
 		return
 	}
 
-	h.SendToUser(userID, msg.Payload)
+	h.BroadcastToConversation(reply.ConversationID, Event{
+		Type: "thread_reply",
+		Data: ThreadReplyData{
+			ThreadRootID:      root.ID,
+			ConversationID:    reply.ConversationID,
+			MessageID:         reply.ID,
+			Seq:               reply.Seq,
+			SenderID:          reply.SenderID,
+			ThreadReplyCount:  root.ThreadReplyCount,
+			ThreadLastReplyAt: root.ThreadLastReplyAt,
+		},
+	})
+}
+
+// SendMessagePinned 推送消息置顶事件给会话所有成员
+func (h *Hub) SendMessagePinned(pin *model.PinnedMessage) {
+	h.BroadcastToConversation(pin.ConversationID, Event{
+		Type: "pinned",
+		Data: PinnedData{
+			ConversationID: pin.ConversationID,
+			MessageID:      pin.MessageID,
+			PinnedBy:       pin.PinnedBy,
+			PinnedAt:       pin.PinnedAt,
+			Message:        pin.Message,
+		},
+	})
+}
+
+// SendMessageUnpinned 推送取消置顶事件给会话所有成员
+func (h *Hub) SendMessageUnpinned(message *model.Message, unpinnedBy uuid.UUID) {
+	h.BroadcastToConversation(message.ConversationID, Event{
+		Type: "unpinned",
+		Data: UnpinnedData{
+			ConversationID: message.ConversationID,
+			MessageID:      message.ID,
+			UnpinnedBy:     unpinnedBy,
+		},
+	})
+}
+
+// SendPollUpdate 推送投票结果变化给会话所有成员（不包含操作者自己的选择）
+func (h *Hub) SendPollUpdate(userID uuid.UUID, action string, result *service.PollUpdateResult) {
+	poll := *result.Poll
+	poll.MyOptionIDs = nil
+
+	data := PollUpdatedData{
+		MessageID:      result.Message.ID,
+		ConversationID: result.Message.ConversationID,
+		Action:         action,
+		Poll:           poll,
+	}
+	// 匿名投票不暴露投票人
+	if !poll.Anonymous || action == "close" {
+		data.UserID = &userID
+	}
+
+	h.BroadcastToConversation(result.Message.ConversationID, Event{
+		Type: "poll_updated",
+		Data: data,
+	})
+}
+
+// SendVoiceListened 推送语音消息已播放事件给会话所有成员（发送者据此显示对方已收听）
+func (h *Hub) SendVoiceListened(result *service.VoiceListenResult) {
+	h.BroadcastToConversation(result.Message.ConversationID, Event{
+		Type: "voice_listened",
+		Data: VoiceListenedData{
+			MessageID:      result.Message.ID,
+			ConversationID: result.Message.ConversationID,
+			UserID:         result.Listen.UserID,
+			ListenedAt:     result.Listen.ListenedAt,
+		},
+	})
+}
+
+// SendLiveLocationUpdated 推送实时位置更新事件给会话所有成员
+func (h *Hub) SendLiveLocationUpdated(location *model.LiveLocation) {
+	h.BroadcastToConversation(location.ConversationID, Event{
+		Type: "live_location_updated",
+		Data: LiveLocationUpdatedData{
+			MessageID:      location.MessageID,
+			ConversationID: location.ConversationID,
+			UserID:         location.UserID,
+			Latitude:       location.Latitude,
+			Longitude:      location.Longitude,
+			Accuracy:       location.Accuracy,
+			Heading:        location.Heading,
+			UpdatedAt:      location.UpdatedAt,
+			ExpiresAt:      location.ExpiresAt,
+		},
+	})
+}
+
+// SendLiveLocationStopped 推送实时位置共享结束事件给会话所有成员（reason: stopped | expired）
+func (h *Hub) SendLiveLocationStopped(location *model.LiveLocation, reason string) {
+	h.BroadcastToConversation(location.ConversationID, Event{
+		Type: "live_location_stopped",
+		Data: LiveLocationStoppedData{
+			MessageID:      location.MessageID,
+			ConversationID: location.ConversationID,
+			UserID:         location.UserID,
+			Latitude:       location.Latitude,
+			Longitude:      location.Longitude,
+			StoppedAt:      location.StoppedAt,
+			Reason:         reason,
+		},
+	})
+}
+
+// SendMessageUpdated 推送消息 metadata 更新事件给会话所有成员（如服务端生成的图片宽高和缩略图）
+func (h *Hub) SendMessageUpdated(message *model.Message) {
+	h.BroadcastToConversation(message.ConversationID, Event{
+		Type: "message_updated",
+		Data: MessageUpdatedData{
+			MessageID:      message.ID,
+			ConversationID: message.ConversationID,
+			Seq:            message.Seq,
+			Metadata:       rawMetadata(message.Metadata),
+		},
+	})
+}
+
+// SendMessagesExpired 推送消息过期事件给会话所有成员（客户端据此删除本地缓存）
+func (h *Hub) SendMessagesExpired(conversationID uuid.UUID, messageIDs []uuid.UUID) {
+	h.BroadcastToConversation(conversationID, Event{
+		Type: "expired",
+		Data: ExpiredData{
+			ConversationID: conversationID,
+			MessageIDs:     messageIDs,
+		},
+	})
+}
+
+// SendRetentionUpdated 推送会话消息保留时长变化事件给会话所有成员
+func (h *Hub) SendRetentionUpdated(conversation *model.Conversation, updatedBy uuid.UUID) {
+	h.BroadcastToConversation(conversation.ID, Event{
+		Type: "retention_updated",
+		Data: RetentionUpdatedData{
+			ConversationID:    conversation.ID,
+			MessageTTLSeconds: conversation.MessageTTLSeconds,
+			UpdatedBy:         updatedBy,
+		},
+	})
+}
+
+// SetLocationService 设置位置服务（用于依赖注入）
+func (h *Hub) SetLocationService(locationSvc *service.LocationService) {
+	h.locationSvc = locationSvc
+}
+
+// SetSyncService 设置同步服务（用于依赖注入）
+func (h *Hub) SetSyncService(syncSvc *service.SyncService) {
+	h.syncSvc = syncSvc
+}
+
+// recordSyncDelivery 同步返回的新消息已送达：每个会话记录最新一条他人发送的消息
+func (h *Hub) recordSyncDelivery(userID uuid.UUID, messages []model.Message) {
+	latestByConversation := make(map[uuid.UUID]*DeliveryTarget)
+	for _, message := range messages {
+		if message.SenderID == userID {
+			continue
+		}
+		if latest := latestByConversation[message.ConversationID]; latest != nil && latest.Seq >= message.Seq {
+			continue
+		}
+		latestByConversation[message.ConversationID] = &DeliveryTarget{
+			MessageID:      message.ID,
+			ConversationID: message.ConversationID,
+			SenderID:       message.SenderID,
+			Seq:            message.Seq,
+			CreatedAt:      message.CreatedAt,
+		}
+	}
+	for _, target := range latestByConversation {
+		h.recordDelivery(userID, target)
+	}
 }
 
 // GetMessageService 获取消息服务（用于依赖注入）
@@ -341,91 +802,72 @@ func (h *Hub) IsUserOnline(userID uuid.UUID) bool {
 
 // SendNotification 通过 WebSocket 发送通知给用户
 func (h *Hub) SendNotification(userID uuid.UUID, notification interface{}) bool {
-	response := map[string]interface{}{
-		"type": "notification",
-		"data": notification,
-	}
-	responseData, err := json.Marshal(response)
-	if err != nil {
-		log.Printf("[ERROR] Failed to marshal notification: %v", err)
-		return false
-	}
-	h.BroadcastToUser(userID, responseData)
+	h.BroadcastToUser(userID, Event{
+		Type: "notification",
+		Data: notification,
+	})
 	return true
 }
 
 // SendUnreadCountUpdate 推送未读数量更新
 func (h *Hub) SendUnreadCountUpdate(userID uuid.UUID, conversationID uuid.UUID, unreadCount int) bool {
-	response := map[string]interface{}{
-		"type": "unread_count_update",
-		"data": map[string]interface{}{
-			"conversation_id": conversationID,
-			"unread_count":    unreadCount,
+	h.BroadcastToUser(userID, Event{
+		Type: "unread_count_update",
+		Data: UnreadCountUpdateData{
+			ConversationID: conversationID,
+			UnreadCount:    unreadCount,
 		},
-	}
-	responseData, err := json.Marshal(response)
-	if err != nil {
-		log.Printf("[ERROR] Failed to marshal unread count update: %v", err)
-		return false
-	}
-	h.BroadcastToUser(userID, responseData)
+	})
 	return true
 }
 
 // SendOnlineStatusUpdate 推送在线状态变化
 func (h *Hub) SendOnlineStatusUpdate(userID uuid.UUID, targetUserID uuid.UUID, isOnline bool) bool {
-	response := map[string]interface{}{
-		"type": "online_status_update",
-		"data": map[string]interface{}{
-			"user_id":   targetUserID,
-			"is_online": isOnline,
+	h.BroadcastToUser(userID, Event{
+		Type: "online_status_update",
+		Data: OnlineStatusUpdateData{
+			UserID:   targetUserID,
+			IsOnline: isOnline,
 		},
-	}
-	responseData, err := json.Marshal(response)
-	if err != nil {
-		log.Printf("[ERROR] Failed to marshal online status update: %v", err)
-		return false
-	}
-	h.BroadcastToUser(userID, responseData)
+	})
 	return true
 }
 
 // SendConversationUpdate 推送会话更新(包含最新消息时间等)
 func (h *Hub) SendConversationUpdate(userID uuid.UUID, conversationID uuid.UUID, lastMessageTime *time.Time, lastMessageText *string, unreadCount int) bool {
-	response := map[string]interface{}{
-		"type": "conversation_update",
-		"data": map[string]interface{}{
-			"conversation_id":   conversationID,
-			"last_message_time": lastMessageTime,
-			"last_message_text": lastMessageText,
-			"unread_count":      unreadCount,
-		},
-	}
-	responseData, err := json.Marshal(response)
-	if err != nil {
-		log.Printf("[ERROR] ConvUpdate marshal failed: user=%s, conversation=%s, error=%v", userID, conversationID, err)
-		return false
-	}
-
-	h.BroadcastToUser(userID, responseData)
+	h.broadcastToUser(userID, versionedPayload{
+		ProtocolV1: newOutboundEvent(Event{
+			Type: "conversation_update",
+			Data: ConversationUpdateData{
+				ConversationID:  conversationID,
+				LastMessageTime: lastMessageTime,
+				LastMessageText: lastMessageText,
+				UnreadCount:     unreadCount,
+			},
+		}),
+		// v2：时间字段与同步结果、会话模型一致（last_message_at）
+		ProtocolV2: newOutboundEvent(Event{
+			Type: "conversation_update",
+			Data: ConversationUpdateDataV2{
+				ConversationID:  conversationID,
+				LastMessageAt:   lastMessageTime,
+				LastMessageText: lastMessageText,
+				UnreadCount:     unreadCount,
+			},
+		}),
+	}, nil)
 	return true
 }
 
 // SendNotificationUpdate 推送通知更新(未读数量+最新通知时间)
 func (h *Hub) SendNotificationUpdate(userID uuid.UUID, unreadCount int, latestNotifTime *time.Time) bool {
-	response := map[string]interface{}{
-		"type": "notification_update",
-		"data": map[string]interface{}{
-			"unread_count":      unreadCount,
-			"latest_notif_time": latestNotifTime,
+	h.BroadcastToUser(userID, Event{
+		Type: "notification_update",
+		Data: NotificationUpdateData{
+			UnreadCount:     unreadCount,
+			LatestNotifTime: latestNotifTime,
 		},
-	}
-	responseData, err := json.Marshal(response)
-	if err != nil {
-		log.Printf("[ERROR] Failed to marshal notification update: %v", err)
-		return false
-	}
-	h.BroadcastToUser(userID, responseData)
+	})
 	return true
 }
 
@@ -526,8 +968,9 @@ func (h *Hub) IsUserInConversation(userID uuid.UUID, conversationID uuid.UUID) b
 
 // WSMessage WebSocket 消息格式
 type WSMessage struct {
-	Type string          `json:"type"` // 'message' | 'typing' | 'read' | 'heartbeat'
-	Data json.RawMessage `json:"data"`
+	Type      string          `json:"type"`                 // 'message' | 'typing' | 'read' | 'recall' | 'edit' | 'reaction' | 'forward' | 'ack' | 'heartbeat'
+	RequestID string          `json:"request_id,omitempty"` // 可选，原样带回对应的 ack/error（或 forward_result、sync）
+	Data      json.RawMessage `json:"data"`
 }
 
 // HandleWebSocket 处理 WebSocket 连接
@@ -547,27 +990,68 @@ func HandleWebSocket(hub *Hub) gin.HandlerFunc {
 			return
 		}
 
+		// 协商协议版本（query 参数 v 或子协议 dinq.vN）
+		version, subprotocol, protocolErr := negotiateProtocol(c.Request)
+		// 协商帧编码（query 参数 encoding）
+		encoding, encodingErr := negotiateEncoding(c.Request)
+		var responseHeader http.Header
+		if subprotocol != "" {
+			responseHeader = http.Header{}
+			responseHeader.Set("Sec-WebSocket-Protocol", subprotocol)
+		}
+
 		// 升级为 WebSocket 连接
-		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+		conn, err := upgrader.Upgrade(c.Writer, c.Request, responseHeader)
 		if err != nil {
 			log.Printf("[ERROR] WebSocket upgrade failed for user %s: %v", userID, err)
 			return
 		}
 
+		// 不支持的协议版本：以专用关闭码拒绝，客户端据此提示升级
+		if protocolErr != nil {
+			log.Printf("[WARN] User %s requested %v", userID, protocolErr)
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(closeUnsupportedProtocol, protocolErr.Error()),
+				time.Now().Add(time.Second))
+			conn.Close()
+			return
+		}
+		if encodingErr != nil {
+			log.Printf("[WARN] User %s requested %v", userID, encodingErr)
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(closeUnsupportedEncoding, encodingErr.Error()),
+				time.Now().Add(time.Second))
+			conn.Close()
+			return
+		}
+
 		// 创建客户端
 		client := &Client{
-			ID:     uuid.New(),
-			UserID: userID,
-			Conn:   conn,
-			Send:   make(chan []byte, 1024), // 增加缓冲区，应对高并发场景
-			Hub:    hub,
+			ID:              uuid.New(),
+			UserID:          userID,
+			Conn:            conn,
+			Send:            make(chan queuedEvent, 1024), // 增加缓冲区，应对高并发场景
+			Hub:             hub,
+			ProtocolVersion: version,
+			Encoding:        encoding,
+		}
+		if ackEnabled, _ := strconv.ParseBool(c.Query("ack")); ackEnabled {
+			client.AckEnabled = true
+			client.pending = make(map[uuid.UUID]*pendingDelivery)
 		}
 
 		// 注册客户端
 		hub.Register(client)
 
-		// 发送离线消息
-		go client.sendOfflineMessages()
+		// 带 checkpoint 参数（可以为空）的客户端使用同步协议，从数据库同步断线期间的变化；否则发送 Redis 中的离线消息
+		if checkpoint, ok := c.GetQuery("checkpoint"); ok {
+			go func() {
+				client.sendSync("", checkpoint)
+				client.sendLatestNotification()
+			}()
+		} else {
+			go client.sendOfflineMessages()
+		}
 
 		// 启动读写协程
 		go client.readPump()
@@ -589,7 +1073,7 @@ func (c *Client) readPump() {
 	})
 
 	for {
-		_, message, err := c.Conn.ReadMessage()
+		frameType, message, err := c.Conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseNoStatusReceived, websocket.CloseAbnormalClosure) {
 				log.Printf("[ERROR] User %s WebSocket unexpected close error: %v", c.UserID, err)
@@ -597,22 +1081,21 @@ func (c *Client) readPump() {
 			break
 		}
 
-		// 解析消息
+		// 解析消息（二进制帧为 MessagePack，文本帧为 JSON）
 		var wsMsg WSMessage
-		if err := json.Unmarshal(message, &wsMsg); err != nil {
+		if frameType == websocket.BinaryMessage {
+			if err := decodeMsgpackRequest(message, &wsMsg); err != nil {
+				log.Printf("[ERROR] Invalid message format: %v", err)
+				c.sendError("", wsErrInvalidFormat, "Invalid MessagePack format")
+				continue
+			}
+		} else if err := json.Unmarshal(message, &wsMsg); err != nil {
 			log.Printf("[ERROR] Invalid message format: %v", err)
 			// 发送错误消息给客户端
-			errorResponse := map[string]interface{}{
-				"type": "error",
-				"data": map[string]interface{}{
-					"message": "Invalid JSON format",
-				},
-			}
-			if responseData, err := json.Marshal(errorResponse); err == nil {
-				c.Send <- responseData
-			}
+			c.sendError("", wsErrInvalidFormat, "Invalid JSON format")
 			continue
 		}
+		requestID := wsMsg.RequestID
 
 		// 处理不同类型的消息
 		switch wsMsg.Type {
@@ -622,26 +1105,58 @@ func (c *Client) readPump() {
 				ctx := context.Background()
 				c.Hub.rdb.Set(ctx, "online:"+c.UserID.String(), "1", 30*time.Second)
 			}
+			c.sendAck(requestID, nil)
 
 		case "message":
 			// 聊天消息
-			c.handleSendMessage(wsMsg.Data)
+			c.handleSendMessage(requestID, wsMsg.Data)
 
 		case "typing":
 			// 正在输入提示
-			c.handleTyping(wsMsg.Data)
+			c.handleTyping(requestID, wsMsg.Data)
 
 		case "read":
 			// 已读回执
-			c.handleMarkAsRead(wsMsg.Data)
+			c.handleMarkAsRead(requestID, wsMsg.Data)
 
 		case "recall":
 			// 撤回消息
-			c.handleRecallMessage(wsMsg.Data)
+			c.handleRecallMessage(requestID, wsMsg.Data)
+
+		case "edit":
+			// 编辑消息
+			c.handleEditMessage(requestID, wsMsg.Data)
+
+		case "reaction":
+			// 表情回应
+			c.handleReaction(requestID, wsMsg.Data)
+
+		case "forward":
+			// 转发消息
+			c.handleForwardMessages(requestID, wsMsg.Data)
+
+		case "location_update":
+			// 上报实时位置
+			c.handleLiveLocationUpdate(requestID, wsMsg.Data)
+
+		case "location_stop":
+			// 停止实时位置共享
+			c.handleLiveLocationStop(requestID, wsMsg.Data)
+
+		case "sync":
+			// 同步自检查点以来的变化
+			c.handleSync(requestID, wsMsg.Data)
+
+		case "ack":
+			// 确认收到新消息推送
+			c.handleAck(requestID, wsMsg.Data)
 
 		case "set_current_conversation":
 			// 设置当前正在查看的会话（用于智能通知）
-			c.handleSetCurrentConversation(wsMsg.Data)
+			c.handleSetCurrentConversation(requestID, wsMsg.Data)
+
+		default:
+			c.sendError(requestID, wsErrUnknownType, "Unknown message type: "+wsMsg.Type)
 		}
 	}
 }
@@ -649,14 +1164,25 @@ func (c *Client) readPump() {
 // writePump 向 WebSocket 写入消息
 func (c *Client) writePump() {
 	ticker := time.NewTicker(54 * time.Second)
+
+	// 开启确认的设备定期重发超时未确认的新消息
+	var ackCheck <-chan time.Time
+	if c.AckEnabled {
+		ackTicker := time.NewTicker(ackCheckInterval)
+		defer ackTicker.Stop()
+		ackCheck = ackTicker.C
+	}
+
 	defer func() {
 		ticker.Stop()
 		c.Conn.Close()
+		// 连接关闭时仍未确认的消息放回离线队列
+		c.requeuePendingDeliveries()
 	}()
 
 	for {
 		select {
-		case message, ok := <-c.Send:
+		case queued, ok := <-c.Send:
 			c.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
 			if !ok {
 				// Hub 关闭了通道
@@ -664,16 +1190,50 @@ func (c *Client) writePump() {
 				return
 			}
 
-			w, err := c.Conn.NextWriter(websocket.TextMessage)
+			// 按该设备的帧编码编码（同一事件的其他设备共用编码结果）
+			message, err := queued.event.encoded(c.Encoding)
+			if err != nil {
+				log.Printf("[ERROR] Failed to encode event for user %s (client: %s): %v", c.UserID, c.ID, err)
+				continue
+			}
+
+			w, err := c.Conn.NextWriter(c.frameType())
 			if err != nil {
+				log.Printf("[ERROR] Failed to write to user %s (client: %s): %v", c.UserID, c.ID, err)
 				return
 			}
 			w.Write(message)
 
 			if err := w.Close(); err != nil {
+				log.Printf("[ERROR] Failed to write to user %s (client: %s): %v", c.UserID, c.ID, err)
 				return
 			}
 
+			// 新消息写入连接成功才记录送达
+			if queued.delivery != nil {
+				c.Hub.recordDelivery(c.UserID, queued.delivery)
+			}
+
+		case <-ackCheck:
+			retries, exhausted := c.duePendingDeliveries(time.Now())
+			if exhausted {
+				// 重试次数用完仍未确认，视为设备已离线：断开连接，未确认的消息走离线路径
+				log.Printf("[WARN] User %s (client: %s) did not ack messages, closing connection", c.UserID, c.ID)
+				return
+			}
+			for _, event := range retries {
+				payload, err := event.encoded(c.Encoding)
+				if err != nil {
+					log.Printf("[ERROR] Failed to encode event for user %s (client: %s): %v", c.UserID, c.ID, err)
+					continue
+				}
+				c.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+				if err := c.Conn.WriteMessage(c.frameType(), payload); err != nil {
+					log.Printf("[ERROR] Failed to write to user %s (client: %s): %v", c.UserID, c.ID, err)
+					return
+				}
+			}
+
 		case <-ticker.C:
 			// 发送 ping 保持连接
 			c.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
@@ -685,11 +1245,11 @@ func (c *Client) writePump() {
 }
 
 // handleSendMessage 处理发送消息
-func (c *Client) handleSendMessage(data json.RawMessage) {
+func (c *Client) handleSendMessage(requestID string, data json.RawMessage) {
 	var req service.SendMessageRequest
 	if err := json.Unmarshal(data, &req); err != nil {
 		log.Printf("[ERROR] Invalid message format: %v", err)
-		c.sendError("Invalid message format")
+		c.sendError(requestID, wsErrInvalidFormat, "Invalid message format")
 		return
 	}
 
@@ -697,56 +1257,33 @@ func (c *Client) handleSendMessage(data json.RawMessage) {
 	message, err := c.Hub.msgSvc.SendMessage(c.UserID, &req)
 	if err != nil {
 		log.Printf("[ERROR] Failed to send message: %v", err)
-		c.sendError(err.Error())
+		c.sendServiceError(requestID, err)
 		return
 	}
 
-	// 获取会话中的所有在线成员
-	members, err := c.Hub.msgSvc.GetConversationMembers(message.ConversationID)
-	if err != nil {
-		log.Printf("[ERROR] Failed to get conversation members: %v", err)
-		members = []uuid.UUID{} // 空数组，避免后续panic
-	}
-
-	// 为每个成员计算 can_send 状态并发送消息
-	for _, memberID := range members {
-		// 计算该成员是否可以发送消息
-		canSend := c.Hub.msgSvc.CheckCanSend(memberID, message.ConversationID)
-
-		// 解析 metadata (json.RawMessage -> map)
-		var metadata map[string]interface{}
-		if len(message.Metadata) > 0 {
-			json.Unmarshal(message.Metadata, &metadata)
-		}
-
-		// 构造包含 can_send 的响应
-		response := map[string]interface{}{
-			"type": "message",
-			"data": map[string]interface{}{
-				"id":                  message.ID,
-				"conversation_id":     message.ConversationID,
-				"sender_id":           message.SenderID,
-				"message_type":        message.MessageType,
-				"content":             message.Content,
-				"metadata":            metadata,
-				"status":              message.Status,
-				"created_at":          message.CreatedAt,
-				"reply_to_message_id": message.ReplyToMessageID, // 回复消息ID
-				"can_send":            canSend,                  // 告诉前端是否可以发送
-			},
+	// 重试（client_msg_id 已经使用过）：只把原消息回给当前连接，不再推送给其他成员
+	if message.Duplicate {
+		if requestID != "" {
+			c.sendAck(requestID, message)
+		} else {
+			c.sendMessageAck(message)
 		}
-		responseData, _ := json.Marshal(response)
-		c.Hub.BroadcastToUser(memberID, responseData)
-
-		// 注意：会话更新推送已经在 message_service.SendMessage() 中完成
-		// 不需要在这里重复推送，避免竞态条件和重复查询数据库
+		return
 	}
+
+	// 广播新消息给会话成员
+	c.Hub.BroadcastNewMessage(message)
+	c.sendAck(requestID, message)
 }
 
 // handleTyping 处理正在输入提示
-func (c *Client) handleTyping(data json.RawMessage) {
+func (c *Client) handleTyping(requestID string, data json.RawMessage) {
 	// 检查系统是否启用了正在输入提示功能
+	// 未启用时只回复带 request_id 的请求，避免每次输入都收到错误
 	if !c.Hub.sysSvc.IsFeatureEnabled("enable_typing_indicator") {
+		if requestID != "" {
+			c.sendError(requestID, wsErrFeatureDisabled, "typing indicator is disabled")
+		}
 		return
 	}
 
@@ -754,134 +1291,277 @@ func (c *Client) handleTyping(data json.RawMessage) {
 		ConversationID uuid.UUID `json:"conversation_id"`
 	}
 	if err := json.Unmarshal(data, &req); err != nil {
+		c.sendError(requestID, wsErrInvalidFormat, "Invalid typing format")
 		return
 	}
 
 	// 广播给会话中的其他在线成员
-	response := map[string]interface{}{
-		"type": "typing",
-		"data": map[string]interface{}{
-			"conversation_id": req.ConversationID,
-			"user_id":         c.UserID,
-		},
-	}
-	responseData, _ := json.Marshal(response)
-
 	members, _ := c.Hub.msgSvc.GetConversationMembers(req.ConversationID)
-	for _, memberID := range members {
-		if memberID != c.UserID {
-			c.Hub.BroadcastToUser(memberID, responseData)
-		}
-	}
+	c.Hub.broadcastToUsers(otherMembers(members, c.UserID), Event{
+		Type: "typing",
+		Data: TypingData{
+			ConversationID: req.ConversationID,
+			UserID:         c.UserID,
+		},
+	})
+	c.sendAck(requestID, nil)
 }
 
 // handleMarkAsRead 处理已读回执
-func (c *Client) handleMarkAsRead(data json.RawMessage) {
+func (c *Client) handleMarkAsRead(requestID string, data json.RawMessage) {
 	var req struct {
 		ConversationID uuid.UUID `json:"conversation_id"`
 		MessageID      uuid.UUID `json:"message_id"`
 	}
 	if err := json.Unmarshal(data, &req); err != nil {
 		log.Printf("[ERROR] Invalid read receipt format: %v", err)
+		c.sendError(requestID, wsErrInvalidFormat, "Invalid read format")
 		return
 	}
 
 	// 标记为已读（这个操作总是执行，更新未读计数）
-	if err := c.Hub.msgSvc.MarkAsRead(c.UserID, req.ConversationID, req.MessageID); err != nil {
+	delivery, err := c.Hub.msgSvc.MarkAsRead(c.UserID, req.ConversationID, req.MessageID)
+	if err != nil {
 		log.Printf("[ERROR] Failed to mark as read: %v", err)
+		c.sendServiceError(requestID, err)
 		return
 	}
+	if delivery != nil {
+		c.Hub.SendDelivered(delivery)
+	}
 
 	// 如果启用了已读回执功能，广播已读状态给其他成员
 	if c.Hub.sysSvc.IsFeatureEnabled("enable_read_receipt") {
-		response := map[string]interface{}{
-			"type": "read",
-			"data": map[string]interface{}{
-				"conversation_id": req.ConversationID,
-				"message_id":      req.MessageID,
-				"reader_id":       c.UserID,
-			},
-		}
-		responseData, _ := json.Marshal(response)
-
 		members, _ := c.Hub.msgSvc.GetConversationMembers(req.ConversationID)
-		for _, memberID := range members {
-			if memberID != c.UserID {
-				c.Hub.BroadcastToUser(memberID, responseData)
-			}
-		}
+		c.Hub.broadcastToUsers(otherMembers(members, c.UserID), Event{
+			Type: "read",
+			Data: ReadData{
+				ConversationID: req.ConversationID,
+				MessageID:      req.MessageID,
+				ReaderID:       c.UserID,
+			},
+		})
 	}
+
+	c.sendAck(requestID, map[string]interface{}{
+		"conversation_id": req.ConversationID,
+		"message_id":      req.MessageID,
+	})
 }
 
 // handleRecallMessage 处理撤回消息
-func (c *Client) handleRecallMessage(data json.RawMessage) {
+func (c *Client) handleRecallMessage(requestID string, data json.RawMessage) {
 	var req struct {
 		MessageID uuid.UUID `json:"message_id"`
 	}
 	if err := json.Unmarshal(data, &req); err != nil {
 		log.Printf("[ERROR] Invalid recall format: %v", err)
-		c.sendError("Invalid recall format")
+		c.sendError(requestID, wsErrInvalidFormat, "Invalid recall format")
 		return
 	}
 
-	// 先查询消息获取conversation_id
-	message, err := c.Hub.msgSvc.GetMessageByID(req.MessageID)
+	// 撤回消息
+	result, err := c.Hub.msgSvc.RecallMessage(c.UserID, req.MessageID)
 	if err != nil {
-		log.Printf("[ERROR] Message not found: %v", err)
-		c.sendError("Message not found")
+		log.Printf("[ERROR] Failed to recall message: %v", err)
+		c.sendServiceError(requestID, err)
 		return
 	}
 
-	// 撤回消息
-	if err := c.Hub.msgSvc.RecallMessage(c.UserID, req.MessageID); err != nil {
-		log.Printf("[ERROR] Failed to recall message: %v", err)
-		c.sendError(err.Error())
+	// 广播撤回通知给会话中的所有成员
+	c.Hub.SendMessageRecalled(result, c.UserID)
+	c.sendAck(requestID, map[string]interface{}{
+		"message_id":      result.Message.ID,
+		"conversation_id": result.Message.ConversationID,
+	})
+}
+
+// handleEditMessage 处理编辑消息
+func (c *Client) handleEditMessage(requestID string, data json.RawMessage) {
+	var req struct {
+		MessageID uuid.UUID `json:"message_id"`
+		Content   string    `json:"content"`
+	}
+	if err := json.Unmarshal(data, &req); err != nil {
+		log.Printf("[ERROR] Invalid edit format: %v", err)
+		c.sendError(requestID, wsErrInvalidFormat, "Invalid edit format")
 		return
 	}
 
-	// 广播撤回通知给会话中的所有在线成员
-	response := map[string]interface{}{
-		"type": "recalled",
-		"data": map[string]interface{}{
-			"message_id": req.MessageID,
-		},
+	message, err := c.Hub.msgSvc.EditMessage(c.UserID, req.MessageID, req.Content)
+	if err != nil {
+		log.Printf("[ERROR] Failed to edit message: %v", err)
+		c.sendServiceError(requestID, err)
+		return
+	}
+
+	// 广播编辑通知给会话中的所有成员
+	c.Hub.SendMessageEdited(message)
+	c.sendAck(requestID, message)
+}
+
+// handleReaction 处理表情回应（添加/取消）
+func (c *Client) handleReaction(requestID string, data json.RawMessage) {
+	var req struct {
+		MessageID uuid.UUID `json:"message_id"`
+		Emoji     string    `json:"emoji"`
+		Action    string    `json:"action"` // 'add' | 'remove'，默认 add
+	}
+	if err := json.Unmarshal(data, &req); err != nil {
+		log.Printf("[ERROR] Invalid reaction format: %v", err)
+		c.sendError(requestID, wsErrInvalidFormat, "Invalid reaction format")
+		return
+	}
+
+	var (
+		result *service.ReactionResult
+		err    error
+	)
+	switch req.Action {
+	case "", "add":
+		req.Action = "add"
+		result, err = c.Hub.reactionSvc.AddReaction(c.UserID, req.MessageID, req.Emoji)
+	case "remove":
+		result, err = c.Hub.reactionSvc.RemoveReaction(c.UserID, req.MessageID, req.Emoji)
+	default:
+		c.sendError(requestID, wsErrInvalidRequest, "Invalid reaction action")
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] Failed to %s reaction: %v", req.Action, err)
+		c.sendServiceError(requestID, err)
+		return
 	}
-	responseData, _ := json.Marshal(response)
 
-	// 发送给会话中所有成员
-	members, err := c.Hub.msgSvc.GetConversationMembers(message.ConversationID)
-	if err == nil {
-		for _, memberID := range members {
-			c.Hub.BroadcastToUser(memberID, responseData)
+	// 重复操作不产生变化，无需广播
+	if result.Changed {
+		c.Hub.SendReactionUpdate(c.UserID, req.Action, result)
+	}
+	c.sendAck(requestID, map[string]interface{}{
+		"message_id": result.Message.ID,
+		"emoji":      result.Emoji,
+		"action":     req.Action,
+		"changed":    result.Changed,
+		"reactions":  result.Reactions,
+	})
+}
+
+// handleLiveLocationUpdate 处理实时位置上报
+func (c *Client) handleLiveLocationUpdate(requestID string, data json.RawMessage) {
+	var req struct {
+		MessageID uuid.UUID `json:"message_id"`
+		service.LocationPoint
+	}
+	if err := json.Unmarshal(data, &req); err != nil {
+		log.Printf("[ERROR] Invalid location update format: %v", err)
+		c.sendError(requestID, wsErrInvalidFormat, "Invalid location update format")
+		return
+	}
+	if c.Hub.locationSvc == nil {
+		c.sendError(requestID, wsErrUnavailable, "live location is not supported")
+		return
+	}
+
+	location, err := c.Hub.locationSvc.UpdateLiveLocation(c.UserID, req.MessageID, &req.LocationPoint)
+	if err != nil {
+		log.Printf("[ERROR] Failed to update live location: %v", err)
+		c.sendServiceError(requestID, err)
+		return
+	}
+
+	c.Hub.SendLiveLocationUpdated(location)
+	c.sendAck(requestID, location)
+}
+
+// handleLiveLocationStop 处理停止实时位置共享
+func (c *Client) handleLiveLocationStop(requestID string, data json.RawMessage) {
+	var req struct {
+		MessageID uuid.UUID `json:"message_id"`
+	}
+	if err := json.Unmarshal(data, &req); err != nil {
+		log.Printf("[ERROR] Invalid location stop format: %v", err)
+		c.sendError(requestID, wsErrInvalidFormat, "Invalid location stop format")
+		return
+	}
+	if c.Hub.locationSvc == nil {
+		c.sendError(requestID, wsErrUnavailable, "live location is not supported")
+		return
+	}
+
+	location, err := c.Hub.locationSvc.StopLiveLocation(c.UserID, req.MessageID)
+	if err != nil {
+		log.Printf("[ERROR] Failed to stop live location: %v", err)
+		c.sendServiceError(requestID, err)
+		return
+	}
+
+	c.Hub.SendLiveLocationStopped(location, "stopped")
+	c.sendAck(requestID, location)
+}
+
+// handleForwardMessages 处理转发消息
+func (c *Client) handleForwardMessages(requestID string, data json.RawMessage) {
+	var req struct {
+		MessageIDs      []uuid.UUID `json:"message_ids"`
+		ConversationIDs []uuid.UUID `json:"conversation_ids"`
+	}
+	if err := json.Unmarshal(data, &req); err != nil {
+		log.Printf("[ERROR] Invalid forward format: %v", err)
+		c.sendError(requestID, wsErrInvalidFormat, "Invalid forward format")
+		return
+	}
+
+	results, err := c.Hub.msgSvc.ForwardMessages(c.UserID, req.MessageIDs, req.ConversationIDs)
+	if err != nil {
+		log.Printf("[ERROR] Failed to forward messages: %v", err)
+		c.sendServiceError(requestID, err)
+		return
+	}
+
+	// 广播转发产生的新消息
+	for _, result := range results {
+		for _, message := range result.Messages {
+			c.Hub.BroadcastNewMessage(message)
 		}
 	}
+
+	// 回复转发结果（包含每个目标会话的失败原因），带回 request_id
+	c.sendEvent(Event{
+		Type:      "forward_result",
+		RequestID: requestID,
+		Data:      ForwardResultData{Results: results},
+	}, "forward result")
 }
 
 // handleSetCurrentConversation 设置用户当前正在查看的会话
-func (c *Client) handleSetCurrentConversation(data json.RawMessage) {
+func (c *Client) handleSetCurrentConversation(requestID string, data json.RawMessage) {
 	var req struct {
 		ConversationID *string `json:"conversation_id"` // null表示离开聊天页面
 	}
 	if err := json.Unmarshal(data, &req); err != nil {
 		log.Printf("[ERROR] Invalid set_current_conversation format: %v", err)
+		c.sendError(requestID, wsErrInvalidFormat, "Invalid set_current_conversation format")
 		return
 	}
 
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
 	if req.ConversationID == nil || *req.ConversationID == "" {
 		// 用户离开聊天页面
+		c.mu.Lock()
 		c.CurrentConversationID = nil
+		c.mu.Unlock()
 	} else {
 		// 用户进入特定会话页面
 		convID, err := uuid.Parse(*req.ConversationID)
 		if err != nil {
 			log.Printf("[ERROR] Invalid conversation_id: %v", err)
+			c.sendError(requestID, wsErrInvalidRequest, "Invalid conversation_id")
 			return
 		}
+		c.mu.Lock()
 		c.CurrentConversationID = &convID
+		c.mu.Unlock()
 	}
+	c.sendAck(requestID, nil)
 }
 
 // sendOfflineMessages 发送离线消息给客户端
@@ -900,73 +1580,158 @@ func (c *Client) sendOfflineMessages() {
 		return
 	}
 
-	// 发送每条离线消息
+	// 发送每条离线消息，并记录每个会话中最新的一条（用于记录送达）
+	latestByConversation := make(map[uuid.UUID]*DeliveryTarget)
 	for _, msgData := range messages {
-		var message map[string]interface{}
-		if err := json.Unmarshal([]byte(msgData), &message); err != nil {
-			log.Printf("[ERROR] Failed to unmarshal offline message: %v", err)
+		if !json.Valid([]byte(msgData)) {
+			log.Printf("[ERROR] Failed to unmarshal offline message: invalid JSON")
 			continue
 		}
-
-		// 发送离线消息（type: offline_message）
-		response := map[string]interface{}{
-			"type": "offline_message",
-			"data": message,
+		var queued struct {
+			ID             uuid.UUID `json:"id"`
+			ConversationID uuid.UUID `json:"conversation_id"`
+			SenderID       uuid.UUID `json:"sender_id"`
+			Seq            int64     `json:"seq"`
+			CreatedAt      time.Time `json:"created_at"`
 		}
-		responseData, _ := json.Marshal(response)
-
-		// 非阻塞发送，避免 channel 满时阻塞
-		select {
-		case c.Send <- responseData:
-			// 发送成功
-		default:
-			// channel 满了，跳过这条消息
-			log.Printf("[ERROR] Failed to send offline message to user %s: channel full", c.UserID)
+		if err := json.Unmarshal([]byte(msgData), &queued); err == nil {
+			if latest := latestByConversation[queued.ConversationID]; latest == nil || queued.Seq > latest.Seq {
+				latestByConversation[queued.ConversationID] = &DeliveryTarget{
+					MessageID:      queued.ID,
+					ConversationID: queued.ConversationID,
+					SenderID:       queued.SenderID,
+					Seq:            queued.Seq,
+					CreatedAt:      queued.CreatedAt,
+				}
+			}
 		}
+
+		// 发送离线消息（type: offline_message），channel 满时跳过这条消息
+		c.sendEvent(Event{
+			Type: "offline_message",
+			Data: json.RawMessage(msgData),
+		}, "offline message")
 	}
 
 	// 删除已发送的离线消息
 	c.Hub.rdb.Del(ctx, key)
 
+	// 离线消息已拉取，记录送达
+	for _, target := range latestByConversation {
+		c.Hub.recordDelivery(c.UserID, target)
+	}
+
 	// 推送最新一条未读通知
+	c.sendLatestNotification()
+}
+
+// sendLatestNotification 推送最新一条未读通知（连接建立时）
+func (c *Client) sendLatestNotification() {
 	if c.Hub.notifSvc != nil {
 		latestNotif, err := c.Hub.notifSvc.GetLatestUnreadNotification(c.UserID)
 		if err != nil {
 			log.Printf("[ERROR] Failed to get latest unread notification for user %s: %v", c.UserID, err)
 		} else if latestNotif != nil {
 			// 发送通知
-			response := map[string]interface{}{
-				"type": "notification",
-				"data": latestNotif,
-			}
-			responseData, _ := json.Marshal(response)
-
-			// 非阻塞发送
-			select {
-			case c.Send <- responseData:
-				// 发送成功
-			default:
-				log.Printf("[ERROR] Failed to send notification to user %s: channel full", c.UserID)
-			}
+			c.sendEvent(Event{
+				Type: "notification",
+				Data: latestNotif,
+			}, "notification")
 		}
 	}
 }
 
-// sendError 发送错误消息给客户端
-func (c *Client) sendError(errMsg string) {
-	response := map[string]interface{}{
-		"type": "error",
-		"data": map[string]string{
-			"message": errMsg,
-		},
+// handleSync 处理同步请求：{"checkpoint": "..."}
+func (c *Client) handleSync(requestID string, data json.RawMessage) {
+	var req struct {
+		Checkpoint string `json:"checkpoint"`
+	}
+	if err := json.Unmarshal(data, &req); err != nil {
+		c.sendError(requestID, wsErrInvalidFormat, "Invalid sync format")
+		return
 	}
-	responseData, _ := json.Marshal(response)
+	c.sendSync(requestID, req.Checkpoint)
+}
 
+// sendSync 发送自检查点以来的变化（type: sync，带回 request_id），并记录新消息已送达
+func (c *Client) sendSync(requestID, checkpoint string) {
+	if c.Hub.syncSvc == nil {
+		c.sendError(requestID, wsErrUnavailable, "sync is not available")
+		return
+	}
+	result, err := c.Hub.syncSvc.Sync(c.UserID, checkpoint)
+	if err != nil {
+		log.Printf("[ERROR] Failed to sync user %s: %v", c.UserID, err)
+		c.sendServiceError(requestID, err)
+		return
+	}
+
+	if !c.sendEvent(Event{
+		Type:      "sync",
+		RequestID: requestID,
+		Data:      result,
+	}, "sync result") {
+		return
+	}
+
+	// 同步结果已包含离线期间的新消息（reset 时客户端重新拉取），清空离线队列避免使用同步协议的用户队列一直增长
+	if err := c.Hub.rdb.Del(context.Background(), "offline_msg:"+c.UserID.String()).Err(); err != nil {
+		log.Printf("[ERROR] Failed to clear offline messages for user %s: %v", c.UserID, err)
+	}
+
+	c.Hub.recordSyncDelivery(c.UserID, result.Messages)
+}
+
+// sendMessageAck 把重试发送的原消息回给当前连接（带 duplicate 标记）
+func (c *Client) sendMessageAck(message *model.Message) {
+	canSend := c.Hub.msgSvc.CheckCanSend(c.UserID, message.ConversationID)
+	event := buildNewMessageEventV2(message, canSend) // 消息对象中已包含 duplicate
+	if c.ProtocolVersion < ProtocolV2 {
+		data := buildNewMessageData(message, canSend)
+		data.Duplicate = true
+		event = Event{Type: "message", Data: data}
+	}
+	c.sendEvent(event, "message ack")
+}
+
+// sendAck 回复请求处理成功（type: ack），仅在请求带 request_id 时发送
+func (c *Client) sendAck(requestID string, data interface{}) {
+	if requestID == "" {
+		return
+	}
+	c.sendEvent(Event{
+		Type:      "ack",
+		RequestID: requestID,
+		Data:      data,
+	}, "ack")
+}
+
+// sendServiceError 发送业务错误（根据错误类别确定错误码）
+func (c *Client) sendServiceError(requestID string, err error) {
+	c.sendError(requestID, wsErrorCode(err), err.Error())
+}
+
+// sendError 发送错误消息给客户端（带错误码，请求带 request_id 时原样带回）
+func (c *Client) sendError(requestID, code, errMsg string) {
+	c.sendEvent(Event{
+		Type:      "error",
+		RequestID: requestID,
+		Data: ErrorData{
+			Code:    code,
+			Message: errMsg,
+		},
+	}, "error message")
+}
+
+// sendEvent 发送事件给当前连接（写入时按该设备的帧编码编码；非阻塞，channel 满时丢弃），desc 用于日志
+func (c *Client) sendEvent(event Event, desc string) bool {
 	// 非阻塞发送
 	select {
-	case c.Send <- responseData:
+	case c.Send <- queuedEvent{event: newOutboundEvent(event)}:
 		// 发送成功
+		return true
 	default:
-		log.Printf("[ERROR] Failed to send error message to user %s: channel full", c.UserID)
+		log.Printf("[ERROR] Failed to send %s to user %s: channel full", desc, c.UserID)
+		return false
 	}
 }
@@ -0,0 +1,198 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sort"
+	"time"
+
+	"dinq_message/service"
+
+	"github.com/google/uuid"
+)
+
+// 确认投递：连接时带 ack=1 的客户端收到 message 推送后回复 {"type":"ack","data":{"message_ids":[...]}}，
+// 服务端收到确认才记录送达；超时未确认的消息按指数退避重发（客户端按消息ID去重），
+// 重试次数用完仍未确认时断开该设备，未确认的消息放回离线队列，设备重连后通过离线消息或同步拿到。
+// 跨 Pod 时新消息通过 Redis 广播携带 DeliveryTarget，由持有该设备连接的 Pod 负责跟踪、重发和记录送达。
+
+// ackCheckInterval 检查待确认消息的间隔
+const ackCheckInterval = 500 * time.Millisecond
+
+// 确认配置的取值范围（后台修改配置时校验；直接写入数据库的越界值在读取时截断）：
+// 等待时长每次重发翻倍，限制两者避免退避时长溢出或长时间占用待确认列表
+const (
+	minAckTimeoutSeconds = 1
+	maxAckTimeoutSeconds = 60
+	maxAckRetries        = 10
+)
+
+// pendingDelivery 等待客户端确认的新消息推送
+type pendingDelivery struct {
+	event    *outboundEvent // 推送的事件（重发时按设备的帧编码写入，放回离线队列时使用 JSON）
+	target   *DeliveryTarget
+	retries  int       // 已重发次数
+	deadline time.Time // 超过该时间仍未确认则重发
+}
+
+// ackTimeout 首次等待确认的时长（之后每次重发翻倍）
+func (h *Hub) ackTimeout() time.Duration {
+	seconds := h.sysSvc.GetIntSetting("ws_ack_timeout_seconds", 2)
+	seconds = max(minAckTimeoutSeconds, min(seconds, maxAckTimeoutSeconds))
+	return time.Duration(seconds) * time.Second
+}
+
+// ackMaxRetries 未确认时的最大重发次数
+func (h *Hub) ackMaxRetries() int {
+	return max(0, min(h.sysSvc.GetIntSetting("ws_ack_max_retries", 2), maxAckRetries))
+}
+
+// trackDelivery 登记等待确认的新消息推送
+func (c *Client) trackDelivery(event *outboundEvent, target *DeliveryTarget) {
+	deadline := time.Now().Add(c.Hub.ackTimeout())
+
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+	c.pending[target.MessageID] = &pendingDelivery{
+		event:    event,
+		target:   target,
+		deadline: deadline,
+	}
+}
+
+// duePendingDeliveries 返回需要重发的消息；有消息重试次数用完仍未确认时 exhausted 为 true
+func (c *Client) duePendingDeliveries(now time.Time) (retries []*outboundEvent, exhausted bool) {
+	timeout := c.Hub.ackTimeout()
+	maxRetries := c.Hub.ackMaxRetries()
+
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+
+	due := make([]*pendingDelivery, 0)
+	for _, delivery := range c.pending {
+		if now.Before(delivery.deadline) {
+			continue
+		}
+		if delivery.retries >= maxRetries {
+			return nil, true
+		}
+		due = append(due, delivery)
+	}
+
+	// 按发送时间重发，保持消息顺序
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].target.CreatedAt.Before(due[j].target.CreatedAt)
+	})
+	for _, delivery := range due {
+		delivery.retries++
+		delivery.deadline = now.Add(timeout << delivery.retries)
+		retries = append(retries, delivery.event)
+	}
+	return retries, false
+}
+
+// handleAck 处理新消息推送的确认：{"message_ids": ["..."]}（也支持单个 message_id）
+func (c *Client) handleAck(requestID string, data json.RawMessage) {
+	var req struct {
+		MessageID  *uuid.UUID  `json:"message_id"`
+		MessageIDs []uuid.UUID `json:"message_ids"`
+	}
+	if err := json.Unmarshal(data, &req); err != nil {
+		c.sendError(requestID, wsErrInvalidFormat, "Invalid ack format")
+		return
+	}
+	messageIDs := req.MessageIDs
+	if req.MessageID != nil {
+		messageIDs = append(messageIDs, *req.MessageID)
+	}
+
+	// 未登记的消息（重复确认、未开启确认的连接）直接忽略
+	acked := make([]*DeliveryTarget, 0, len(messageIDs))
+	c.pendingMu.Lock()
+	for _, messageID := range messageIDs {
+		if delivery, ok := c.pending[messageID]; ok {
+			acked = append(acked, delivery.target)
+			delete(c.pending, messageID)
+		}
+	}
+	c.pendingMu.Unlock()
+
+	for _, target := range acked {
+		c.Hub.recordDelivery(c.UserID, target)
+	}
+	c.sendAck(requestID, nil)
+}
+
+// requeuePendingDeliveries 连接关闭时把仍未确认的消息放回离线队列（队列中已有的消息不重复添加）
+func (c *Client) requeuePendingDeliveries() {
+	c.pendingMu.Lock()
+	pending := c.pending
+	if len(pending) > 0 {
+		c.pending = make(map[uuid.UUID]*pendingDelivery)
+	}
+	c.pendingMu.Unlock()
+	if len(pending) == 0 {
+		return
+	}
+
+	ctx := context.Background()
+	key := "offline_msg:" + c.UserID.String()
+
+	items, err := c.Hub.rdb.LRange(ctx, key, 0, -1).Result()
+	if err != nil {
+		log.Printf("[ERROR] Failed to get offline messages for user %s: %v", c.UserID, err)
+		return
+	}
+	queuedIDs := make(map[uuid.UUID]bool, len(items))
+	for _, item := range items {
+		var queued struct {
+			ID uuid.UUID `json:"id"`
+		}
+		if err := json.Unmarshal([]byte(item), &queued); err == nil {
+			queuedIDs[queued.ID] = true
+		}
+	}
+
+	deliveries := make([]*pendingDelivery, 0, len(pending))
+	for messageID, delivery := range pending {
+		if !queuedIDs[messageID] {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	if len(deliveries) == 0 {
+		return
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].target.CreatedAt.Before(deliveries[j].target.CreatedAt)
+	})
+
+	// 离线队列中保存的是发送时保存的消息内容（撤回和过期清理按该内容移除，已撤回或已删除的消息不再放回）
+	payloadKeys := make([]string, len(deliveries))
+	for i, delivery := range deliveries {
+		payloadKeys[i] = service.OfflinePayloadKey(delivery.target.MessageID)
+	}
+	payloads, err := c.Hub.rdb.MGet(ctx, payloadKeys...).Result()
+	if err != nil {
+		log.Printf("[ERROR] Failed to get offline payloads for user %s: %v", c.UserID, err)
+		return
+	}
+	pipe := c.Hub.rdb.Pipeline()
+	requeued := 0
+	for _, value := range payloads {
+		if payload, ok := value.(string); ok {
+			pipe.RPush(ctx, key, payload)
+			requeued++
+		}
+	}
+	if requeued == 0 {
+		return
+	}
+	pipe.LTrim(ctx, key, -service.OfflineQueueLimit, -1)
+	pipe.Expire(ctx, key, service.OfflineQueueTTL) // 7天过期
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("[ERROR] Failed to requeue unacked messages for user %s: %v", c.UserID, err)
+		return
+	}
+	log.Printf("User %s (client: %s) requeued %d unacked messages", c.UserID, c.ID, requeued)
+}
@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// 送达记录合并：同一接收者在同一会话中短时间内收到的多条消息只记录最新一条
+// （送达按会话成员的进度记录，最新一条已送达即表示之前的消息均已送达），
+// 避免群聊消息密集时每写入一条消息都执行一次 MarkDelivered 事务。
+
+// deliveryFlushDelay 送达记录的合并窗口
+const deliveryFlushDelay = 200 * time.Millisecond
+
+// deliveryKey 送达记录的合并维度（接收者 + 会话）
+type deliveryKey struct {
+	userID         uuid.UUID
+	conversationID uuid.UUID
+}
+
+// deliveryBatcher 等待记录的送达进度 map[接收者+会话]最新送达的消息
+type deliveryBatcher struct {
+	mu      sync.Mutex
+	pending map[deliveryKey]*DeliveryTarget
+}
+
+// newDeliveryBatcher 创建送达记录合并器
+func newDeliveryBatcher() *deliveryBatcher {
+	return &deliveryBatcher{pending: make(map[deliveryKey]*DeliveryTarget)}
+}
+
+// add 登记送达，返回 true 表示该接收者和会话是新的一批（调用方需要在合并窗口后 flush）
+func (b *deliveryBatcher) add(userID uuid.UUID, target *DeliveryTarget) bool {
+	key := deliveryKey{userID: userID, conversationID: target.ConversationID}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	existing, ok := b.pending[key]
+	if !ok {
+		b.pending[key] = target
+		return true
+	}
+	if target.Seq > existing.Seq {
+		b.pending[key] = target
+	}
+	return false
+}
+
+// take 取出该接收者和会话等待记录的送达
+func (b *deliveryBatcher) take(userID, conversationID uuid.UUID) *DeliveryTarget {
+	key := deliveryKey{userID: userID, conversationID: conversationID}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	target := b.pending[key]
+	delete(b.pending, key)
+	return target
+}
+
+// recordDelivery 记录新消息已送达给接收者（非阻塞）：合并窗口内同一会话只记录最新一条，
+// 送达进度前进时推送 delivered 事件
+func (h *Hub) recordDelivery(userID uuid.UUID, target *DeliveryTarget) {
+	if userID == target.SenderID {
+		return
+	}
+	if h.deliveries.add(userID, target) {
+		conversationID := target.ConversationID
+		time.AfterFunc(deliveryFlushDelay, func() {
+			h.flushDelivery(userID, conversationID)
+		})
+	}
+}
+
+// flushDelivery 记录合并窗口内该接收者在该会话中最新送达的消息
+func (h *Hub) flushDelivery(userID, conversationID uuid.UUID) {
+	target := h.deliveries.take(userID, conversationID)
+	if target == nil {
+		return
+	}
+	result, err := h.msgSvc.MarkDelivered(userID, target.ConversationID, target.MessageID, target.Seq)
+	if err != nil {
+		log.Printf("[ERROR] Failed to record delivery: user=%s, message=%s, error=%v", userID, target.MessageID, err)
+		return
+	}
+	if result != nil {
+		h.SendDelivered(result)
+	}
+}
@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/ugorji/go/codec"
+)
+
+// WebSocket 帧编码：客户端在 /ws 握手时通过 query 参数 encoding 选择，未指定时为 json（文本帧，Web 客户端使用）。
+// msgpack 使用二进制帧，事件结构与 JSON 完全一致（ID、时间仍为字符串），只是编码更紧凑，适合移动端。
+// 事件的 JSON 是唯一的规范内容：msgpack 帧由 JSON 转换而来，只在有 msgpack 设备时生成，同一次推送只转换一次；
+// 跨 Pod 广播只携带 JSON，其他 Pod 按本地设备实际使用的编码按需转换，本地和跨 Pod 推送的帧内容相同。
+const (
+	EncodingJSON    = "json"    // 文本帧，JSON
+	EncodingMsgpack = "msgpack" // 二进制帧，MessagePack；客户端请求也使用二进制帧发送（文本帧仍按 JSON 解析）
+
+	// closeUnsupportedEncoding 编码不受支持时的关闭码（应用自定义范围 4000-4999）
+	closeUnsupportedEncoding = 4002
+)
+
+var (
+	// msgpackHandle MessagePack 编解码：解析客户端请求（字符串使用 str 类型，对象解码为 map[string]interface{}），编码推送帧
+	msgpackHandle = func() *codec.MsgpackHandle {
+		h := &codec.MsgpackHandle{WriteExt: true}
+		h.RawToString = true
+		h.MapType = reflect.TypeOf(map[string]interface{}(nil))
+		h.SignedInteger = true
+		return h
+	}()
+
+	// jsonCodecHandle 把事件的 JSON 解码为通用结构（整数保持为整数），再编码为 MessagePack
+	jsonCodecHandle = func() *codec.JsonHandle {
+		h := &codec.JsonHandle{}
+		h.MapType = reflect.TypeOf(map[string]interface{}(nil))
+		h.SignedInteger = true
+		return h
+	}()
+)
+
+// negotiateEncoding 协商帧编码（query 参数 encoding），未指定时为 json
+func negotiateEncoding(r *http.Request) (string, error) {
+	requested := r.URL.Query().Get("encoding")
+	switch strings.ToLower(strings.TrimSpace(requested)) {
+	case "", EncodingJSON:
+		return EncodingJSON, nil
+	case EncodingMsgpack:
+		return EncodingMsgpack, nil
+	}
+
+	// 关闭原因最长 123 字节
+	if len(requested) > 32 {
+		requested = requested[:32] + "..."
+	}
+	return "", fmt.Errorf("unsupported encoding: %s, supported encodings: %s, %s", requested, EncodingJSON, EncodingMsgpack)
+}
+
+// encodeEvent 把事件编码为指定的帧编码
+func encodeEvent(event Event, encoding string) ([]byte, error) {
+	frame, err := json.Marshal(event)
+	if err != nil || encoding != EncodingMsgpack {
+		return frame, err
+	}
+	return jsonToMsgpack(frame)
+}
+
+// jsonToMsgpack 把 JSON 编码的事件转换为 MessagePack
+func jsonToMsgpack(frame []byte) ([]byte, error) {
+	var value interface{}
+	if err := codec.NewDecoderBytes(frame, jsonCodecHandle).Decode(&value); err != nil {
+		return nil, fmt.Errorf("failed to decode json event: %w", err)
+	}
+	var out []byte
+	if err := codec.NewEncoderBytes(&out, msgpackHandle).Encode(value); err != nil {
+		return nil, fmt.Errorf("failed to encode msgpack event: %w", err)
+	}
+	return out, nil
+}
+
+// outboundEvent 推送给设备的事件：写入连接时按设备的帧编码编码，每种编码只编码一次
+// （同一次推送的所有接收者、所有设备共用）；来自其他 Pod 的广播只有 JSON
+type outboundEvent struct {
+	event  *Event
+	mu     sync.Mutex
+	frames map[string][]byte // map[帧编码]已编码的内容
+}
+
+// newOutboundEvent 创建待推送的事件
+func newOutboundEvent(event Event) *outboundEvent {
+	return &outboundEvent{event: &event, frames: make(map[string][]byte, 2)}
+}
+
+// newEncodedEvent JSON 编码的事件（跨 Pod 广播）
+func newEncodedEvent(frame []byte) *outboundEvent {
+	return &outboundEvent{frames: map[string][]byte{EncodingJSON: frame}}
+}
+
+// encoded 返回事件在该帧编码下的内容（第一次使用时编码，msgpack 由 JSON 转换）
+func (o *outboundEvent) encoded(encoding string) ([]byte, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if frame, ok := o.frames[encoding]; ok {
+		return frame, nil
+	}
+
+	frame, ok := o.frames[EncodingJSON]
+	if !ok {
+		var err error
+		if frame, err = json.Marshal(o.event); err != nil {
+			return nil, err
+		}
+		o.frames[EncodingJSON] = frame
+	}
+	if encoding == EncodingMsgpack {
+		msgpackFrame, err := jsonToMsgpack(frame)
+		if err != nil {
+			return nil, err
+		}
+		o.frames[EncodingMsgpack] = msgpackFrame
+		return msgpackFrame, nil
+	}
+	return frame, nil
+}
+
+// decodeMsgpackRequest 解析 MessagePack 编码的客户端请求，data 转为 JSON 交给各请求处理函数
+func decodeMsgpackRequest(frame []byte, wsMsg *WSMessage) error {
+	var req struct {
+		Type      string      `codec:"type"`
+		RequestID string      `codec:"request_id"`
+		Data      interface{} `codec:"data"`
+	}
+	if err := codec.NewDecoderBytes(frame, msgpackHandle).Decode(&req); err != nil {
+		return err
+	}
+	data, err := json.Marshal(req.Data)
+	if err != nil {
+		return err
+	}
+	wsMsg.Type = req.Type
+	wsMsg.RequestID = req.RequestID
+	wsMsg.Data = data
+	return nil
+}
+
+// frameType 该设备使用的 WebSocket 帧类型
+func (c *Client) frameType() int {
+	if c.Encoding == EncodingMsgpack {
+		return websocket.BinaryMessage
+	}
+	return websocket.TextMessage
+}
@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"errors"
+
+	"dinq_message/service"
+)
+
+// WebSocket 错误码（error 事件的 data.code），客户端据此处理错误，message 仅用于展示和排查
+const (
+	wsErrInvalidFormat   = "invalid_format"      // 消息格式错误（JSON 无法解析、字段类型不对）
+	wsErrUnknownType     = "unknown_type"        // 不支持的消息类型
+	wsErrInvalidRequest  = "invalid_request"     // 参数校验失败
+	wsErrNotFound        = "not_found"           // 消息、会话等不存在
+	wsErrForbidden       = "forbidden"           // 不是会话成员、被拉黑、权限不足
+	wsErrConflict        = "conflict"            // 与当前状态冲突（如 client_msg_id 已在其他会话使用、消息已撤回）
+	wsErrFirstMessage    = "first_message_limit" // 私聊首条消息限制：对方回复前不能继续发送
+	wsErrFeatureDisabled = "feature_disabled"    // 功能已在系统配置中关闭
+	wsErrUnavailable     = "unavailable"         // 服务端未启用该能力（如同步、实时位置）
+	wsErrInternal        = "internal_error"      // 服务端内部错误，可以重试
+	wsErrTooManyDevices  = "too_many_devices"    // 超过每个用户的最大连接数
+)
+
+// wsErrorCode 根据业务错误的类别确定错误码（与 HTTP 接口的状态码映射保持一致），没有类别的错误视为内部错误
+func wsErrorCode(err error) string {
+	switch {
+	case errors.Is(err, service.ErrFirstMessageLimit):
+		return wsErrFirstMessage
+	case errors.Is(err, service.ErrNotFound):
+		return wsErrNotFound
+	case errors.Is(err, service.ErrForbidden):
+		return wsErrForbidden
+	case errors.Is(err, service.ErrConflict):
+		return wsErrConflict
+	case errors.Is(err, service.ErrInvalid):
+		return wsErrInvalidRequest
+	default:
+		return wsErrInternal
+	}
+}
@@ -0,0 +1,239 @@
+package handler
+
+import (
+	"encoding/json"
+	"time"
+
+	"dinq_message/model"
+	"dinq_message/service"
+
+	"github.com/google/uuid"
+)
+
+// Event 服务端推送的 WebSocket 事件：{"type": "...", "request_id": "...", "data": {...}}
+// 各事件的 data 使用下面的类型化结构，字段名即协议字段（JSON 和 MessagePack 编码相同）
+type Event struct {
+	Type      string      `json:"type"`
+	RequestID string      `json:"request_id,omitempty"` // 对请求的回复原样带回（ack、error、forward_result、sync）
+	Data      interface{} `json:"data,omitempty"`
+}
+
+// NewMessageData message 事件（v1）：消息字段平铺，附带接收者的 can_send
+type NewMessageData struct {
+	ID               uuid.UUID           `json:"id"`
+	ConversationID   uuid.UUID           `json:"conversation_id"`
+	Seq              int64               `json:"seq"` // 会话内序号（客户端据此排序和检测缺失的消息）
+	SenderID         uuid.UUID           `json:"sender_id"`
+	MessageType      string              `json:"message_type"`
+	Content          *string             `json:"content"`
+	PlainText        *string             `json:"plain_text"` // 富文本消息的纯文本
+	Metadata         json.RawMessage     `json:"metadata"`
+	Status           string              `json:"status"`
+	ClientMsgID      *string             `json:"client_msg_id"` // 发送者据此替换本地的待发送消息
+	CreatedAt        time.Time           `json:"created_at"`
+	ReplyToMessageID *uuid.UUID          `json:"reply_to_message_id"` // 回复消息ID
+	ThreadRootID     *uuid.UUID          `json:"thread_root_id"`      // 所属话题根消息ID
+	ExpiresAt        *time.Time          `json:"expires_at"`          // 阅后即焚过期时间
+	CanSend          bool                `json:"can_send"`            // 告诉前端是否可以发送
+	Poll             *model.PollResult   `json:"poll,omitempty"`
+	LiveLocation     *model.LiveLocation `json:"live_location,omitempty"`
+	Duplicate        bool                `json:"duplicate,omitempty"` // 重试发送时回给发送者的原消息
+}
+
+// NewMessageDataV2 message 事件（v2）：完整的消息对象（与 HTTP 接口一致）和会话级的 can_send 分开
+type NewMessageDataV2 struct {
+	Message *model.Message `json:"message"`
+	CanSend bool           `json:"can_send"`
+}
+
+// ConversationUpdateData conversation_update 事件（v1）
+type ConversationUpdateData struct {
+	ConversationID  uuid.UUID  `json:"conversation_id"`
+	LastMessageTime *time.Time `json:"last_message_time"`
+	LastMessageText *string    `json:"last_message_text"`
+	UnreadCount     int        `json:"unread_count"`
+}
+
+// ConversationUpdateDataV2 conversation_update 事件（v2）：时间字段与同步结果、会话模型一致
+type ConversationUpdateDataV2 struct {
+	ConversationID  uuid.UUID  `json:"conversation_id"`
+	LastMessageAt   *time.Time `json:"last_message_at"`
+	LastMessageText *string    `json:"last_message_text"`
+	UnreadCount     int        `json:"unread_count"`
+}
+
+// UnreadCountUpdateData unread_count_update 事件
+type UnreadCountUpdateData struct {
+	ConversationID uuid.UUID `json:"conversation_id"`
+	UnreadCount    int       `json:"unread_count"`
+}
+
+// OnlineStatusUpdateData online_status_update 事件
+type OnlineStatusUpdateData struct {
+	UserID   uuid.UUID `json:"user_id"`
+	IsOnline bool      `json:"is_online"`
+}
+
+// NotificationUpdateData notification_update 事件
+type NotificationUpdateData struct {
+	UnreadCount     int        `json:"unread_count"`
+	LatestNotifTime *time.Time `json:"latest_notif_time"`
+}
+
+// TypingData typing 事件
+type TypingData struct {
+	ConversationID uuid.UUID `json:"conversation_id"`
+	UserID         uuid.UUID `json:"user_id"`
+}
+
+// ReadData read 事件
+type ReadData struct {
+	ConversationID uuid.UUID `json:"conversation_id"`
+	MessageID      uuid.UUID `json:"message_id"`
+	ReaderID       uuid.UUID `json:"reader_id"`
+}
+
+// DeliveredData delivered 事件：message_id 及之前的消息均已送达给 user_id
+type DeliveredData struct {
+	ConversationID uuid.UUID `json:"conversation_id"`
+	MessageID      uuid.UUID `json:"message_id"`
+	UserID         uuid.UUID `json:"user_id"`
+	DeliveredAt    time.Time `json:"delivered_at"`
+}
+
+// ReactionData reaction 事件
+type ReactionData struct {
+	MessageID      uuid.UUID               `json:"message_id"`
+	ConversationID uuid.UUID               `json:"conversation_id"`
+	UserID         uuid.UUID               `json:"user_id"`
+	Emoji          string                  `json:"emoji"`
+	Action         string                  `json:"action"` // 'add' | 'remove'
+	Reactions      []model.ReactionSummary `json:"reactions"`
+}
+
+// RecalledData recalled 事件
+type RecalledData struct {
+	MessageID      uuid.UUID `json:"message_id"`
+	ConversationID uuid.UUID `json:"conversation_id"`
+	Seq            int64     `json:"seq"`
+	RecalledBy     uuid.UUID `json:"recalled_by"`
+}
+
+// EditedData edited 事件（富文本消息的 metadata 包含重新生成的 HTML）
+type EditedData struct {
+	MessageID      uuid.UUID       `json:"message_id"`
+	ConversationID uuid.UUID       `json:"conversation_id"`
+	Seq            int64           `json:"seq"`
+	Content        *string         `json:"content"`
+	PlainText      *string         `json:"plain_text"`
+	Metadata       json.RawMessage `json:"metadata"`
+	EditedAt       *time.Time      `json:"edited_at"`
+}
+
+// MessageUpdatedData message_updated 事件（服务端更新了消息 metadata）
+type MessageUpdatedData struct {
+	MessageID      uuid.UUID       `json:"message_id"`
+	ConversationID uuid.UUID       `json:"conversation_id"`
+	Seq            int64           `json:"seq"`
+	Metadata       json.RawMessage `json:"metadata"`
+}
+
+// ThreadReplyData thread_reply 事件
+type ThreadReplyData struct {
+	ThreadRootID      uuid.UUID  `json:"thread_root_id"`
+	ConversationID    uuid.UUID  `json:"conversation_id"`
+	MessageID         uuid.UUID  `json:"message_id"`
+	Seq               int64      `json:"seq"`
+	SenderID          uuid.UUID  `json:"sender_id"`
+	ThreadReplyCount  int        `json:"thread_reply_count"`
+	ThreadLastReplyAt *time.Time `json:"thread_last_reply_at"`
+}
+
+// PinnedData pinned 事件
+type PinnedData struct {
+	ConversationID uuid.UUID      `json:"conversation_id"`
+	MessageID      uuid.UUID      `json:"message_id"`
+	PinnedBy       uuid.UUID      `json:"pinned_by"`
+	PinnedAt       time.Time      `json:"pinned_at"`
+	Message        *model.Message `json:"message"`
+}
+
+// UnpinnedData unpinned 事件
+type UnpinnedData struct {
+	ConversationID uuid.UUID `json:"conversation_id"`
+	MessageID      uuid.UUID `json:"message_id"`
+	UnpinnedBy     uuid.UUID `json:"unpinned_by"`
+}
+
+// PollUpdatedData poll_updated 事件（匿名投票的 vote 不包含 user_id）
+type PollUpdatedData struct {
+	MessageID      uuid.UUID        `json:"message_id"`
+	ConversationID uuid.UUID        `json:"conversation_id"`
+	Action         string           `json:"action"` // 'vote' | 'close'
+	Poll           model.PollResult `json:"poll"`
+	UserID         *uuid.UUID       `json:"user_id,omitempty"`
+}
+
+// VoiceListenedData voice_listened 事件
+type VoiceListenedData struct {
+	MessageID      uuid.UUID `json:"message_id"`
+	ConversationID uuid.UUID `json:"conversation_id"`
+	UserID         uuid.UUID `json:"user_id"`
+	ListenedAt     time.Time `json:"listened_at"`
+}
+
+// LiveLocationUpdatedData live_location_updated 事件
+type LiveLocationUpdatedData struct {
+	MessageID      uuid.UUID `json:"message_id"`
+	ConversationID uuid.UUID `json:"conversation_id"`
+	UserID         uuid.UUID `json:"user_id"`
+	Latitude       float64   `json:"latitude"`
+	Longitude      float64   `json:"longitude"`
+	Accuracy       *float64  `json:"accuracy"`
+	Heading        *float64  `json:"heading"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	ExpiresAt      time.Time `json:"expires_at"`
+}
+
+// LiveLocationStoppedData live_location_stopped 事件
+type LiveLocationStoppedData struct {
+	MessageID      uuid.UUID  `json:"message_id"`
+	ConversationID uuid.UUID  `json:"conversation_id"`
+	UserID         uuid.UUID  `json:"user_id"`
+	Latitude       float64    `json:"latitude"`
+	Longitude      float64    `json:"longitude"`
+	StoppedAt      *time.Time `json:"stopped_at"`
+	Reason         string     `json:"reason"` // 'stopped' | 'expired'
+}
+
+// ExpiredData expired 事件
+type ExpiredData struct {
+	ConversationID uuid.UUID   `json:"conversation_id"`
+	MessageIDs     []uuid.UUID `json:"message_ids"`
+}
+
+// RetentionUpdatedData retention_updated 事件
+type RetentionUpdatedData struct {
+	ConversationID    uuid.UUID `json:"conversation_id"`
+	MessageTTLSeconds int       `json:"message_ttl_seconds"`
+	UpdatedBy         uuid.UUID `json:"updated_by"`
+}
+
+// ForwardResultData forward_result 事件
+type ForwardResultData struct {
+	Results []service.ForwardResult `json:"results"`
+}
+
+// ErrorData error 事件
+type ErrorData struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// rawMetadata 消息的 metadata 原样推送（为空时为 null）
+func rawMetadata(metadata json.RawMessage) json.RawMessage {
+	if len(metadata) == 0 {
+		return nil
+	}
+	return metadata
+}
@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// WebSocket 协议版本：客户端在 /ws 握手时通过 query 参数 v=N 或子协议 dinq.vN 协商，未指定时为 v1。
+// 事件格式需要变化时增加新版本，旧版本的客户端继续收到原来的格式；只有格式不同的事件才需要按版本分别构造。
+const (
+	ProtocolV1 = 1 // 初始版本
+	ProtocolV2 = 2 // message 推送完整的消息对象 {message, can_send}；conversation_update 使用 last_message_at
+
+	minProtocolVersion = ProtocolV1
+	maxProtocolVersion = ProtocolV2
+)
+
+const (
+	// protocolSubprotocolPrefix 子协议名称前缀（dinq.v1、dinq.v2）
+	protocolSubprotocolPrefix = "dinq.v"
+	// closeUnsupportedProtocol 协议版本不受支持时的关闭码（应用自定义范围 4000-4999）
+	closeUnsupportedProtocol = 4001
+)
+
+// negotiateProtocol 协商协议版本：优先使用 query 参数 v，其次选择客户端子协议中支持的最高版本。
+// 返回需要在握手响应中回复的子协议（未使用子协议时为空）。
+// 版本不受支持时仍然回复客户端提出的一个子协议：浏览器在服务端没有选择任何子协议时直接判定握手失败，
+// 收不到随后的 4001 关闭码，也就无法提示升级
+func negotiateProtocol(r *http.Request) (version int, subprotocol string, err error) {
+	var requested []string
+	for _, protocol := range websocket.Subprotocols(r) {
+		if strings.HasPrefix(protocol, protocolSubprotocolPrefix) {
+			requested = append(requested, protocol)
+		}
+	}
+	// echo 版本不受支持时回复的子协议
+	echo := ""
+	if len(requested) > 0 {
+		echo = requested[0]
+	}
+
+	if value, ok := r.URL.Query()["v"]; ok {
+		requestedVersion, convErr := strconv.Atoi(strings.TrimSpace(value[0]))
+		if convErr != nil || !isSupportedProtocol(requestedVersion) {
+			return 0, echo, unsupportedProtocolError(value[0])
+		}
+		return requestedVersion, "", nil
+	}
+
+	for _, protocol := range requested {
+		candidate, convErr := strconv.Atoi(strings.TrimPrefix(protocol, protocolSubprotocolPrefix))
+		if convErr == nil && isSupportedProtocol(candidate) && candidate > version {
+			version = candidate
+			subprotocol = protocol
+		}
+	}
+	if len(requested) == 0 {
+		return ProtocolV1, "", nil
+	}
+	if version == 0 {
+		return 0, echo, unsupportedProtocolError(strings.Join(requested, ", "))
+	}
+	return version, subprotocol, nil
+}
+
+// isSupportedProtocol 是否支持该协议版本
+func isSupportedProtocol(version int) bool {
+	return version >= minProtocolVersion && version <= maxProtocolVersion
+}
+
+// unsupportedProtocolError 不支持的协议版本（作为关闭原因发送给客户端）
+func unsupportedProtocolError(requested string) error {
+	// 关闭原因最长 123 字节
+	if len(requested) > 32 {
+		requested = requested[:32] + "..."
+	}
+	return fmt.Errorf("unsupported protocol version: %s, supported versions: %d-%d", requested, minProtocolVersion, maxProtocolVersion)
+}
+
+// versionedPayload 按协议版本区分的推送事件 map[起始版本]事件，必须包含 ProtocolV1
+type versionedPayload map[int]*outboundEvent
+
+// versionFor 返回适用于该协议版本的内容的起始版本（不超过该版本的最高版本）
+func (p versionedPayload) versionFor(version int) int {
+	best := ProtocolV1
+	for v := range p {
+		if v <= version && v > best {
+			best = v
+		}
+	}
+	return best
+}
@@ -0,0 +1,60 @@
+package linkpreview
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+)
+
+// FakeFetcher 不访问网络的抓取器（测试环境使用）
+// 预置的链接返回预置结果，其他链接根据 URL 生成确定的预览，路径为 /404 的链接返回错误
+type FakeFetcher struct {
+	mu       sync.Mutex
+	previews map[string]*Preview
+	calls    map[string]int
+}
+
+func NewFakeFetcher(previews map[string]*Preview) *FakeFetcher {
+	if previews == nil {
+		previews = make(map[string]*Preview)
+	}
+	return &FakeFetcher{
+		previews: previews,
+		calls:    make(map[string]int),
+	}
+}
+
+// Fetch 返回预置或生成的预览
+func (f *FakeFetcher) Fetch(ctx context.Context, rawURL string) (*Preview, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls[rawURL]++
+	if preview, ok := f.previews[rawURL]; ok {
+		copied := *preview
+		return &copied, nil
+	}
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid url")
+	}
+	if parsed.Path == "/404" {
+		return nil, fmt.Errorf("unexpected status 404")
+	}
+	return &Preview{
+		URL:         rawURL,
+		Title:       "Preview of " + parsed.Host + parsed.Path,
+		Description: "Fake description for " + rawURL,
+		ImageURL:    parsed.Scheme + "://" + parsed.Host + "/og-image.png",
+		SiteName:    parsed.Host,
+	}, nil
+}
+
+// Calls 返回链接被抓取的次数（用于验证缓存）
+func (f *FakeFetcher) Calls(rawURL string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[rawURL]
+}
@@ -0,0 +1,152 @@
+package linkpreview
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"dinq_message/utils"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	// fetchTimeout 抓取页面的超时时间
+	fetchTimeout = 8 * time.Second
+	// maxPageBytes 最多读取的页面字节数（Open Graph 标签都在 <head> 中）
+	maxPageBytes = 512 * 1024
+	// 预览字段最大长度（字符数）
+	maxTitleLength       = 200
+	maxDescriptionLength = 500
+	userAgent            = "dinq-message-linkpreview/1.0"
+)
+
+// HTTPFetcher 通过 HTTP 抓取页面并解析 Open Graph / Twitter Card / <title> 标签
+type HTTPFetcher struct {
+	client *http.Client
+}
+
+func NewHTTPFetcher() *HTTPFetcher {
+	return &HTTPFetcher{client: utils.NewPublicHTTPClient(fetchTimeout)}
+}
+
+// Fetch 抓取页面并解析预览信息（只允许 http/https 公网地址，只解析 HTML 页面）
+func (f *HTTPFetcher) Fetch(ctx context.Context, rawURL string) (*Preview, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid url")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, parsed.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	preview := &Preview{URL: rawURL}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return preview, nil
+	}
+
+	// 重定向后以最终地址为基准解析相对路径的图片
+	parsePage(io.LimitReader(resp.Body, maxPageBytes), resp.Request.URL, preview)
+	return preview, nil
+}
+
+// parsePage 解析页面中的预览标签，og:* 优先，其次 twitter:* 和 <title>/<meta name="description">
+func parsePage(body io.Reader, baseURL *url.URL, preview *Preview) {
+	tags := make(map[string]string)
+	var title string
+
+	tokenizer := html.NewTokenizer(body)
+	inTitle := false
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			finishPreview(preview, tags, title, baseURL)
+			return
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			switch token.Data {
+			case "meta":
+				var key, content string
+				for _, attr := range token.Attr {
+					switch strings.ToLower(attr.Key) {
+					case "property", "name":
+						if key == "" {
+							key = strings.ToLower(strings.TrimSpace(attr.Val))
+						}
+					case "content":
+						content = strings.TrimSpace(attr.Val)
+					}
+				}
+				if key != "" && content != "" {
+					if _, exists := tags[key]; !exists {
+						tags[key] = content
+					}
+				}
+			case "title":
+				inTitle = title == ""
+			case "body":
+				// 预览标签只出现在 <head> 中，无需继续解析
+				finishPreview(preview, tags, title, baseURL)
+				return
+			}
+		case html.TextToken:
+			if inTitle {
+				title = strings.TrimSpace(string(tokenizer.Text()))
+				inTitle = false
+			}
+		case html.EndTagToken:
+			inTitle = false
+		}
+	}
+}
+
+// finishPreview 按优先级选取字段并截断、校验
+func finishPreview(preview *Preview, tags map[string]string, title string, baseURL *url.URL) {
+	preview.Title = truncate(firstNonEmpty(tags["og:title"], tags["twitter:title"], title), maxTitleLength)
+	preview.Description = truncate(firstNonEmpty(tags["og:description"], tags["twitter:description"], tags["description"]), maxDescriptionLength)
+	preview.SiteName = truncate(tags["og:site_name"], maxTitleLength)
+
+	if image := firstNonEmpty(tags["og:image"], tags["og:image:url"], tags["twitter:image"]); image != "" {
+		if imageURL, err := baseURL.Parse(image); err == nil && (imageURL.Scheme == "http" || imageURL.Scheme == "https") {
+			preview.ImageURL = imageURL.String()
+		}
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// truncate 按字符截断（避免截断多字节字符）
+func truncate(text string, maxLength int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	runes := []rune(text)
+	if len(runes) > maxLength {
+		return string(runes[:maxLength]) + "..."
+	}
+	return text
+}
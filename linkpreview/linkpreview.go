@@ -0,0 +1,40 @@
+package linkpreview
+
+import (
+	"context"
+	"fmt"
+
+	"dinq_message/config"
+)
+
+// Preview 链接预览信息（Open Graph）
+type Preview struct {
+	URL         string `json:"url"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	ImageURL    string `json:"image_url,omitempty"`
+	SiteName    string `json:"site_name,omitempty"`
+}
+
+// IsEmpty 是否没有可展示的内容
+func (p *Preview) IsEmpty() bool {
+	return p == nil || (p.Title == "" && p.Description == "" && p.ImageURL == "")
+}
+
+// Fetcher 链接预览抓取接口
+type Fetcher interface {
+	// Fetch 抓取链接的预览信息（页面没有可用信息时返回空的 Preview）
+	Fetch(ctx context.Context, rawURL string) (*Preview, error)
+}
+
+// New 根据配置创建抓取器
+func New(cfg *config.Config) (Fetcher, error) {
+	switch cfg.LinkPreviewFetcher {
+	case "http":
+		return NewHTTPFetcher(), nil
+	case "fake":
+		return NewFakeFetcher(nil), nil
+	default:
+		return nil, fmt.Errorf("unknown link preview fetcher: %s", cfg.LinkPreviewFetcher)
+	}
+}
@@ -2,11 +2,14 @@ package main
 
 import (
 	"log"
+	"time"
 
 	"dinq_message/config"
 	"dinq_message/handler"
+	"dinq_message/linkpreview"
 	"dinq_message/middleware"
 	"dinq_message/service"
+	"dinq_message/storage"
 	"dinq_message/utils"
 
 	"github.com/gin-gonic/gin"
@@ -31,6 +34,18 @@ func main() {
 	// 初始化认证中间件
 	middleware.InitAuth(cfg.JWTSecret)
 
+	// 初始化文件存储（OSS 或本地文件系统）
+	store, err := storage.New(cfg)
+	if err != nil {
+		log.Fatalf("Failed to init storage: %v", err)
+	}
+
+	// 初始化链接预览抓取器
+	linkFetcher, err := linkpreview.New(cfg)
+	if err != nil {
+		log.Fatalf("Failed to init link preview fetcher: %v", err)
+	}
+
 	// 创建系统配置服务（全局单例）
 	sysSvc := service.NewSystemSettingsService(utils.GetDB())
 
@@ -57,12 +72,58 @@ func main() {
 	convSvc := service.NewConversationServiceWithRedis(utils.GetDB(), utils.GetRedis())
 	relSvc := service.NewRelationshipService(utils.GetDB())
 	msgSvc := service.NewMessageServiceWithConfig(utils.GetDB(), utils.GetRedis(), sysSvc, cfg.MaxVideoSizeMB)
+	reactionSvc := service.NewReactionService(utils.GetDB())
+	threadSvc := service.NewThreadService(utils.GetDB())
+	pinSvc := service.NewPinService(utils.GetDB())
+	pollSvc := service.NewPollService(utils.GetDB())
+	fileSvc := service.NewFileService(utils.GetDB(), store, cfg.MaxFileSizeMB, cfg.MaxVideoSizeMB)
+
+	// 图片处理（上传或发送图片后异步生成宽高和缩略图，完成后由 Hub 推送 message_updated）
+	imageSvc := service.NewImageService(utils.GetDB(), store, fileSvc.MaxUploadBytes())
+	imageSvc.SetNotifier(hub)
+	fileSvc.SetImageService(imageSvc)
+	hub.GetMessageService().SetImageService(imageSvc)
+
+	// 语音消息（大小和时长限制来自系统配置）
+	voiceSvc := service.NewVoiceService(utils.GetDB(), store, sysSvc)
+	hub.GetMessageService().SetVoiceService(voiceSvc)
+
+	// 链接预览（文本消息发送后异步抓取，完成后由 Hub 推送 message_updated）
+	linkPreviewSvc := service.NewLinkPreviewService(utils.GetDB(), utils.GetRedis(), sysSvc, linkFetcher)
+	linkPreviewSvc.SetNotifier(hub)
+	hub.GetMessageService().SetLinkPreviewService(linkPreviewSvc)
 
 	// 为 msgSvc 也注入依赖（用于 HTTP API）
 	msgSvc.SetNotificationService(notifSvc)
 	msgSvc.SetHubChecker(hub)
 	msgSvc.SetUnreadNotifier(hub)
 	msgSvc.SetConversationNotifier(hub)
+	msgSvc.SetImageService(imageSvc)
+	msgSvc.SetVoiceService(voiceSvc)
+	msgSvc.SetLinkPreviewService(linkPreviewSvc)
+
+	// 启动定时消息调度器（到期后通过 msgSvc 正常发送并由 Hub 推送）
+	scheduledSvc := service.NewScheduledMessageService(utils.GetDB(), utils.GetRedis(), msgSvc)
+	scheduledSvc.SetBroadcaster(hub)
+	scheduledSvc.StartDispatcher(5 * time.Second)
+	defer scheduledSvc.StopDispatcher()
+
+	// 启动过期消息清理器（阅后即焚）
+	retentionSvc := service.NewRetentionService(utils.GetDB(), msgSvc)
+	retentionSvc.SetNotifier(hub)
+	retentionSvc.StartSweeper(10 * time.Second)
+	defer retentionSvc.StopSweeper()
+
+	// 启动实时位置到期处理（到期后推送 live_location_stopped）
+	locationSvc := service.NewLocationService(utils.GetDB())
+	locationSvc.SetNotifier(hub)
+	hub.SetLocationService(locationSvc)
+	locationSvc.StartSweeper(5 * time.Second)
+	defer locationSvc.StopSweeper()
+
+	// 断线重连同步（从数据库同步检查点之后的变化）
+	syncSvc := service.NewSyncService(utils.GetDB(), sysSvc)
+	hub.SetSyncService(syncSvc)
 
 	// 创建处理器
 	convHandler := handler.NewConversationHandler(convSvc)
@@ -71,6 +132,16 @@ func main() {
 	relHandler := handler.NewRelationshipHandler(relSvc)
 	sysHandler := handler.NewSystemSettingsHandler(sysSvc)
 	msgHandler := handler.NewMessageHandler(msgSvc, hub)
+	reactionHandler := handler.NewReactionHandler(reactionSvc, hub)
+	threadHandler := handler.NewThreadHandler(threadSvc)
+	pinHandler := handler.NewPinHandler(pinSvc, hub)
+	pollHandler := handler.NewPollHandler(pollSvc, hub)
+	voiceHandler := handler.NewVoiceHandler(voiceSvc, hub)
+	locationHandler := handler.NewLocationHandler(locationSvc, hub)
+	fileHandler := handler.NewFileHandler(fileSvc)
+	scheduledHandler := handler.NewScheduledMessageHandler(scheduledSvc)
+	retentionHandler := handler.NewRetentionHandler(retentionSvc, hub)
+	syncHandler := handler.NewSyncHandler(syncSvc, hub)
 
 	// 初始化默认通知模板
 	_ = notifTemplateSvc.InitDefaultTemplates()
@@ -89,6 +160,14 @@ func main() {
 	// WebSocket 连接（使用 token 认证，不需要 HTTP 中间件）
 	r.GET("/ws", handler.HandleWebSocket(hub))
 
+	// 本地存储：文件访问和预签名上传（使用签名认证，不需要 HTTP 中间件）
+	if localStore, ok := store.(*storage.LocalStorage); ok {
+		localHandler := handler.NewLocalStorageHandler(localStore, fileSvc.MaxUploadBytes())
+		r.GET(storage.LocalRoutePrefix+"/*key", localHandler.Download)
+		r.HEAD(storage.LocalRoutePrefix+"/*key", localHandler.Download)
+		r.PUT(storage.LocalRoutePrefix+"/*key", localHandler.Upload)
+	}
+
 	// HTTP API 路由组（需要认证）
 	api := r.Group("/api/v1")
 	api.Use(middleware.AuthMiddleware())
@@ -98,8 +177,10 @@ func main() {
 		api.GET("/conversations/search", convHandler.SearchConversations)         // 搜索会话
 		api.POST("/conversations/private", convHandler.CreatePrivateConversation) // 创建私聊会话
 		api.POST("/conversations/group", convHandler.CreateGroup)                 // 创建群聊
+		api.GET("/conversations/:id", convHandler.GetConversationDetail)          // 会话详情（含置顶消息）
 		api.GET("/conversations/:id/messages", convHandler.GetMessages)           // 获取消息历史
 		api.POST("/conversations/:id/hide", convHandler.HideConversation)         // 隐藏会话
+		api.POST("/conversations/:id/retention", retentionHandler.SetMessageTTL)  // 设置消息保留时长（阅后即焚）
 
 		// 群聊成员管理
 		api.POST("/conversations/:id/members", convHandler.AddMembers)
@@ -108,8 +189,53 @@ func main() {
 		api.POST("/conversations/:id/members/:user_id/role", convHandler.UpdateMemberRole)
 
 		// 消息管理
+		api.POST("/messages", msgHandler.SendMessage) // 发送消息（支持 client_msg_id 重试去重）
 		api.POST("/messages/:id/recall", msgHandler.RecallMessage)
-		api.GET("/messages/search", msgHandler.SearchMessages) // 搜索消息
+		api.POST("/messages/:id/edit", msgHandler.EditMessage)           // 编辑消息
+		api.GET("/messages/:id/edits", msgHandler.GetMessageEdits)       // 编辑历史
+		api.GET("/messages/:id/receipts", msgHandler.GetMessageReceipts) // 送达/已读回执（仅发送者）
+		api.GET("/messages/search", msgHandler.SearchMessages)           // 搜索消息
+		api.POST("/messages/forward", msgHandler.ForwardMessages)        // 转发消息
+
+		// 表情回应
+		api.GET("/messages/:id/reactions", reactionHandler.GetReactions)
+		api.POST("/messages/:id/reactions", reactionHandler.AddReaction)
+		api.DELETE("/messages/:id/reactions/:emoji", reactionHandler.RemoveReaction)
+
+		// 置顶消息
+		api.GET("/conversations/:id/pins", pinHandler.GetPinnedMessages)
+		api.POST("/messages/:id/pin", pinHandler.PinMessage)
+		api.POST("/messages/:id/unpin", pinHandler.UnpinMessage)
+
+		// 文件上传
+		api.POST("/files", fileHandler.UploadFile)                  // multipart 上传
+		api.POST("/files/presign", fileHandler.PresignUpload)       // 获取直传地址
+		api.POST("/files/:id/complete", fileHandler.CompleteUpload) // 确认直传完成
+		api.GET("/files/:id", fileHandler.GetFile)
+
+		// 投票
+		api.GET("/messages/:id/poll", pollHandler.GetPoll)
+		api.POST("/messages/:id/poll/vote", pollHandler.Vote)
+		api.POST("/messages/:id/poll/close", pollHandler.ClosePoll)
+
+		// 语音消息
+		api.POST("/messages/:id/listened", voiceHandler.MarkListened) // 标记已播放
+
+		// 实时位置（位置上报通过 WebSocket location_update）
+		api.POST("/messages/:id/live-location/stop", locationHandler.StopLiveLocation)
+
+		// 定时消息
+		api.GET("/scheduled-messages", scheduledHandler.ListScheduledMessages)
+		api.POST("/scheduled-messages", scheduledHandler.CreateScheduledMessage)
+		api.POST("/scheduled-messages/:id", scheduledHandler.UpdateScheduledMessage)
+		api.POST("/scheduled-messages/:id/cancel", scheduledHandler.CancelScheduledMessage)
+
+		// 话题（消息串）
+		api.GET("/messages/:id/thread", threadHandler.GetThread)            // 获取话题回复
+		api.POST("/messages/:id/thread/read", threadHandler.MarkThreadRead) // 话题标记已读
+
+		// 断线重连同步
+		api.GET("/sync", syncHandler.Sync)
 
 		// 通知
 		api.GET("/notifications", notifHandler.GetNotifications)
@@ -151,6 +277,9 @@ func main() {
 
 		// 批量发送通知
 		admin.POST("/notifications/batch-send", notifHandler.BatchSendNotification)
+
+		// 消息审核
+		admin.POST("/messages/:id/recall", msgHandler.AdminRecallMessage)
 	}
 
 	// 启动服务
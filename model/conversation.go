@@ -8,13 +8,15 @@ import (
 
 // Conversation 会话表
 type Conversation struct {
-	ID               uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
-	ConversationType string     `json:"conversation_type" gorm:"type:varchar(20);not null"` // 'private' | 'group'
-	GroupName        *string    `json:"group_name,omitempty" gorm:"type:varchar(100)"`
-	CreatedAt        time.Time  `json:"created_at" gorm:"autoCreateTime"`
-	UpdatedAt        time.Time  `json:"updated_at" gorm:"autoUpdateTime"`
-	LastMessageAt    *time.Time `json:"last_message_at,omitempty"`
-	LastMessageID    *uuid.UUID `json:"last_message_id,omitempty" gorm:"type:uuid"`
+	ID                uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	ConversationType  string     `json:"conversation_type" gorm:"type:varchar(20);not null"` // 'private' | 'group'
+	GroupName         *string    `json:"group_name,omitempty" gorm:"type:varchar(100)"`
+	CreatedAt         time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt         time.Time  `json:"updated_at" gorm:"autoUpdateTime"`
+	LastMessageAt     *time.Time `json:"last_message_at,omitempty"`
+	LastMessageID     *uuid.UUID `json:"last_message_id,omitempty" gorm:"type:uuid"`
+	LastSeq           int64      `json:"last_seq" gorm:"default:0"`            // 最新消息的序号（客户端据此检测缺失的消息）
+	MessageTTLSeconds int        `json:"message_ttl_seconds" gorm:"default:0"` // 消息保留时长（秒），0 表示不自动删除
 }
 
 func (Conversation) TableName() string {
@@ -23,17 +25,20 @@ func (Conversation) TableName() string {
 
 // ConversationMember 会话成员表
 type ConversationMember struct {
-	ID                uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
-	ConversationID    uuid.UUID  `json:"conversation_id" gorm:"type:uuid;not null;index"`
-	UserID            uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
-	Role              string     `json:"role" gorm:"type:varchar(20);default:member"` // 'owner' | 'admin' | 'member'
-	IsMuted           bool       `json:"is_muted" gorm:"default:false"`
-	IsHidden          bool       `json:"is_hidden" gorm:"default:false"` // 软删除标记,收到新消息时自动恢复
-	JoinedAt          time.Time  `json:"joined_at" gorm:"autoCreateTime"`
-	LeftAt            *time.Time `json:"left_at,omitempty"`
-	UnreadCount       int        `json:"unread_count" gorm:"default:0"`
-	LastReadMessageID *uuid.UUID `json:"last_read_message_id,omitempty" gorm:"type:uuid"`
-	LastReadAt        *time.Time `json:"last_read_at,omitempty"`
+	ID                 uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	ConversationID     uuid.UUID  `json:"conversation_id" gorm:"type:uuid;not null;index"`
+	UserID             uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
+	Role               string     `json:"role" gorm:"type:varchar(20);default:member"` // 'owner' | 'admin' | 'member'
+	IsMuted            bool       `json:"is_muted" gorm:"default:false"`
+	IsHidden           bool       `json:"is_hidden" gorm:"default:false"` // 软删除标记,收到新消息时自动恢复
+	JoinedAt           time.Time  `json:"joined_at" gorm:"autoCreateTime"`
+	LeftAt             *time.Time `json:"left_at,omitempty"`
+	UnreadCount        int        `json:"unread_count" gorm:"default:0"`
+	UnreadMentionCount int        `json:"unread_mention_count" gorm:"default:0"` // 未读@提及数
+	LastReadMessageID  *uuid.UUID `json:"last_read_message_id,omitempty" gorm:"type:uuid"`
+	LastReadSeq        int64      `json:"last_read_seq" gorm:"default:0"` // 已读进度：序号不超过该值的消息均已读
+	LastReadAt         *time.Time `json:"last_read_at,omitempty"`
+	DeliveredUntilSeq  int64      `json:"delivered_until_seq" gorm:"default:0"` // 送达进度：序号不超过该值的消息均已送达
 
 	// 用户信息（从agent查询补充，不存数据库）
 	Name         *string `json:"name,omitempty" gorm:"-"`
@@ -55,9 +60,11 @@ type ConversationWithMembers struct {
 // ConversationListItem 会话列表项(包含扩展信息)
 type ConversationListItem struct {
 	Conversation
-	UnreadCount     int                  `json:"unread_count"`      // 未读消息数量
-	LastMessageTime *time.Time           `json:"last_message_time"` // 最新消息时间
-	LastMessageText *string              `json:"last_message_text"` // 最新消息内容预览
-	OnlineStatus    map[string]bool      `json:"online_status"`     // 成员在线状态 map[userID]isOnline
-	Members         []ConversationMember `json:"members"`           // 会话成员
+	UnreadCount        int                  `json:"unread_count"`              // 未读消息数量
+	UnreadMentionCount int                  `json:"unread_mention_count"`      // 未读@提及数量（提及角标）
+	LastMessageTime    *time.Time           `json:"last_message_time"`         // 最新消息时间
+	LastMessageText    *string              `json:"last_message_text"`         // 最新消息内容预览
+	OnlineStatus       map[string]bool      `json:"online_status"`             // 成员在线状态 map[userID]isOnline
+	Members            []ConversationMember `json:"members"`                   // 会话成员
+	PinnedMessages     []PinnedMessage      `json:"pinned_messages,omitempty"` // 置顶消息（仅会话详情返回）
 }
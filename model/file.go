@@ -0,0 +1,31 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UploadedFile 上传文件表（文件内容保存在存储后端，消息通过 metadata.file_id 引用）
+type UploadedFile struct {
+	ID         uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	UploaderID uuid.UUID `json:"uploader_id" gorm:"type:uuid;not null;index"`
+	StorageKey string    `json:"-" gorm:"type:varchar(512);not null"`
+	FileName   string    `json:"file_name" gorm:"type:varchar(255);not null"`
+	MimeType   string    `json:"mime_type" gorm:"type:varchar(127);not null"`
+	Size       int64     `json:"size"`                                           // 实际上传的字节数（预签名上传完成前为客户端声明的大小）
+	URL        string    `json:"url" gorm:"type:text;not null"`                  // 文件访问地址
+	Status     string    `json:"status" gorm:"type:varchar(20);default:pending"` // 'pending' | 'uploaded'
+
+	// 图片信息（上传后由服务端异步解析并生成缩略图）
+	Width        int    `json:"width,omitempty"`
+	Height       int    `json:"height,omitempty"`
+	ThumbnailURL string `json:"thumbnail_url,omitempty" gorm:"type:text"`
+
+	CreatedAt  time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	UploadedAt *time.Time `json:"uploaded_at,omitempty"`
+}
+
+func (UploadedFile) TableName() string {
+	return "uploaded_files"
+}
@@ -0,0 +1,26 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// LiveLocation 实时位置共享（location 消息的 metadata.live_period > 0 时创建，发送者通过 WebSocket 持续上报位置）
+type LiveLocation struct {
+	MessageID      uuid.UUID  `json:"message_id" gorm:"type:uuid;primaryKey"`
+	ConversationID uuid.UUID  `json:"conversation_id" gorm:"type:uuid;not null"`
+	UserID         uuid.UUID  `json:"user_id" gorm:"type:uuid;not null"`
+	Latitude       float64    `json:"latitude" gorm:"not null"`
+	Longitude      float64    `json:"longitude" gorm:"not null"`
+	Accuracy       *float64   `json:"accuracy,omitempty"` // 精度（米）
+	Heading        *float64   `json:"heading,omitempty"`  // 方向（度，0-360）
+	UpdatedAt      time.Time  `json:"updated_at" gorm:"not null"`
+	ExpiresAt      time.Time  `json:"expires_at" gorm:"not null"`
+	StoppedAt      *time.Time `json:"stopped_at,omitempty"` // 结束时间（手动停止或到期）
+	IsActive       bool       `json:"is_active" gorm:"-"`   // 是否仍在共享（查询时补充）
+}
+
+func (LiveLocation) TableName() string {
+	return "live_locations"
+}
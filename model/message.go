@@ -9,23 +9,59 @@ import (
 
 // Message 消息表
 type Message struct {
-	ID               uuid.UUID       `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
-	ConversationID   uuid.UUID       `json:"conversation_id" gorm:"type:uuid;not null;index"`
-	SenderID         uuid.UUID       `json:"sender_id" gorm:"type:uuid;not null;index"`
-	MessageType      string          `json:"message_type" gorm:"type:varchar(20);not null"` // 'text' | 'image' | 'video' | 'emoji'
-	Content          *string         `json:"content,omitempty" gorm:"type:text"`
-	Metadata         json.RawMessage `json:"metadata,omitempty" gorm:"type:jsonb"`        // JSONB 字段
-	Status           string          `json:"status" gorm:"type:varchar(20);default:sent"` // 'sent' | 'delivered' | 'read'
-	ReplyToMessageID *uuid.UUID      `json:"reply_to_message_id,omitempty" gorm:"type:uuid"`
-	IsRecalled       bool            `json:"is_recalled" gorm:"default:false"`
-	RecalledAt       *time.Time      `json:"recalled_at,omitempty"`
-	CreatedAt        time.Time       `json:"created_at" gorm:"autoCreateTime"`
+	ID                uuid.UUID       `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	ConversationID    uuid.UUID       `json:"conversation_id" gorm:"type:uuid;not null;index"`
+	Seq               int64           `json:"seq" gorm:"not null"` // 会话内序号（从 1 开始严格递增，发送时在事务中分配）
+	SenderID          uuid.UUID       `json:"sender_id" gorm:"type:uuid;not null;index"`
+	MessageType       string          `json:"message_type" gorm:"type:varchar(20);not null"` // 'text' | 'rich_text' | 'image' | 'video' | 'emoji' | 'poll' | 'file' | 'voice' | 'location'
+	Content           *string         `json:"content,omitempty" gorm:"type:text"`
+	PlainText         *string         `json:"plain_text,omitempty" gorm:"type:text"`           // 纯文本（仅富文本消息，用于预览和搜索）
+	Metadata          json.RawMessage `json:"metadata,omitempty" gorm:"type:jsonb"`            // JSONB 字段
+	Status            string          `json:"status" gorm:"type:varchar(20);default:sent"`     // 'sent' | 'delivered' | 'read'
+	ClientMsgID       *string         `json:"client_msg_id,omitempty" gorm:"type:varchar(64)"` // 客户端生成的消息ID（同一发送者唯一，用于重试去重）
+	ReplyToMessageID  *uuid.UUID      `json:"reply_to_message_id,omitempty" gorm:"type:uuid"`
+	ThreadRootID      *uuid.UUID      `json:"thread_root_id,omitempty" gorm:"type:uuid;index"` // 所属话题的根消息ID（根消息本身为空）
+	ThreadReplyCount  int             `json:"thread_reply_count,omitempty" gorm:"default:0"`   // 话题回复数（仅根消息）
+	ThreadLastReplyAt *time.Time      `json:"thread_last_reply_at,omitempty"`
+	IsRecalled        bool            `json:"is_recalled" gorm:"default:false"`
+	RecalledAt        *time.Time      `json:"recalled_at,omitempty"`
+	EditedAt          *time.Time      `json:"edited_at,omitempty"`
+	ExpiresAt         *time.Time      `json:"expires_at,omitempty"` // 阅后即焚过期时间（发送时根据会话保留时长计算）
+	CreatedAt         time.Time       `json:"created_at" gorm:"autoCreateTime"`
+
+	// 表情回应聚合（查询时补充，不存数据库）
+	Reactions []ReactionSummary `json:"reactions,omitempty" gorm:"-"`
+	// 当前用户在该话题中的未读回复数（仅根消息，查询时补充）
+	ThreadUnreadCount int `json:"thread_unread_count,omitempty" gorm:"-"`
+	// 投票结果（仅投票消息，查询时补充）
+	Poll *PollResult `json:"poll,omitempty" gorm:"-"`
+	// 收听记录（仅语音消息，查询时补充；不在列表中的接收者为未收听）
+	VoiceListens []VoiceListen `json:"voice_listens,omitempty" gorm:"-"`
+	// 实时位置共享状态（仅实时位置消息，查询时补充）
+	LiveLocation *LiveLocation `json:"live_location,omitempty" gorm:"-"`
+	// 送达/已读统计（仅当前用户发送的群聊消息，查询时补充）
+	Receipts *ReceiptSummary `json:"receipts,omitempty" gorm:"-"`
+	// 重复发送：client_msg_id 已经使用过，返回的是第一次发送时创建的消息（发送时补充）
+	Duplicate bool `json:"duplicate,omitempty" gorm:"-"`
 }
 
 func (Message) TableName() string {
 	return "messages"
 }
 
+// MessageEdit 消息编辑历史表（保存每次编辑前的内容）
+type MessageEdit struct {
+	ID              uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	MessageID       uuid.UUID `json:"message_id" gorm:"type:uuid;not null;index"`
+	EditorID        uuid.UUID `json:"editor_id" gorm:"type:uuid;not null"`
+	PreviousContent *string   `json:"previous_content,omitempty" gorm:"type:text"`
+	EditedAt        time.Time `json:"edited_at" gorm:"not null"`
+}
+
+func (MessageEdit) TableName() string {
+	return "message_edits"
+}
+
 // MessageMetadata 消息元数据结构（用于解析 metadata 字段）
 type MessageMetadata struct {
 	// 图片相关
@@ -40,12 +76,38 @@ type MessageMetadata struct {
 	Duration int    `json:"duration,omitempty"`  // 视频时长（秒）
 	CoverURL string `json:"cover_url,omitempty"` // 视频封面
 
+	// 语音相关（时长和波形由服务端计算）
+	DurationMS int   `json:"duration_ms,omitempty"` // 语音时长（毫秒）
+	Waveform   []int `json:"waveform,omitempty"`    // 波形摘要（固定数量的采样点，取值 0-100）
+
+	// 位置相关（live_period > 0 为实时位置共享）
+	Latitude   float64  `json:"latitude,omitempty"`
+	Longitude  float64  `json:"longitude,omitempty"`
+	Accuracy   *float64 `json:"accuracy,omitempty"`    // 精度（米）
+	PlaceName  string   `json:"place_name,omitempty"`  // 地点名称
+	Address    string   `json:"address,omitempty"`     // 详细地址
+	LivePeriod int      `json:"live_period,omitempty"` // 实时共享时长（秒）
+
 	// 表情相关
 	EmojiID   string `json:"emoji_id,omitempty"`
 	EmojiName string `json:"emoji_name,omitempty"`
 
 	// 回复消息预览
 	ReplyToContent string `json:"reply_to_content,omitempty"`
+
+	// @提及（群聊文本消息，发送时解析）
+	MentionedUserIDs []string `json:"mentioned_user_ids,omitempty"`
+	MentionAll       bool     `json:"mention_all,omitempty"`
+
+	// 转发来源（多次转发时保留最初的来源）
+	ForwardedFrom *ForwardedFrom `json:"forwarded_from,omitempty"`
+}
+
+// ForwardedFrom 转发消息的原始来源
+type ForwardedFrom struct {
+	MessageID      string `json:"message_id"`
+	SenderID       string `json:"sender_id"`
+	ConversationID string `json:"conversation_id"`
 }
 
 // MessageWithSender 消息详情（包含发送者信息）
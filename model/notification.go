@@ -11,7 +11,7 @@ import (
 type Notification struct {
 	ID               uuid.UUID       `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
 	UserID           uuid.UUID       `json:"user_id" gorm:"type:uuid;not null;index"`
-	NotificationType string          `json:"notification_type" gorm:"type:varchar(30);not null"` // 'system' | 'message' | 'card_completed' | 'custom'
+	NotificationType string          `json:"notification_type" gorm:"type:varchar(30);not null"` // 'system' | 'message' | 'mention' | 'card_completed' | 'custom'
 	Title            string          `json:"title" gorm:"type:varchar(200);not null"`
 	Content          *string         `json:"content,omitempty" gorm:"type:text"`
 	Metadata         json.RawMessage `json:"metadata,omitempty" gorm:"type:jsonb"` // JSONB 字段
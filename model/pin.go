@@ -0,0 +1,23 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PinnedMessage 会话置顶消息表
+type PinnedMessage struct {
+	ID             uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	ConversationID uuid.UUID `json:"conversation_id" gorm:"type:uuid;not null;index"`
+	MessageID      uuid.UUID `json:"message_id" gorm:"type:uuid;not null"`
+	PinnedBy       uuid.UUID `json:"pinned_by" gorm:"type:uuid;not null"`
+	PinnedAt       time.Time `json:"pinned_at" gorm:"autoCreateTime"`
+
+	// 被置顶的消息（查询时补充，不存数据库）
+	Message *Message `json:"message,omitempty" gorm:"-"`
+}
+
+func (PinnedMessage) TableName() string {
+	return "pinned_messages"
+}
@@ -0,0 +1,71 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Poll 投票表（每条 message_type='poll' 的消息对应一条记录，问题存储在消息 content 中）
+type Poll struct {
+	MessageID      uuid.UUID  `json:"message_id" gorm:"type:uuid;primaryKey"`
+	MultipleChoice bool       `json:"multiple_choice" gorm:"default:false"`
+	Anonymous      bool       `json:"anonymous" gorm:"default:false"`
+	ClosesAt       *time.Time `json:"closes_at,omitempty"` // 自动截止时间（为空表示手动关闭）
+	ClosedAt       *time.Time `json:"closed_at,omitempty"` // 手动关闭时间
+	ClosedBy       *uuid.UUID `json:"closed_by,omitempty" gorm:"type:uuid"`
+	CreatedAt      time.Time  `json:"created_at" gorm:"autoCreateTime"`
+}
+
+func (Poll) TableName() string {
+	return "polls"
+}
+
+// IsClosed 投票是否已结束（手动关闭或超过截止时间）
+func (p *Poll) IsClosed(now time.Time) bool {
+	return p.ClosedAt != nil || (p.ClosesAt != nil && !p.ClosesAt.After(now))
+}
+
+// PollOption 投票选项表
+type PollOption struct {
+	ID        uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	MessageID uuid.UUID `json:"message_id" gorm:"type:uuid;not null;index"`
+	Position  int       `json:"position" gorm:"not null"`
+	Text      string    `json:"text" gorm:"type:varchar(100);not null"`
+}
+
+func (PollOption) TableName() string {
+	return "poll_options"
+}
+
+// PollVote 投票记录表（一个用户对一个选项只有一条记录）
+type PollVote struct {
+	OptionID  uuid.UUID `json:"option_id" gorm:"type:uuid;primaryKey"`
+	UserID    uuid.UUID `json:"user_id" gorm:"type:uuid;primaryKey"`
+	MessageID uuid.UUID `json:"message_id" gorm:"type:uuid;not null;index"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+func (PollVote) TableName() string {
+	return "poll_votes"
+}
+
+// PollResult 投票结果（用于消息列表和实时推送）
+type PollResult struct {
+	MessageID      uuid.UUID          `json:"message_id"`
+	MultipleChoice bool               `json:"multiple_choice"`
+	Anonymous      bool               `json:"anonymous"`
+	ClosesAt       *time.Time         `json:"closes_at,omitempty"`
+	IsClosed       bool               `json:"is_closed"`
+	TotalVoters    int                `json:"total_voters"`
+	Options        []PollOptionResult `json:"options"`
+	MyOptionIDs    []uuid.UUID        `json:"my_option_ids,omitempty"` // 当前用户选择的选项（实时推送中不包含）
+}
+
+// PollOptionResult 单个选项的投票结果
+type PollOptionResult struct {
+	ID        uuid.UUID   `json:"id"`
+	Text      string      `json:"text"`
+	VoteCount int         `json:"vote_count"`
+	VoterIDs  []uuid.UUID `json:"voter_ids,omitempty"` // 匿名投票时不返回
+}
@@ -0,0 +1,23 @@
+package model
+
+import "github.com/google/uuid"
+
+// ReceiptSummary 消息送达/已读统计（如"5 人中 3 人已读"）
+type ReceiptSummary struct {
+	Total     int `json:"total"`     // 接收者人数（不含发送者，只统计消息发送时已在会话中的成员）
+	Delivered int `json:"delivered"` // 已送达人数（包含已读）
+	Read      int `json:"read"`      // 已读人数（关闭已读回执时为 0）
+}
+
+// MessageReceipt 单个接收者的回执状态
+type MessageReceipt struct {
+	UserID uuid.UUID `json:"user_id"`
+	Status string    `json:"status"` // 'sent' | 'delivered' | 'read'
+}
+
+// MessageReceipts 消息的回执详情
+type MessageReceipts struct {
+	MessageID uuid.UUID        `json:"message_id"`
+	Summary   ReceiptSummary   `json:"summary"`
+	Receipts  []MessageReceipt `json:"receipts"`
+}
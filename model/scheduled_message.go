@@ -0,0 +1,31 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ScheduledMessage 定时消息表（到期后由调度器通过正常发送流程发出）
+type ScheduledMessage struct {
+	ID               uuid.UUID       `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	SenderID         uuid.UUID       `json:"sender_id" gorm:"type:uuid;not null;index"`
+	ConversationID   *uuid.UUID      `json:"conversation_id,omitempty" gorm:"type:uuid"`
+	ReceiverID       *uuid.UUID      `json:"receiver_id,omitempty" gorm:"type:uuid"` // 私聊时使用
+	MessageType      string          `json:"message_type" gorm:"type:varchar(20);not null"`
+	Content          *string         `json:"content,omitempty" gorm:"type:text"`
+	Metadata         json.RawMessage `json:"metadata,omitempty" gorm:"type:jsonb"`
+	ReplyToMessageID *uuid.UUID      `json:"reply_to_message_id,omitempty" gorm:"type:uuid"`
+	ScheduledAt      time.Time       `json:"scheduled_at" gorm:"not null"`
+	Status           string          `json:"status" gorm:"type:varchar(20);default:pending"` // 'pending' | 'sending' | 'sent' | 'failed' | 'cancelled'
+	SentMessageID    *uuid.UUID      `json:"sent_message_id,omitempty" gorm:"type:uuid"`
+	Error            *string         `json:"error,omitempty" gorm:"type:text"` // 发送失败原因
+	SentAt           *time.Time      `json:"sent_at,omitempty"`
+	CreatedAt        time.Time       `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt        time.Time       `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+func (ScheduledMessage) TableName() string {
+	return "scheduled_messages"
+}
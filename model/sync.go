@@ -0,0 +1,58 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SyncResult 断线重连同步结果（自上次检查点以来的所有变化）
+type SyncResult struct {
+	Checkpoint    string             `json:"checkpoint"`    // 下次同步使用的检查点
+	Reset         bool               `json:"reset"`         // 检查点为空、已过期或变化太多：客户端需要重新拉取会话列表和消息历史
+	Messages      []Message          `json:"messages"`      // 新消息（序号大于检查点的消息，按发送时间正序，包含自己在其他设备发送的消息）
+	Recalled      []SyncRecall       `json:"recalled"`      // 被撤回的消息
+	Edited        []SyncEdit         `json:"edited"`        // 被编辑的消息（最新内容）
+	Read          []SyncRead         `json:"read"`          // 已读进度变化（自己在其他设备上的已读，以及开启已读回执时其他成员的已读）
+	Conversations []SyncConversation `json:"conversations"` // 状态发生变化的会话（当前状态）
+}
+
+// SyncRecall 撤回事件
+type SyncRecall struct {
+	MessageID      uuid.UUID `json:"message_id"`
+	ConversationID uuid.UUID `json:"conversation_id"`
+	RecalledAt     time.Time `json:"recalled_at"`
+}
+
+// SyncEdit 编辑事件
+type SyncEdit struct {
+	MessageID      uuid.UUID       `json:"message_id"`
+	ConversationID uuid.UUID       `json:"conversation_id"`
+	Content        *string         `json:"content,omitempty"`
+	PlainText      *string         `json:"plain_text,omitempty"`
+	Metadata       json.RawMessage `json:"metadata,omitempty"`
+	EditedAt       time.Time       `json:"edited_at"`
+}
+
+// SyncRead 已读事件（message_id 及之前的消息已被 user_id 读过）
+type SyncRead struct {
+	ConversationID uuid.UUID `json:"conversation_id"`
+	UserID         uuid.UUID `json:"user_id"`
+	MessageID      uuid.UUID `json:"message_id"`
+	ReadAt         time.Time `json:"read_at"`
+}
+
+// SyncConversation 会话的当前状态
+type SyncConversation struct {
+	ConversationID     uuid.UUID  `json:"conversation_id"`
+	ConversationType   string     `json:"conversation_type"`
+	GroupName          *string    `json:"group_name,omitempty"`
+	LastMessageAt      *time.Time `json:"last_message_at,omitempty"`
+	LastSeq            int64      `json:"last_seq"`
+	MessageTTLSeconds  int        `json:"message_ttl_seconds"`
+	UnreadCount        int        `json:"unread_count"`
+	UnreadMentionCount int        `json:"unread_mention_count"`
+	IsHidden           bool       `json:"is_hidden"`
+	Left               bool       `json:"left"` // 已离开或被移出会话（客户端应移除该会话）
+}
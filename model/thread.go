@@ -0,0 +1,18 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ThreadReadState 用户在话题中的已读位置（用于计算话题未读数）
+type ThreadReadState struct {
+	ThreadRootID uuid.UUID `json:"thread_root_id" gorm:"type:uuid;primaryKey"`
+	UserID       uuid.UUID `json:"user_id" gorm:"type:uuid;primaryKey"`
+	LastReadAt   time.Time `json:"last_read_at" gorm:"not null"`
+}
+
+func (ThreadReadState) TableName() string {
+	return "thread_read_states"
+}
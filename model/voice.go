@@ -0,0 +1,18 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// VoiceListen 语音消息收听记录（每个接收者首次播放时记录一次）
+type VoiceListen struct {
+	MessageID  uuid.UUID `json:"message_id" gorm:"type:uuid;primaryKey"`
+	UserID     uuid.UUID `json:"user_id" gorm:"type:uuid;primaryKey"`
+	ListenedAt time.Time `json:"listened_at" gorm:"not null"`
+}
+
+func (VoiceListen) TableName() string {
+	return "voice_listens"
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"dinq_message/model"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// maxClientMsgIDLength 客户端消息ID的最大长度
+const maxClientMsgIDLength = 64
+
+// errDuplicateClientMsgID 并发重试时插入冲突（事务回滚已分配的序号，改为返回已保存的消息）
+var errDuplicateClientMsgID = errors.New("duplicate client_msg_id")
+
+// 客户端消息ID（client_msg_id）由客户端在发送前生成，同一发送者的同一ID最多创建一条消息：
+// 网络不稳定时客户端可以用同一ID重试（HTTP 或 WebSocket），服务端直接返回第一次发送时创建的消息，不会重复推送。
+// 唯一索引 idx_msg_client_msg_id 兜底并发重试的情况。
+
+// normalizeClientMsgID 校验并规范化客户端消息ID（为空时视为未提供）
+func normalizeClientMsgID(req *SendMessageRequest) error {
+	if req.ClientMsgID == nil {
+		return nil
+	}
+	clientMsgID := strings.TrimSpace(*req.ClientMsgID)
+	if clientMsgID == "" {
+		req.ClientMsgID = nil
+		return nil
+	}
+	if len(clientMsgID) > maxClientMsgIDLength {
+		return invalidError("client_msg_id exceeds %d characters", maxClientMsgIDLength)
+	}
+	req.ClientMsgID = &clientMsgID
+	return nil
+}
+
+// findClientMessage 查询发送者用该客户端消息ID发送过的消息（不存在时返回 nil）
+func (s *MessageService) findClientMessage(senderID uuid.UUID, req *SendMessageRequest) (*model.Message, error) {
+	var message model.Message
+	if err := s.db.Where("sender_id = ? AND client_msg_id = ?", senderID, *req.ClientMsgID).First(&message).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to query message: %w", err)
+	}
+	if req.ConversationID != uuid.Nil && req.ConversationID != message.ConversationID {
+		return nil, conflictError("client_msg_id has already been used in another conversation")
+	}
+
+	// 补充投票和实时位置，与第一次发送时返回的消息一致
+	messages := []model.Message{message}
+	if message.MessageType == "poll" {
+		polls, err := loadPollResults(s.db, senderID, []uuid.UUID{message.ID})
+		if err != nil {
+			return nil, err
+		}
+		messages[0].Poll = polls[message.ID]
+	}
+	if err := attachLiveLocations(s.db, messages); err != nil {
+		return nil, err
+	}
+	messages[0].Duplicate = true
+	return &messages[0], nil
+}
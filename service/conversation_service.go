@@ -26,29 +26,30 @@ type ConversationService struct {
 }
 
 func NewConversationService(db *gorm.DB) *ConversationService {
-	agentURL := os.Getenv("AGENT_URL")
-	if agentURL == "" {
-		agentURL = "http://localhost:8082"
-	}
 	return &ConversationService{
 		db:       db,
 		rdb:      nil, // 可选，如果不需要在线状态功能可以为 nil
 		sysSvc:   NewSystemSettingsService(db),
-		agentURL: agentURL,
+		agentURL: agentURLFromEnv(),
 	}
 }
 
 func NewConversationServiceWithRedis(db *gorm.DB, rdb *redis.Client) *ConversationService {
-	agentURL := os.Getenv("AGENT_URL")
-	if agentURL == "" {
-		agentURL = "http://localhost:8082"
-	}
 	return &ConversationService{
 		db:       db,
 		rdb:      rdb,
 		sysSvc:   NewSystemSettingsService(db),
-		agentURL: agentURL,
+		agentURL: agentURLFromEnv(),
+	}
+}
+
+// agentURLFromEnv 读取 agent 服务地址（未配置时使用本地默认地址）
+func agentURLFromEnv() string {
+	agentURL := os.Getenv("AGENT_URL")
+	if agentURL == "" {
+		agentURL = "http://localhost:8082"
 	}
+	return agentURL
 }
 
 // GetConversations 获取用户的所有会话列表(增强版)
@@ -56,7 +57,8 @@ func (s *ConversationService) GetConversations(userID uuid.UUID, limit, offset i
 	// 1. 查询用户参与的会话ID列表(排除已隐藏的会话)
 	type ConversationQuery struct {
 		model.Conversation
-		UnreadCount int `gorm:"column:unread_count"`
+		UnreadCount        int `gorm:"column:unread_count"`
+		UnreadMentionCount int `gorm:"column:unread_mention_count"`
 	}
 
 	var (
@@ -67,7 +69,7 @@ func (s *ConversationService) GetConversations(userID uuid.UUID, limit, offset i
 	search = strings.TrimSpace(search)
 	if search == "" {
 		if err = s.db.Table("conversations c").
-			Select("c.*, cm.unread_count").
+			Select("c.*, cm.unread_count, cm.unread_mention_count").
 			Joins("INNER JOIN conversation_members cm ON c.id = cm.conversation_id AND cm.user_id = ?", userID).
 			Where("cm.left_at IS NULL AND cm.is_hidden = ?", false).
 			Order("c.last_message_at DESC NULLS LAST, c.created_at DESC").
@@ -87,7 +89,7 @@ func (s *ConversationService) GetConversations(userID uuid.UUID, limit, offset i
 		}
 
 		if err = s.db.Table("conversations c").
-			Select("c.*, cm.unread_count").
+			Select("c.*, cm.unread_count, cm.unread_mention_count").
 			Joins("INNER JOIN conversation_members cm ON c.id = cm.conversation_id AND cm.user_id = ?", userID).
 			Where("cm.left_at IS NULL AND cm.is_hidden = ? AND c.id IN ?", false, matchedIDs).
 			Order("c.last_message_at DESC NULLS LAST, c.created_at DESC").
@@ -196,12 +198,13 @@ func (s *ConversationService) GetConversations(userID uuid.UUID, limit, offset i
 		}
 
 		item := model.ConversationListItem{
-			Conversation:    convQuery.Conversation,
-			UnreadCount:     convQuery.UnreadCount,
-			LastMessageTime: convQuery.LastMessageAt,
-			LastMessageText: lastMsg,
-			OnlineStatus:    onlineStatusMap[convID],
-			Members:         membersByConvID[convID],
+			Conversation:       convQuery.Conversation,
+			UnreadCount:        convQuery.UnreadCount,
+			UnreadMentionCount: convQuery.UnreadMentionCount,
+			LastMessageTime:    convQuery.LastMessageAt,
+			LastMessageText:    lastMsg,
+			OnlineStatus:       onlineStatusMap[convID],
+			Members:            membersByConvID[convID],
 		}
 		if item.Members == nil {
 			item.Members = []model.ConversationMember{}
@@ -288,12 +291,13 @@ func (s *ConversationService) filterConversationIDsBySearch(userID uuid.UUID, ke
 func (s *ConversationService) GetConversationDetailWithMembers(conversationID, userID uuid.UUID) (*model.ConversationListItem, error) {
 	type conversationQuery struct {
 		model.Conversation
-		UnreadCount int `gorm:"column:unread_count"`
+		UnreadCount        int `gorm:"column:unread_count"`
+		UnreadMentionCount int `gorm:"column:unread_mention_count"`
 	}
 
 	var conv conversationQuery
 	err := s.db.Table("conversations c").
-		Select("c.*, cm.unread_count").
+		Select("c.*, cm.unread_count, cm.unread_mention_count").
 		Joins("INNER JOIN conversation_members cm ON c.id = cm.conversation_id AND cm.user_id = ?", userID).
 		Where("c.id = ? AND cm.left_at IS NULL", conversationID).
 		First(&conv).Error
@@ -344,13 +348,21 @@ func (s *ConversationService) GetConversationDetailWithMembers(conversationID, u
 		}
 	}
 
+	// 置顶消息
+	pinnedMessages, err := loadPinnedMessages(s.db, conversationID)
+	if err != nil {
+		return nil, err
+	}
+
 	return &model.ConversationListItem{
-		Conversation:    conv.Conversation,
-		UnreadCount:     conv.UnreadCount,
-		LastMessageTime: conv.LastMessageAt,
-		LastMessageText: lastMsgText,
-		Members:         members,
-		OnlineStatus:    onlineStatus,
+		Conversation:       conv.Conversation,
+		UnreadCount:        conv.UnreadCount,
+		UnreadMentionCount: conv.UnreadMentionCount,
+		LastMessageTime:    conv.LastMessageAt,
+		LastMessageText:    lastMsgText,
+		Members:            members,
+		OnlineStatus:       onlineStatus,
+		PinnedMessages:     pinnedMessages,
 	}, nil
 }
 
@@ -365,13 +377,14 @@ func (s *ConversationService) getMessagesByIDs(messageIDs []uuid.UUID) map[uuid.
 	type MessagePreview struct {
 		ID          uuid.UUID
 		Content     *string
+		PlainText   *string
 		MessageType string
 	}
 
 	var messages []MessagePreview
 	// 直接用主键IN查询,利用主键索引,性能最优
 	err := s.db.Table("messages").
-		Select("id, content, message_type").
+		Select("id, content, plain_text, message_type").
 		Where("id IN ? AND is_recalled = ?", messageIDs, false).
 		Find(&messages).Error
 
@@ -380,49 +393,34 @@ func (s *ConversationService) getMessagesByIDs(messageIDs []uuid.UUID) map[uuid.
 	}
 
 	for _, msg := range messages {
-		var text string
-		if msg.MessageType == "text" && msg.Content != nil {
-			text = *msg.Content
-			// 限制预览长度（按字符截断，避免中文乱码）
-			runes := []rune(text)
-			if len(runes) > 50 {
-				text = string(runes[:50]) + "..."
-			}
-		} else if msg.MessageType == "image" {
-			text = "[图片]"
-		} else if msg.MessageType == "video" {
-			text = "[视频]"
-		} else if msg.MessageType == "emoji" {
-			text = "[表情]"
+		text := buildMessagePreview(msg.MessageType, msg.Content, msg.PlainText)
+		if text == nil {
+			empty := ""
+			text = &empty
 		}
-		result[msg.ID] = &text
+		result[msg.ID] = text
 	}
 
 	return result
 }
 
 // GetMessages 获取会话的消息历史（包含 can_send 状态和在线状态）
-func (s *ConversationService) GetMessages(userID, conversationID uuid.UUID, limit, offset int) (map[string]interface{}, error) {
+// 支持游标分页（before/after/around），新消息到达时翻页不会重复或遗漏
+func (s *ConversationService) GetMessages(userID, conversationID uuid.UUID, page *MessagePageQuery) (map[string]interface{}, error) {
 	// 检查用户是否是会话成员
 	isMember, err := s.isConversationMember(conversationID, userID)
 	if err != nil || !isMember {
 		return nil, fmt.Errorf("user is not a member of this conversation")
 	}
 
-	var messages []model.Message
-	err = s.db.Where("conversation_id = ?", conversationID).
-		Order("created_at DESC").
-		Limit(limit).
-		Offset(offset).
-		Find(&messages).Error
-
+	result, err := queryMessagePage(s.db, conversationID, page)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query messages: %w", err)
+		return nil, err
 	}
+	messages := result.Messages
 
-	// 反转顺序，使最新消息在最后
-	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
-		messages[i], messages[j] = messages[j], messages[i]
+	if err := attachMessageDetails(s.db, userID, s.sysSvc.IsFeatureEnabled("enable_read_receipt"), messages); err != nil {
+		return nil, err
 	}
 
 	// 计算是否可以发送消息
@@ -432,12 +430,77 @@ func (s *ConversationService) GetMessages(userID, conversationID uuid.UUID, limi
 	onlineStatus := s.getOnlineStatusForConversation(userID, conversationID)
 
 	return map[string]interface{}{
-		"messages":      messages,
-		"can_send":      canSend,
-		"online_status": onlineStatus,
+		"messages":        messages,
+		"has_more_before": result.HasMoreBefore,
+		"has_more_after":  result.HasMoreAfter,
+		"can_send":        canSend,
+		"online_status":   onlineStatus,
 	}, nil
 }
 
+// attachMessageDetails 为消息列表补充查询时的附加信息（表情回应、话题未读数、投票、语音收听、实时位置、回执统计）
+func attachMessageDetails(db *gorm.DB, userID uuid.UUID, readReceiptEnabled bool, messages []model.Message) error {
+	// 补充表情回应聚合
+	messageIDs := make([]uuid.UUID, len(messages))
+	for i, msg := range messages {
+		messageIDs[i] = msg.ID
+	}
+	reactionMap, err := loadReactionSummaries(db, messageIDs)
+	if err != nil {
+		return err
+	}
+	for i := range messages {
+		messages[i].Reactions = reactionMap[messages[i].ID]
+	}
+
+	// 补充话题未读数（仅有回复的根消息）
+	var threadRootIDs []uuid.UUID
+	for _, msg := range messages {
+		if msg.ThreadReplyCount > 0 {
+			threadRootIDs = append(threadRootIDs, msg.ID)
+		}
+	}
+	threadUnreadMap, err := loadThreadUnreadCounts(db, userID, threadRootIDs)
+	if err != nil {
+		return err
+	}
+	for i := range messages {
+		messages[i].ThreadUnreadCount = threadUnreadMap[messages[i].ID]
+	}
+
+	// 补充投票结果（仅投票消息）
+	var pollMessageIDs []uuid.UUID
+	for _, msg := range messages {
+		if msg.MessageType == "poll" {
+			pollMessageIDs = append(pollMessageIDs, msg.ID)
+		}
+	}
+	pollMap, err := loadPollResults(db, userID, pollMessageIDs)
+	if err != nil {
+		return err
+	}
+	for i := range messages {
+		messages[i].Poll = pollMap[messages[i].ID]
+	}
+
+	// 补充语音收听记录（仅语音消息）
+	if err := attachVoiceListens(db, messages); err != nil {
+		return err
+	}
+
+	// 补充实时位置共享状态（仅位置消息）
+	if err := attachLiveLocations(db, messages); err != nil {
+		return err
+	}
+
+	// 补充送达/已读统计（仅当前用户发送的群聊消息）
+	if err := attachReceiptSummaries(db, userID, readReceiptEnabled, messages); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 // checkCanSendFromMessages 从消息列表判断用户是否可以发送消息
 func (s *ConversationService) checkCanSendFromMessages(userID uuid.UUID, messages []model.Message) bool {
 	// 如果系统未启用首条消息限制，直接返回 true
@@ -762,6 +825,11 @@ type UserDataInfo struct {
 
 // batchGetUserDataFromAgent 从agent批量获取用户数据
 func (s *ConversationService) batchGetUserDataFromAgent(userIDs []string) map[string]UserDataInfo {
+	return fetchUserDataFromAgent(s.agentURL, userIDs)
+}
+
+// fetchUserDataFromAgent 调用agent批量用户数据接口（失败时返回空map）
+func fetchUserDataFromAgent(agentURL string, userIDs []string) map[string]UserDataInfo {
 	result := make(map[string]UserDataInfo)
 
 	if len(userIDs) == 0 {
@@ -777,7 +845,7 @@ func (s *ConversationService) batchGetUserDataFromAgent(userIDs []string) map[st
 	}
 
 	// 调用agent接口
-	resp, err := http.Post(s.agentURL+"/api/v1/user-data/batch", "application/json", bytes.NewBuffer(reqBody))
+	resp, err := http.Post(agentURL+"/api/v1/user-data/batch", "application/json", bytes.NewBuffer(reqBody))
 	if err != nil {
 		return result
 	}
@@ -887,7 +955,7 @@ func (s *ConversationService) SearchConversations(userID uuid.UUID, keyword stri
 		// 查询最新消息
 		var lastMessage model.Message
 		s.db.Where("conversation_id = ?", convID).
-			Order("created_at DESC").
+			Order("seq DESC").
 			First(&lastMessage)
 
 		// 查询未读数量
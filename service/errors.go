@@ -0,0 +1,55 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+)
+
+// 业务错误类别：服务层返回的错误带有类别（errors.Is 判断），接口层据此确定错误码，
+// 修改错误信息的措辞不会改变客户端看到的错误码；没有类别的错误（数据库、Redis 等）视为内部错误
+var (
+	ErrInvalid           = errors.New("invalid request")     // 参数校验失败
+	ErrNotFound          = errors.New("not found")           // 消息、会话等不存在
+	ErrForbidden         = errors.New("forbidden")           // 不是会话成员、被拉黑、权限不足
+	ErrConflict          = errors.New("conflict")            // 与当前状态冲突（如消息已撤回）
+	ErrFirstMessageLimit = errors.New("first message limit") // 私聊首条消息限制：对方回复前不能继续发送
+)
+
+// classifiedError 带类别的业务错误：Error() 只返回错误信息本身，errors.Is 同时匹配类别和被包装的错误
+type classifiedError struct {
+	kind error
+	err  error
+}
+
+func (e *classifiedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *classifiedError) Unwrap() []error {
+	return []error{e.kind, e.err}
+}
+
+// newError 创建指定类别的错误（format 与 fmt.Errorf 相同，支持 %w）
+func newError(kind error, format string, args ...interface{}) error {
+	return &classifiedError{kind: kind, err: fmt.Errorf(format, args...)}
+}
+
+// invalidError 参数校验失败
+func invalidError(format string, args ...interface{}) error {
+	return newError(ErrInvalid, format, args...)
+}
+
+// notFoundError 目标不存在
+func notFoundError(format string, args ...interface{}) error {
+	return newError(ErrNotFound, format, args...)
+}
+
+// forbiddenError 没有权限
+func forbiddenError(format string, args ...interface{}) error {
+	return newError(ErrForbidden, format, args...)
+}
+
+// conflictError 与当前状态冲突
+func conflictError(format string, args ...interface{}) error {
+	return newError(ErrConflict, format, args...)
+}
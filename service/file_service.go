@@ -0,0 +1,490 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"dinq_message/model"
+	"dinq_message/storage"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// maxFileNameLength 文件名最大长度（字符数，与数据库 varchar(255) 保持一致）
+	maxFileNameLength = 255
+	// presignUploadExpiry 预签名上传地址有效期
+	presignUploadExpiry = 15 * time.Minute
+)
+
+// allowedMimeTypes 允许上传的文件类型（以 '/'、'.'、'-' 结尾的按前缀匹配）
+var allowedMimeTypes = []string{
+	"image/", "video/", "audio/",
+	"text/plain", "text/csv",
+	"application/pdf", "application/json", "application/zip", "application/x-zip-compressed",
+	"application/x-7z-compressed", "application/x-rar-compressed", "application/gzip",
+	"application/msword", "application/vnd.ms-", "application/vnd.openxmlformats-officedocument.",
+	"application/octet-stream",
+}
+
+// blockedMimeTypes 可能在浏览器中执行脚本的类型，即使匹配允许的前缀也拒绝
+var blockedMimeTypes = map[string]bool{
+	"image/svg+xml": true,
+}
+
+// storageExtPattern 存储 key 中保留的扩展名（只保留安全字符）
+var storageExtPattern = regexp.MustCompile(`^\.[a-z0-9]{1,10}$`)
+
+// preferredExtensions 类型对应多个扩展名时优先使用的扩展名
+var preferredExtensions = map[string]string{
+	"text/plain": ".txt",
+	"image/jpeg": ".jpg",
+}
+
+// audioContainerExtensions 内容识别为容器格式（application/ogg、video/mp4、video/webm）时按扩展名识别的音频类型
+var audioContainerExtensions = map[string]string{
+	".ogg":  "audio/ogg",
+	".oga":  "audio/ogg",
+	".opus": "audio/ogg",
+	".m4a":  "audio/mp4",
+	".weba": "audio/webm",
+}
+
+type FileService struct {
+	db             *gorm.DB
+	store          storage.Storage
+	imageSvc       *ImageService
+	maxFileSizeMB  int
+	maxVideoSizeMB int
+}
+
+func NewFileService(db *gorm.DB, store storage.Storage, maxFileSizeMB, maxVideoSizeMB int) *FileService {
+	return &FileService{
+		db:             db,
+		store:          store,
+		maxFileSizeMB:  maxFileSizeMB,
+		maxVideoSizeMB: maxVideoSizeMB,
+	}
+}
+
+// SetImageService 设置图片处理服务（上传图片后异步生成缩略图）
+func (s *FileService) SetImageService(imageSvc *ImageService) {
+	s.imageSvc = imageSvc
+}
+
+// PresignUploadRequest 预签名上传请求（客户端声明的文件信息，完成上传时按实际字节数重新校验）
+type PresignUploadRequest struct {
+	FileName string `json:"file_name"`
+	MimeType string `json:"mime_type"`
+	Size     int64  `json:"size"`
+}
+
+// PresignUploadResult 预签名上传结果
+type PresignUploadResult struct {
+	File   *model.UploadedFile       `json:"file"`
+	Upload *storage.PresignedRequest `json:"upload"`
+}
+
+// MaxUploadBytes 单个文件允许的最大字节数（用于限制请求体大小）
+func (s *FileService) MaxUploadBytes() int64 {
+	maxMB := s.maxFileSizeMB
+	if s.maxVideoSizeMB > maxMB {
+		maxMB = s.maxVideoSizeMB
+	}
+	return int64(maxMB) * 1024 * 1024
+}
+
+// UploadFile 服务端中转上传（multipart），文件类型根据实际内容识别
+func (s *FileService) UploadFile(userID uuid.UUID, fileName string, body io.ReadSeeker, size int64) (*model.UploadedFile, error) {
+	fileName, err := normalizeFileName(fileName)
+	if err != nil {
+		return nil, err
+	}
+	mimeType, err := detectMimeType(fileName, body)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.validateFile(mimeType, size); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	file := s.newUploadedFile(userID, fileName, mimeType, size)
+	file.Status = "uploaded"
+	file.UploadedAt = &now
+
+	ctx := context.Background()
+	if err := s.store.Put(ctx, file.StorageKey, body, size, mimeType); err != nil {
+		return nil, fmt.Errorf("failed to upload file: %w", err)
+	}
+	if err := s.db.Create(file).Error; err != nil {
+		s.store.Delete(ctx, file.StorageKey)
+		return nil, fmt.Errorf("failed to save file: %w", err)
+	}
+	s.processImageAsync(file)
+
+	return file, nil
+}
+
+// PresignUpload 创建待上传的文件记录并生成客户端直传地址
+func (s *FileService) PresignUpload(userID uuid.UUID, req *PresignUploadRequest) (*PresignUploadResult, error) {
+	fileName, err := normalizeFileName(req.FileName)
+	if err != nil {
+		return nil, err
+	}
+	mimeType := normalizeMimeType(req.MimeType)
+	if mimeType == "" {
+		mimeType = mimeTypeByFileName(fileName)
+	}
+	if err := s.validateFile(mimeType, req.Size); err != nil {
+		return nil, err
+	}
+
+	file := s.newUploadedFile(userID, fileName, mimeType, req.Size)
+	if err := s.db.Create(file).Error; err != nil {
+		return nil, fmt.Errorf("failed to save file: %w", err)
+	}
+
+	upload, err := s.store.PresignPut(context.Background(), file.StorageKey, mimeType, presignUploadExpiry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to presign upload: %w", err)
+	}
+
+	return &PresignUploadResult{
+		File:   file,
+		Upload: upload,
+	}, nil
+}
+
+// CompleteUpload 客户端直传完成后确认上传，按存储中实际的字节数校验大小，按实际内容校验类型
+// 超出限制或类型不符的文件会被删除
+func (s *FileService) CompleteUpload(userID, fileID uuid.UUID) (*model.UploadedFile, error) {
+	file, err := s.getOwnFile(userID, fileID)
+	if err != nil {
+		return nil, err
+	}
+	if file.Status == "uploaded" {
+		return file, nil
+	}
+
+	ctx := context.Background()
+	info, err := s.store.Stat(ctx, file.StorageKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, invalidError("file has not been uploaded")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to check uploaded file: %w", err)
+	}
+
+	if err := s.validateFile(file.MimeType, info.Size); err != nil {
+		s.store.Delete(ctx, file.StorageKey)
+		s.db.Delete(file)
+		return nil, err
+	}
+
+	// 客户端可以上传任意内容：按存储记录的类型和实际内容校验，与申请的类型不符的文件会被删除
+	detected, err := s.sniffObject(ctx, file.StorageKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check uploaded file: %w", err)
+	}
+	storedType := normalizeMimeType(info.ContentType)
+	if (storedType != "" && storedType != file.MimeType) || !contentMatchesMimeType(detected, file.MimeType) {
+		s.store.Delete(ctx, file.StorageKey)
+		s.db.Delete(file)
+		return nil, invalidError("file content does not match mime_type: %s", file.MimeType)
+	}
+
+	now := time.Now()
+	result := s.db.Model(&model.UploadedFile{}).
+		Where("id = ? AND status = ?", fileID, "pending").
+		Updates(map[string]interface{}{
+			"status":      "uploaded",
+			"size":        info.Size,
+			"uploaded_at": now,
+		})
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to complete upload: %w", result.Error)
+	}
+
+	file, err = s.getOwnFile(userID, fileID)
+	if err != nil {
+		return nil, err
+	}
+	s.processImageAsync(file)
+
+	return file, nil
+}
+
+// processImageAsync 图片上传完成后异步解析宽高并生成缩略图
+func (s *FileService) processImageAsync(file *model.UploadedFile) {
+	if s.imageSvc == nil || !strings.HasPrefix(file.MimeType, "image/") {
+		return
+	}
+	go func() {
+		if _, err := s.imageSvc.ProcessFile(file.ID); err != nil {
+			log.Printf("[ERROR] Failed to process image file: file=%s, error=%v", file.ID, err)
+		}
+	}()
+}
+
+// GetFile 获取自己上传的文件信息
+func (s *FileService) GetFile(userID, fileID uuid.UUID) (*model.UploadedFile, error) {
+	return s.getOwnFile(userID, fileID)
+}
+
+// newUploadedFile 构造文件记录（存储 key 只包含服务端生成的 ID 和由文件类型决定的扩展名，不使用客户端文件名）
+func (s *FileService) newUploadedFile(userID uuid.UUID, fileName, mimeType string, size int64) *model.UploadedFile {
+	fileID := uuid.New()
+	key := fmt.Sprintf("files/%s/%s%s", userID, fileID, storageExtension(fileName, mimeType))
+
+	return &model.UploadedFile{
+		ID:         fileID,
+		UploaderID: userID,
+		StorageKey: key,
+		FileName:   fileName,
+		MimeType:   mimeType,
+		Size:       size,
+		URL:        s.store.URL(key),
+		Status:     "pending",
+	}
+}
+
+// storageExtension 存储 key 的扩展名（访问文件时按扩展名确定 Content-Type，必须与校验过的文件类型一致）
+// 客户端文件名的扩展名对应该类型时保留，否则使用该类型的标准扩展名，都没有时不带扩展名
+func storageExtension(fileName, mimeType string) string {
+	candidates := []string{strings.ToLower(path.Ext(fileName)), preferredExtensions[mimeType]}
+	if exts, err := mime.ExtensionsByType(mimeType); err == nil {
+		candidates = append(candidates, exts...)
+	}
+	for _, ext := range candidates {
+		if storageExtPattern.MatchString(ext) && mimeTypeByFileName(ext) == mimeType {
+			return ext
+		}
+	}
+	return ""
+}
+
+// validateFile 校验文件类型和大小（视频使用 MaxVideoSizeMB，其他文件使用 MaxFileSizeMB）
+func (s *FileService) validateFile(mimeType string, size int64) error {
+	if !isAllowedMimeType(mimeType) {
+		return invalidError("file type not allowed: %s", mimeType)
+	}
+	if size <= 0 {
+		return invalidError("file is empty")
+	}
+
+	sizeMB := float64(size) / (1024 * 1024)
+	if strings.HasPrefix(mimeType, "video/") {
+		if sizeMB > float64(s.maxVideoSizeMB) {
+			return invalidError("video file size exceeds limit: max %dMB, got %.2fMB", s.maxVideoSizeMB, sizeMB)
+		}
+		return nil
+	}
+	if sizeMB > float64(s.maxFileSizeMB) {
+		return invalidError("file size exceeds limit: max %dMB, got %.2fMB", s.maxFileSizeMB, sizeMB)
+	}
+	return nil
+}
+
+// getOwnFile 查询用户自己上传的文件
+func (s *FileService) getOwnFile(userID, fileID uuid.UUID) (*model.UploadedFile, error) {
+	var file model.UploadedFile
+	if err := s.db.Where("id = ? AND uploader_id = ?", fileID, userID).First(&file).Error; err != nil {
+		return nil, notFoundError("file not found")
+	}
+	return &file, nil
+}
+
+// normalizeFileName 去掉路径部分并校验文件名
+func normalizeFileName(fileName string) (string, error) {
+	fileName = strings.TrimSpace(path.Base(strings.ReplaceAll(fileName, "\\", "/")))
+	if fileName == "" || fileName == "." || fileName == "/" {
+		return "", invalidError("file_name is required")
+	}
+	if utf8.RuneCountInString(fileName) > maxFileNameLength {
+		return "", invalidError("file_name is too long")
+	}
+	return fileName, nil
+}
+
+// detectMimeType 根据文件内容识别类型，无法识别时按扩展名判断
+func detectMimeType(fileName string, body io.ReadSeeker) (string, error) {
+	header := make([]byte, 512)
+	n, err := io.ReadFull(body, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+
+	mimeType := normalizeMimeType(http.DetectContentType(header[:n]))
+	// 内容识别只能区分少数格式，文本和通用二进制再按扩展名细分（如 csv、docx）
+	if mimeType == "application/octet-stream" || mimeType == "text/plain" || mimeType == "application/zip" {
+		if byName := mimeTypeByFileName(fileName); byName != "application/octet-stream" && sameMimeFamily(mimeType, byName) {
+			return byName, nil
+		}
+	}
+	// 容器格式：音频文件（如 opus、m4a）按扩展名识别为音频
+	if audioType, ok := audioContainerExtensions[strings.ToLower(path.Ext(fileName))]; ok && contentMatchesMimeType(mimeType, audioType) {
+		return audioType, nil
+	}
+	return mimeType, nil
+}
+
+// sniffObject 读取存储中对象的前 512 字节识别类型
+func (s *FileService) sniffObject(ctx context.Context, key string) (string, error) {
+	body, err := s.store.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	header := make([]byte, 512)
+	n, err := io.ReadFull(body, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	return normalizeMimeType(http.DetectContentType(header[:n])), nil
+}
+
+// contentMatchesMimeType 内容识别结果与申请的类型是否兼容
+// 内容识别只能区分少数格式：无法识别的内容按类型族判断，能识别的内容（如 HTML、脚本）必须与申请的类型一致
+func contentMatchesMimeType(detected, declared string) bool {
+	if detected == declared || declared == "application/octet-stream" {
+		return true
+	}
+	switch detected {
+	case "application/octet-stream", "text/plain", "application/zip":
+		return sameMimeFamily(detected, declared)
+	case "application/ogg", "video/mp4", "video/webm":
+		// 容器格式：同一容器可以是音频或视频（如 m4a、opus）
+		return strings.HasPrefix(declared, "audio/") || strings.HasPrefix(declared, "video/")
+	}
+	// 图片、音视频的具体格式可以不同，但大类必须一致
+	for _, prefix := range []string{"image/", "video/", "audio/"} {
+		if strings.HasPrefix(detected, prefix) {
+			return strings.HasPrefix(declared, prefix) && !blockedMimeTypes[declared]
+		}
+	}
+	return false
+}
+
+// sameMimeFamily 内容识别结果与扩展名推断结果是否兼容（避免把可执行内容伪装成其他类型）
+func sameMimeFamily(detected, byName string) bool {
+	switch detected {
+	case "text/plain":
+		return strings.HasPrefix(byName, "text/") || byName == "application/json"
+	case "application/zip":
+		// docx/xlsx/pptx 本质上是 zip
+		return strings.HasPrefix(byName, "application/vnd.openxmlformats-officedocument.")
+	default:
+		return true
+	}
+}
+
+// mimeTypeByFileName 根据扩展名推断文件类型
+func mimeTypeByFileName(fileName string) string {
+	if mimeType := normalizeMimeType(mime.TypeByExtension(path.Ext(fileName))); mimeType != "" {
+		return mimeType
+	}
+	return "application/octet-stream"
+}
+
+// normalizeMimeType 去掉参数（如 charset）并转小写
+func normalizeMimeType(mimeType string) string {
+	if idx := strings.Index(mimeType, ";"); idx >= 0 {
+		mimeType = mimeType[:idx]
+	}
+	return strings.ToLower(strings.TrimSpace(mimeType))
+}
+
+func isAllowedMimeType(mimeType string) bool {
+	if blockedMimeTypes[mimeType] {
+		return false
+	}
+	for _, allowed := range allowedMimeTypes {
+		if strings.HasSuffix(allowed, "/") || strings.HasSuffix(allowed, ".") || strings.HasSuffix(allowed, "-") {
+			if strings.HasPrefix(mimeType, allowed) {
+				return true
+			}
+		} else if mimeType == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// applyUploadedFile 消息引用已上传的文件（metadata.file_id）时，用文件的实际信息覆盖客户端提交的文件名、类型和大小
+// 返回引用的文件（未引用文件时为 nil）
+func (s *MessageService) applyUploadedFile(senderID uuid.UUID, req *SendMessageRequest) (*model.UploadedFile, error) {
+	fileIDValue, _ := req.Metadata["file_id"].(string)
+	if fileIDValue == "" {
+		if req.MessageType == "file" || req.MessageType == "voice" {
+			return nil, invalidError("file_id is required for %s messages", req.MessageType)
+		}
+		return nil, nil
+	}
+	fileID, err := uuid.Parse(fileIDValue)
+	if err != nil {
+		return nil, invalidError("invalid file_id")
+	}
+
+	// 只能发送自己上传的文件；转发时文件来自已校验的源消息
+	query := s.db.Where("id = ? AND status = ?", fileID, "uploaded")
+	if !req.forwarded {
+		query = query.Where("uploader_id = ?", senderID)
+	}
+	var file model.UploadedFile
+	if err := query.First(&file).Error; err != nil {
+		return nil, notFoundError("file not found")
+	}
+
+	switch req.MessageType {
+	case "image", "video":
+		if !strings.HasPrefix(file.MimeType, req.MessageType+"/") {
+			return nil, invalidError("file type does not match message type")
+		}
+	case "voice":
+		if !strings.HasPrefix(file.MimeType, "audio/") {
+			return nil, invalidError("file type does not match message type")
+		}
+	}
+	if req.MessageType == "video" {
+		fileSizeMB := float64(file.Size) / (1024 * 1024)
+		if fileSizeMB > float64(s.maxVideoSizeMB) {
+			return nil, invalidError("video file size exceeds limit: max %dMB, got %.2fMB", s.maxVideoSizeMB, fileSizeMB)
+		}
+	}
+
+	req.Metadata["file_name"] = file.FileName
+	req.Metadata["mime_type"] = file.MimeType
+	req.Metadata["file_size"] = file.Size
+	req.Metadata["url"] = file.URL
+	switch req.MessageType {
+	case "image":
+		req.Metadata["image_url"] = file.URL
+		// 图片已处理完成时直接使用服务端解析的宽高和缩略图
+		if file.Width > 0 {
+			req.Metadata["width"] = file.Width
+			req.Metadata["height"] = file.Height
+			req.Metadata["thumbnail_url"] = file.ThumbnailURL
+		}
+	case "video":
+		req.Metadata["video_url"] = file.URL
+	case "voice":
+		req.Metadata["audio_url"] = file.URL
+	}
+	return &file, nil
+}
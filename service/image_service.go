@@ -0,0 +1,356 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	_ "image/gif" // 注册 GIF 解码器
+	_ "image/png" // 注册 PNG 解码器
+
+	"dinq_message/model"
+	"dinq_message/storage"
+	"dinq_message/utils"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// thumbnailMaxSide 缩略图最长边（像素）
+	thumbnailMaxSide = 320
+	// thumbnailQuality 缩略图 JPEG 质量
+	thumbnailQuality = 80
+	// maxImagePixels 允许解码的最大像素数（防止解压炸弹）
+	maxImagePixels = 50_000_000
+	// remoteImageTimeout 下载外部图片的超时时间
+	remoteImageTimeout = 15 * time.Second
+	// maxConcurrentImageJobs 同时处理的图片数（每个任务需要保存原文件和解码后的图片，限制并发以控制内存）
+	maxConcurrentImageJobs = 2
+)
+
+// ImageService 图片处理服务：解析宽高并生成缩略图（异步执行，完成后推送 message_updated 事件）
+type ImageService struct {
+	db         *gorm.DB
+	store      storage.Storage
+	maxBytes   int64
+	httpClient *http.Client
+	notifier   MessageUpdateNotifier
+	jobs       chan struct{} // 并发处理的信号量
+}
+
+// MessageUpdateNotifier 接口用于推送消息内容更新
+type MessageUpdateNotifier interface {
+	SendMessageUpdated(message *model.Message)
+}
+
+// imageInfo 图片解析结果
+type imageInfo struct {
+	Width        int
+	Height       int
+	FileSize     int64
+	ThumbnailURL string
+}
+
+func NewImageService(db *gorm.DB, store storage.Storage, maxBytes int64) *ImageService {
+	return &ImageService{
+		db:         db,
+		store:      store,
+		maxBytes:   maxBytes,
+		httpClient: utils.NewPublicHTTPClient(remoteImageTimeout),
+		jobs:       make(chan struct{}, maxConcurrentImageJobs),
+	}
+}
+
+// SetNotifier 设置消息更新推送器（用于依赖注入）
+func (s *ImageService) SetNotifier(notifier MessageUpdateNotifier) {
+	s.notifier = notifier
+}
+
+// acquire 等待处理名额（超过 maxConcurrentImageJobs 的任务排队），返回释放函数
+func (s *ImageService) acquire() func() {
+	s.jobs <- struct{}{}
+	return func() { <-s.jobs }
+}
+
+// ProcessFile 解析已上传图片的宽高并生成缩略图，结果保存到文件记录（已处理过的直接返回）
+func (s *ImageService) ProcessFile(fileID uuid.UUID) (*model.UploadedFile, error) {
+	defer s.acquire()()
+	return s.processFile(fileID)
+}
+
+// processFile 处理已上传的图片（调用方已取得处理名额）
+func (s *ImageService) processFile(fileID uuid.UUID) (*model.UploadedFile, error) {
+	var file model.UploadedFile
+	if err := s.db.Where("id = ? AND status = ?", fileID, "uploaded").First(&file).Error; err != nil {
+		return nil, fmt.Errorf("file not found")
+	}
+	if file.Width > 0 {
+		return &file, nil
+	}
+	if !strings.HasPrefix(file.MimeType, "image/") {
+		return nil, fmt.Errorf("file is not an image")
+	}
+
+	ctx := context.Background()
+	reader, err := s.store.Get(ctx, file.StorageKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	data, err := readLimited(reader, s.maxBytes)
+	reader.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := s.processImage(data, "thumbnails/"+file.StorageKey+".jpg")
+	if err != nil {
+		return nil, err
+	}
+
+	file.Width = info.Width
+	file.Height = info.Height
+	file.ThumbnailURL = info.ThumbnailURL
+	if err := s.db.Model(&model.UploadedFile{}).Where("id = ?", file.ID).Updates(map[string]interface{}{
+		"width":         info.Width,
+		"height":        info.Height,
+		"thumbnail_url": info.ThumbnailURL,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to save image info: %w", err)
+	}
+
+	return &file, nil
+}
+
+// ProcessMessage 为图片消息补充宽高、大小和缩略图，并推送 message_updated 事件
+// 图片来源：metadata.file_id（本服务上传的文件）或 metadata.image_url / content（外部链接）
+func (s *ImageService) ProcessMessage(message *model.Message) {
+	defer s.acquire()()
+
+	var metadata map[string]interface{}
+	if len(message.Metadata) > 0 {
+		json.Unmarshal(message.Metadata, &metadata)
+	}
+
+	var info *imageInfo
+	if fileIDValue, _ := metadata["file_id"].(string); fileIDValue != "" {
+		fileID, err := uuid.Parse(fileIDValue)
+		if err != nil {
+			return
+		}
+		file, err := s.processFile(fileID)
+		if err != nil {
+			log.Printf("[ERROR] Failed to process image file: message=%s, file=%s, error=%v", message.ID, fileID, err)
+			return
+		}
+		info = &imageInfo{
+			Width:        file.Width,
+			Height:       file.Height,
+			FileSize:     file.Size,
+			ThumbnailURL: file.ThumbnailURL,
+		}
+	} else {
+		imageURL, _ := metadata["image_url"].(string)
+		if imageURL == "" && message.Content != nil {
+			imageURL = *message.Content
+		}
+		data, err := s.fetchRemoteImage(imageURL)
+		if err != nil {
+			log.Printf("[ERROR] Failed to fetch image: message=%s, error=%v", message.ID, err)
+			return
+		}
+		info, err = s.processImage(data, fmt.Sprintf("thumbnails/messages/%s.jpg", message.ID))
+		if err != nil {
+			log.Printf("[ERROR] Failed to process image: message=%s, error=%v", message.ID, err)
+			return
+		}
+	}
+
+	updated, err := mergeMessageMetadata(s.db, message.ID, map[string]interface{}{
+		"width":         info.Width,
+		"height":        info.Height,
+		"file_size":     info.FileSize,
+		"thumbnail_url": info.ThumbnailURL,
+	})
+	if err != nil {
+		log.Printf("[ERROR] Failed to update image metadata: message=%s, error=%v", message.ID, err)
+		return
+	}
+	if updated == nil {
+		return // 消息已撤回或已删除
+	}
+
+	if s.notifier != nil {
+		s.notifier.SendMessageUpdated(updated)
+	}
+}
+
+// mergeMessageMetadata 将 patch 合并到消息的 metadata（已撤回或已删除的消息返回 nil）
+func mergeMessageMetadata(db *gorm.DB, messageID uuid.UUID, patch map[string]interface{}) (*model.Message, error) {
+	patchBytes, err := json.Marshal(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	var updated model.Message
+	if err := db.Raw(`
+		UPDATE messages
+		SET metadata = COALESCE(metadata, '{}'::jsonb) || ?::jsonb
+		WHERE id = ? AND is_recalled = FALSE
+		RETURNING *
+	`, string(patchBytes), messageID).Scan(&updated).Error; err != nil {
+		return nil, err
+	}
+	if updated.ID == uuid.Nil {
+		return nil, nil
+	}
+	return &updated, nil
+}
+
+// processImage 解码图片获取宽高，生成 JPEG 缩略图并上传
+func (s *ImageService) processImage(data []byte, thumbnailKey string) (*imageInfo, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("unsupported image format: %w", err)
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxImagePixels {
+		return nil, fmt.Errorf("image dimensions are not allowed: %dx%d", config.Width, config.Height)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, resizeImage(img, thumbnailMaxSide), &jpeg.Options{Quality: thumbnailQuality}); err != nil {
+		return nil, fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+	if err := s.store.Put(context.Background(), thumbnailKey, &buf, int64(buf.Len()), "image/jpeg"); err != nil {
+		return nil, fmt.Errorf("failed to upload thumbnail: %w", err)
+	}
+
+	return &imageInfo{
+		Width:        config.Width,
+		Height:       config.Height,
+		FileSize:     int64(len(data)),
+		ThumbnailURL: s.store.URL(thumbnailKey),
+	}, nil
+}
+
+// fetchRemoteImage 下载外部图片（只允许 http/https 公网地址，大小不超过上传限制）
+func (s *ImageService) fetchRemoteImage(rawURL string) ([]byte, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid image url")
+	}
+
+	resp, err := s.httpClient.Get(parsed.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return readLimited(resp.Body, s.maxBytes)
+}
+
+// readLimited 读取全部内容，超过 maxBytes 时返回错误
+func readLimited(reader io.Reader, maxBytes int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(reader, maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, fmt.Errorf("image is too large")
+	}
+	return data, nil
+}
+
+// resizeImage 等比缩小到最长边不超过 maxSide（区域平均采样，透明部分以白色为背景）
+// 直接从解码结果采样生成缩略图，不复制全尺寸的图片
+func resizeImage(src image.Image, maxSide int) image.Image {
+	bounds := src.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+
+	dstW, dstH := srcW, srcH
+	if srcW > maxSide || srcH > maxSide {
+		if srcW > srcH {
+			dstW, dstH = maxSide, max(1, srcH*maxSide/srcW)
+		} else {
+			dstW, dstH = max(1, srcW*maxSide/srcH), maxSide
+		}
+	}
+
+	sample := pixelSampler(src)
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := 0; y < dstH; y++ {
+		y0, y1 := y*srcH/dstH, max((y+1)*srcH/dstH, y*srcH/dstH+1)
+		for x := 0; x < dstW; x++ {
+			x0, x1 := x*srcW/dstW, max((x+1)*srcW/dstW, x*srcW/dstW+1)
+
+			var r, g, b, count uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb := sample(bounds.Min.X+sx, bounds.Min.Y+sy)
+					r += uint64(pr)
+					g += uint64(pg)
+					b += uint64(pb)
+					count++
+				}
+			}
+
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8(r / count)
+			dst.Pix[i+1] = uint8(g / count)
+			dst.Pix[i+2] = uint8(b / count)
+			dst.Pix[i+3] = 0xff
+		}
+	}
+	return dst
+}
+
+// pixelSampler 返回读取单个像素（叠加到白色背景）的函数，常见的解码结果直接读取像素数据
+func pixelSampler(src image.Image) func(x, y int) (r, g, b uint8) {
+	switch img := src.(type) {
+	case *image.YCbCr: // JPEG
+		return func(x, y int) (uint8, uint8, uint8) {
+			return color.YCbCrToRGB(img.Y[img.YOffset(x, y)], img.Cb[img.COffset(x, y)], img.Cr[img.COffset(x, y)])
+		}
+	case *image.NRGBA: // PNG（带透明度）
+		return func(x, y int) (uint8, uint8, uint8) {
+			p := img.Pix[img.PixOffset(x, y):]
+			a := uint32(p[3])
+			over := func(c uint8) uint8 { return uint8((uint32(c)*a + 0xff*(0xff-a)) / 0xff) }
+			return over(p[0]), over(p[1]), over(p[2])
+		}
+	case *image.RGBA: // 预乘透明度
+		return func(x, y int) (uint8, uint8, uint8) {
+			p := img.Pix[img.PixOffset(x, y):]
+			white := 0xff - p[3]
+			return p[0] + white, p[1] + white, p[2] + white
+		}
+	case *image.Gray:
+		return func(x, y int) (uint8, uint8, uint8) {
+			v := img.Pix[img.PixOffset(x, y)]
+			return v, v, v
+		}
+	}
+	return func(x, y int) (uint8, uint8, uint8) {
+		r, g, b, a := src.At(x, y).RGBA() // 16 位预乘透明度
+		white := 0xffff - a
+		return uint8((r + white) >> 8), uint8((g + white) >> 8), uint8((b + white) >> 8)
+	}
+}
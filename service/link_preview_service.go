@@ -0,0 +1,196 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"dinq_message/linkpreview"
+	"dinq_message/model"
+	"dinq_message/utils"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+const (
+	// linkPreviewCacheTTL 链接预览缓存时间
+	linkPreviewCacheTTL = 24 * time.Hour
+	// linkPreviewFailureTTL 抓取失败或页面没有预览信息时的缓存时间（避免反复抓取）
+	linkPreviewFailureTTL = time.Hour
+	// linkPreviewFetchTimeout 单次抓取的超时时间
+	linkPreviewFetchTimeout = 10 * time.Second
+	// maxLinkURLLength 允许预览的最大链接长度
+	maxLinkURLLength = 2048
+)
+
+// linkURLPattern 文本中的 http/https 链接
+var linkURLPattern = regexp.MustCompile(`(?i)https?://[^\s<>"'` + "`" + `]+`)
+
+// LinkPreviewService 链接预览服务：识别文本消息中的链接，异步抓取 Open Graph 信息并推送 message_updated 事件
+type LinkPreviewService struct {
+	db       *gorm.DB
+	rdb      *redis.Client
+	sysSvc   *SystemSettingsService
+	fetcher  linkpreview.Fetcher
+	notifier MessageUpdateNotifier
+}
+
+func NewLinkPreviewService(db *gorm.DB, rdb *redis.Client, sysSvc *SystemSettingsService, fetcher linkpreview.Fetcher) *LinkPreviewService {
+	return &LinkPreviewService{
+		db:      db,
+		rdb:     rdb,
+		sysSvc:  sysSvc,
+		fetcher: fetcher,
+	}
+}
+
+// SetNotifier 设置消息更新推送器（用于依赖注入）
+func (s *LinkPreviewService) SetNotifier(notifier MessageUpdateNotifier) {
+	s.notifier = notifier
+}
+
+// FindPreviewURL 返回文本中第一个允许预览的链接（功能关闭或没有可预览的链接时返回空字符串）
+func (s *LinkPreviewService) FindPreviewURL(content string) string {
+	if !s.sysSvc.IsFeatureEnabled("enable_link_preview") {
+		return ""
+	}
+
+	allowed := s.sysSvc.GetListSetting("link_preview_allowed_domains")
+	blocked := s.sysSvc.GetListSetting("link_preview_blocked_domains")
+	for _, match := range linkURLPattern.FindAllString(content, -1) {
+		rawURL := strings.TrimRight(match, ".,;:!?)]}>，。；：！？）】")
+		if len(rawURL) > maxLinkURLLength {
+			continue
+		}
+		parsed, err := url.Parse(rawURL)
+		if err != nil || parsed.Hostname() == "" {
+			continue
+		}
+		if !domainAllowed(parsed.Hostname(), allowed, blocked) {
+			continue
+		}
+		return rawURL
+	}
+	return ""
+}
+
+// ProcessMessage 抓取链接预览并写入消息的 metadata.link_preview，然后推送 message_updated 事件
+func (s *LinkPreviewService) ProcessMessage(message *model.Message, rawURL string) {
+	preview := s.getPreview(rawURL)
+	if preview.IsEmpty() {
+		return
+	}
+
+	updated, err := s.saveLinkPreview(message, preview)
+	if err != nil {
+		log.Printf("[ERROR] Failed to update link preview: message=%s, error=%v", message.ID, err)
+		return
+	}
+	if updated == nil {
+		return // 消息已撤回、已删除或内容已被编辑
+	}
+
+	if s.notifier != nil {
+		s.notifier.SendMessageUpdated(updated)
+	}
+}
+
+// saveLinkPreview 写入 metadata.link_preview：只在消息内容仍然是抓取时的内容时写入，
+// 避免编辑前开始的抓取覆盖编辑后的预览（消息已撤回、已删除或已编辑时返回 nil）
+func (s *LinkPreviewService) saveLinkPreview(message *model.Message, preview *linkpreview.Preview) (*model.Message, error) {
+	patch, err := json.Marshal(map[string]interface{}{"link_preview": preview})
+	if err != nil {
+		return nil, err
+	}
+
+	var updated model.Message
+	if err := s.db.Raw(`
+		UPDATE messages
+		SET metadata = COALESCE(metadata, '{}'::jsonb) || ?::jsonb
+		WHERE id = ? AND is_recalled = FALSE AND content IS NOT DISTINCT FROM ?
+		RETURNING *
+	`, string(patch), message.ID, message.Content).Scan(&updated).Error; err != nil {
+		return nil, err
+	}
+	if updated.ID == uuid.Nil {
+		return nil, nil
+	}
+	return &updated, nil
+}
+
+// getPreview 优先从 Redis 缓存读取预览（包括失败结果），未命中时抓取并缓存
+func (s *LinkPreviewService) getPreview(rawURL string) *linkpreview.Preview {
+	ctx := context.Background()
+	cacheKey := linkPreviewCacheKey(rawURL)
+
+	if cached, err := s.rdb.Get(ctx, cacheKey).Bytes(); err == nil {
+		var preview linkpreview.Preview
+		if json.Unmarshal(cached, &preview) == nil {
+			return &preview
+		}
+	}
+
+	fetchCtx, cancel := context.WithTimeout(ctx, linkPreviewFetchTimeout)
+	defer cancel()
+	fetchCtx = utils.WithRedirectCheck(fetchCtx, s.checkRedirect)
+
+	preview, err := s.fetcher.Fetch(fetchCtx, rawURL)
+	if err != nil {
+		log.Printf("[WARN] Failed to fetch link preview: url=%s, error=%v", rawURL, err)
+		preview = &linkpreview.Preview{URL: rawURL}
+	}
+	preview.URL = rawURL
+
+	ttl := linkPreviewCacheTTL
+	if preview.IsEmpty() {
+		ttl = linkPreviewFailureTTL
+	}
+	if data, err := json.Marshal(preview); err == nil {
+		s.rdb.Set(ctx, cacheKey, data, ttl)
+	}
+	return preview
+}
+
+// checkRedirect 重定向后的地址同样需要通过域名白名单/黑名单
+func (s *LinkPreviewService) checkRedirect(target *url.URL) error {
+	allowed := s.sysSvc.GetListSetting("link_preview_allowed_domains")
+	blocked := s.sysSvc.GetListSetting("link_preview_blocked_domains")
+	if !domainAllowed(target.Hostname(), allowed, blocked) {
+		return fmt.Errorf("redirect to %s is not allowed", target.Hostname())
+	}
+	return nil
+}
+
+// linkPreviewCacheKey 链接预览的缓存 key（对 URL 做哈希，避免 key 过长）
+func linkPreviewCacheKey(rawURL string) string {
+	sum := sha256.Sum256([]byte(rawURL))
+	return "link_preview:" + hex.EncodeToString(sum[:])
+}
+
+// domainAllowed 域名是否允许预览：不在黑名单中，且白名单为空或在白名单中
+func domainAllowed(host string, allowed, blocked []string) bool {
+	host = strings.ToLower(host)
+	if host == "" || matchDomain(host, blocked) {
+		return false
+	}
+	return len(allowed) == 0 || matchDomain(host, allowed)
+}
+
+// matchDomain 域名是否在列表中（列表中的域名同时匹配其子域名）
+func matchDomain(host string, domains []string) bool {
+	for _, domain := range domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,298 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"dinq_message/model"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// minLivePeriodSeconds 实时位置共享的最短时长（最长时长由系统配置 live_location_max_duration_seconds 控制）
+	minLivePeriodSeconds = 5
+	// 地点名称和地址的最大长度（字符数）
+	maxPlaceNameLength = 200
+	maxAddressLength   = 500
+)
+
+// LocationService 位置服务：处理实时位置共享的位置更新、停止和到期
+type LocationService struct {
+	db       *gorm.DB
+	notifier LiveLocationNotifier
+	stop     chan struct{}
+}
+
+// LiveLocationNotifier 接口用于推送实时位置事件
+type LiveLocationNotifier interface {
+	SendLiveLocationUpdated(location *model.LiveLocation)
+	SendLiveLocationStopped(location *model.LiveLocation, reason string)
+}
+
+func NewLocationService(db *gorm.DB) *LocationService {
+	return &LocationService{
+		db:   db,
+		stop: make(chan struct{}),
+	}
+}
+
+// SetNotifier 设置实时位置事件推送器（用于依赖注入）
+func (s *LocationService) SetNotifier(notifier LiveLocationNotifier) {
+	s.notifier = notifier
+}
+
+// LocationPoint 位置坐标（发送位置消息和上报实时位置共用）
+type LocationPoint struct {
+	Latitude  float64  `json:"latitude"`
+	Longitude float64  `json:"longitude"`
+	Accuracy  *float64 `json:"accuracy,omitempty"`
+	Heading   *float64 `json:"heading,omitempty"`
+}
+
+// validate 校验坐标范围
+func (p *LocationPoint) validate() error {
+	if math.IsNaN(p.Latitude) || p.Latitude < -90 || p.Latitude > 90 {
+		return invalidError("latitude must be between -90 and 90")
+	}
+	if math.IsNaN(p.Longitude) || p.Longitude < -180 || p.Longitude > 180 {
+		return invalidError("longitude must be between -180 and 180")
+	}
+	if p.Accuracy != nil && (math.IsNaN(*p.Accuracy) || *p.Accuracy < 0) {
+		return invalidError("accuracy must be a non-negative number")
+	}
+	if p.Heading != nil && (math.IsNaN(*p.Heading) || *p.Heading < 0 || *p.Heading >= 360) {
+		return invalidError("heading must be between 0 and 360")
+	}
+	return nil
+}
+
+// prepareLocationMessage 校验位置消息的 metadata（坐标、地点名称、实时共享时长），返回起始位置和实时共享时长（秒，0 表示静态位置）
+func prepareLocationMessage(req *SendMessageRequest, maxLivePeriod int) (*LocationPoint, int, error) {
+	if req.Metadata == nil {
+		return nil, 0, invalidError("metadata is required for location messages")
+	}
+
+	latitude, latOK := req.Metadata["latitude"].(float64)
+	longitude, lngOK := req.Metadata["longitude"].(float64)
+	if !latOK || !lngOK {
+		return nil, 0, invalidError("latitude and longitude are required for location messages")
+	}
+	point := &LocationPoint{Latitude: latitude, Longitude: longitude}
+	if value, exists := req.Metadata["accuracy"]; exists && value != nil {
+		accuracy, ok := value.(float64)
+		if !ok {
+			return nil, 0, invalidError("accuracy must be a non-negative number")
+		}
+		point.Accuracy = &accuracy
+	}
+	if err := point.validate(); err != nil {
+		return nil, 0, err
+	}
+
+	for key, maxLength := range map[string]int{"place_name": maxPlaceNameLength, "address": maxAddressLength} {
+		value, exists := req.Metadata[key]
+		if !exists || value == nil {
+			continue
+		}
+		text, ok := value.(string)
+		if !ok {
+			return nil, 0, invalidError("%s must be a string", key)
+		}
+		text = strings.TrimSpace(text)
+		if utf8.RuneCountInString(text) > maxLength {
+			return nil, 0, invalidError("%s exceeds %d characters", key, maxLength)
+		}
+		req.Metadata[key] = text
+	}
+
+	livePeriod := 0
+	if value, exists := req.Metadata["live_period"]; exists && value != nil {
+		period, ok := value.(float64)
+		if !ok || period != math.Trunc(period) || period < minLivePeriodSeconds || period > float64(maxLivePeriod) {
+			return nil, 0, invalidError("live_period must be an integer between %d and %d seconds", minLivePeriodSeconds, maxLivePeriod)
+		}
+		livePeriod = int(period)
+	}
+
+	return point, livePeriod, nil
+}
+
+// createLiveLocation 在发送消息的事务中创建实时位置共享
+func createLiveLocation(tx *gorm.DB, message *model.Message, point *LocationPoint, livePeriod int) (*model.LiveLocation, error) {
+	location := &model.LiveLocation{
+		MessageID:      message.ID,
+		ConversationID: message.ConversationID,
+		UserID:         message.SenderID,
+		Latitude:       point.Latitude,
+		Longitude:      point.Longitude,
+		Accuracy:       point.Accuracy,
+		UpdatedAt:      message.CreatedAt,
+		ExpiresAt:      message.CreatedAt.Add(time.Duration(livePeriod) * time.Second),
+		IsActive:       true,
+	}
+	if err := tx.Create(location).Error; err != nil {
+		return nil, fmt.Errorf("failed to save live location: %w", err)
+	}
+	return location, nil
+}
+
+// UpdateLiveLocation 上报实时位置（仅发送者，共享结束后不能再更新）
+func (s *LocationService) UpdateLiveLocation(userID, messageID uuid.UUID, point *LocationPoint) (*model.LiveLocation, error) {
+	if err := point.validate(); err != nil {
+		return nil, err
+	}
+
+	location, err := s.getOwnLiveLocation(userID, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 条件更新：并发的停止或到期处理之后不会再写入位置
+	var updated []model.LiveLocation
+	if err := s.db.Model(&updated).
+		Clauses(clause.Returning{}).
+		Where("message_id = ? AND stopped_at IS NULL AND expires_at > NOW()", location.MessageID).
+		Updates(map[string]interface{}{
+			"latitude":   point.Latitude,
+			"longitude":  point.Longitude,
+			"accuracy":   point.Accuracy,
+			"heading":    point.Heading,
+			"updated_at": time.Now(),
+		}).Error; err != nil {
+		return nil, fmt.Errorf("failed to update live location: %w", err)
+	}
+	if len(updated) == 0 {
+		return nil, invalidError("live location has ended")
+	}
+
+	updated[0].IsActive = true
+	return &updated[0], nil
+}
+
+// StopLiveLocation 停止实时位置共享（仅发送者）
+func (s *LocationService) StopLiveLocation(userID, messageID uuid.UUID) (*model.LiveLocation, error) {
+	location, err := s.getOwnLiveLocation(userID, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	var stopped []model.LiveLocation
+	if err := s.db.Model(&stopped).
+		Clauses(clause.Returning{}).
+		Where("message_id = ? AND stopped_at IS NULL AND expires_at > NOW()", location.MessageID).
+		Update("stopped_at", time.Now()).Error; err != nil {
+		return nil, fmt.Errorf("failed to stop live location: %w", err)
+	}
+	if len(stopped) == 0 {
+		return nil, invalidError("live location has ended")
+	}
+
+	return &stopped[0], nil
+}
+
+// getOwnLiveLocation 查询实时位置共享并检查是否为发送者
+func (s *LocationService) getOwnLiveLocation(userID, messageID uuid.UUID) (*model.LiveLocation, error) {
+	var location model.LiveLocation
+	if err := s.db.Where("message_id = ?", messageID).First(&location).Error; err != nil {
+		return nil, notFoundError("live location not found")
+	}
+	if location.UserID != userID {
+		return nil, forbiddenError("only the sender can update a live location")
+	}
+	return &location, nil
+}
+
+// StartSweeper 启动后台任务，定期结束已到期的实时位置共享
+func (s *LocationService) StartSweeper(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		log.Printf("[INFO] Live location sweeper started (interval=%s)", interval)
+
+		for {
+			select {
+			case <-s.stop:
+				log.Printf("[INFO] Live location sweeper stopped")
+				return
+			case <-ticker.C:
+				s.SweepExpired()
+			}
+		}
+	}()
+}
+
+// StopSweeper 停止后台任务
+func (s *LocationService) StopSweeper() {
+	close(s.stop)
+}
+
+// SweepExpired 结束所有已到期的实时位置共享并推送 live_location_stopped 事件
+// 多 Pod 同时执行是安全的：每条共享只会被一个 UPDATE 结束并返回，事件也只会推送一次
+func (s *LocationService) SweepExpired() {
+	var expired []model.LiveLocation
+	if err := s.db.Raw(`
+		UPDATE live_locations
+		SET stopped_at = expires_at
+		WHERE message_id IN (
+			SELECT message_id FROM live_locations
+			WHERE stopped_at IS NULL AND expires_at <= NOW()
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *
+	`).Scan(&expired).Error; err != nil {
+		log.Printf("[ERROR] Failed to expire live locations: %v", err)
+		return
+	}
+
+	if s.notifier == nil {
+		return
+	}
+	for i := range expired {
+		s.notifier.SendLiveLocationStopped(&expired[i], "expired")
+	}
+}
+
+// loadLiveLocations 批量查询实时位置共享状态
+func loadLiveLocations(db *gorm.DB, messageIDs []uuid.UUID) (map[uuid.UUID]*model.LiveLocation, error) {
+	result := make(map[uuid.UUID]*model.LiveLocation)
+	if len(messageIDs) == 0 {
+		return result, nil
+	}
+
+	var locations []model.LiveLocation
+	if err := db.Where("message_id IN ?", messageIDs).Find(&locations).Error; err != nil {
+		return nil, fmt.Errorf("failed to query live locations: %w", err)
+	}
+	now := time.Now()
+	for i := range locations {
+		locations[i].IsActive = locations[i].StoppedAt == nil && locations[i].ExpiresAt.After(now)
+		result[locations[i].MessageID] = &locations[i]
+	}
+	return result, nil
+}
+
+// attachLiveLocations 为消息列表中的位置消息补充实时共享状态
+func attachLiveLocations(db *gorm.DB, messages []model.Message) error {
+	var locationMessageIDs []uuid.UUID
+	for _, msg := range messages {
+		if msg.MessageType == "location" {
+			locationMessageIDs = append(locationMessageIDs, msg.ID)
+		}
+	}
+	locationMap, err := loadLiveLocations(db, locationMessageIDs)
+	if err != nil {
+		return err
+	}
+	for i := range messages {
+		messages[i].LiveLocation = locationMap[messages[i].ID]
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"dinq_message/model"
+
+	"github.com/google/uuid"
+)
+
+// mentionPattern 匹配 @<user_id> 和 @all
+var mentionPattern = regexp.MustCompile(`@(all\b|[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12})`)
+
+// parseMentions 从消息内容中解析被@的用户ID（去重）以及是否@all
+func parseMentions(content string) ([]uuid.UUID, bool) {
+	var (
+		userIDs    []uuid.UUID
+		mentionAll bool
+		seen       = make(map[uuid.UUID]bool)
+	)
+	for _, match := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		if strings.EqualFold(match[1], "all") {
+			mentionAll = true
+			continue
+		}
+		userID, err := uuid.Parse(match[1])
+		if err != nil || seen[userID] {
+			continue
+		}
+		seen[userID] = true
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs, mentionAll
+}
+
+// resolveMentions 解析群聊文本消息中的@提及，返回被提及的会话成员（不含发送者）
+// @all 仅允许群主/管理员使用；非成员的@会被忽略
+func (s *MessageService) resolveMentions(conversationID, senderID uuid.UUID, content string) ([]uuid.UUID, bool, error) {
+	userIDs, mentionAll := parseMentions(content)
+	if len(userIDs) == 0 && !mentionAll {
+		return nil, false, nil
+	}
+
+	var conversation model.Conversation
+	if err := s.db.Where("id = ?", conversationID).First(&conversation).Error; err != nil {
+		return nil, false, notFoundError("conversation not found")
+	}
+	if conversation.ConversationType != "group" {
+		return nil, false, nil
+	}
+
+	var members []model.ConversationMember
+	if err := s.db.Where("conversation_id = ? AND left_at IS NULL", conversationID).
+		Find(&members).Error; err != nil {
+		return nil, false, fmt.Errorf("failed to get conversation members: %w", err)
+	}
+
+	memberSet := make(map[uuid.UUID]bool, len(members))
+	var senderRole string
+	for _, member := range members {
+		memberSet[member.UserID] = true
+		if member.UserID == senderID {
+			senderRole = member.Role
+		}
+	}
+
+	var mentioned []uuid.UUID
+	if mentionAll {
+		if senderRole != "owner" && senderRole != "admin" {
+			return nil, false, forbiddenError("only group owner or admin can mention all")
+		}
+		for _, member := range members {
+			if member.UserID != senderID {
+				mentioned = append(mentioned, member.UserID)
+			}
+		}
+		return mentioned, true, nil
+	}
+
+	for _, userID := range userIDs {
+		if userID != senderID && memberSet[userID] {
+			mentioned = append(mentioned, userID)
+		}
+	}
+	return mentioned, false, nil
+}
+
+// notifyMentions 给被@的用户发送 mention 通知（不受会话免打扰影响）
+func (s *MessageService) notifyMentions(message *model.Message, mentionedUserIDs []uuid.UUID) {
+	if s.notifSvc == nil || len(mentionedUserIDs) == 0 {
+		return
+	}
+
+	groupName := ""
+	var conversation model.Conversation
+	if err := s.db.Where("id = ?", message.ConversationID).First(&conversation).Error; err == nil && conversation.GroupName != nil {
+		groupName = *conversation.GroupName
+	}
+
+	senderName := "Someone"
+	if userData, ok := fetchUserDataFromAgent(s.agentURL, []string{message.SenderID.String()})[message.SenderID.String()]; ok && userData.Name != "" {
+		senderName = userData.Name
+	}
+
+	content := ""
+	if preview := buildMessagePreview(message.MessageType, message.Content, message.PlainText); preview != nil {
+		content = *preview
+	}
+
+	templateVars := map[string]string{
+		"sender_name": senderName,
+		"group_name":  groupName,
+		"content":     content,
+	}
+	metadata := map[string]interface{}{
+		"conversation_id": message.ConversationID,
+		"message_id":      message.ID,
+		"sender_id":       message.SenderID,
+	}
+
+	for _, userID := range mentionedUserIDs {
+		if _, err := s.notifSvc.CreateNotificationWithTemplate(userID, "mention", templateVars, metadata); err != nil {
+			log.Printf("[ERROR] Failed to send mention notification: user=%s, message=%s, error=%v", userID, message.ID, err)
+		}
+	}
+}
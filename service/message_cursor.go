@@ -0,0 +1,333 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"dinq_message/model"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// defaultMessagePageSize 默认每页消息数
+	defaultMessagePageSize = 50
+	// maxMessagePageSize 每页最多消息数
+	maxMessagePageSize = 200
+)
+
+// MessagePageQuery 消息分页参数
+// 消息按会话内序号 seq 排序：before/after 为消息ID，before_time/after_time 为时间，around 返回目标消息及其前后的消息，
+// after_seq/before_seq 返回序号范围内的消息（两者可以同时使用，用于补齐缺失的消息）；
+// 游标之间互斥，都为空时按 offset 分页（兼容旧客户端，新消息到达时可能重复或遗漏）
+type MessagePageQuery struct {
+	Limit      int
+	Offset     int
+	Before     *uuid.UUID
+	After      *uuid.UUID
+	Around     *uuid.UUID
+	BeforeTime *time.Time
+	AfterTime  *time.Time
+	AfterSeq   *int64
+	BeforeSeq  *int64
+}
+
+// MessagePage 分页结果（消息按时间正序，最新消息在最后）
+type MessagePage struct {
+	Messages      []model.Message
+	HasMoreBefore bool // 是否还有更早的消息（以第一条消息的ID作为 before 继续查询）
+	HasMoreAfter  bool // 是否还有更新的消息（以最后一条消息的ID作为 after 继续查询）
+}
+
+// messageCursor 分页位置（At 不为空时按时间比较，否则按序号比较）
+type messageCursor struct {
+	Seq int64
+	At  *time.Time
+}
+
+// normalize 校验游标互斥并修正 limit
+func (q *MessagePageQuery) normalize() error {
+	cursors := 0
+	seqRange := q.AfterSeq != nil || q.BeforeSeq != nil
+	for _, set := range []bool{q.Before != nil, q.After != nil, q.Around != nil, q.BeforeTime != nil, q.AfterTime != nil, seqRange} {
+		if set {
+			cursors++
+		}
+	}
+	if cursors > 1 {
+		return fmt.Errorf("only one of before, after, around, before_time, after_time and after_seq/before_seq can be used")
+	}
+	if q.AfterSeq != nil && *q.AfterSeq < 0 {
+		return fmt.Errorf("after_seq must be a non-negative integer")
+	}
+	if q.BeforeSeq != nil && *q.BeforeSeq < 1 {
+		return fmt.Errorf("before_seq must be a positive integer")
+	}
+	if q.AfterSeq != nil && q.BeforeSeq != nil && *q.AfterSeq >= *q.BeforeSeq {
+		return fmt.Errorf("after_seq must be less than before_seq")
+	}
+	if cursors == 1 && q.Offset > 0 {
+		return fmt.Errorf("offset cannot be combined with a cursor")
+	}
+	if q.Limit <= 0 {
+		q.Limit = defaultMessagePageSize
+	}
+	if q.Limit > maxMessagePageSize {
+		q.Limit = maxMessagePageSize
+	}
+	if q.Offset < 0 {
+		q.Offset = 0
+	}
+	return nil
+}
+
+// queryMessagePage 按分页参数查询会话中的消息（使用 idx_msg_conversation_seq 索引，每个方向多查一条用于判断是否还有更多）
+func queryMessagePage(db *gorm.DB, conversationID uuid.UUID, q *MessagePageQuery) (*MessagePage, error) {
+	if err := q.normalize(); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case q.Around != nil:
+		target, err := loadCursorMessage(db, conversationID, *q.Around)
+		if err != nil {
+			return nil, err
+		}
+		cursor := &messageCursor{Seq: target.Seq}
+		beforeLimit := (q.Limit - 1) / 2
+		older, hasMoreBefore, err := queryMessagesBefore(db, conversationID, cursor, beforeLimit)
+		if err != nil {
+			return nil, err
+		}
+		newer, hasMoreAfter, err := queryMessagesAfter(db, conversationID, cursor, q.Limit-1-beforeLimit)
+		if err != nil {
+			return nil, err
+		}
+		messages := append(older, *target)
+		return &MessagePage{Messages: append(messages, newer...), HasMoreBefore: hasMoreBefore, HasMoreAfter: hasMoreAfter}, nil
+
+	case q.Before != nil || q.BeforeTime != nil:
+		cursor, err := resolveCursor(db, conversationID, q.Before, q.BeforeTime)
+		if err != nil {
+			return nil, err
+		}
+		messages, hasMore, err := queryMessagesBefore(db, conversationID, cursor, q.Limit)
+		if err != nil {
+			return nil, err
+		}
+		hasMoreAfter, err := hasMessagesAfter(db, conversationID, lastCursor(messages, cursor))
+		if err != nil {
+			return nil, err
+		}
+		return &MessagePage{Messages: messages, HasMoreBefore: hasMore, HasMoreAfter: hasMoreAfter}, nil
+
+	case q.After != nil || q.AfterTime != nil:
+		cursor, err := resolveCursor(db, conversationID, q.After, q.AfterTime)
+		if err != nil {
+			return nil, err
+		}
+		messages, hasMore, err := queryMessagesAfter(db, conversationID, cursor, q.Limit)
+		if err != nil {
+			return nil, err
+		}
+		hasMoreBefore, err := hasMessagesBefore(db, conversationID, firstCursor(messages, cursor))
+		if err != nil {
+			return nil, err
+		}
+		return &MessagePage{Messages: messages, HasMoreBefore: hasMoreBefore, HasMoreAfter: hasMore}, nil
+
+	case q.AfterSeq != nil || q.BeforeSeq != nil:
+		return queryMessageSeqRange(db, conversationID, q)
+
+	default:
+		var messages []model.Message
+		if err := db.Where("conversation_id = ?", conversationID).
+			Order("seq DESC").
+			Limit(q.Limit + 1).
+			Offset(q.Offset).
+			Find(&messages).Error; err != nil {
+			return nil, fmt.Errorf("failed to query messages: %w", err)
+		}
+		hasMore := len(messages) > q.Limit
+		if hasMore {
+			messages = messages[:q.Limit]
+		}
+		reverseMessages(messages)
+		return &MessagePage{Messages: messages, HasMoreBefore: hasMore, HasMoreAfter: q.Offset > 0}, nil
+	}
+}
+
+// loadCursorMessage 查询作为游标的消息（必须属于该会话）
+func loadCursorMessage(db *gorm.DB, conversationID, messageID uuid.UUID) (*model.Message, error) {
+	var message model.Message
+	if err := db.Where("id = ? AND conversation_id = ?", messageID, conversationID).First(&message).Error; err != nil {
+		return nil, fmt.Errorf("cursor message not found")
+	}
+	return &message, nil
+}
+
+// resolveCursor 把消息ID或时间转换为分页位置
+func resolveCursor(db *gorm.DB, conversationID uuid.UUID, messageID *uuid.UUID, at *time.Time) (*messageCursor, error) {
+	if messageID == nil {
+		return &messageCursor{At: at}, nil
+	}
+	var seqs []int64
+	if err := db.Model(&model.Message{}).
+		Where("id = ? AND conversation_id = ?", *messageID, conversationID).
+		Limit(1).
+		Pluck("seq", &seqs).Error; err != nil {
+		return nil, fmt.Errorf("failed to query cursor message: %w", err)
+	}
+	if len(seqs) == 0 {
+		return nil, fmt.Errorf("cursor message not found")
+	}
+	return &messageCursor{Seq: seqs[0]}, nil
+}
+
+// queryMessageSeqRange 查询序号范围 (after_seq, before_seq) 内的消息：指定 after_seq 时从前往后取，否则取最靠近 before_seq 的 limit 条
+// 范围内的序号不一定连续：过期或被删除的消息不会再返回
+func queryMessageSeqRange(db *gorm.DB, conversationID uuid.UUID, q *MessagePageQuery) (*MessagePage, error) {
+	query := db.Where("conversation_id = ?", conversationID)
+	if q.AfterSeq != nil {
+		query = query.Where("seq > ?", *q.AfterSeq)
+	}
+	if q.BeforeSeq != nil {
+		query = query.Where("seq < ?", *q.BeforeSeq)
+	}
+	order := "seq DESC"
+	if q.AfterSeq != nil {
+		order = "seq ASC"
+	}
+
+	messages := []model.Message{}
+	if err := query.Order(order).Limit(q.Limit).Find(&messages).Error; err != nil {
+		return nil, fmt.Errorf("failed to query messages: %w", err)
+	}
+	if q.AfterSeq == nil {
+		reverseMessages(messages)
+	}
+
+	// 结果为空时以范围边界判断两侧是否还有消息
+	lower := &messageCursor{}
+	upper := &messageCursor{}
+	if q.AfterSeq != nil {
+		lower.Seq = *q.AfterSeq + 1
+		upper.Seq = *q.AfterSeq
+	}
+	if q.BeforeSeq != nil {
+		upper.Seq = *q.BeforeSeq - 1
+		if q.AfterSeq == nil {
+			lower.Seq = *q.BeforeSeq
+		}
+	}
+	hasMoreBefore, err := hasMessagesBefore(db, conversationID, firstCursor(messages, lower))
+	if err != nil {
+		return nil, err
+	}
+	hasMoreAfter, err := hasMessagesAfter(db, conversationID, lastCursor(messages, upper))
+	if err != nil {
+		return nil, err
+	}
+	return &MessagePage{Messages: messages, HasMoreBefore: hasMoreBefore, HasMoreAfter: hasMoreAfter}, nil
+}
+
+// queryMessagesBefore 查询游标之前的 limit 条消息（返回时间正序）
+func queryMessagesBefore(db *gorm.DB, conversationID uuid.UUID, cursor *messageCursor, limit int) ([]model.Message, bool, error) {
+	messages := []model.Message{}
+	if limit <= 0 {
+		hasMore, err := hasMessagesBefore(db, conversationID, cursor)
+		return messages, hasMore, err
+	}
+	if err := cursor.applyBefore(db.Where("conversation_id = ?", conversationID)).
+		Order("seq DESC").
+		Limit(limit + 1).
+		Find(&messages).Error; err != nil {
+		return nil, false, fmt.Errorf("failed to query messages: %w", err)
+	}
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+	reverseMessages(messages)
+	return messages, hasMore, nil
+}
+
+// queryMessagesAfter 查询游标之后的 limit 条消息（返回时间正序）
+func queryMessagesAfter(db *gorm.DB, conversationID uuid.UUID, cursor *messageCursor, limit int) ([]model.Message, bool, error) {
+	messages := []model.Message{}
+	if limit <= 0 {
+		hasMore, err := hasMessagesAfter(db, conversationID, cursor)
+		return messages, hasMore, err
+	}
+	if err := cursor.applyAfter(db.Where("conversation_id = ?", conversationID)).
+		Order("seq ASC").
+		Limit(limit + 1).
+		Find(&messages).Error; err != nil {
+		return nil, false, fmt.Errorf("failed to query messages: %w", err)
+	}
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+	return messages, hasMore, nil
+}
+
+// hasMessagesBefore 游标之前是否还有消息
+func hasMessagesBefore(db *gorm.DB, conversationID uuid.UUID, cursor *messageCursor) (bool, error) {
+	var ids []uuid.UUID
+	if err := cursor.applyBefore(db.Model(&model.Message{}).Where("conversation_id = ?", conversationID)).
+		Limit(1).
+		Pluck("id", &ids).Error; err != nil {
+		return false, fmt.Errorf("failed to query messages: %w", err)
+	}
+	return len(ids) > 0, nil
+}
+
+// hasMessagesAfter 游标之后是否还有消息
+func hasMessagesAfter(db *gorm.DB, conversationID uuid.UUID, cursor *messageCursor) (bool, error) {
+	var ids []uuid.UUID
+	if err := cursor.applyAfter(db.Model(&model.Message{}).Where("conversation_id = ?", conversationID)).
+		Limit(1).
+		Pluck("id", &ids).Error; err != nil {
+		return false, fmt.Errorf("failed to query messages: %w", err)
+	}
+	return len(ids) > 0, nil
+}
+
+func (c *messageCursor) applyBefore(query *gorm.DB) *gorm.DB {
+	if c.At != nil {
+		return query.Where("created_at < ?", *c.At)
+	}
+	return query.Where("seq < ?", c.Seq)
+}
+
+func (c *messageCursor) applyAfter(query *gorm.DB) *gorm.DB {
+	if c.At != nil {
+		return query.Where("created_at > ?", *c.At)
+	}
+	return query.Where("seq > ?", c.Seq)
+}
+
+// firstCursor 结果中第一条消息的位置（结果为空时使用查询游标）
+func firstCursor(messages []model.Message, fallback *messageCursor) *messageCursor {
+	if len(messages) == 0 {
+		return fallback
+	}
+	return &messageCursor{Seq: messages[0].Seq}
+}
+
+// lastCursor 结果中最后一条消息的位置（结果为空时使用查询游标）
+func lastCursor(messages []model.Message, fallback *messageCursor) *messageCursor {
+	if len(messages) == 0 {
+		return fallback
+	}
+	return &messageCursor{Seq: messages[len(messages)-1].Seq}
+}
+
+// reverseMessages 原地反转消息顺序
+func reverseMessages(messages []model.Message) {
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+}
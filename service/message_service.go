@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log"
+	"strings"
 	"time"
 
 	"dinq_message/model"
@@ -11,8 +13,21 @@ import (
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// 离线消息队列 offline_msg:<用户ID>：只保留最新的 OfflineQueueLimit 条，OfflineQueueTTL 内没有新消息则整个队列过期
+// （用户在线或使用同步协议时队列不会被拉取，长度上限避免活跃用户的队列无限增长）
+const (
+	OfflineQueueLimit = 1000
+	OfflineQueueTTL   = 7 * 24 * time.Hour
+)
+
+// OfflinePayloadKey 消息在离线队列中的内容（所有成员的队列存同一份内容），撤回和过期清理时按内容 LREM
+func OfflinePayloadKey(messageID uuid.UUID) string {
+	return "offline_payload:" + messageID.String()
+}
+
 type MessageService struct {
 	db             *gorm.DB
 	rdb            *redis.Client
@@ -22,6 +37,10 @@ type MessageService struct {
 	hubChecker     OnlineChecker              // Interface to check if user is online
 	unreadNotifier UnreadCountNotifier        // Interface to notify unread count changes
 	convNotifier   ConversationUpdateNotifier // Interface to notify conversation updates
+	imageSvc       *ImageService              // 图片处理（宽高、缩略图）
+	voiceSvc       *VoiceService              // 语音消息（时长、波形）
+	linkPreviewSvc *LinkPreviewService        // 链接预览
+	agentURL       string                     // agent 服务地址（查询用户信息）
 }
 
 // OnlineChecker 接口用于检查用户是否在线
@@ -46,6 +65,7 @@ func NewMessageService(db *gorm.DB, rdb *redis.Client, sysSvc *SystemSettingsSer
 		rdb:            rdb,
 		sysSvc:         sysSvc,
 		maxVideoSizeMB: 5, // 默认5MB
+		agentURL:       agentURLFromEnv(),
 	}
 }
 
@@ -55,6 +75,7 @@ func NewMessageServiceWithConfig(db *gorm.DB, rdb *redis.Client, sysSvc *SystemS
 		rdb:            rdb,
 		sysSvc:         sysSvc,
 		maxVideoSizeMB: maxVideoSizeMB,
+		agentURL:       agentURLFromEnv(),
 	}
 }
 
@@ -78,28 +99,116 @@ func (s *MessageService) SetConversationNotifier(notifier ConversationUpdateNoti
 	s.convNotifier = notifier
 }
 
+// SetImageService 设置图片处理服务（用于依赖注入）
+func (s *MessageService) SetImageService(imageSvc *ImageService) {
+	s.imageSvc = imageSvc
+}
+
+// SetVoiceService 设置语音消息服务（用于依赖注入）
+func (s *MessageService) SetVoiceService(voiceSvc *VoiceService) {
+	s.voiceSvc = voiceSvc
+}
+
+// SetLinkPreviewService 设置链接预览服务（用于依赖注入）
+func (s *MessageService) SetLinkPreviewService(linkPreviewSvc *LinkPreviewService) {
+	s.linkPreviewSvc = linkPreviewSvc
+}
+
 // GetDB 获取数据库连接（用于高级查询）
 func (s *MessageService) GetDB() *gorm.DB {
 	return s.db
 }
 
+// serverMetadataKeys 由服务端生成的 metadata 字段：客户端发送的值一律丢弃，避免伪造转发来源、@提及、链接预览等
+var serverMetadataKeys = []string{
+	"forwarded_from",
+	"reply_to_content",
+	"mentioned_user_ids",
+	"mention_all",
+	"link_preview",
+	"html",
+}
+
+// imageMetadataKeys 图片消息由服务端解析的 metadata 字段（上传文件的信息或异步处理的结果），客户端发送的值一律丢弃
+var imageMetadataKeys = []string{
+	"width",
+	"height",
+	"file_size",
+	"thumbnail_url",
+}
+
 // SendMessageRequest 发送消息请求
 type SendMessageRequest struct {
 	ConversationID   uuid.UUID              `json:"conversation_id"`
 	ReceiverID       *uuid.UUID             `json:"receiver_id,omitempty"` // 私聊时必须,群聊时不需要
-	MessageType      string                 `json:"message_type"`          // 'text' | 'image' | 'video' | 'emoji'
-	Content          *string                `json:"content,omitempty"`
+	MessageType      string                 `json:"message_type"`          // 'text' | 'rich_text' | 'image' | 'video' | 'emoji' | 'poll' | 'file' | 'voice' | 'location'
+	Content          *string                `json:"content,omitempty"`     // 投票消息为投票问题，富文本消息为 Markdown
 	Metadata         map[string]interface{} `json:"metadata,omitempty"`
 	ReplyToMessageID *uuid.UUID             `json:"reply_to_message_id,omitempty"`
+	Poll             *PollRequest           `json:"poll,omitempty"`          // 投票消息的选项和设置
+	ClientMsgID      *string                `json:"client_msg_id,omitempty"` // 客户端生成的消息ID（重试时使用同一ID，保证只创建一条消息）
+
+	forwarded bool // 内部使用：转发的消息，metadata 来自已校验的源消息
 }
 
 // SendMessage 发送消息
 func (s *MessageService) SendMessage(senderID uuid.UUID, req *SendMessageRequest) (*model.Message, error) {
 	ctx := context.Background()
 
-	// 0. 验证输入
+	// 0. 客户端消息ID去重：重试时直接返回第一次发送时创建的消息（在其他检查之前，避免首条消息限制等拒绝重试）
+	if err := normalizeClientMsgID(req); err != nil {
+		return nil, err
+	}
+	if req.ClientMsgID != nil {
+		existing, err := s.findClientMessage(senderID, req)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			return existing, nil
+		}
+	}
+
+	// 0.1 丢弃客户端提供的服务端字段（转发的 metadata 来自源消息，由 buildForwardMetadata 处理）
+	if !req.forwarded {
+		for _, key := range serverMetadataKeys {
+			delete(req.Metadata, key)
+		}
+		if req.MessageType == "image" {
+			for _, key := range imageMetadataKeys {
+				delete(req.Metadata, key)
+			}
+		}
+	}
+
+	// 0.2 验证输入
 	if req.MessageType == "text" && (req.Content == nil || *req.Content == "") {
-		return nil, fmt.Errorf("content is required for text messages")
+		return nil, invalidError("content is required for text messages")
+	}
+	// 富文本消息：解析并清理 Markdown，content 保存规范化的 Markdown，同时生成纯文本和 HTML
+	var plainText *string
+	if req.MessageType == "rich_text" {
+		if req.Content == nil || strings.TrimSpace(*req.Content) == "" {
+			return nil, invalidError("content is required for rich_text messages")
+		}
+		rendered, err := renderRichText(*req.Content)
+		if err != nil {
+			return nil, err
+		}
+		req.Content = &rendered.Markdown
+		plainText = &rendered.PlainText
+		if req.Metadata == nil {
+			req.Metadata = make(map[string]interface{})
+		}
+		req.Metadata["html"] = rendered.HTML
+	}
+	if req.MessageType == "poll" {
+		if req.Content == nil || strings.TrimSpace(*req.Content) == "" {
+			return nil, invalidError("content is required for poll messages")
+		}
+		if err := validatePollRequest(req.Poll); err != nil {
+			return nil, err
+		}
 	}
 
 	// 1. 如果没有 conversation_id,创建或查找私聊会话
@@ -115,13 +224,13 @@ func (s *MessageService) SendMessage(senderID uuid.UUID, req *SendMessageRequest
 	}
 
 	if conversationID == uuid.Nil {
-		return nil, fmt.Errorf("conversation_id is required")
+		return nil, invalidError("conversation_id is required")
 	}
 
 	// 2. 检查用户是否是会话成员
 	isMember, err := s.isConversationMember(conversationID, senderID)
 	if err != nil || !isMember {
-		return nil, fmt.Errorf("user is not a member of this conversation")
+		return nil, forbiddenError("user is not a member of this conversation")
 	}
 
 	// 3. 检查是否被拉黑
@@ -131,16 +240,94 @@ func (s *MessageService) SendMessage(senderID uuid.UUID, req *SendMessageRequest
 			return nil, err
 		}
 		if isBlocked {
-			return nil, fmt.Errorf("you are blocked by this user")
+			return nil, forbiddenError("you are blocked by this user")
 		}
 	}
 
-	// 4. 检查视频文件大小限制
-	if req.MessageType == "video" && req.Metadata != nil {
+	// 3.1 回复消息：校验回复目标，填充回复预览并确定所属话题（回复的回复归入同一话题）
+	var threadRootID *uuid.UUID
+	if req.ReplyToMessageID != nil {
+		target, err := s.getReplyTarget(conversationID, *req.ReplyToMessageID)
+		if err != nil {
+			return nil, err
+		}
+
+		rootID := target.ID
+		if target.ThreadRootID != nil {
+			rootID = *target.ThreadRootID
+		}
+		threadRootID = &rootID
+
+		if preview := buildMessagePreview(target.MessageType, target.Content, target.PlainText); preview != nil {
+			if req.Metadata == nil {
+				req.Metadata = make(map[string]interface{})
+			}
+			req.Metadata["reply_to_content"] = *preview
+		}
+	}
+
+	// 3.2 群聊文本消息：解析@提及（富文本消息按纯文本解析）
+	// 转发的内容是原作者写的，其中的@不是转发者的提及，不解析也不通知
+	var mentionedUserIDs []uuid.UUID
+	mentionSource := req.Content
+	if plainText != nil {
+		mentionSource = plainText
+	}
+	if (req.MessageType == "text" || req.MessageType == "rich_text") && mentionSource != nil && !req.forwarded {
+		var mentionAll bool
+		mentionedUserIDs, mentionAll, err = s.resolveMentions(conversationID, senderID, *mentionSource)
+		if err != nil {
+			return nil, err
+		}
+		if len(mentionedUserIDs) > 0 || mentionAll {
+			if req.Metadata == nil {
+				req.Metadata = make(map[string]interface{})
+			}
+			mentionedIDStrings := make([]string, len(mentionedUserIDs))
+			for i, userID := range mentionedUserIDs {
+				mentionedIDStrings[i] = userID.String()
+			}
+			req.Metadata["mentioned_user_ids"] = mentionedIDStrings
+			if mentionAll {
+				req.Metadata["mention_all"] = true
+			}
+		}
+	}
+	mentionedSet := make(map[uuid.UUID]bool, len(mentionedUserIDs))
+	for _, userID := range mentionedUserIDs {
+		mentionedSet[userID] = true
+	}
+
+	// 4. 引用已上传的文件：使用实际上传的文件信息（大小按实际字节数校验）
+	uploadedFile, err := s.applyUploadedFile(senderID, req)
+	if err != nil {
+		return nil, err
+	}
+	// 语音消息：按系统配置校验大小和时长，并由服务端生成波形摘要
+	if req.MessageType == "voice" {
+		if s.voiceSvc == nil {
+			return nil, invalidError("voice messages are not supported")
+		}
+		if err := s.voiceSvc.prepareVoiceMessage(req, uploadedFile); err != nil {
+			return nil, err
+		}
+	}
+	// 位置消息：校验坐标和地点信息，live_period > 0 时同时开始实时位置共享
+	var livePoint *LocationPoint
+	livePeriod := 0
+	if req.MessageType == "location" {
+		maxLivePeriod := s.sysSvc.GetIntSetting("live_location_max_duration_seconds", 28800)
+		livePoint, livePeriod, err = prepareLocationMessage(req, maxLivePeriod)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// 未上传到本服务的视频（外部链接）只能按客户端声明的大小检查；转发的视频已在原消息发送时检查
+	if req.MessageType == "video" && !req.forwarded && req.Metadata != nil && req.Metadata["file_id"] == nil {
 		if fileSize, ok := req.Metadata["file_size"].(float64); ok {
 			fileSizeMB := fileSize / (1024 * 1024)
 			if fileSizeMB > float64(s.maxVideoSizeMB) {
-				return nil, fmt.Errorf("video file size exceeds limit: max %dMB, got %.2fMB", s.maxVideoSizeMB, fileSizeMB)
+				return nil, invalidError("video file size exceeds limit: max %dMB, got %.2fMB", s.maxVideoSizeMB, fileSizeMB)
 			}
 		}
 	}
@@ -166,11 +353,11 @@ func (s *MessageService) SendMessage(senderID uuid.UUID, req *SendMessageRequest
 
 		// 在锁内进行检查
 		if !s.CheckCanSend(senderID, conversationID) {
-			return nil, fmt.Errorf("first message limit: wait for reply before sending more messages")
+			return nil, newError(ErrFirstMessageLimit, "first message limit: wait for reply before sending more messages")
 		}
 	} else if !conversationJustCreated && !s.CheckCanSend(senderID, conversationID) {
 		// 功能未启用但仍需检查的情况（向后兼容）
-		return nil, fmt.Errorf("first message limit: wait for reply before sending more messages")
+		return nil, newError(ErrFirstMessageLimit, "first message limit: wait for reply before sending more messages")
 	}
 
 	// 6. 创建消息对象
@@ -179,8 +366,11 @@ func (s *MessageService) SendMessage(senderID uuid.UUID, req *SendMessageRequest
 		SenderID:         senderID,
 		MessageType:      req.MessageType,
 		Content:          req.Content,
+		PlainText:        plainText,
 		Status:           "sent",
+		ClientMsgID:      req.ClientMsgID,
 		ReplyToMessageID: req.ReplyToMessageID,
+		ThreadRootID:     threadRootID,
 		IsRecalled:       false,
 	}
 
@@ -188,11 +378,18 @@ func (s *MessageService) SendMessage(senderID uuid.UUID, req *SendMessageRequest
 	if req.Metadata != nil {
 		metadataBytes, err := json.Marshal(req.Metadata)
 		if err != nil {
-			return nil, fmt.Errorf("invalid metadata: %w", err)
+			return nil, invalidError("invalid metadata: %w", err)
 		}
 		message.Metadata = metadataBytes
 	}
 
+	// 根据会话的消息保留时长设置过期时间（只影响之后发送的消息）
+	var conversation model.Conversation
+	if err := s.db.Select("message_ttl_seconds").Where("id = ?", conversationID).First(&conversation).Error; err == nil && conversation.MessageTTLSeconds > 0 {
+		expiresAt := time.Now().Add(time.Duration(conversation.MessageTTLSeconds) * time.Second)
+		message.ExpiresAt = &expiresAt
+	}
+
 	// 7. 提前查询会话成员并检查查看状态（避免在事务内检查，提高准确性）
 	var members []model.ConversationMember
 	if err := s.db.Where("conversation_id = ? AND user_id != ?", conversationID, senderID).
@@ -212,9 +409,54 @@ func (s *MessageService) SendMessage(senderID uuid.UUID, req *SendMessageRequest
 
 	// 8. 使用事务保证数据一致性
 	err = s.db.Transaction(func(tx *gorm.DB) error {
-		// 8.1 保存消息
-		if err := tx.Create(message).Error; err != nil {
-			return fmt.Errorf("failed to save message: %w", err)
+		// 8.1 分配会话内序号并保存消息
+		// 会话行锁一直持有到事务提交，同一会话的消息按序号顺序提交，created_at 也随序号递增
+		var seq int64
+		if err := tx.Raw("UPDATE conversations SET last_seq = last_seq + 1 WHERE id = ? RETURNING last_seq", conversationID).
+			Scan(&seq).Error; err != nil {
+			return fmt.Errorf("failed to allocate message seq: %w", err)
+		}
+		if seq == 0 {
+			return notFoundError("conversation not found")
+		}
+		message.Seq = seq
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(message)
+		if result.Error != nil {
+			return fmt.Errorf("failed to save message: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return errDuplicateClientMsgID // 同一客户端消息ID的并发重试已经保存
+		}
+
+		// 8.1.1 话题回复：更新根消息的回复数和最后回复时间，并将话题标记为发送者已读
+		if threadRootID != nil {
+			if err := tx.Model(&model.Message{}).Where("id = ?", *threadRootID).Updates(map[string]interface{}{
+				"thread_reply_count":   gorm.Expr("thread_reply_count + ?", 1),
+				"thread_last_reply_at": message.CreatedAt,
+			}).Error; err != nil {
+				return fmt.Errorf("failed to update thread root: %w", err)
+			}
+			if err := upsertThreadReadState(tx, *threadRootID, senderID, message.CreatedAt); err != nil {
+				return err
+			}
+		}
+
+		// 8.1.2 投票消息：保存投票和选项
+		if message.MessageType == "poll" {
+			poll, err := createPoll(tx, message.ID, req.Poll)
+			if err != nil {
+				return err
+			}
+			message.Poll = poll
+		}
+
+		// 8.1.3 实时位置消息：创建位置共享
+		if livePeriod > 0 {
+			location, err := createLiveLocation(tx, message, livePoint, livePeriod)
+			if err != nil {
+				return err
+			}
+			message.LiveLocation = location
 		}
 
 		// 8.2 更新会话的最后消息
@@ -237,9 +479,12 @@ func (s *MessageService) SendMessage(senderID uuid.UUID, req *SendMessageRequest
 			// 如果会话被隐藏，自动取消隐藏
 			updates["is_hidden"] = false
 
-			// 只有在用户不在该会话页面时才增加未读数
+			// 只有在用户不在该会话页面时才增加未读数（被@时同时增加未读提及数）
 			if !isViewing {
 				updates["unread_count"] = gorm.Expr("unread_count + ?", 1)
+				if mentionedSet[member.UserID] {
+					updates["unread_mention_count"] = gorm.Expr("unread_mention_count + ?", 1)
+				}
 			}
 
 			// 执行更新
@@ -253,39 +498,34 @@ func (s *MessageService) SendMessage(senderID uuid.UUID, req *SendMessageRequest
 		return nil
 	})
 
+	if err == errDuplicateClientMsgID {
+		existing, findErr := s.findClientMessage(senderID, req)
+		if findErr != nil {
+			return nil, findErr
+		}
+		if existing == nil {
+			return nil, fmt.Errorf("failed to save message: duplicate client_msg_id")
+		}
+		return existing, nil
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	// 9. 生成消息预览文本
-	var lastMessageText *string
-	if message.MessageType == "text" && message.Content != nil {
-		text := *message.Content
-		runes := []rune(text)
-		if len(runes) > 50 {
-			text = string(runes[:50]) + "..."
-		}
-		lastMessageText = &text
-	} else if message.MessageType == "image" {
-		text := "[图片]"
-		lastMessageText = &text
-	} else if message.MessageType == "video" {
-		text := "[视频]"
-		lastMessageText = &text
-	} else if message.MessageType == "emoji" {
-		text := "[表情]"
-		lastMessageText = &text
-	}
+	lastMessageText := buildMessagePreview(message.MessageType, message.Content, message.PlainText)
 
 	// 10. 将未读消息推送到 Redis（用于离线消息）并推送未读数量更新和会话更新
 	// 使用之前查询的 members 和 memberViewingStatus（避免重新查询数据库）
+	msgData, _ := json.Marshal(message)
+	s.rdb.Set(ctx, OfflinePayloadKey(message.ID), msgData, OfflineQueueTTL)
 	for _, member := range members {
-		// 推送到离线消息队列，设置7天过期时间
-		msgData, _ := json.Marshal(message)
+		// 推送到离线消息队列，只保留最新的 OfflineQueueLimit 条，设置7天过期时间
 		key := "offline_msg:" + member.UserID.String()
 		pipe := s.rdb.Pipeline()
 		pipe.RPush(ctx, key, msgData)
-		pipe.Expire(ctx, key, 7*24*time.Hour) // 7天过期
+		pipe.LTrim(ctx, key, -OfflineQueueLimit, -1)
+		pipe.Expire(ctx, key, OfflineQueueTTL) // 7天过期
 		pipe.Exec(ctx)
 
 		// 计算该成员的未读数（基于之前的快照状态）
@@ -310,27 +550,65 @@ func (s *MessageService) SendMessage(senderID uuid.UUID, req *SendMessageRequest
 		// 用户可以通过会话列表的未读数量来了解新消息
 	}
 
+	// 11. 被@的用户单独发送 mention 通知（异步，避免查询发送者信息阻塞消息发送）
+	if len(mentionedUserIDs) > 0 {
+		go s.notifyMentions(message, mentionedUserIDs)
+	}
+
+	// 12. 图片消息：异步解析宽高并生成缩略图，完成后推送 message_updated（引用的文件已处理完成时无需再处理）
+	if message.MessageType == "image" && s.imageSvc != nil && (uploadedFile == nil || uploadedFile.Width == 0) {
+		go s.imageSvc.ProcessMessage(message)
+	}
+
+	// 13. 文本消息中的链接：异步抓取预览，完成后推送 message_updated
+	s.startLinkPreview(message)
+
 	return message, nil
 }
 
-// RecallMessage 撤回消息（2分钟内）
-func (s *MessageService) RecallMessage(userID uuid.UUID, messageID uuid.UUID) error {
-	var message model.Message
-	if err := s.db.Where("id = ?", messageID).First(&message).Error; err != nil {
-		return fmt.Errorf("message not found")
+// startLinkPreview 文本消息中有可预览的链接时异步抓取预览（发送和编辑后调用）
+func (s *MessageService) startLinkPreview(message *model.Message) {
+	if (message.MessageType == "text" || message.MessageType == "rich_text") && message.Content != nil && s.linkPreviewSvc != nil {
+		if previewURL := s.linkPreviewSvc.FindPreviewURL(*message.Content); previewURL != "" {
+			go s.linkPreviewSvc.ProcessMessage(message, previewURL)
+		}
 	}
+}
 
-	// 检查是否是发送者
-	if message.SenderID != userID {
-		return fmt.Errorf("you can only recall your own messages")
+// RecallResult 撤回结果（撤回同时取消的置顶、结束的实时位置共享需要一并推送）
+type RecallResult struct {
+	Message         *model.Message      // 被撤回的消息
+	Unpinned        bool                // 撤回前消息处于置顶状态，已取消置顶
+	StoppedLocation *model.LiveLocation // 撤回时结束的实时位置共享（没有进行中的共享时为 nil）
+}
+
+// RecallMessage 撤回消息
+// 发送者可在配置的时间窗口内撤回自己的消息；群聊 owner/admin 可撤回其他成员的消息（不受时间限制）
+func (s *MessageService) RecallMessage(userID uuid.UUID, messageID uuid.UUID) (*RecallResult, error) {
+	var message model.Message
+	if err := s.db.Where("id = ?", messageID).First(&message).Error; err != nil {
+		return nil, notFoundError("message not found")
 	}
 
 	// 检查是否已撤回
 	if message.IsRecalled {
-		return fmt.Errorf("message already recalled")
+		return nil, conflictError("message already recalled")
 	}
 
-	// 检查是否超过2分钟（使用数据库原生计算，避免时区问题）
+	if message.SenderID != userID {
+		// 非发送者：检查是否是群管理员
+		canModerate, err := s.canModerateMessage(userID, &message)
+		if err != nil {
+			return nil, err
+		}
+		if !canModerate {
+			return nil, forbiddenError("you can only recall your own messages")
+		}
+		return s.recall(&message)
+	}
+
+	// 检查是否超过撤回时间窗口（使用数据库原生计算，避免时区问题）
+	recallWindow := s.sysSvc.GetIntSetting("recall_time_limit_seconds", 120)
 	var elapsedSeconds float64
 	err := s.db.Raw(`
 		SELECT EXTRACT(EPOCH FROM (NOW() - created_at))
@@ -339,39 +617,568 @@ func (s *MessageService) RecallMessage(userID uuid.UUID, messageID uuid.UUID) er
 	`, messageID).Scan(&elapsedSeconds).Error
 
 	if err != nil {
-		return fmt.Errorf("failed to calculate elapsed time: %w", err)
+		return nil, fmt.Errorf("failed to calculate elapsed time: %w", err)
+	}
+
+	if elapsedSeconds > float64(recallWindow) {
+		return nil, invalidError("can only recall messages within %d seconds (elapsed: %.0f seconds)", recallWindow, elapsedSeconds)
+	}
+
+	return s.recall(&message)
+}
+
+// AdminRecallMessage 超管撤回任意消息（内容审核，不受发送者和时间限制）
+func (s *MessageService) AdminRecallMessage(messageID uuid.UUID) (*RecallResult, error) {
+	var message model.Message
+	if err := s.db.Where("id = ?", messageID).First(&message).Error; err != nil {
+		return nil, notFoundError("message not found")
+	}
+
+	if message.IsRecalled {
+		return nil, conflictError("message already recalled")
+	}
+
+	return s.recall(&message)
+}
+
+// canModerateMessage 检查用户是否可以管理他人在群聊中的消息
+// owner 可管理所有成员的消息，admin 可管理除 owner 外的成员消息
+func (s *MessageService) canModerateMessage(userID uuid.UUID, message *model.Message) (bool, error) {
+	var conversation model.Conversation
+	if err := s.db.Where("id = ?", message.ConversationID).First(&conversation).Error; err != nil {
+		return false, notFoundError("conversation not found")
+	}
+	if conversation.ConversationType != "group" {
+		return false, nil
+	}
+
+	var operator model.ConversationMember
+	if err := s.db.Where("conversation_id = ? AND user_id = ? AND left_at IS NULL", message.ConversationID, userID).
+		First(&operator).Error; err != nil {
+		return false, nil
+	}
+
+	switch operator.Role {
+	case "owner":
+		return true, nil
+	case "admin":
+		var sender model.ConversationMember
+		if err := s.db.Where("conversation_id = ? AND user_id = ?", message.ConversationID, message.SenderID).
+			First(&sender).Error; err != nil {
+			return true, nil // 发送者已不在群中，admin 可以撤回
+		}
+		return sender.Role != "owner", nil
+	default:
+		return false, nil
+	}
+}
+
+// recall 标记消息为已撤回，取消置顶、结束实时位置共享，并清理离线队列和会话预览
+func (s *MessageService) recall(message *model.Message) (*RecallResult, error) {
+	now := time.Now()
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// 只更新未撤回的消息：并发撤回同一条消息时只有一个成功，其余不重复推送和清理
+		update := tx.Model(&model.Message{}).Where("id = ? AND is_recalled = ?", message.ID, false).Updates(map[string]interface{}{
+			"is_recalled": true,
+			"recalled_at": now,
+		})
+		if update.Error != nil {
+			return fmt.Errorf("failed to recall message: %w", update.Error)
+		}
+		if update.RowsAffected == 0 {
+			return conflictError("message already recalled")
+		}
+
+		// 撤回的话题回复不再计入根消息的回复数（与过期清理一致）
+		if message.ThreadRootID != nil {
+			if err := tx.Model(&model.Message{}).Where("id = ?", *message.ThreadRootID).
+				Update("thread_reply_count", gorm.Expr("GREATEST(thread_reply_count - 1, 0)")).Error; err != nil {
+				return fmt.Errorf("failed to update thread root: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	message.IsRecalled = true
+	message.RecalledAt = &now
+	result := &RecallResult{Message: message}
+
+	// 已撤回的消息不再保留置顶
+	unpin := s.db.Where("message_id = ?", message.ID).Delete(&model.PinnedMessage{})
+	if unpin.Error != nil {
+		log.Printf("[ERROR] Failed to unpin recalled message %s: %v", message.ID, unpin.Error)
+	}
+	result.Unpinned = unpin.RowsAffected > 0
+
+	// 撤回实时位置消息时结束位置共享
+	var stopped []model.LiveLocation
+	if err := s.db.Raw(`
+		UPDATE live_locations SET stopped_at = ?
+		WHERE message_id = ? AND stopped_at IS NULL
+		RETURNING *
+	`, now, message.ID).Scan(&stopped).Error; err != nil {
+		log.Printf("[ERROR] Failed to stop live location of recalled message %s: %v", message.ID, err)
+	}
+	if len(stopped) > 0 {
+		result.StoppedLocation = &stopped[0]
+	}
+
+	// 从离线消息队列中移除，避免离线用户上线后看到原始内容
+	s.removeFromOfflineQueues(message.ConversationID, []uuid.UUID{message.ID})
+
+	// 如果撤回的是会话最新消息，刷新会话列表预览
+	s.refreshConversationPreview(message)
+
+	return result, nil
+}
+
+// removeFromOfflineQueues 从会话成员的 Redis 离线消息队列中移除指定消息（按发送时保存的队列内容 LREM）
+func (s *MessageService) removeFromOfflineQueues(conversationID uuid.UUID, messageIDs []uuid.UUID) {
+	if s.rdb == nil || len(messageIDs) == 0 {
+		return
+	}
+
+	ctx := context.Background()
+	payloadKeys := make([]string, len(messageIDs))
+	for i, id := range messageIDs {
+		payloadKeys[i] = OfflinePayloadKey(id)
+	}
+	values, err := s.rdb.MGet(ctx, payloadKeys...).Result()
+	if err != nil {
+		log.Printf("[ERROR] Failed to get offline payloads for conversation %s: %v", conversationID, err)
+		return
+	}
+	var payloads []string
+	for _, value := range values {
+		if payload, ok := value.(string); ok {
+			payloads = append(payloads, payload)
+		}
+	}
+	if len(payloads) == 0 {
+		return // 超过离线队列保留时长，队列中已不存在这些消息
+	}
+
+	var memberIDs []uuid.UUID
+	if err := s.db.Model(&model.ConversationMember{}).
+		Where("conversation_id = ?", conversationID).
+		Pluck("user_id", &memberIDs).Error; err != nil {
+		return
+	}
+
+	pipe := s.rdb.Pipeline()
+	for _, memberID := range memberIDs {
+		key := "offline_msg:" + memberID.String()
+		for _, payload := range payloads {
+			pipe.LRem(ctx, key, 0, payload)
+		}
+	}
+	pipe.Del(ctx, payloadKeys...)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("[ERROR] Failed to remove messages from offline queues of conversation %s: %v", conversationID, err)
+	}
+}
+
+// getReplyTarget 查询被回复的消息（必须属于同一会话且未撤回）
+func (s *MessageService) getReplyTarget(conversationID, messageID uuid.UUID) (*model.Message, error) {
+	var target model.Message
+	if err := s.db.Where("id = ? AND conversation_id = ?", messageID, conversationID).First(&target).Error; err != nil {
+		return nil, notFoundError("reply target not found in this conversation")
+	}
+	if target.IsRecalled {
+		return nil, invalidError("cannot reply to a recalled message")
+	}
+	return &target, nil
+}
+
+// buildMessagePreview 生成会话列表中的消息预览文本（未知类型返回 nil）
+// 富文本消息使用纯文本（合并为单行），没有纯文本时从 Markdown 重新生成
+func buildMessagePreview(messageType string, content, plainText *string) *string {
+	var text string
+	switch messageType {
+	case "text", "rich_text":
+		if content == nil {
+			return nil
+		}
+		text = *content
+		if messageType == "rich_text" {
+			if plainText != nil {
+				text = strings.Join(strings.Fields(*plainText), " ")
+			} else {
+				text = richTextPreview(text)
+			}
+		}
+		// 限制预览长度（按字符截断，避免中文乱码）
+		runes := []rune(text)
+		if len(runes) > 50 {
+			text = string(runes[:50]) + "..."
+		}
+	case "image":
+		text = "[图片]"
+	case "video":
+		text = "[视频]"
+	case "emoji":
+		text = "[表情]"
+	case "poll":
+		text = "[投票]"
+	case "file":
+		text = "[文件]"
+	case "voice":
+		text = "[语音]"
+	case "location":
+		text = "[位置]"
+	default:
+		return nil
+	}
+	return &text
+}
+
+// EditMessage 编辑消息（仅发送者可编辑文本消息，需在配置的时间窗口内）
+func (s *MessageService) EditMessage(userID uuid.UUID, messageID uuid.UUID, content string) (*model.Message, error) {
+	if content == "" {
+		return nil, invalidError("content is required for text messages")
+	}
+
+	var message model.Message
+	if err := s.db.Where("id = ?", messageID).First(&message).Error; err != nil {
+		return nil, notFoundError("message not found")
+	}
+
+	// 检查是否是发送者
+	if message.SenderID != userID {
+		return nil, forbiddenError("you can only edit your own messages")
+	}
+
+	if message.IsRecalled {
+		return nil, invalidError("cannot edit a recalled message")
+	}
+
+	if message.MessageType != "text" && message.MessageType != "rich_text" {
+		return nil, invalidError("only text messages can be edited")
+	}
+
+	// 原来的链接预览不再对应编辑后的内容，去掉后按新内容重新抓取
+	updates := map[string]interface{}{
+		"metadata": gorm.Expr("metadata - 'link_preview'"),
+	}
+	if message.MessageType == "rich_text" {
+		rendered, err := renderRichText(content)
+		if err != nil {
+			return nil, err
+		}
+		content = rendered.Markdown
+		htmlPatch, _ := json.Marshal(map[string]string{"html": rendered.HTML})
+		updates["plain_text"] = rendered.PlainText
+		updates["metadata"] = gorm.Expr("(COALESCE(metadata, '{}'::jsonb) - 'link_preview') || ?::jsonb", string(htmlPatch))
+	}
+
+	if message.Content != nil && *message.Content == content {
+		return nil, invalidError("content is unchanged")
+	}
+
+	// 检查编辑时间窗口（0 表示不限制，使用数据库原生计算，避免时区问题）
+	editWindow := s.sysSvc.GetIntSetting("message_edit_window_seconds", 900)
+	if editWindow > 0 {
+		var elapsedSeconds float64
+		if err := s.db.Raw(`
+			SELECT EXTRACT(EPOCH FROM (NOW() - created_at))
+			FROM messages
+			WHERE id = ?
+		`, messageID).Scan(&elapsedSeconds).Error; err != nil {
+			return nil, fmt.Errorf("failed to calculate elapsed time: %w", err)
+		}
+
+		if elapsedSeconds > float64(editWindow) {
+			return nil, invalidError("can only edit messages within %d seconds (elapsed: %.0f seconds)", editWindow, elapsedSeconds)
+		}
+	}
+
+	// 保存编辑历史并更新消息内容
+	now := time.Now()
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		edit := &model.MessageEdit{
+			MessageID:       messageID,
+			EditorID:        userID,
+			PreviousContent: message.Content,
+			EditedAt:        now,
+		}
+		if err := tx.Create(edit).Error; err != nil {
+			return fmt.Errorf("failed to save edit history: %w", err)
+		}
+
+		updates["content"] = content
+		updates["edited_at"] = now
+		if err := tx.Model(&model.Message{}).Where("id = ?", messageID).Updates(updates).Error; err != nil {
+			return fmt.Errorf("failed to update message: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Where("id = ?", messageID).First(&message).Error; err != nil {
+		return nil, fmt.Errorf("failed to reload message: %w", err)
+	}
+
+	// 如果编辑的是会话最新消息，刷新会话列表预览
+	s.refreshConversationPreview(&message)
+
+	// 按编辑后的内容重新抓取链接预览
+	s.startLinkPreview(&message)
+
+	return &message, nil
+}
+
+// GetMessageEdits 获取消息的编辑历史（按时间正序）
+func (s *MessageService) GetMessageEdits(userID uuid.UUID, messageID uuid.UUID) ([]model.MessageEdit, error) {
+	var message model.Message
+	if err := s.db.Where("id = ?", messageID).First(&message).Error; err != nil {
+		return nil, notFoundError("message not found")
+	}
+
+	isMember, err := s.isConversationMember(message.ConversationID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !isMember {
+		return nil, forbiddenError("you are not a member of this conversation")
+	}
+
+	var edits []model.MessageEdit
+	if err := s.db.Where("message_id = ?", messageID).
+		Order("edited_at ASC").
+		Find(&edits).Error; err != nil {
+		return nil, fmt.Errorf("failed to query edit history: %w", err)
+	}
+
+	return edits, nil
+}
+
+// refreshConversationPreview 当消息是会话的最新消息时，推送新的预览文本给所有成员
+func (s *MessageService) refreshConversationPreview(message *model.Message) {
+	if s.convNotifier == nil {
+		return
+	}
+
+	var conversation model.Conversation
+	if err := s.db.Where("id = ?", message.ConversationID).First(&conversation).Error; err != nil {
+		return
+	}
+	if conversation.LastMessageID == nil || *conversation.LastMessageID != message.ID {
+		return
+	}
+
+	var members []model.ConversationMember
+	if err := s.db.Where("conversation_id = ? AND left_at IS NULL", message.ConversationID).
+		Find(&members).Error; err != nil {
+		return
+	}
+
+	var previewText *string
+	if !message.IsRecalled {
+		previewText = buildMessagePreview(message.MessageType, message.Content, message.PlainText)
+	}
+	for _, member := range members {
+		s.convNotifier.SendConversationUpdate(member.UserID, message.ConversationID, conversation.LastMessageAt, previewText, member.UnreadCount)
+	}
+}
+
+// 单次转发的数量限制
+const (
+	maxForwardMessages = 50
+	maxForwardTargets  = 20
+)
+
+// ForwardResult 转发到单个目标会话的结果
+type ForwardResult struct {
+	ConversationID uuid.UUID        `json:"conversation_id"`
+	Messages       []*model.Message `json:"messages"`
+	Error          string           `json:"error,omitempty"` // 该目标转发失败的原因（其他目标不受影响）
+}
+
+// ForwardMessages 将一条或多条消息转发到一个或多个会话
+// 转发的消息由当前用户发送，metadata.forwarded_from 记录原发送者和原会话；
+// 每个目标会话都走 SendMessage 的完整校验（成员、拉黑、首条消息限制）
+func (s *MessageService) ForwardMessages(userID uuid.UUID, messageIDs, targetConversationIDs []uuid.UUID) ([]ForwardResult, error) {
+	if len(messageIDs) == 0 {
+		return nil, invalidError("message_ids is required")
+	}
+	if len(targetConversationIDs) == 0 {
+		return nil, invalidError("conversation_ids is required")
+	}
+	if len(messageIDs) > maxForwardMessages {
+		return nil, invalidError("can only forward up to %d messages at once", maxForwardMessages)
+	}
+	if len(targetConversationIDs) > maxForwardTargets {
+		return nil, invalidError("can only forward to up to %d conversations at once", maxForwardTargets)
+	}
+
+	// 1. 查询源消息（按原始发送时间排序）
+	var sources []model.Message
+	if err := s.db.Where("id IN ?", messageIDs).
+		Order("created_at ASC").
+		Find(&sources).Error; err != nil {
+		return nil, fmt.Errorf("failed to query messages: %w", err)
+	}
+	if len(sources) != len(uniqueUUIDs(messageIDs)) {
+		return nil, notFoundError("message not found")
+	}
+
+	// 2. 用户必须是源消息所在会话的成员，且不能转发已撤回的消息
+	checkedConversations := make(map[uuid.UUID]bool)
+	for _, source := range sources {
+		if source.IsRecalled {
+			return nil, invalidError("cannot forward a recalled message")
+		}
+		if checkedConversations[source.ConversationID] {
+			continue
+		}
+		isMember, err := s.isConversationMember(source.ConversationID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if !isMember {
+			return nil, forbiddenError("user is not a member of this conversation")
+		}
+		checkedConversations[source.ConversationID] = true
+	}
+
+	// 2.1 投票消息转发为新的投票（相同的问题和选项，不带原投票的票数和截止时间）
+	var pollMessageIDs []uuid.UUID
+	for _, source := range sources {
+		if source.MessageType == "poll" {
+			pollMessageIDs = append(pollMessageIDs, source.ID)
+		}
+	}
+	pollMap, err := loadPollResults(s.db, userID, pollMessageIDs)
+	if err != nil {
+		return nil, err
 	}
 
-	if elapsedSeconds > 10 { // 2分钟 = 120秒
-		return fmt.Errorf("can only recall messages within 2 minutes (elapsed: %.0f seconds)", elapsedSeconds)
+	// 3. 逐个目标会话转发
+	results := make([]ForwardResult, 0, len(targetConversationIDs))
+	for _, targetID := range uniqueUUIDs(targetConversationIDs) {
+		result := ForwardResult{ConversationID: targetID, Messages: []*model.Message{}}
+
+		receiverID, err := s.getPrivateReceiver(targetID, userID)
+		if err != nil {
+			result.Error = err.Error()
+			results = append(results, result)
+			continue
+		}
+
+		for _, source := range sources {
+			message, err := s.SendMessage(userID, &SendMessageRequest{
+				ConversationID: targetID,
+				ReceiverID:     receiverID,
+				MessageType:    source.MessageType,
+				Content:        source.Content,
+				Metadata:       buildForwardMetadata(&source),
+				Poll:           buildForwardPoll(pollMap[source.ID]),
+				forwarded:      true,
+			})
+			if err != nil {
+				result.Error = err.Error()
+				break
+			}
+			result.Messages = append(result.Messages, message)
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// getPrivateReceiver 私聊会话返回对方用户ID（用于拉黑检查），群聊返回 nil
+func (s *MessageService) getPrivateReceiver(conversationID, userID uuid.UUID) (*uuid.UUID, error) {
+	var conversation model.Conversation
+	if err := s.db.Where("id = ?", conversationID).First(&conversation).Error; err != nil {
+		return nil, notFoundError("conversation not found")
+	}
+	if conversation.ConversationType != "private" {
+		return nil, nil
+	}
+
+	var other model.ConversationMember
+	if err := s.db.Where("conversation_id = ? AND user_id != ?", conversationID, userID).
+		First(&other).Error; err != nil {
+		return nil, notFoundError("conversation not found")
+	}
+	return &other.UserID, nil
+}
+
+// buildForwardPoll 根据源投票生成新投票的请求（非投票消息返回 nil）
+func buildForwardPoll(source *model.PollResult) *PollRequest {
+	if source == nil {
+		return nil
+	}
+	options := make([]string, len(source.Options))
+	for i, option := range source.Options {
+		options[i] = option.Text
+	}
+	return &PollRequest{
+		Options:        options,
+		MultipleChoice: source.MultipleChoice,
+		Anonymous:      source.Anonymous,
 	}
+}
 
-	// 撤回消息
-	return s.db.Model(&message).Updates(map[string]interface{}{
-		"is_recalled": true,
-		"recalled_at": time.Now(),
-	}).Error
+// buildForwardMetadata 复制源消息的 metadata（去掉回复、@提及等与原会话相关的字段），并按源消息记录转发来源
+func buildForwardMetadata(source *model.Message) map[string]interface{} {
+	metadata := make(map[string]interface{})
+	if len(source.Metadata) > 0 {
+		json.Unmarshal(source.Metadata, &metadata)
+	}
+	delete(metadata, "reply_to_content")
+	delete(metadata, "mentioned_user_ids")
+	delete(metadata, "mention_all")
+	delete(metadata, "live_period")  // 实时位置转发为静态位置
+	delete(metadata, "link_preview") // 链接预览在新消息发送后重新抓取
+
+	// 转发来源总是取自源消息本身
+	metadata["forwarded_from"] = map[string]interface{}{
+		"message_id":      source.ID,
+		"sender_id":       source.SenderID,
+		"conversation_id": source.ConversationID,
+	}
+	return metadata
+}
+
+// uniqueUUIDs 去重并保持原有顺序
+func uniqueUUIDs(ids []uuid.UUID) []uuid.UUID {
+	seen := make(map[uuid.UUID]bool, len(ids))
+	result := make([]uuid.UUID, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	return result
 }
 
 // GetMessageByID 根据ID获取消息
 func (s *MessageService) GetMessageByID(messageID uuid.UUID) (*model.Message, error) {
 	var message model.Message
 	if err := s.db.Where("id = ?", messageID).First(&message).Error; err != nil {
-		return nil, fmt.Errorf("message not found")
+		return nil, notFoundError("message not found")
 	}
 	return &message, nil
 }
 
-// SearchMessages 搜索消息
-func (s *MessageService) SearchMessages(userID uuid.UUID, keyword string, conversationID *uuid.UUID, limit, offset int) ([]model.Message, error) {
+// SearchMessages 搜索消息（支持 offset 或 before 游标分页，同时返回是否还有更多结果）
+func (s *MessageService) SearchMessages(userID uuid.UUID, keyword string, conversationID *uuid.UUID, limit, offset int, before *uuid.UUID) ([]model.Message, bool, error) {
 	// 如果指定了 conversation_id，先检查用户是否是该会话成员
 	if conversationID != nil {
 		isMember, err := s.isConversationMember(*conversationID, userID)
 		if err != nil {
-			return nil, err
+			return nil, false, err
 		}
 		if !isMember {
-			return nil, fmt.Errorf("you are not a member of this conversation")
+			return nil, false, forbiddenError("you are not a member of this conversation")
 		}
 	}
 
@@ -380,58 +1187,85 @@ func (s *MessageService) SearchMessages(userID uuid.UUID, keyword string, conver
 		Select("DISTINCT messages.*").
 		Joins("JOIN conversation_members ON messages.conversation_id = conversation_members.conversation_id").
 		Where("conversation_members.user_id = ?", userID).
-		Where("messages.content ILIKE ?", "%"+keyword+"%").
+		Where("COALESCE(messages.plain_text, messages.content) ILIKE ?", "%"+keyword+"%"). // 富文本消息按纯文本搜索
 		Where("messages.is_recalled = ?", false)
 
 	if conversationID != nil {
 		query = query.Where("messages.conversation_id = ?", *conversationID)
 	}
 
-	if err := query.Order("messages.created_at DESC").Limit(limit).Offset(offset).Find(&messages).Error; err != nil {
-		return nil, err
+	// 游标分页：返回比 before 更早的结果（before 为上一页最后一条结果的ID），新消息到达时不会重复或遗漏
+	if before != nil {
+		var cursor model.Message
+		if err := s.db.Select("id, created_at").Where("id = ?", *before).First(&cursor).Error; err != nil {
+			return nil, false, notFoundError("cursor message not found")
+		}
+		query = query.Where("(messages.created_at, messages.id) < (?, ?)", cursor.CreatedAt, cursor.ID)
+		offset = 0
 	}
 
-	return messages, nil
+	if err := query.Order("messages.created_at DESC, messages.id DESC").Limit(limit + 1).Offset(offset).Find(&messages).Error; err != nil {
+		return nil, false, err
+	}
+
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+	return messages, hasMore, nil
 }
 
 // MarkAsRead 标记消息为已读（支持多设备，使用 MAX 逻辑确保幂等性）
-func (s *MessageService) MarkAsRead(userID uuid.UUID, conversationID uuid.UUID, messageID uuid.UUID) error {
-	// 先检查要标记的消息是否存在
+// 已读同时记录送达，送达进度前进时返回送达结果（用于推送 delivered 事件）
+func (s *MessageService) MarkAsRead(userID uuid.UUID, conversationID uuid.UUID, messageID uuid.UUID) (*DeliveryResult, error) {
+	// 先检查要标记的消息是否存在（必须属于该会话，否则会用其他会话的序号推进本会话的进度）
 	var targetMessage model.Message
-	if err := s.db.Where("id = ?", messageID).First(&targetMessage).Error; err != nil {
-		return fmt.Errorf("message not found: %w", err)
+	if err := s.db.Where("id = ? AND conversation_id = ?", messageID, conversationID).First(&targetMessage).Error; err != nil {
+		return nil, notFoundError("message not found")
+	}
+
+	// 已读的消息一定已送达（送达进度同步前进，必要时推送 delivered 事件）
+	delivery, err := s.MarkDelivered(userID, conversationID, messageID, targetMessage.Seq)
+	if err != nil {
+		return nil, err
 	}
 
-	// 更新会话成员的已读状态（只有当新消息比当前 last_read 更新时才更新）
-	// 使用原生 SQL 实现 MAX 逻辑，支持多设备并发标记
-	result := s.db.Exec(`
+	// 更新会话成员的已读状态（只有当新消息的序号比当前已读进度大时才更新）
+	// 使用 RETURNING 取回更新前的进度，用于确定已读状态可能变化的消息范围；多设备并发标记时只有一个更新生效
+	var previousReadSeq []int64
+	result := s.db.Raw(`
 		UPDATE conversation_members cm
 		SET
 			unread_count = 0,
+			unread_mention_count = 0,
 			last_read_message_id = ?,
+			last_read_seq = ?,
 			last_read_at = NOW()
-		WHERE cm.conversation_id = ?
+		FROM conversation_members old
+		WHERE old.id = cm.id
+		  AND cm.conversation_id = ?
 		  AND cm.user_id = ?
-		  AND (
-		      cm.last_read_message_id IS NULL
-		      OR NOT EXISTS (
-		          SELECT 1 FROM messages m
-		          WHERE m.id = cm.last_read_message_id
-		            AND m.created_at > ?
-		      )
-		  )
-	`, messageID, conversationID, userID, targetMessage.CreatedAt)
+		  AND cm.last_read_seq < ?
+		RETURNING old.last_read_seq
+	`, messageID, targetMessage.Seq, conversationID, userID, targetMessage.Seq).Scan(&previousReadSeq)
 
 	if result.Error != nil {
-		return result.Error
+		return nil, result.Error
 	}
 
 	// 只有真正更新了记录，才推送未读数清零（避免旧消息标记触发推送）
-	if result.RowsAffected > 0 && s.unreadNotifier != nil {
+	if len(previousReadSeq) > 0 && s.unreadNotifier != nil {
 		s.unreadNotifier.SendUnreadCountUpdate(userID, conversationID, 0)
 	}
 
-	return nil
+	// 启用已读回执时，更新所有接收者都已读的消息状态
+	if len(previousReadSeq) > 0 && s.sysSvc.IsFeatureEnabled("enable_read_receipt") {
+		if err := promoteMessageStatus(s.db, conversationID, "read", previousReadSeq[0], targetMessage.Seq); err != nil {
+			return nil, err
+		}
+	}
+
+	return delivery, nil
 }
 
 // getOrCreatePrivateConversation 获取或创建私聊会话（带分布式锁）
@@ -441,7 +1275,7 @@ func (s *MessageService) getOrCreatePrivateConversation(user1ID, user2ID uuid.UU
 
 	// 0. 检查是否是自己给自己发消息
 	if user1ID == user2ID {
-		return uuid.Nil, false, fmt.Errorf("cannot send message to yourself")
+		return uuid.Nil, false, invalidError("cannot send message to yourself")
 	}
 
 	// 1. 先查询是否已存在
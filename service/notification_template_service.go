@@ -103,6 +103,16 @@ func (s *NotificationTemplateService) InitDefaultTemplates() error {
 			IsActive:        true,
 			Description:     stringPtr("群聊新消息通知"),
 		},
+		{
+			Type:            "mention",
+			Title:           "New Mention",
+			ContentTemplate: stringPtr("{{sender_name}} mentioned you in {{group_name}}: {{content}}"),
+			Priority:        1,
+			EnablePush:      true,
+			EnableWebsocket: true,
+			IsActive:        true,
+			Description:     stringPtr("群聊@提及通知"),
+		},
 		{
 			Type:            "system",
 			Title:           "System Notification",
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"fmt"
+
+	"dinq_message/model"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxPinnedMessages 每个会话最多置顶的消息数
+const maxPinnedMessages = 50
+
+type PinService struct {
+	db *gorm.DB
+}
+
+func NewPinService(db *gorm.DB) *PinService {
+	return &PinService{db: db}
+}
+
+// PinResult 置顶/取消置顶操作结果
+type PinResult struct {
+	Message *model.Message       // 被操作的消息
+	Pin     *model.PinnedMessage // 置顶记录（取消置顶时为 nil）
+	Changed bool                 // 是否真正发生变化（重复置顶/取消时为 false）
+}
+
+// PinMessage 置顶消息（群聊仅 owner/admin，私聊双方均可）
+func (s *PinService) PinMessage(userID, messageID uuid.UUID) (*PinResult, error) {
+	message, err := s.getPinnableMessage(userID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if message.IsRecalled {
+		return nil, fmt.Errorf("cannot pin a recalled message")
+	}
+
+	var pinCount int64
+	if err := s.db.Model(&model.PinnedMessage{}).
+		Where("conversation_id = ?", message.ConversationID).
+		Count(&pinCount).Error; err != nil {
+		return nil, fmt.Errorf("failed to count pinned messages: %w", err)
+	}
+	if pinCount >= maxPinnedMessages {
+		return nil, fmt.Errorf("can only pin up to %d messages per conversation", maxPinnedMessages)
+	}
+
+	pin := &model.PinnedMessage{
+		ConversationID: message.ConversationID,
+		MessageID:      messageID,
+		PinnedBy:       userID,
+	}
+	result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(pin)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to pin message: %w", result.Error)
+	}
+
+	// 已经置顶过，返回原有的置顶记录
+	if result.RowsAffected == 0 {
+		if err := s.db.Where("conversation_id = ? AND message_id = ?", message.ConversationID, messageID).
+			First(pin).Error; err != nil {
+			return nil, fmt.Errorf("failed to query pinned message: %w", err)
+		}
+	}
+
+	pin.Message = message
+	return &PinResult{
+		Message: message,
+		Pin:     pin,
+		Changed: result.RowsAffected > 0,
+	}, nil
+}
+
+// UnpinMessage 取消置顶（权限与置顶相同）
+func (s *PinService) UnpinMessage(userID, messageID uuid.UUID) (*PinResult, error) {
+	message, err := s.getPinnableMessage(userID, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := s.db.Where("conversation_id = ? AND message_id = ?", message.ConversationID, messageID).
+		Delete(&model.PinnedMessage{})
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to unpin message: %w", result.Error)
+	}
+
+	return &PinResult{
+		Message: message,
+		Changed: result.RowsAffected > 0,
+	}, nil
+}
+
+// GetPinnedMessages 获取会话的置顶消息列表（最新置顶的在前）
+func (s *PinService) GetPinnedMessages(userID, conversationID uuid.UUID) ([]model.PinnedMessage, error) {
+	if _, err := s.getMember(conversationID, userID); err != nil {
+		return nil, err
+	}
+	return loadPinnedMessages(s.db, conversationID)
+}
+
+// getPinnableMessage 查询消息并检查用户是否有权限置顶
+func (s *PinService) getPinnableMessage(userID, messageID uuid.UUID) (*model.Message, error) {
+	var message model.Message
+	if err := s.db.Where("id = ?", messageID).First(&message).Error; err != nil {
+		return nil, fmt.Errorf("message not found")
+	}
+
+	member, err := s.getMember(message.ConversationID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var conversation model.Conversation
+	if err := s.db.Where("id = ?", message.ConversationID).First(&conversation).Error; err != nil {
+		return nil, fmt.Errorf("conversation not found")
+	}
+	if conversation.ConversationType == "group" && member.Role != "owner" && member.Role != "admin" {
+		return nil, fmt.Errorf("only group owner or admin can pin messages")
+	}
+
+	return &message, nil
+}
+
+// getMember 查询用户在会话中的成员记录
+func (s *PinService) getMember(conversationID, userID uuid.UUID) (*model.ConversationMember, error) {
+	var member model.ConversationMember
+	if err := s.db.Where("conversation_id = ? AND user_id = ? AND left_at IS NULL", conversationID, userID).
+		First(&member).Error; err != nil {
+		return nil, fmt.Errorf("user is not a member of this conversation")
+	}
+	return &member, nil
+}
+
+// loadPinnedMessages 查询会话的置顶消息并补充消息内容（最新置顶的在前）
+func loadPinnedMessages(db *gorm.DB, conversationID uuid.UUID) ([]model.PinnedMessage, error) {
+	var pins []model.PinnedMessage
+	if err := db.Where("conversation_id = ?", conversationID).
+		Order("pinned_at DESC").
+		Find(&pins).Error; err != nil {
+		return nil, fmt.Errorf("failed to query pinned messages: %w", err)
+	}
+	if len(pins) == 0 {
+		return []model.PinnedMessage{}, nil
+	}
+
+	messageIDs := make([]uuid.UUID, len(pins))
+	for i, pin := range pins {
+		messageIDs[i] = pin.MessageID
+	}
+	var messages []model.Message
+	if err := db.Where("id IN ?", messageIDs).Find(&messages).Error; err != nil {
+		return nil, fmt.Errorf("failed to query pinned messages: %w", err)
+	}
+	messageMap := make(map[uuid.UUID]*model.Message, len(messages))
+	for i := range messages {
+		messageMap[messages[i].ID] = &messages[i]
+	}
+
+	for i := range pins {
+		pins[i].Message = messageMap[pins[i].MessageID]
+	}
+	return pins, nil
+}
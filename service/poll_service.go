@@ -0,0 +1,324 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"dinq_message/model"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 投票选项限制
+const (
+	minPollOptions      = 2
+	maxPollOptions      = 10
+	maxPollOptionLength = 100 // 字符数，与数据库 varchar(100) 保持一致
+)
+
+type PollService struct {
+	db *gorm.DB
+}
+
+func NewPollService(db *gorm.DB) *PollService {
+	return &PollService{db: db}
+}
+
+// PollRequest 创建投票请求（问题放在消息 content 中）
+type PollRequest struct {
+	Options        []string   `json:"options"`
+	MultipleChoice bool       `json:"multiple_choice"`
+	Anonymous      bool       `json:"anonymous"`
+	ClosesAt       *time.Time `json:"closes_at,omitempty"`
+}
+
+// PollUpdateResult 投票/关闭操作结果
+type PollUpdateResult struct {
+	Message *model.Message    // 投票消息（用于获取 conversation_id 广播）
+	Poll    *model.PollResult // 操作后的投票结果（包含当前用户的选择）
+}
+
+// validatePollRequest 校验投票参数，并去掉选项首尾空白
+func validatePollRequest(req *PollRequest) error {
+	if req == nil {
+		return invalidError("poll is required for poll messages")
+	}
+	if len(req.Options) < minPollOptions || len(req.Options) > maxPollOptions {
+		return invalidError("poll must have between %d and %d options", minPollOptions, maxPollOptions)
+	}
+
+	seen := make(map[string]bool, len(req.Options))
+	for i, option := range req.Options {
+		option = strings.TrimSpace(option)
+		if option == "" {
+			return invalidError("poll option cannot be empty")
+		}
+		if utf8.RuneCountInString(option) > maxPollOptionLength {
+			return invalidError("poll option is too long")
+		}
+		if seen[option] {
+			return invalidError("poll options must be unique")
+		}
+		seen[option] = true
+		req.Options[i] = option
+	}
+
+	if req.ClosesAt != nil && !req.ClosesAt.After(time.Now()) {
+		return invalidError("closes_at must be in the future")
+	}
+	return nil
+}
+
+// createPoll 在发送消息的事务中保存投票和选项
+func createPoll(tx *gorm.DB, messageID uuid.UUID, req *PollRequest) (*model.PollResult, error) {
+	poll := &model.Poll{
+		MessageID:      messageID,
+		MultipleChoice: req.MultipleChoice,
+		Anonymous:      req.Anonymous,
+		ClosesAt:       req.ClosesAt,
+	}
+	if err := tx.Create(poll).Error; err != nil {
+		return nil, fmt.Errorf("failed to save poll: %w", err)
+	}
+
+	options := make([]model.PollOption, len(req.Options))
+	for i, text := range req.Options {
+		options[i] = model.PollOption{
+			MessageID: messageID,
+			Position:  i,
+			Text:      text,
+		}
+	}
+	if err := tx.Create(&options).Error; err != nil {
+		return nil, fmt.Errorf("failed to save poll options: %w", err)
+	}
+
+	return buildPollResult(poll, options, nil, uuid.Nil), nil
+}
+
+// Vote 投票（覆盖用户之前的选择，option_ids 为空表示撤回投票）
+func (s *PollService) Vote(userID, messageID uuid.UUID, optionIDs []uuid.UUID) (*PollUpdateResult, error) {
+	message, _, err := s.getPollMessage(userID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if message.IsRecalled {
+		return nil, invalidError("cannot vote on a recalled message")
+	}
+	optionIDs = uniqueUUIDs(optionIDs)
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// 锁定投票行，串行化同一投票的并发投票和关闭操作
+		var poll model.Poll
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("message_id = ?", messageID).
+			First(&poll).Error; err != nil {
+			return notFoundError("poll not found")
+		}
+		if poll.IsClosed(time.Now()) {
+			return invalidError("poll is closed")
+		}
+		if !poll.MultipleChoice && len(optionIDs) > 1 {
+			return invalidError("this poll allows only one option")
+		}
+
+		if len(optionIDs) > 0 {
+			var count int64
+			if err := tx.Model(&model.PollOption{}).
+				Where("message_id = ? AND id IN ?", messageID, optionIDs).
+				Count(&count).Error; err != nil {
+				return fmt.Errorf("failed to query poll options: %w", err)
+			}
+			if int(count) != len(optionIDs) {
+				return invalidError("invalid poll option")
+			}
+		}
+
+		if err := tx.Where("message_id = ? AND user_id = ?", messageID, userID).
+			Delete(&model.PollVote{}).Error; err != nil {
+			return fmt.Errorf("failed to update vote: %w", err)
+		}
+		if len(optionIDs) == 0 {
+			return nil
+		}
+
+		votes := make([]model.PollVote, len(optionIDs))
+		for i, optionID := range optionIDs {
+			votes[i] = model.PollVote{
+				OptionID:  optionID,
+				UserID:    userID,
+				MessageID: messageID,
+			}
+		}
+		if err := tx.Create(&votes).Error; err != nil {
+			return fmt.Errorf("failed to update vote: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.buildUpdateResult(userID, message)
+}
+
+// ClosePoll 关闭投票（投票发起人，或群聊 owner/admin）
+func (s *PollService) ClosePoll(userID, messageID uuid.UUID) (*PollUpdateResult, error) {
+	message, member, err := s.getPollMessage(userID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if message.SenderID != userID && member.Role != "owner" && member.Role != "admin" {
+		return nil, forbiddenError("only the poll creator or group admin can close the poll")
+	}
+
+	now := time.Now()
+	result := s.db.Model(&model.Poll{}).
+		Where("message_id = ? AND closed_at IS NULL AND (closes_at IS NULL OR closes_at > ?)", messageID, now).
+		Updates(map[string]interface{}{
+			"closed_at": now,
+			"closed_by": userID,
+		})
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to close poll: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, invalidError("poll is closed")
+	}
+
+	return s.buildUpdateResult(userID, message)
+}
+
+// GetPoll 获取投票结果
+func (s *PollService) GetPoll(userID, messageID uuid.UUID) (*model.PollResult, error) {
+	if _, _, err := s.getPollMessage(userID, messageID); err != nil {
+		return nil, err
+	}
+
+	results, err := loadPollResults(s.db, userID, []uuid.UUID{messageID})
+	if err != nil {
+		return nil, err
+	}
+	if results[messageID] == nil {
+		return nil, notFoundError("poll not found")
+	}
+	return results[messageID], nil
+}
+
+// buildUpdateResult 查询操作后的最新投票结果
+func (s *PollService) buildUpdateResult(userID uuid.UUID, message *model.Message) (*PollUpdateResult, error) {
+	results, err := loadPollResults(s.db, userID, []uuid.UUID{message.ID})
+	if err != nil {
+		return nil, err
+	}
+	if results[message.ID] == nil {
+		return nil, notFoundError("poll not found")
+	}
+	return &PollUpdateResult{
+		Message: message,
+		Poll:    results[message.ID],
+	}, nil
+}
+
+// getPollMessage 查询投票消息并检查用户是否是会话成员
+func (s *PollService) getPollMessage(userID, messageID uuid.UUID) (*model.Message, *model.ConversationMember, error) {
+	var message model.Message
+	if err := s.db.Where("id = ? AND message_type = ?", messageID, "poll").First(&message).Error; err != nil {
+		return nil, nil, notFoundError("poll not found")
+	}
+
+	var member model.ConversationMember
+	if err := s.db.Where("conversation_id = ? AND user_id = ? AND left_at IS NULL", message.ConversationID, userID).
+		First(&member).Error; err != nil {
+		return nil, nil, forbiddenError("user is not a member of this conversation")
+	}
+
+	return &message, &member, nil
+}
+
+// loadPollResults 批量查询投票结果（票数由投票记录实时统计，viewerID 用于填充 my_option_ids）
+func loadPollResults(db *gorm.DB, viewerID uuid.UUID, messageIDs []uuid.UUID) (map[uuid.UUID]*model.PollResult, error) {
+	result := make(map[uuid.UUID]*model.PollResult)
+	if len(messageIDs) == 0 {
+		return result, nil
+	}
+
+	var polls []model.Poll
+	if err := db.Where("message_id IN ?", messageIDs).Find(&polls).Error; err != nil {
+		return nil, fmt.Errorf("failed to query polls: %w", err)
+	}
+	if len(polls) == 0 {
+		return result, nil
+	}
+
+	var options []model.PollOption
+	if err := db.Where("message_id IN ?", messageIDs).
+		Order("position ASC").
+		Find(&options).Error; err != nil {
+		return nil, fmt.Errorf("failed to query poll options: %w", err)
+	}
+
+	var votes []model.PollVote
+	if err := db.Where("message_id IN ?", messageIDs).
+		Order("created_at ASC").
+		Find(&votes).Error; err != nil {
+		return nil, fmt.Errorf("failed to query poll votes: %w", err)
+	}
+
+	optionsByMessage := make(map[uuid.UUID][]model.PollOption)
+	for _, option := range options {
+		optionsByMessage[option.MessageID] = append(optionsByMessage[option.MessageID], option)
+	}
+	votesByMessage := make(map[uuid.UUID][]model.PollVote)
+	for _, vote := range votes {
+		votesByMessage[vote.MessageID] = append(votesByMessage[vote.MessageID], vote)
+	}
+
+	for i := range polls {
+		poll := &polls[i]
+		result[poll.MessageID] = buildPollResult(poll, optionsByMessage[poll.MessageID], votesByMessage[poll.MessageID], viewerID)
+	}
+	return result, nil
+}
+
+// buildPollResult 根据投票、选项和投票记录生成投票结果
+func buildPollResult(poll *model.Poll, options []model.PollOption, votes []model.PollVote, viewerID uuid.UUID) *model.PollResult {
+	result := &model.PollResult{
+		MessageID:      poll.MessageID,
+		MultipleChoice: poll.MultipleChoice,
+		Anonymous:      poll.Anonymous,
+		ClosesAt:       poll.ClosesAt,
+		IsClosed:       poll.IsClosed(time.Now()),
+		Options:        make([]model.PollOptionResult, len(options)),
+	}
+
+	indexByOption := make(map[uuid.UUID]int, len(options))
+	for i, option := range options {
+		result.Options[i] = model.PollOptionResult{ID: option.ID, Text: option.Text}
+		indexByOption[option.ID] = i
+	}
+
+	voters := make(map[uuid.UUID]bool)
+	for _, vote := range votes {
+		idx, exists := indexByOption[vote.OptionID]
+		if !exists {
+			continue
+		}
+		optionResult := &result.Options[idx]
+		optionResult.VoteCount++
+		if !poll.Anonymous {
+			optionResult.VoterIDs = append(optionResult.VoterIDs, vote.UserID)
+		}
+		voters[vote.UserID] = true
+		if vote.UserID == viewerID {
+			result.MyOptionIDs = append(result.MyOptionIDs, vote.OptionID)
+		}
+	}
+	result.TotalVoters = len(voters)
+
+	return result
+}
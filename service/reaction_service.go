@@ -0,0 +1,252 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"dinq_message/model"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxReactionEmojiLength 表情最大长度（字符数，与数据库 varchar(32) 保持一致）
+const maxReactionEmojiLength = 32
+
+// emojiRunes 可以作为表情主体的字符：Unicode 表情符号所在的区块（含国旗的区域指示符和肤色修饰符）
+var emojiRunes = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: 0x00a9, Hi: 0x00a9, Stride: 1},
+		{Lo: 0x00ae, Hi: 0x00ae, Stride: 1},
+		{Lo: 0x203c, Hi: 0x203c, Stride: 1},
+		{Lo: 0x2049, Hi: 0x2049, Stride: 1},
+		{Lo: 0x2122, Hi: 0x2122, Stride: 1},
+		{Lo: 0x2139, Hi: 0x2139, Stride: 1},
+		{Lo: 0x2194, Hi: 0x21aa, Stride: 1},
+		{Lo: 0x231a, Hi: 0x23ff, Stride: 1},
+		{Lo: 0x24c2, Hi: 0x24c2, Stride: 1},
+		{Lo: 0x25aa, Hi: 0x25fe, Stride: 1},
+		{Lo: 0x2600, Hi: 0x27bf, Stride: 1},
+		{Lo: 0x2934, Hi: 0x2935, Stride: 1},
+		{Lo: 0x2b05, Hi: 0x2b55, Stride: 1},
+		{Lo: 0x3030, Hi: 0x3030, Stride: 1},
+		{Lo: 0x303d, Hi: 0x303d, Stride: 1},
+		{Lo: 0x3297, Hi: 0x3299, Stride: 1},
+	},
+	R32: []unicode.Range32{
+		{Lo: 0x1f000, Hi: 0x1faff, Stride: 1},
+	},
+}
+
+// emojiJoiners 只能出现在表情序列中的组合字符：零宽连接符、变体选择符、组合用键帽和标签字符（地区旗帜）
+var emojiJoiners = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: 0x200d, Hi: 0x200d, Stride: 1},
+		{Lo: 0x20e3, Hi: 0x20e3, Stride: 1},
+		{Lo: 0xfe0e, Hi: 0xfe0f, Stride: 1},
+	},
+	R32: []unicode.Range32{
+		{Lo: 0xe0020, Hi: 0xe007f, Stride: 1},
+	},
+}
+
+type ReactionService struct {
+	db *gorm.DB
+}
+
+func NewReactionService(db *gorm.DB) *ReactionService {
+	return &ReactionService{db: db}
+}
+
+// ReactionResult 表情回应操作结果
+type ReactionResult struct {
+	Message   *model.Message          // 被回应的消息（用于获取 conversation_id 广播）
+	Emoji     string                  // 规范化后的表情
+	Changed   bool                    // 是否真正发生变化（重复添加/删除不存在的回应时为 false）
+	Reactions []model.ReactionSummary // 操作后该消息的最新回应聚合
+}
+
+// AddReaction 添加表情回应（同一用户对同一消息的同一表情只记录一次）
+func (s *ReactionService) AddReaction(userID, messageID uuid.UUID, emoji string) (*ReactionResult, error) {
+	emoji, err := normalizeEmoji(emoji)
+	if err != nil {
+		return nil, err
+	}
+
+	message, err := s.getReactableMessage(userID, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	reaction := &model.MessageReaction{
+		MessageID: messageID,
+		UserID:    userID,
+		Emoji:     emoji,
+	}
+	result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(reaction)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to add reaction: %w", result.Error)
+	}
+
+	reactions, err := s.GetReactionSummary(messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ReactionResult{
+		Message:   message,
+		Emoji:     emoji,
+		Changed:   result.RowsAffected > 0,
+		Reactions: reactions,
+	}, nil
+}
+
+// RemoveReaction 取消表情回应
+func (s *ReactionService) RemoveReaction(userID, messageID uuid.UUID, emoji string) (*ReactionResult, error) {
+	emoji, err := normalizeEmoji(emoji)
+	if err != nil {
+		return nil, err
+	}
+
+	message, err := s.getReactableMessage(userID, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := s.db.Where("message_id = ? AND user_id = ? AND emoji = ?", messageID, userID, emoji).
+		Delete(&model.MessageReaction{})
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to remove reaction: %w", result.Error)
+	}
+
+	reactions, err := s.GetReactionSummary(messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ReactionResult{
+		Message:   message,
+		Emoji:     emoji,
+		Changed:   result.RowsAffected > 0,
+		Reactions: reactions,
+	}, nil
+}
+
+// GetReactions 获取消息的表情回应（谁回应了什么）
+func (s *ReactionService) GetReactions(userID, messageID uuid.UUID) ([]model.ReactionSummary, error) {
+	if _, err := s.getReactableMessage(userID, messageID); err != nil {
+		return nil, err
+	}
+	return s.GetReactionSummary(messageID)
+}
+
+// GetReactionSummary 获取单条消息的表情回应聚合
+func (s *ReactionService) GetReactionSummary(messageID uuid.UUID) ([]model.ReactionSummary, error) {
+	summaries, err := loadReactionSummaries(s.db, []uuid.UUID{messageID})
+	if err != nil {
+		return nil, err
+	}
+	if summaries[messageID] == nil {
+		return []model.ReactionSummary{}, nil
+	}
+	return summaries[messageID], nil
+}
+
+// getReactableMessage 查询消息并检查用户是否有权限回应
+func (s *ReactionService) getReactableMessage(userID, messageID uuid.UUID) (*model.Message, error) {
+	var message model.Message
+	if err := s.db.Where("id = ?", messageID).First(&message).Error; err != nil {
+		return nil, notFoundError("message not found")
+	}
+
+	var count int64
+	if err := s.db.Model(&model.ConversationMember{}).
+		Where("conversation_id = ? AND user_id = ? AND left_at IS NULL", message.ConversationID, userID).
+		Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, forbiddenError("user is not a member of this conversation")
+	}
+
+	if message.IsRecalled {
+		return nil, invalidError("cannot react to a recalled message")
+	}
+
+	return &message, nil
+}
+
+// normalizeEmoji 校验并规范化表情：只接受 Unicode 表情（含肤色、组合表情、国旗和键帽表情），不接受普通文字
+func normalizeEmoji(emoji string) (string, error) {
+	emoji = strings.TrimSpace(emoji)
+	if emoji == "" {
+		return "", invalidError("emoji is required")
+	}
+	if utf8.RuneCountInString(emoji) > maxReactionEmojiLength {
+		return "", invalidError("emoji is too long")
+	}
+	if !isEmoji(emoji) {
+		return "", invalidError("emoji is not a valid emoji")
+	}
+	return emoji, nil
+}
+
+// isEmoji 检查字符串是否只由表情字符组成：键帽表情（0-9、#、* 加组合用键帽）之外不能包含普通字符
+func isEmoji(emoji string) bool {
+	hasEmoji := false
+	hasKeycap := strings.ContainsRune(emoji, 0x20e3)
+	for _, r := range emoji {
+		switch {
+		case unicode.Is(emojiRunes, r):
+			hasEmoji = true
+		case unicode.Is(emojiJoiners, r):
+		case hasKeycap && (r >= '0' && r <= '9' || r == '#' || r == '*'):
+			hasEmoji = true
+		default:
+			return false
+		}
+	}
+	return hasEmoji
+}
+
+// loadReactionSummaries 批量查询消息的表情回应并按表情聚合（按首次回应时间排序）
+func loadReactionSummaries(db *gorm.DB, messageIDs []uuid.UUID) (map[uuid.UUID][]model.ReactionSummary, error) {
+	result := make(map[uuid.UUID][]model.ReactionSummary)
+	if len(messageIDs) == 0 {
+		return result, nil
+	}
+
+	var reactions []model.MessageReaction
+	if err := db.Where("message_id IN ?", messageIDs).
+		Order("created_at ASC").
+		Find(&reactions).Error; err != nil {
+		return nil, fmt.Errorf("failed to query reactions: %w", err)
+	}
+
+	// map[messageID]map[emoji]在 result 切片中的下标
+	indexByEmoji := make(map[uuid.UUID]map[string]int)
+	for _, reaction := range reactions {
+		if indexByEmoji[reaction.MessageID] == nil {
+			indexByEmoji[reaction.MessageID] = make(map[string]int)
+		}
+
+		idx, exists := indexByEmoji[reaction.MessageID][reaction.Emoji]
+		if !exists {
+			result[reaction.MessageID] = append(result[reaction.MessageID], model.ReactionSummary{
+				Emoji:   reaction.Emoji,
+				UserIDs: []uuid.UUID{},
+			})
+			idx = len(result[reaction.MessageID]) - 1
+			indexByEmoji[reaction.MessageID][reaction.Emoji] = idx
+		}
+
+		summary := &result[reaction.MessageID][idx]
+		summary.Count++
+		summary.UserIDs = append(summary.UserIDs, reaction.UserID)
+	}
+
+	return result, nil
+}
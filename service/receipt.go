@@ -0,0 +1,215 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"dinq_message/model"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 送达和已读使用会话成员上的进度记录（delivered_until_seq、last_read_seq），不按消息逐条保存：
+// 某条消息对某个接收者已送达/已读，当且仅当该接收者的进度不小于消息的会话内序号 seq。
+// 使用 seq 而不是发送时间：不同 Pod 的时钟可能不一致，同一会话的消息时间可能乱序或相同，seq 在发送事务中严格递增；
+// 进度也不指向具体的消息，消息被保留时长清理后仍然有效。
+// 所有 Pod 共享同一份数据库记录，进度只会前进（并发更新取最大值），多 Pod 同时记录是安全的。
+
+// DeliveryResult 送达记录结果（仅在送达进度前进时返回）
+type DeliveryResult struct {
+	ConversationID uuid.UUID
+	UserID         uuid.UUID   // 接收者
+	MessageID      uuid.UUID   // 该消息及之前发送的消息均已送达
+	DeliveredAt    time.Time   // 送达时间
+	SenderIDs      []uuid.UUID // 本次新送达的消息的发送者（需要推送 delivered 事件）
+}
+
+// MarkDelivered 记录消息已送达给接收者（写入接收者的 WebSocket 或离线消息被拉取时调用），messageSeq 为该消息的会话内序号
+// 发送者自己、非会话成员或进度没有前进时返回 nil
+func (s *MessageService) MarkDelivered(userID, conversationID, messageID uuid.UUID, messageSeq int64) (*DeliveryResult, error) {
+	var result *DeliveryResult
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var member model.ConversationMember
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("conversation_id = ? AND user_id = ? AND left_at IS NULL", conversationID, userID).
+			First(&member).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return nil
+			}
+			return fmt.Errorf("failed to query conversation member: %w", err)
+		}
+
+		// 本次新送达的消息范围：(previous, messageSeq]
+		previous := member.DeliveredUntilSeq
+		if messageSeq <= previous {
+			return nil
+		}
+
+		if err := tx.Model(&member).Update("delivered_until_seq", messageSeq).Error; err != nil {
+			return fmt.Errorf("failed to update delivery: %w", err)
+		}
+
+		var senderIDs []uuid.UUID
+		if err := tx.Model(&model.Message{}).
+			Where("conversation_id = ? AND sender_id != ? AND seq > ? AND seq <= ? AND created_at >= ?", conversationID, userID, previous, messageSeq, member.JoinedAt).
+			Distinct().
+			Pluck("sender_id", &senderIDs).Error; err != nil {
+			return fmt.Errorf("failed to query delivered messages: %w", err)
+		}
+		if len(senderIDs) == 0 {
+			return nil // 只送达了自己发送的消息
+		}
+
+		if err := promoteMessageStatus(tx, conversationID, "delivered", previous, messageSeq); err != nil {
+			return err
+		}
+
+		result = &DeliveryResult{
+			ConversationID: conversationID,
+			UserID:         userID,
+			MessageID:      messageID,
+			DeliveredAt:    time.Now(),
+			SenderIDs:      senderIDs,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// promoteMessageStatus 把序号在 (afterSeq, untilSeq] 范围内、所有接收者都已送达/已读的消息更新为 delivered/read
+// 只有该范围内的消息的汇总状态会因为当前接收者的进度前进而改变
+func promoteMessageStatus(db *gorm.DB, conversationID uuid.UUID, status string, afterSeq, untilSeq int64) error {
+	var pendingStatuses []string
+	var notReachedCondition string
+	switch status {
+	case "delivered":
+		pendingStatuses = []string{"sent"}
+		notReachedCondition = "cm.delivered_until_seq < m.seq"
+	case "read":
+		pendingStatuses = []string{"sent", "delivered"}
+		notReachedCondition = "cm.last_read_seq < m.seq"
+	default:
+		return fmt.Errorf("invalid message status: %s", status)
+	}
+
+	if err := db.Exec(`
+		UPDATE messages m
+		SET status = ?
+		WHERE m.conversation_id = ?
+		  AND m.status IN ?
+		  AND m.seq > ? AND m.seq <= ?
+		  AND NOT EXISTS (
+		      SELECT 1 FROM conversation_members cm
+		      WHERE cm.conversation_id = m.conversation_id
+		        AND cm.user_id != m.sender_id
+		        AND cm.left_at IS NULL
+		        AND cm.joined_at <= m.created_at
+		        AND (`+notReachedCondition+`)
+		  )
+	`, status, conversationID, pendingStatuses, afterSeq, untilSeq).Error; err != nil {
+		return fmt.Errorf("failed to update message status: %w", err)
+	}
+	return nil
+}
+
+// GetMessageReceipts 获取消息每个接收者的送达/已读状态（仅发送者可查看）
+func (s *MessageService) GetMessageReceipts(userID, messageID uuid.UUID) (*model.MessageReceipts, error) {
+	var message model.Message
+	if err := s.db.Where("id = ?", messageID).First(&message).Error; err != nil {
+		return nil, notFoundError("message not found")
+	}
+	if message.SenderID != userID {
+		return nil, forbiddenError("only the sender can view message receipts")
+	}
+
+	var receipts []model.MessageReceipt
+	if err := s.db.Raw(`
+		SELECT cm.user_id,
+		       CASE
+		           WHEN ? AND cm.last_read_seq >= m.seq THEN 'read'
+		           WHEN cm.delivered_until_seq >= m.seq THEN 'delivered'
+		           ELSE 'sent'
+		       END AS status
+		FROM messages m
+		JOIN conversation_members cm ON cm.conversation_id = m.conversation_id
+		     AND cm.user_id != m.sender_id
+		     AND cm.left_at IS NULL
+		     AND cm.joined_at <= m.created_at
+		WHERE m.id = ?
+		ORDER BY cm.joined_at ASC
+	`, s.sysSvc.IsFeatureEnabled("enable_read_receipt"), messageID).Scan(&receipts).Error; err != nil {
+		return nil, fmt.Errorf("failed to query receipts: %w", err)
+	}
+
+	result := &model.MessageReceipts{
+		MessageID: messageID,
+		Receipts:  receipts,
+	}
+	result.Summary.Total = len(receipts)
+	for _, receipt := range receipts {
+		switch receipt.Status {
+		case "read":
+			result.Summary.Read++
+			result.Summary.Delivered++
+		case "delivered":
+			result.Summary.Delivered++
+		}
+	}
+	return result, nil
+}
+
+// attachReceiptSummaries 为当前用户发送的群聊消息补充送达/已读统计
+func attachReceiptSummaries(db *gorm.DB, viewerID uuid.UUID, readReceiptEnabled bool, messages []model.Message) error {
+	var ownMessageIDs []uuid.UUID
+	for _, msg := range messages {
+		if msg.SenderID == viewerID && !msg.IsRecalled {
+			ownMessageIDs = append(ownMessageIDs, msg.ID)
+		}
+	}
+	if len(ownMessageIDs) == 0 {
+		return nil
+	}
+
+	var rows []struct {
+		MessageID uuid.UUID
+		Total     int
+		Delivered int
+		ReadCount int
+	}
+	if err := db.Raw(`
+		SELECT m.id AS message_id,
+		       COUNT(cm.user_id) AS total,
+		       COUNT(*) FILTER (WHERE cm.delivered_until_seq >= m.seq) AS delivered,
+		       COUNT(*) FILTER (WHERE ? AND cm.last_read_seq >= m.seq) AS read_count
+		FROM messages m
+		JOIN conversations c ON c.id = m.conversation_id AND c.conversation_type = 'group'
+		JOIN conversation_members cm ON cm.conversation_id = m.conversation_id
+		     AND cm.user_id != m.sender_id
+		     AND cm.left_at IS NULL
+		     AND cm.joined_at <= m.created_at
+		WHERE m.id IN ?
+		GROUP BY m.id
+	`, readReceiptEnabled, ownMessageIDs).Scan(&rows).Error; err != nil {
+		return fmt.Errorf("failed to query receipts: %w", err)
+	}
+
+	summaryMap := make(map[uuid.UUID]*model.ReceiptSummary, len(rows))
+	for _, row := range rows {
+		summaryMap[row.MessageID] = &model.ReceiptSummary{
+			Total:     row.Total,
+			Delivered: row.Delivered,
+			Read:      row.ReadCount,
+		}
+	}
+	for i := range messages {
+		if summary, ok := summaryMap[messages[i].ID]; ok {
+			messages[i].Receipts = summary
+		}
+	}
+	return nil
+}
@@ -30,7 +30,7 @@ func (s *RelationshipService) BlockUser(userID, targetUserID uuid.UUID) error {
 	}
 
 	if count > 0 {
-		return fmt.Errorf("user already blocked")
+		return conflictError("user already blocked")
 	}
 
 	// 创建拉黑关系
@@ -57,7 +57,7 @@ func (s *RelationshipService) UnblockUser(userID, targetUserID uuid.UUID) error
 	}
 
 	if result.RowsAffected == 0 {
-		return fmt.Errorf("user not blocked")
+		return invalidError("user not blocked")
 	}
 
 	return nil
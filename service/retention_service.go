@@ -0,0 +1,273 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"dinq_message/model"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// 消息保留时长范围（0 表示关闭）
+	minMessageTTLSeconds = 5
+	maxMessageTTLSeconds = 365 * 24 * 3600
+	// expiredSweepBatchSize 清理器每轮最多删除的消息数
+	expiredSweepBatchSize = 500
+)
+
+type RetentionService struct {
+	db       *gorm.DB
+	msgSvc   *MessageService
+	notifier ExpiredMessagesNotifier
+	stop     chan struct{}
+}
+
+// ExpiredMessagesNotifier 接口用于推送消息过期事件
+type ExpiredMessagesNotifier interface {
+	SendMessagesExpired(conversationID uuid.UUID, messageIDs []uuid.UUID)
+}
+
+func NewRetentionService(db *gorm.DB, msgSvc *MessageService) *RetentionService {
+	return &RetentionService{
+		db:     db,
+		msgSvc: msgSvc,
+		stop:   make(chan struct{}),
+	}
+}
+
+// SetNotifier 设置过期事件推送器（用于依赖注入）
+func (s *RetentionService) SetNotifier(notifier ExpiredMessagesNotifier) {
+	s.notifier = notifier
+}
+
+// SetMessageTTL 设置会话的消息保留时长（私聊双方均可，群聊仅 owner/admin）
+// 只影响之后发送的消息，已发送的消息保持原有的过期时间
+func (s *RetentionService) SetMessageTTL(userID, conversationID uuid.UUID, ttlSeconds int) (*model.Conversation, error) {
+	if ttlSeconds != 0 && (ttlSeconds < minMessageTTLSeconds || ttlSeconds > maxMessageTTLSeconds) {
+		return nil, fmt.Errorf("message_ttl_seconds must be 0 or between %d and %d", minMessageTTLSeconds, maxMessageTTLSeconds)
+	}
+
+	var member model.ConversationMember
+	if err := s.db.Where("conversation_id = ? AND user_id = ? AND left_at IS NULL", conversationID, userID).
+		First(&member).Error; err != nil {
+		return nil, fmt.Errorf("user is not a member of this conversation")
+	}
+
+	var conversation model.Conversation
+	if err := s.db.Where("id = ?", conversationID).First(&conversation).Error; err != nil {
+		return nil, fmt.Errorf("conversation not found")
+	}
+	if conversation.ConversationType == "group" && member.Role != "owner" && member.Role != "admin" {
+		return nil, fmt.Errorf("only group owner or admin can change message retention")
+	}
+
+	if err := s.db.Model(&conversation).Update("message_ttl_seconds", ttlSeconds).Error; err != nil {
+		return nil, fmt.Errorf("failed to update message retention: %w", err)
+	}
+	conversation.MessageTTLSeconds = ttlSeconds
+
+	return &conversation, nil
+}
+
+// StartSweeper 启动后台清理器，定期删除过期消息
+func (s *RetentionService) StartSweeper(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		log.Printf("[INFO] Expired message sweeper started (interval=%s)", interval)
+
+		for {
+			select {
+			case <-s.stop:
+				log.Printf("[INFO] Expired message sweeper stopped")
+				return
+			case <-ticker.C:
+				s.SweepExpired()
+			}
+		}
+	}()
+}
+
+// StopSweeper 停止后台清理器
+func (s *RetentionService) StopSweeper() {
+	close(s.stop)
+}
+
+// SweepExpired 删除所有已过期的消息
+// 多 Pod 同时执行是安全的：每条消息只会被一个清理事务锁定并删除，过期事件也只会推送一次
+func (s *RetentionService) SweepExpired() {
+	for {
+		deleted, unreadChanges, err := s.deleteExpiredBatch()
+		if err != nil {
+			log.Printf("[ERROR] Failed to delete expired messages: %v", err)
+			return
+		}
+
+		// 按会话分组处理
+		messageIDsByConv := make(map[uuid.UUID][]uuid.UUID)
+		for _, row := range deleted {
+			messageIDsByConv[row.ConversationID] = append(messageIDsByConv[row.ConversationID], row.ID)
+		}
+		for conversationID, messageIDs := range messageIDsByConv {
+			s.purgeConversationState(conversationID, messageIDs)
+		}
+
+		// 未读数变化的成员推送最新未读数
+		if s.msgSvc.unreadNotifier != nil {
+			for _, change := range unreadChanges {
+				s.msgSvc.unreadNotifier.SendUnreadCountUpdate(change.UserID, change.ConversationID, change.UnreadCount)
+			}
+		}
+
+		if len(deleted) < expiredSweepBatchSize {
+			return
+		}
+	}
+}
+
+// expiredMessage 被清理的过期消息
+type expiredMessage struct {
+	ID             uuid.UUID
+	ConversationID uuid.UUID
+}
+
+// unreadChange 清理后未读数发生变化的成员
+type unreadChange struct {
+	ConversationID uuid.UUID
+	UserID         uuid.UUID
+	UnreadCount    int
+}
+
+// deleteExpiredBatch 在一个事务中删除一批过期消息，并扣减这些消息计入的计数：
+// 成员的未读数和未读提及数（在成员已读进度之后、由其他成员发送的消息），以及话题根消息的回复数
+func (s *RetentionService) deleteExpiredBatch() ([]expiredMessage, []unreadChange, error) {
+	var deleted []expiredMessage
+	var unreadChanges []unreadChange
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Raw(`
+			SELECT id, conversation_id FROM messages
+			WHERE expires_at IS NOT NULL AND expires_at <= NOW()
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		`, expiredSweepBatchSize).Scan(&deleted).Error; err != nil {
+			return err
+		}
+		if len(deleted) == 0 {
+			return nil
+		}
+		ids := make([]uuid.UUID, len(deleted))
+		for i, row := range deleted {
+			ids[i] = row.ID
+		}
+
+		// 1. 未读数：按已读进度（last_read_seq）判断，已读的消息即使被删除进度仍然有效
+		if err := tx.Raw(`
+			UPDATE conversation_members cm
+			SET unread_count = GREATEST(cm.unread_count - u.unread, 0),
+			    unread_mention_count = GREATEST(cm.unread_mention_count - u.mentions, 0)
+			FROM (
+				SELECT m.conversation_id, o.user_id,
+				       COUNT(*) AS unread,
+				       COUNT(*) FILTER (WHERE m.metadata->'mentioned_user_ids' @> jsonb_build_array(o.user_id::text)) AS mentions
+				FROM messages m
+				JOIN conversation_members o ON o.conversation_id = m.conversation_id
+				     AND o.user_id <> m.sender_id AND o.left_at IS NULL AND m.created_at >= o.joined_at
+				WHERE m.id IN ? AND m.seq > o.last_read_seq
+				GROUP BY m.conversation_id, o.user_id
+			) u
+			WHERE cm.conversation_id = u.conversation_id AND cm.user_id = u.user_id
+			  AND (cm.unread_count > 0 OR cm.unread_mention_count > 0)
+			RETURNING cm.conversation_id, cm.user_id, cm.unread_count
+		`, ids).Scan(&unreadChanges).Error; err != nil {
+			return fmt.Errorf("failed to update unread counts: %w", err)
+		}
+
+		// 2. 话题回复数（根消息本身也过期时不需要更新；已撤回的回复在撤回时已扣减）
+		if err := tx.Exec(`
+			UPDATE messages r
+			SET thread_reply_count = GREATEST(r.thread_reply_count - t.replies, 0)
+			FROM (
+				SELECT thread_root_id, COUNT(*) AS replies
+				FROM messages
+				WHERE id IN ? AND thread_root_id IS NOT NULL AND is_recalled = FALSE
+				GROUP BY thread_root_id
+			) t
+			WHERE r.id = t.thread_root_id AND r.id NOT IN ?
+		`, ids, ids).Error; err != nil {
+			return fmt.Errorf("failed to update thread reply counts: %w", err)
+		}
+
+		// 3. 删除消息
+		if err := tx.Exec("DELETE FROM messages WHERE id IN ?", ids).Error; err != nil {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return deleted, unreadChanges, nil
+}
+
+// purgeConversationState 清理已删除消息在离线队列和会话预览中的残留，并推送 expired 事件
+func (s *RetentionService) purgeConversationState(conversationID uuid.UUID, messageIDs []uuid.UUID) {
+	// 1. 从离线消息队列中移除
+	s.msgSvc.removeFromOfflineQueues(conversationID, messageIDs)
+
+	// 2. 如果会话最新消息已被删除，回退到剩余的最新消息并刷新会话列表预览
+	s.refreshLastMessage(conversationID, messageIDs)
+
+	// 3. 通知客户端删除本地缓存
+	if s.notifier != nil {
+		s.notifier.SendMessagesExpired(conversationID, messageIDs)
+	}
+}
+
+// refreshLastMessage 会话的 last_message_id 被删除时，改为剩余的最新消息（没有则置空），last_message_at 随之更新
+func (s *RetentionService) refreshLastMessage(conversationID uuid.UUID, deletedIDs []uuid.UUID) {
+	var conversation model.Conversation
+	if err := s.db.Where("id = ? AND last_message_id IN ?", conversationID, deletedIDs).
+		First(&conversation).Error; err != nil {
+		return // 会话不存在或最新消息未被删除
+	}
+
+	var latest model.Message
+	var lastMessageID *uuid.UUID
+	var lastMessageAt *time.Time
+	var previewText *string
+	if err := s.db.Where("conversation_id = ?", conversationID).
+		Order("seq DESC").
+		First(&latest).Error; err == nil {
+		lastMessageID = &latest.ID
+		lastMessageAt = &latest.CreatedAt
+		if !latest.IsRecalled {
+			previewText = buildMessagePreview(latest.MessageType, latest.Content, latest.PlainText)
+		}
+	}
+
+	if err := s.db.Model(&model.Conversation{}).Where("id = ?", conversationID).
+		Updates(map[string]interface{}{
+			"last_message_id": lastMessageID,
+			"last_message_at": lastMessageAt,
+		}).Error; err != nil {
+		log.Printf("[ERROR] Failed to refresh last message: conversation=%s, error=%v", conversationID, err)
+		return
+	}
+
+	if s.msgSvc.convNotifier == nil {
+		return
+	}
+	var members []model.ConversationMember
+	if err := s.db.Where("conversation_id = ? AND left_at IS NULL", conversationID).
+		Find(&members).Error; err != nil {
+		return
+	}
+	for _, member := range members {
+		s.msgSvc.convNotifier.SendConversationUpdate(member.UserID, conversationID, lastMessageAt, previewText, member.UnreadCount)
+	}
+}
@@ -0,0 +1,630 @@
+package service
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// 富文本消息（rich_text）支持的 Markdown 子集：
+//   - 行内：**粗体**、*斜体* / _斜体_、`代码`、[链接](https://...)、反斜杠转义
+//   - 块级：段落、无序列表（- / * / +）、有序列表（1. / 1)）、``` 代码块
+//
+// 其他语法（标题、引用、HTML 标签等）一律按普通文本处理。服务端解析后重新输出规范化的 Markdown 保存到 content，
+// 同时生成纯文本（预览和搜索）和 HTML（metadata.html），客户端以服务端结果为准，避免各端对星号等符号的解析不一致
+
+const (
+	// maxRichTextLength 富文本内容最大长度（字符数）
+	maxRichTextLength = 10000
+	// maxRichTextDepth 行内格式最大嵌套层数
+	maxRichTextDepth = 4
+)
+
+var (
+	richTextBulletPattern  = regexp.MustCompile(`^ {0,3}[-*+][ \t]+(.*)$`)
+	richTextOrderedPattern = regexp.MustCompile(`^ {0,3}(\d{1,9})[.)][ \t]+(.*)$`)
+	richTextFencePattern   = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})[ \t]*([A-Za-z0-9_+-]*)[ \t]*$")
+	// richTextLineStartPattern 规范化输出时需要转义的行首字符（避免被客户端解析为标题、引用、列表等）
+	richTextLineStartPattern = regexp.MustCompile(`^([#>+~-]|\d{1,9}[.)])`)
+)
+
+// richTextAllowedSchemes 链接允许的协议（其他协议的链接只保留文字）
+var richTextAllowedSchemes = map[string]bool{
+	"http":   true,
+	"https":  true,
+	"mailto": true,
+}
+
+// richTextInline 行内节点
+type richTextInline struct {
+	kind     string // 'text' | 'bold' | 'italic' | 'code' | 'link' | 'break'
+	text     string
+	url      string
+	children []richTextInline
+}
+
+// richTextBlock 块级节点
+type richTextBlock struct {
+	kind    string // 'paragraph' | 'bullet' | 'ordered' | 'code'
+	number  int    // 有序列表序号
+	lang    string // 代码块语言
+	code    string // 代码块内容
+	inlines []richTextInline
+}
+
+// renderedRichText 富文本解析结果
+type renderedRichText struct {
+	Markdown  string // 规范化的 Markdown（保存到 content）
+	PlainText string // 纯文本（预览和搜索）
+	HTML      string // 安全的 HTML（保存到 metadata.html）
+}
+
+// renderRichText 解析并清理富文本内容
+func renderRichText(source string) (*renderedRichText, error) {
+	if utf8.RuneCountInString(source) > maxRichTextLength {
+		return nil, invalidError("rich_text content exceeds %d characters", maxRichTextLength)
+	}
+	if !utf8.ValidString(source) {
+		return nil, invalidError("rich_text content is not valid UTF-8")
+	}
+
+	blocks := parseRichTextBlocks(source)
+	if len(blocks) == 0 {
+		return nil, invalidError("content is required for rich_text messages")
+	}
+
+	return &renderedRichText{
+		Markdown:  richTextMarkdown(blocks),
+		PlainText: richTextPlainText(blocks),
+		HTML:      richTextHTML(blocks),
+	}, nil
+}
+
+// richTextPreview 富文本的单行纯文本（用于会话预览）
+func richTextPreview(markdown string) string {
+	rendered, err := renderRichText(markdown)
+	if err != nil {
+		return markdown
+	}
+	return strings.Join(strings.Fields(rendered.PlainText), " ")
+}
+
+// ============================================
+// 解析
+// ============================================
+
+// parseRichTextBlocks 按行解析块级结构
+func parseRichTextBlocks(source string) []richTextBlock {
+	source = strings.ReplaceAll(source, "\r\n", "\n")
+	source = strings.ReplaceAll(source, "\r", "\n")
+	lines := strings.Split(source, "\n")
+
+	var blocks []richTextBlock
+	var paragraph []string
+	flush := func() {
+		if len(paragraph) > 0 {
+			blocks = appendRichTextBlock(blocks, richTextBlock{
+				kind:    "paragraph",
+				inlines: parseRichTextInlines(strings.Join(paragraph, "\n"), 0, false),
+			})
+			paragraph = nil
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], " \t")
+
+		if match := richTextFencePattern.FindStringSubmatch(line); match != nil {
+			flush()
+			fence := match[1]
+			var code []string
+			for i++; i < len(lines); i++ {
+				trimmed := strings.TrimSpace(lines[i])
+				if len(trimmed) >= len(fence) && strings.Trim(trimmed, fence[:1]) == "" {
+					break
+				}
+				code = append(code, strings.TrimRight(lines[i], " \t"))
+			}
+			blocks = append(blocks, richTextBlock{
+				kind: "code",
+				lang: strings.ToLower(match[2]),
+				code: strings.Join(code, "\n"),
+			})
+			continue
+		}
+
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+
+		if match := richTextBulletPattern.FindStringSubmatch(line); match != nil {
+			flush()
+			blocks = appendRichTextBlock(blocks, richTextBlock{
+				kind:    "bullet",
+				inlines: parseRichTextInlines(match[1], 0, false),
+			})
+			continue
+		}
+
+		if match := richTextOrderedPattern.FindStringSubmatch(line); match != nil {
+			flush()
+			number, _ := strconv.Atoi(match[1])
+			blocks = appendRichTextBlock(blocks, richTextBlock{
+				kind:    "ordered",
+				number:  number,
+				inlines: parseRichTextInlines(match[2], 0, false),
+			})
+			continue
+		}
+
+		paragraph = append(paragraph, strings.TrimLeft(line, " \t"))
+	}
+	flush()
+
+	return blocks
+}
+
+// appendRichTextBlock 忽略没有内容的块
+func appendRichTextBlock(blocks []richTextBlock, block richTextBlock) []richTextBlock {
+	if len(block.inlines) == 0 {
+		return blocks
+	}
+	return append(blocks, block)
+}
+
+// parseRichTextInlines 解析行内格式（无法配对的符号按普通文本处理）
+func parseRichTextInlines(source string, depth int, inLink bool) []richTextInline {
+	var nodes []richTextInline
+	var text strings.Builder
+	flushText := func() {
+		if text.Len() > 0 {
+			nodes = appendRichTextText(nodes, text.String())
+			text.Reset()
+		}
+	}
+
+	for i := 0; i < len(source); {
+		c := source[i]
+		switch {
+		case c == '\\' && i+1 < len(source) && isASCIIPunct(source[i+1]):
+			text.WriteByte(source[i+1])
+			i += 2
+			continue
+
+		case c == '\n':
+			flushText()
+			nodes = append(nodes, richTextInline{kind: "break"})
+			i++
+			continue
+
+		case c == '`':
+			run := countRun(source, i, '`')
+			if end := findBacktickRun(source, i+run, run); end >= 0 {
+				flushText()
+				nodes = append(nodes, richTextInline{kind: "code", text: normalizeCodeSpan(source[i+run : end])})
+				i = end + run
+				continue
+			}
+			text.WriteString(source[i : i+run])
+			i += run
+			continue
+
+		case (c == '*' || c == '_') && depth < maxRichTextDepth:
+			if inner, end, size, ok := matchEmphasis(source, i, c); ok {
+				children := parseRichTextInlines(inner, depth+1, inLink)
+				if len(children) > 0 {
+					flushText()
+					kind := "italic"
+					if size == 2 {
+						kind = "bold"
+					}
+					nodes = append(nodes, richTextInline{kind: kind, children: children})
+					i = end
+					continue
+				}
+			}
+			run := countRun(source, i, c)
+			text.WriteString(source[i : i+run])
+			i += run
+			continue
+
+		case c == '[' && !inLink && depth < maxRichTextDepth:
+			if label, target, end, ok := matchLink(source, i); ok {
+				flushText()
+				children := parseRichTextInlines(label, depth+1, true)
+				if safeURL, ok := sanitizeRichTextURL(target); ok {
+					if len(children) == 0 {
+						children = []richTextInline{{kind: "text", text: safeURL}}
+					}
+					nodes = append(nodes, richTextInline{kind: "link", url: safeURL, children: children})
+				} else {
+					// 不允许的链接（如 javascript:）只保留文字
+					for _, child := range children {
+						nodes = appendRichTextNode(nodes, child)
+					}
+				}
+				i = end
+				continue
+			}
+		}
+
+		text.WriteByte(c)
+		i++
+	}
+	flushText()
+
+	return nodes
+}
+
+// matchEmphasis 匹配从 start 开始的粗体（两个符号）或斜体（一个符号），返回内部文本和结束位置
+// 开始符号后不能是空白，结束符号前不能是空白；下划线不能出现在单词中间（如 snake_case）
+func matchEmphasis(source string, start int, delim byte) (inner string, end int, size int, ok bool) {
+	run := countRun(source, start, delim)
+	size = 1
+	if run >= 2 {
+		size = 2
+	}
+	open := start + size
+	if open >= len(source) || isSpaceByte(source[open]) {
+		return "", 0, 0, false
+	}
+	if delim == '_' && start > 0 && isWordByte(source[start-1]) {
+		return "", 0, 0, false
+	}
+
+	for j := open; j < len(source); {
+		switch source[j] {
+		case '\\':
+			j += 2
+			continue
+		case '\n':
+			return "", 0, 0, false
+		case '`':
+			codeRun := countRun(source, j, '`')
+			if codeEnd := findBacktickRun(source, j+codeRun, codeRun); codeEnd >= 0 {
+				j = codeEnd + codeRun
+			} else {
+				j += codeRun
+			}
+			continue
+		case delim:
+			closeRun := countRun(source, j, delim)
+			closeAt := j + closeRun - size // 连续符号时以末尾的符号作为结束
+			if closeRun >= size && closeAt > open && !isSpaceByte(source[closeAt-1]) &&
+				(size == 2 || closeRun == 1 || closeRun >= 3) {
+				after := closeAt + size
+				if delim != '_' || after >= len(source) || !isWordByte(source[after]) {
+					return source[open:closeAt], after, size, true
+				}
+			}
+			j += closeRun
+			continue
+		}
+		j++
+	}
+	return "", 0, 0, false
+}
+
+// matchLink 匹配 [文字](地址)，返回文字、地址和结束位置（文字中允许成对的方括号，地址中允许成对的圆括号）
+func matchLink(source string, start int) (label, target string, end int, ok bool) {
+	depth := 0
+	closeBracket := -1
+	for j := start; j < len(source) && closeBracket < 0; j++ {
+		switch source[j] {
+		case '\\':
+			j++
+		case '\n':
+			return "", "", 0, false
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				closeBracket = j
+			}
+		}
+	}
+	if closeBracket < 0 || closeBracket+1 >= len(source) || source[closeBracket+1] != '(' {
+		return "", "", 0, false
+	}
+
+	parens := 0
+	for j := closeBracket + 2; j < len(source); j++ {
+		switch source[j] {
+		case ' ', '\t', '\n':
+			return "", "", 0, false
+		case '(':
+			parens++
+		case ')':
+			if parens == 0 {
+				return source[start+1 : closeBracket], source[closeBracket+2 : j], j + 1, true
+			}
+			parens--
+		}
+	}
+	return "", "", 0, false
+}
+
+// sanitizeRichTextURL 校验链接地址（只允许 http/https/mailto）
+func sanitizeRichTextURL(raw string) (string, bool) {
+	parsed, err := url.Parse(raw)
+	if err != nil || !richTextAllowedSchemes[strings.ToLower(parsed.Scheme)] {
+		return "", false
+	}
+	if parsed.Scheme != "mailto" && parsed.Host == "" {
+		return "", false
+	}
+	parsed.Scheme = strings.ToLower(parsed.Scheme)
+	return parsed.String(), true
+}
+
+// normalizeCodeSpan 行内代码：换行视为空格，两端各去掉一个空格（用于包含反引号的代码）
+func normalizeCodeSpan(code string) string {
+	code = strings.ReplaceAll(code, "\n", " ")
+	if len(code) >= 2 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.Trim(code, " ") != "" {
+		code = code[1 : len(code)-1]
+	}
+	return code
+}
+
+// appendRichTextText 追加文本节点（与相邻的文本节点合并）
+func appendRichTextText(nodes []richTextInline, text string) []richTextInline {
+	return appendRichTextNode(nodes, richTextInline{kind: "text", text: text})
+}
+
+func appendRichTextNode(nodes []richTextInline, node richTextInline) []richTextInline {
+	if node.kind == "text" && len(nodes) > 0 && nodes[len(nodes)-1].kind == "text" {
+		nodes[len(nodes)-1].text += node.text
+		return nodes
+	}
+	return append(nodes, node)
+}
+
+func countRun(source string, start int, c byte) int {
+	n := 0
+	for start+n < len(source) && source[start+n] == c {
+		n++
+	}
+	return n
+}
+
+// findBacktickRun 查找长度恰好为 n 的反引号串
+func findBacktickRun(source string, from, n int) int {
+	for j := from; j < len(source); {
+		if source[j] != '`' {
+			j++
+			continue
+		}
+		run := countRun(source, j, '`')
+		if run == n {
+			return j
+		}
+		j += run
+	}
+	return -1
+}
+
+func isASCIIPunct(c byte) bool {
+	return strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) >= 0
+}
+
+func isSpaceByte(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n'
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= 0x80 || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// ============================================
+// 输出
+// ============================================
+
+// richTextMarkdown 输出规范化的 Markdown（再次解析得到相同的结构）
+func richTextMarkdown(blocks []richTextBlock) string {
+	var sb strings.Builder
+	for i, block := range blocks {
+		if i > 0 {
+			if isListBlock(block) && blocks[i-1].kind == block.kind {
+				sb.WriteString("\n")
+			} else {
+				sb.WriteString("\n\n")
+			}
+		}
+
+		switch block.kind {
+		case "code":
+			fence := strings.Repeat("`", max(3, longestRun(block.code, '`')+1))
+			sb.WriteString(fence + block.lang + "\n")
+			if block.code != "" {
+				sb.WriteString(block.code + "\n")
+			}
+			sb.WriteString(fence)
+		case "bullet":
+			sb.WriteString("- " + markdownInlines(block.inlines))
+		case "ordered":
+			sb.WriteString(strconv.Itoa(block.number) + ". " + markdownInlines(block.inlines))
+		default:
+			lines := strings.Split(markdownInlines(block.inlines), "\n")
+			for j, line := range lines {
+				if j > 0 {
+					sb.WriteString("\n")
+				}
+				sb.WriteString(escapeMarkdownLineStart(line))
+			}
+		}
+	}
+	return sb.String()
+}
+
+func markdownInlines(nodes []richTextInline) string {
+	var sb strings.Builder
+	for _, node := range nodes {
+		switch node.kind {
+		case "text":
+			sb.WriteString(escapeMarkdownText(node.text))
+		case "break":
+			sb.WriteString("\n")
+		case "bold":
+			sb.WriteString("**" + markdownInlines(node.children) + "**")
+		case "italic":
+			sb.WriteString("*" + markdownInlines(node.children) + "*")
+		case "code":
+			fence := strings.Repeat("`", longestRun(node.text, '`')+1)
+			code := node.text
+			if strings.HasPrefix(code, "`") || strings.HasSuffix(code, "`") ||
+				(len(code) >= 2 && code[0] == ' ' && code[len(code)-1] == ' ') {
+				code = " " + code + " "
+			}
+			sb.WriteString(fence + code + fence)
+		case "link":
+			// 地址中的圆括号总是成对的（解析时保证），可以原样输出
+			sb.WriteString("[" + markdownInlines(node.children) + "](" + node.url + ")")
+		}
+	}
+	return sb.String()
+}
+
+// escapeMarkdownText 转义文本中的格式符号和 '<'（避免客户端把文本解析为 HTML 标签）
+func escapeMarkdownText(text string) string {
+	var sb strings.Builder
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '\\', '*', '_', '`', '[', ']', '<':
+			sb.WriteByte('\\')
+		}
+		sb.WriteByte(text[i])
+	}
+	return sb.String()
+}
+
+// escapeMarkdownLineStart 段落中以列表、标题、引用等符号开头的行在符号前加转义
+func escapeMarkdownLineStart(line string) string {
+	loc := richTextLineStartPattern.FindStringIndex(line)
+	if loc == nil {
+		return line
+	}
+	markerAt := loc[1] - 1
+	return line[:markerAt] + "\\" + line[markerAt:]
+}
+
+// richTextPlainText 输出纯文本（链接只保留文字，列表保留序号）
+func richTextPlainText(blocks []richTextBlock) string {
+	lines := make([]string, 0, len(blocks))
+	for _, block := range blocks {
+		switch block.kind {
+		case "code":
+			lines = append(lines, block.code)
+		case "bullet":
+			lines = append(lines, "- "+plainInlines(block.inlines))
+		case "ordered":
+			lines = append(lines, strconv.Itoa(block.number)+". "+plainInlines(block.inlines))
+		default:
+			lines = append(lines, plainInlines(block.inlines))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func plainInlines(nodes []richTextInline) string {
+	var sb strings.Builder
+	for _, node := range nodes {
+		switch node.kind {
+		case "text", "code":
+			sb.WriteString(node.text)
+		case "break":
+			sb.WriteString("\n")
+		default:
+			sb.WriteString(plainInlines(node.children))
+		}
+	}
+	return sb.String()
+}
+
+// richTextHTML 输出 HTML（所有文本都经过转义，只包含固定的标签）
+func richTextHTML(blocks []richTextBlock) string {
+	var sb strings.Builder
+	for i, block := range blocks {
+		prevKind, nextKind := "", ""
+		if i > 0 {
+			prevKind = blocks[i-1].kind
+		}
+		if i+1 < len(blocks) {
+			nextKind = blocks[i+1].kind
+		}
+
+		switch block.kind {
+		case "code":
+			sb.WriteString("<pre><code")
+			if block.lang != "" {
+				sb.WriteString(` class="language-` + html.EscapeString(block.lang) + `"`)
+			}
+			sb.WriteString(">" + html.EscapeString(block.code) + "</code></pre>")
+		case "bullet", "ordered":
+			tag := "ul"
+			if block.kind == "ordered" {
+				tag = "ol"
+			}
+			if prevKind != block.kind {
+				if block.kind == "ordered" && block.number != 1 {
+					sb.WriteString(`<ol start="` + strconv.Itoa(block.number) + `">`)
+				} else {
+					sb.WriteString("<" + tag + ">")
+				}
+			}
+			sb.WriteString("<li>" + htmlInlines(block.inlines) + "</li>")
+			if nextKind != block.kind {
+				sb.WriteString("</" + tag + ">")
+			}
+		default:
+			sb.WriteString("<p>" + htmlInlines(block.inlines) + "</p>")
+		}
+	}
+	return sb.String()
+}
+
+func htmlInlines(nodes []richTextInline) string {
+	var sb strings.Builder
+	for _, node := range nodes {
+		switch node.kind {
+		case "text":
+			sb.WriteString(html.EscapeString(node.text))
+		case "break":
+			sb.WriteString("<br>")
+		case "bold":
+			sb.WriteString("<strong>" + htmlInlines(node.children) + "</strong>")
+		case "italic":
+			sb.WriteString("<em>" + htmlInlines(node.children) + "</em>")
+		case "code":
+			sb.WriteString("<code>" + html.EscapeString(node.text) + "</code>")
+		case "link":
+			sb.WriteString(`<a href="` + html.EscapeString(node.url) + `" rel="nofollow noopener noreferrer" target="_blank">` +
+				htmlInlines(node.children) + "</a>")
+		}
+	}
+	return sb.String()
+}
+
+func isListBlock(block richTextBlock) bool {
+	return block.kind == "bullet" || block.kind == "ordered"
+}
+
+func longestRun(text string, c byte) int {
+	longest := 0
+	for i := 0; i < len(text); {
+		if text[i] != c {
+			i++
+			continue
+		}
+		run := countRun(text, i, c)
+		if run > longest {
+			longest = run
+		}
+		i += run
+	}
+	return longest
+}
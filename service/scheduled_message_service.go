@@ -0,0 +1,375 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"dinq_message/model"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+const (
+	// maxScheduleAhead 最多可以提前多久预约发送
+	maxScheduleAhead = 30 * 24 * time.Hour
+	// scheduledDispatchBatchSize 调度器每轮最多发送的消息数
+	scheduledDispatchBatchSize = 100
+	// scheduledDispatcherLockKey 调度器分布式锁（多 Pod 部署时同一时刻只有一个 Pod 在扫描）
+	scheduledDispatcherLockKey = "lock:scheduled_dispatcher"
+	// scheduledClaimTimeout 领取后超过该时间仍为 sending 的消息视为发送中断（Pod 崩溃等），重新领取
+	scheduledClaimTimeout = 5 * time.Minute
+)
+
+// releaseLockScript 只有锁仍属于自己（值与加锁时的 token 相同）时才删除，避免删掉过期后被其他 Pod 获取的锁
+var releaseLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+type ScheduledMessageService struct {
+	db          *gorm.DB
+	rdb         *redis.Client
+	msgSvc      *MessageService
+	broadcaster MessageBroadcaster
+	stop        chan struct{}
+}
+
+// MessageBroadcaster 接口用于推送新消息给会话成员
+type MessageBroadcaster interface {
+	BroadcastNewMessage(message *model.Message)
+}
+
+func NewScheduledMessageService(db *gorm.DB, rdb *redis.Client, msgSvc *MessageService) *ScheduledMessageService {
+	return &ScheduledMessageService{
+		db:     db,
+		rdb:    rdb,
+		msgSvc: msgSvc,
+		stop:   make(chan struct{}),
+	}
+}
+
+// SetBroadcaster 设置新消息推送器（用于依赖注入）
+func (s *ScheduledMessageService) SetBroadcaster(broadcaster MessageBroadcaster) {
+	s.broadcaster = broadcaster
+}
+
+// ScheduleMessageRequest 创建定时消息请求
+type ScheduleMessageRequest struct {
+	SendMessageRequest
+	ScheduledAt time.Time `json:"scheduled_at"`
+}
+
+// UpdateScheduledMessageRequest 修改定时消息请求（只允许修改内容和发送时间）
+type UpdateScheduledMessageRequest struct {
+	Content     *string                `json:"content,omitempty"`
+	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+	ScheduledAt *time.Time             `json:"scheduled_at,omitempty"`
+}
+
+// CreateScheduledMessage 创建定时消息
+func (s *ScheduledMessageService) CreateScheduledMessage(userID uuid.UUID, req *ScheduleMessageRequest) (*model.ScheduledMessage, error) {
+	if req.MessageType == "" {
+		return nil, fmt.Errorf("message_type is required")
+	}
+	if req.MessageType == "text" && (req.Content == nil || *req.Content == "") {
+		return nil, fmt.Errorf("content is required for text messages")
+	}
+	if req.MessageType == "rich_text" {
+		if req.Content == nil {
+			return nil, fmt.Errorf("content is required for rich_text messages")
+		}
+		// 创建时校验，发送时再生成规范化内容
+		if _, err := renderRichText(*req.Content); err != nil {
+			return nil, err
+		}
+	}
+	if req.MessageType == "poll" {
+		return nil, fmt.Errorf("poll messages cannot be scheduled")
+	}
+	req.ScheduledAt = normalizeScheduledAt(req.ScheduledAt)
+	if err := validateScheduledAt(req.ScheduledAt); err != nil {
+		return nil, err
+	}
+
+	scheduled := &model.ScheduledMessage{
+		SenderID:         userID,
+		MessageType:      req.MessageType,
+		Content:          req.Content,
+		ReplyToMessageID: req.ReplyToMessageID,
+		ScheduledAt:      req.ScheduledAt,
+		Status:           "pending",
+	}
+
+	switch {
+	case req.ConversationID != uuid.Nil:
+		isMember, err := s.msgSvc.isConversationMember(req.ConversationID, userID)
+		if err != nil || !isMember {
+			return nil, fmt.Errorf("user is not a member of this conversation")
+		}
+		scheduled.ConversationID = &req.ConversationID
+		scheduled.ReceiverID = req.ReceiverID
+	case req.ReceiverID != nil:
+		scheduled.ReceiverID = req.ReceiverID
+	default:
+		return nil, fmt.Errorf("conversation_id is required")
+	}
+
+	if req.Metadata != nil {
+		metadataBytes, err := json.Marshal(req.Metadata)
+		if err != nil {
+			return nil, fmt.Errorf("invalid metadata: %w", err)
+		}
+		scheduled.Metadata = metadataBytes
+	}
+
+	if err := s.db.Create(scheduled).Error; err != nil {
+		return nil, fmt.Errorf("failed to create scheduled message: %w", err)
+	}
+
+	return scheduled, nil
+}
+
+// ListScheduledMessages 获取用户的定时消息（按发送时间正序，status 为空时返回全部）
+func (s *ScheduledMessageService) ListScheduledMessages(userID uuid.UUID, status string, limit, offset int) ([]model.ScheduledMessage, error) {
+	query := s.db.Where("sender_id = ?", userID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var scheduled []model.ScheduledMessage
+	if err := query.Order("scheduled_at ASC").
+		Limit(limit).
+		Offset(offset).
+		Find(&scheduled).Error; err != nil {
+		return nil, fmt.Errorf("failed to query scheduled messages: %w", err)
+	}
+
+	return scheduled, nil
+}
+
+// UpdateScheduledMessage 修改定时消息（仅 pending 状态可修改）
+func (s *ScheduledMessageService) UpdateScheduledMessage(userID, scheduledID uuid.UUID, req *UpdateScheduledMessageRequest) (*model.ScheduledMessage, error) {
+	scheduled, err := s.getOwnScheduledMessage(userID, scheduledID)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{}
+	if req.Content != nil {
+		if scheduled.MessageType == "text" && *req.Content == "" {
+			return nil, fmt.Errorf("content is required for text messages")
+		}
+		if scheduled.MessageType == "rich_text" {
+			if _, err := renderRichText(*req.Content); err != nil {
+				return nil, err
+			}
+		}
+		updates["content"] = *req.Content
+	}
+	if req.Metadata != nil {
+		metadataBytes, err := json.Marshal(req.Metadata)
+		if err != nil {
+			return nil, fmt.Errorf("invalid metadata: %w", err)
+		}
+		updates["metadata"] = metadataBytes
+	}
+	if req.ScheduledAt != nil {
+		scheduledAt := normalizeScheduledAt(*req.ScheduledAt)
+		if err := validateScheduledAt(scheduledAt); err != nil {
+			return nil, err
+		}
+		updates["scheduled_at"] = scheduledAt
+	}
+	if len(updates) == 0 {
+		return scheduled, nil
+	}
+
+	// 条件更新：调度器可能已经领取该消息
+	result := s.db.Model(&model.ScheduledMessage{}).
+		Where("id = ? AND status = ?", scheduledID, "pending").
+		Updates(updates)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to update scheduled message: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, fmt.Errorf("scheduled message is no longer pending")
+	}
+
+	return s.getOwnScheduledMessage(userID, scheduledID)
+}
+
+// CancelScheduledMessage 取消定时消息（仅 pending 状态可取消）
+func (s *ScheduledMessageService) CancelScheduledMessage(userID, scheduledID uuid.UUID) error {
+	if _, err := s.getOwnScheduledMessage(userID, scheduledID); err != nil {
+		return err
+	}
+
+	result := s.db.Model(&model.ScheduledMessage{}).
+		Where("id = ? AND status = ?", scheduledID, "pending").
+		Update("status", "cancelled")
+	if result.Error != nil {
+		return fmt.Errorf("failed to cancel scheduled message: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("scheduled message is no longer pending")
+	}
+
+	return nil
+}
+
+// getOwnScheduledMessage 查询用户自己的定时消息
+func (s *ScheduledMessageService) getOwnScheduledMessage(userID, scheduledID uuid.UUID) (*model.ScheduledMessage, error) {
+	var scheduled model.ScheduledMessage
+	if err := s.db.Where("id = ? AND sender_id = ?", scheduledID, userID).First(&scheduled).Error; err != nil {
+		return nil, fmt.Errorf("scheduled message not found")
+	}
+	return &scheduled, nil
+}
+
+// normalizeScheduledAt 把客户端提交的时间（可能带任意时区偏移）转换为服务器时区
+// scheduled_at 列不带时区，与其他时间字段一样按服务器时区保存，调度器用 NOW() 比较
+func normalizeScheduledAt(scheduledAt time.Time) time.Time {
+	if scheduledAt.IsZero() {
+		return scheduledAt
+	}
+	return scheduledAt.In(time.Local)
+}
+
+// validateScheduledAt 校验预约发送时间
+func validateScheduledAt(scheduledAt time.Time) error {
+	if scheduledAt.IsZero() {
+		return fmt.Errorf("scheduled_at is required")
+	}
+	if !scheduledAt.After(time.Now()) {
+		return fmt.Errorf("scheduled_at must be in the future")
+	}
+	if scheduledAt.After(time.Now().Add(maxScheduleAhead)) {
+		return fmt.Errorf("scheduled_at must be within %d days", int(maxScheduleAhead.Hours()/24))
+	}
+	return nil
+}
+
+// StartDispatcher 启动后台调度器，定期发送到期的定时消息
+func (s *ScheduledMessageService) StartDispatcher(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		log.Printf("[INFO] Scheduled message dispatcher started (interval=%s)", interval)
+
+		for {
+			select {
+			case <-s.stop:
+				log.Printf("[INFO] Scheduled message dispatcher stopped")
+				return
+			case <-ticker.C:
+				s.DispatchDue()
+			}
+		}
+	}()
+}
+
+// StopDispatcher 停止后台调度器
+func (s *ScheduledMessageService) StopDispatcher() {
+	close(s.stop)
+}
+
+// DispatchDue 发送所有到期的定时消息
+// 多 Pod 安全：Redis 锁保证同一时刻只有一个 Pod 扫描；每条消息通过 pending -> sending 的条件更新领取，
+// 即使锁过期也不会被重复领取。领取后发送中断（长时间停留在 sending）的消息会被重新领取，
+// 重新发送时以定时消息ID作为 client_msg_id，已经创建过的消息不会重复创建
+func (s *ScheduledMessageService) DispatchDue() {
+	ctx := context.Background()
+
+	token, err := newLockToken()
+	if err != nil {
+		log.Printf("[ERROR] Failed to generate dispatcher lock token: %v", err)
+		return
+	}
+	ok, err := s.rdb.SetNX(ctx, scheduledDispatcherLockKey, token, 30*time.Second).Result()
+	if err != nil || !ok {
+		return
+	}
+	defer releaseLockScript.Run(ctx, s.rdb, []string{scheduledDispatcherLockKey}, token)
+
+	// 领取到期的消息和发送中断的消息（SKIP LOCKED 避免与正在修改/取消的事务互相等待）
+	var claimed []model.ScheduledMessage
+	if err := s.db.Raw(`
+		UPDATE scheduled_messages
+		SET status = 'sending', updated_at = NOW()
+		WHERE id IN (
+			SELECT id FROM scheduled_messages
+			WHERE (status = 'pending' AND scheduled_at <= NOW())
+				OR (status = 'sending' AND updated_at < NOW() - make_interval(secs => ?))
+			ORDER BY scheduled_at
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *
+	`, scheduledClaimTimeout.Seconds(), scheduledDispatchBatchSize).Scan(&claimed).Error; err != nil {
+		log.Printf("[ERROR] Failed to claim scheduled messages: %v", err)
+		return
+	}
+
+	for i := range claimed {
+		s.deliver(&claimed[i])
+	}
+}
+
+// newLockToken 生成分布式锁的持有者标识
+func newLockToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// deliver 通过正常发送流程发出定时消息，并记录发送结果
+// client_msg_id 固定为定时消息ID：重新领取后再次发送时直接返回第一次创建的消息
+func (s *ScheduledMessageService) deliver(scheduled *model.ScheduledMessage) {
+	clientMsgID := scheduled.ID.String()
+	req := &SendMessageRequest{
+		ReceiverID:       scheduled.ReceiverID,
+		MessageType:      scheduled.MessageType,
+		Content:          scheduled.Content,
+		ReplyToMessageID: scheduled.ReplyToMessageID,
+		ClientMsgID:      &clientMsgID,
+	}
+	if scheduled.ConversationID != nil {
+		req.ConversationID = *scheduled.ConversationID
+	}
+	if len(scheduled.Metadata) > 0 {
+		json.Unmarshal(scheduled.Metadata, &req.Metadata)
+	}
+
+	message, err := s.msgSvc.SendMessage(scheduled.SenderID, req)
+	if err != nil {
+		log.Printf("[ERROR] Failed to send scheduled message %s: %v", scheduled.ID, err)
+		s.db.Model(&model.ScheduledMessage{}).Where("id = ?", scheduled.ID).Updates(map[string]interface{}{
+			"status": "failed",
+			"error":  err.Error(),
+		})
+		return
+	}
+
+	now := time.Now()
+	s.db.Model(&model.ScheduledMessage{}).Where("id = ?", scheduled.ID).Updates(map[string]interface{}{
+		"status":          "sent",
+		"sent_message_id": message.ID,
+		"sent_at":         now,
+	})
+
+	if s.broadcaster != nil {
+		s.broadcaster.BroadcastNewMessage(message)
+	}
+}
@@ -0,0 +1,262 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"dinq_message/model"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// maxSyncMessages 一次同步最多返回的新消息数，超过时要求客户端重新拉取（reset）
+	maxSyncMessages = 1000
+	// syncOverlap 撤回、编辑、已读和会话变化的同步窗口向前重叠的时长：覆盖检查点之前开始、之后才提交的事务以及 Pod 之间的时钟误差
+	syncOverlap = 10 * time.Second
+	// syncCheckpointVersion 检查点格式版本
+	syncCheckpointVersion = 2
+)
+
+// 同步协议：客户端保存每次同步返回的检查点（每个设备各自保存），重连时带上检查点，
+// 服务端从数据库查询自检查点以来的新消息、撤回、编辑、已读和会话变化，不依赖 Redis 离线队列，
+// 同一用户的多个设备可以各自同步；同步结果送出后由连接方清空该用户的离线队列（离线期间的消息已包含在同步结果中）。
+// 检查点记录生成时间和每个会话当时的 last_seq：新消息按会话内序号同步（seq 大于检查点中的序号），不重复也不遗漏；
+// 撤回、编辑、已读和会话变化按时间同步，窗口与上次有少量重叠，客户端按消息ID/会话ID合并即可（这些事件都是幂等的）。
+
+// syncCheckpoint 解析后的检查点
+type syncCheckpoint struct {
+	at   time.Time
+	seqs map[uuid.UUID]int64 // map[会话ID]生成检查点时的 last_seq
+}
+
+// syncSeqRange 一个会话需要同步的消息序号范围 (from_seq, to_seq]
+type syncSeqRange struct {
+	ConversationID uuid.UUID `json:"conversation_id"`
+	FromSeq        int64     `json:"from_seq"`
+	ToSeq          int64     `json:"to_seq"`
+}
+
+// SyncService 断线重连同步服务
+type SyncService struct {
+	db     *gorm.DB
+	sysSvc *SystemSettingsService
+}
+
+func NewSyncService(db *gorm.DB, sysSvc *SystemSettingsService) *SyncService {
+	return &SyncService{
+		db:     db,
+		sysSvc: sysSvc,
+	}
+}
+
+// Sync 返回自检查点以来的所有变化（检查点为空、超过 sync_max_age_hours 或新消息超过上限时返回 reset）
+func (s *SyncService) Sync(userID uuid.UUID, checkpoint string) (*model.SyncResult, error) {
+	var since *syncCheckpoint
+	if checkpoint != "" {
+		parsed, err := parseSyncCheckpoint(checkpoint)
+		if err != nil {
+			return nil, err
+		}
+		since = parsed
+	}
+
+	// 先取各会话当前的 last_seq：序号在事务中分配并随消息一起提交，不超过它的消息都已经可见
+	until := time.Now()
+	seqs, err := s.conversationSeqs(userID)
+	if err != nil {
+		return nil, err
+	}
+	result := &model.SyncResult{
+		Checkpoint:    formatSyncCheckpoint(syncCheckpoint{at: until, seqs: seqs}),
+		Messages:      []model.Message{},
+		Recalled:      []model.SyncRecall{},
+		Edited:        []model.SyncEdit{},
+		Read:          []model.SyncRead{},
+		Conversations: []model.SyncConversation{},
+	}
+
+	// 旧格式的检查点（只有时间）无法按序号同步，同样要求重新拉取
+	if since == nil || since.seqs == nil {
+		result.Reset = true
+		return result, nil
+	}
+	maxAge := time.Duration(s.sysSvc.GetIntSetting("sync_max_age_hours", 168)) * time.Hour
+	if until.Sub(since.at) > maxAge {
+		result.Reset = true
+		return result, nil
+	}
+	from := since.at.Add(-syncOverlap)
+
+	// 1. 新消息：每个会话中序号大于检查点的消息（只包含加入会话之后发送的、未过期的消息；
+	//    检查点之后才加入的会话序号从 0 开始）
+	var ranges []syncSeqRange
+	for conversationID, toSeq := range seqs {
+		if fromSeq := since.seqs[conversationID]; toSeq > fromSeq {
+			ranges = append(ranges, syncSeqRange{ConversationID: conversationID, FromSeq: fromSeq, ToSeq: toSeq})
+		}
+	}
+	var messages []model.Message
+	if len(ranges) > 0 {
+		rangesJSON, err := json.Marshal(ranges)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode seq ranges: %w", err)
+		}
+		if err := s.db.Table("messages m").
+			Select("m.*").
+			Joins("JOIN jsonb_to_recordset(?::jsonb) AS r(conversation_id uuid, from_seq bigint, to_seq bigint) ON r.conversation_id = m.conversation_id", string(rangesJSON)).
+			Joins("JOIN conversation_members cm ON cm.conversation_id = m.conversation_id AND cm.user_id = ? AND cm.left_at IS NULL", userID).
+			Where("m.seq > r.from_seq AND m.seq <= r.to_seq AND m.created_at >= cm.joined_at").
+			Where("m.expires_at IS NULL OR m.expires_at > ?", until).
+			Order("m.created_at ASC, m.seq ASC").
+			Limit(maxSyncMessages + 1).
+			Find(&messages).Error; err != nil {
+			return nil, fmt.Errorf("failed to query messages: %w", err)
+		}
+	}
+	if len(messages) > maxSyncMessages {
+		result.Reset = true
+		return result, nil
+	}
+	readReceiptEnabled := s.sysSvc.IsFeatureEnabled("enable_read_receipt")
+	if err := attachMessageDetails(s.db, userID, readReceiptEnabled, messages); err != nil {
+		return nil, err
+	}
+	result.Messages = messages
+
+	// 2. 撤回
+	if err := s.db.Table("messages m").
+		Select("m.id AS message_id, m.conversation_id, m.recalled_at").
+		Joins("JOIN conversation_members cm ON cm.conversation_id = m.conversation_id AND cm.user_id = ? AND cm.left_at IS NULL", userID).
+		Where("m.is_recalled = ? AND m.recalled_at > ? AND m.recalled_at <= ?", true, from, until).
+		Order("m.recalled_at ASC").
+		Scan(&result.Recalled).Error; err != nil {
+		return nil, fmt.Errorf("failed to query recalled messages: %w", err)
+	}
+
+	// 3. 编辑（已撤回的消息只返回撤回事件）
+	if err := s.db.Table("messages m").
+		Select("m.id AS message_id, m.conversation_id, m.content, m.plain_text, m.metadata, m.edited_at").
+		Joins("JOIN conversation_members cm ON cm.conversation_id = m.conversation_id AND cm.user_id = ? AND cm.left_at IS NULL", userID).
+		Where("m.is_recalled = ? AND m.edited_at > ? AND m.edited_at <= ?", false, from, until).
+		Order("m.edited_at ASC").
+		Scan(&result.Edited).Error; err != nil {
+		return nil, fmt.Errorf("failed to query edited messages: %w", err)
+	}
+
+	// 4. 已读进度：自己的已读用于多设备同步未读状态，其他成员的已读仅在开启已读回执时返回
+	readQuery := s.db.Table("conversation_members o").
+		Select("o.conversation_id, o.user_id, o.last_read_message_id AS message_id, o.last_read_at AS read_at").
+		Joins("JOIN conversation_members cm ON cm.conversation_id = o.conversation_id AND cm.user_id = ? AND cm.left_at IS NULL", userID).
+		Where("o.left_at IS NULL AND o.last_read_message_id IS NOT NULL AND o.last_read_at > ?", from)
+	if !readReceiptEnabled {
+		readQuery = readQuery.Where("o.user_id = ?", userID)
+	}
+	if err := readQuery.Order("o.last_read_at ASC").Scan(&result.Read).Error; err != nil {
+		return nil, fmt.Errorf("failed to query read receipts: %w", err)
+	}
+
+	// 5. 会话变化：新消息、设置变化、成员加入/离开、自己的已读（未读数变化）
+	if err := s.db.Raw(`
+		SELECT c.id AS conversation_id, c.conversation_type, c.group_name, c.last_message_at, c.last_seq,
+		       c.message_ttl_seconds, cm.unread_count, cm.unread_mention_count, cm.is_hidden,
+		       cm.left_at IS NOT NULL AS "left"
+		FROM conversation_members cm
+		JOIN conversations c ON c.id = cm.conversation_id
+		WHERE cm.user_id = ?
+		  AND (cm.left_at IS NULL OR cm.left_at > ?)
+		  AND (
+		      c.updated_at > ? OR cm.joined_at > ? OR cm.left_at > ? OR cm.last_read_at > ?
+		      OR EXISTS (
+		          SELECT 1 FROM conversation_members o
+		          WHERE o.conversation_id = c.id AND (o.joined_at > ? OR o.left_at > ?)
+		      )
+		  )
+		ORDER BY c.last_message_at DESC NULLS LAST
+	`, userID, from, from, from, from, from, from, from).Scan(&result.Conversations).Error; err != nil {
+		return nil, fmt.Errorf("failed to query conversations: %w", err)
+	}
+
+	return result, nil
+}
+
+// conversationSeqs 用户所在会话（未离开）当前的 last_seq
+func (s *SyncService) conversationSeqs(userID uuid.UUID) (map[uuid.UUID]int64, error) {
+	var rows []struct {
+		ID      uuid.UUID
+		LastSeq int64
+	}
+	if err := s.db.Table("conversations c").
+		Select("c.id, c.last_seq").
+		Joins("JOIN conversation_members cm ON cm.conversation_id = c.id AND cm.user_id = ? AND cm.left_at IS NULL", userID).
+		Where("c.last_seq > 0").
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to query conversation seqs: %w", err)
+	}
+	seqs := make(map[uuid.UUID]int64, len(rows))
+	for _, row := range rows {
+		seqs[row.ID] = row.LastSeq
+	}
+	return seqs, nil
+}
+
+// formatSyncCheckpoint 检查点对客户端是不透明的字符串：
+// base64url(版本号, Unix 微秒时间戳, 每个会话的 会话ID(16 字节) + last_seq)，整数为 varint
+func formatSyncCheckpoint(checkpoint syncCheckpoint) string {
+	buf := make([]byte, 0, 1+binary.MaxVarintLen64+len(checkpoint.seqs)*(16+binary.MaxVarintLen64))
+	buf = append(buf, syncCheckpointVersion)
+	buf = binary.AppendUvarint(buf, uint64(checkpoint.at.UnixMicro()))
+	for conversationID, seq := range checkpoint.seqs {
+		buf = append(buf, conversationID[:]...)
+		buf = binary.AppendUvarint(buf, uint64(seq))
+	}
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// parseSyncCheckpoint 解析检查点（旧格式为 Unix 微秒时间戳，解析结果不包含会话序号）
+func parseSyncCheckpoint(checkpoint string) (*syncCheckpoint, error) {
+	invalid := invalidError("invalid checkpoint")
+
+	var result syncCheckpoint
+	if micros, err := strconv.ParseInt(checkpoint, 10, 64); err == nil {
+		if micros <= 0 {
+			return nil, invalid
+		}
+		result.at = time.UnixMicro(micros)
+	} else {
+		buf, err := base64.RawURLEncoding.DecodeString(checkpoint)
+		if err != nil || len(buf) == 0 || buf[0] != syncCheckpointVersion {
+			return nil, invalid
+		}
+		buf = buf[1:]
+		micros, n := binary.Uvarint(buf)
+		if n <= 0 || micros == 0 || micros > uint64(1<<62) {
+			return nil, invalid
+		}
+		buf = buf[n:]
+		result.at = time.UnixMicro(int64(micros))
+		result.seqs = make(map[uuid.UUID]int64)
+		for len(buf) > 0 {
+			if len(buf) < 16 {
+				return nil, invalid
+			}
+			conversationID, _ := uuid.FromBytes(buf[:16])
+			seq, n := binary.Uvarint(buf[16:])
+			if n <= 0 || seq > uint64(1<<62) {
+				return nil, invalid
+			}
+			result.seqs[conversationID] = int64(seq)
+			buf = buf[16+n:]
+		}
+	}
+
+	if result.at.After(time.Now().Add(syncOverlap)) {
+		return nil, invalid
+	}
+	return &result, nil
+}
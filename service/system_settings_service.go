@@ -2,6 +2,8 @@ package service
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 	"sync"
 
 	"dinq_message/model"
@@ -61,6 +63,34 @@ func (s *SystemSettingsService) GetBoolSetting(key string, defaultValue bool) bo
 	return value == "true"
 }
 
+// GetIntSetting 获取整数类型配置（不存在或格式错误时返回默认值）
+func (s *SystemSettingsService) GetIntSetting(key string, defaultValue int) int {
+	value, exists := s.GetSetting(key)
+	if !exists {
+		return defaultValue
+	}
+	intValue, err := strconv.Atoi(value)
+	if err != nil {
+		return defaultValue
+	}
+	return intValue
+}
+
+// GetListSetting 获取逗号分隔的列表类型配置（去除空白并转为小写，不存在时返回 nil）
+func (s *SystemSettingsService) GetListSetting(key string) []string {
+	value, exists := s.GetSetting(key)
+	if !exists {
+		return nil
+	}
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.ToLower(strings.TrimSpace(item)); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 // IsFeatureEnabled 检查功能是否启用
 func (s *SystemSettingsService) IsFeatureEnabled(featureKey string) bool {
 	return s.GetBoolSetting(featureKey, false)
@@ -0,0 +1,193 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"dinq_message/model"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ThreadService struct {
+	db *gorm.DB
+}
+
+func NewThreadService(db *gorm.DB) *ThreadService {
+	return &ThreadService{db: db}
+}
+
+// ThreadDetail 话题详情（根消息 + 回复列表）
+type ThreadDetail struct {
+	Root        *model.Message  `json:"root"`
+	Replies     []model.Message `json:"replies"`
+	UnreadCount int             `json:"unread_count"` // 当前用户在该话题中的未读回复数
+}
+
+// GetThread 获取话题（传入话题中任意一条消息的ID均可，回复按时间正序分页）
+func (s *ThreadService) GetThread(userID, messageID uuid.UUID, limit, offset int) (*ThreadDetail, error) {
+	root, err := s.getThreadRoot(userID, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	var replies []model.Message
+	if err := s.db.Where("thread_root_id = ?", root.ID).
+		Order("seq ASC").
+		Limit(limit).
+		Offset(offset).
+		Find(&replies).Error; err != nil {
+		return nil, fmt.Errorf("failed to query thread replies: %w", err)
+	}
+
+	// 补充表情回应聚合
+	messageIDs := make([]uuid.UUID, 0, len(replies)+1)
+	messageIDs = append(messageIDs, root.ID)
+	for _, reply := range replies {
+		messageIDs = append(messageIDs, reply.ID)
+	}
+	reactionMap, err := loadReactionSummaries(s.db, messageIDs)
+	if err != nil {
+		return nil, err
+	}
+	root.Reactions = reactionMap[root.ID]
+	for i := range replies {
+		replies[i].Reactions = reactionMap[replies[i].ID]
+	}
+
+	// 补充投票结果（仅投票消息）
+	pollMap, err := loadPollResults(s.db, userID, messageIDs)
+	if err != nil {
+		return nil, err
+	}
+	root.Poll = pollMap[root.ID]
+	for i := range replies {
+		replies[i].Poll = pollMap[replies[i].ID]
+	}
+
+	// 补充语音收听记录（仅语音消息）
+	listenMap, err := loadVoiceListens(s.db, messageIDs)
+	if err != nil {
+		return nil, err
+	}
+	root.VoiceListens = listenMap[root.ID]
+	for i := range replies {
+		replies[i].VoiceListens = listenMap[replies[i].ID]
+	}
+
+	// 补充实时位置共享状态（仅位置消息）
+	locationMap, err := loadLiveLocations(s.db, messageIDs)
+	if err != nil {
+		return nil, err
+	}
+	root.LiveLocation = locationMap[root.ID]
+	for i := range replies {
+		replies[i].LiveLocation = locationMap[replies[i].ID]
+	}
+
+	unreadMap, err := loadThreadUnreadCounts(s.db, userID, []uuid.UUID{root.ID})
+	if err != nil {
+		return nil, err
+	}
+	root.ThreadUnreadCount = unreadMap[root.ID]
+
+	return &ThreadDetail{
+		Root:        root,
+		Replies:     replies,
+		UnreadCount: root.ThreadUnreadCount,
+	}, nil
+}
+
+// MarkThreadRead 将话题标记为已读，返回话题根消息
+func (s *ThreadService) MarkThreadRead(userID, messageID uuid.UUID) (*model.Message, error) {
+	root, err := s.getThreadRoot(userID, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := upsertThreadReadState(s.db, root.ID, userID, time.Now()); err != nil {
+		return nil, err
+	}
+
+	return root, nil
+}
+
+// getThreadRoot 查询消息所属话题的根消息并检查用户是否是会话成员
+func (s *ThreadService) getThreadRoot(userID, messageID uuid.UUID) (*model.Message, error) {
+	var message model.Message
+	if err := s.db.Where("id = ?", messageID).First(&message).Error; err != nil {
+		return nil, fmt.Errorf("message not found")
+	}
+
+	var count int64
+	if err := s.db.Model(&model.ConversationMember{}).
+		Where("conversation_id = ? AND user_id = ? AND left_at IS NULL", message.ConversationID, userID).
+		Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, fmt.Errorf("user is not a member of this conversation")
+	}
+
+	if message.ThreadRootID == nil {
+		return &message, nil
+	}
+
+	var root model.Message
+	if err := s.db.Where("id = ?", *message.ThreadRootID).First(&root).Error; err != nil {
+		return nil, fmt.Errorf("message not found")
+	}
+	return &root, nil
+}
+
+// upsertThreadReadState 更新用户在话题中的已读位置（只前进不后退）
+func upsertThreadReadState(db *gorm.DB, threadRootID, userID uuid.UUID, readAt time.Time) error {
+	state := &model.ThreadReadState{
+		ThreadRootID: threadRootID,
+		UserID:       userID,
+		LastReadAt:   readAt,
+	}
+	if err := db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "thread_root_id"}, {Name: "user_id"}},
+		DoUpdates: clause.Set{{
+			Column: clause.Column{Name: "last_read_at"},
+			Value:  gorm.Expr("GREATEST(thread_read_states.last_read_at, EXCLUDED.last_read_at)"),
+		}},
+	}).Create(state).Error; err != nil {
+		return fmt.Errorf("failed to update thread read state: %w", err)
+	}
+	return nil
+}
+
+// loadThreadUnreadCounts 批量计算用户在各话题中的未读回复数
+// 未读 = 他人发送的、未撤回的、晚于用户已读位置的回复（从未读过则全部计入）
+func loadThreadUnreadCounts(db *gorm.DB, userID uuid.UUID, rootIDs []uuid.UUID) (map[uuid.UUID]int, error) {
+	result := make(map[uuid.UUID]int)
+	if len(rootIDs) == 0 {
+		return result, nil
+	}
+
+	var rows []struct {
+		ThreadRootID uuid.UUID
+		UnreadCount  int
+	}
+	if err := db.Raw(`
+		SELECT m.thread_root_id, COUNT(*) AS unread_count
+		FROM messages m
+		LEFT JOIN thread_read_states t ON t.thread_root_id = m.thread_root_id AND t.user_id = ?
+		WHERE m.thread_root_id IN ?
+		  AND m.sender_id != ?
+		  AND m.is_recalled = FALSE
+		  AND (t.last_read_at IS NULL OR m.created_at > t.last_read_at)
+		GROUP BY m.thread_root_id
+	`, userID, rootIDs, userID).Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to count thread unread replies: %w", err)
+	}
+
+	for _, row := range rows {
+		result[row.ThreadRootID] = row.UnreadCount
+	}
+	return result, nil
+}
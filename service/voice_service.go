@@ -0,0 +1,475 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"dinq_message/model"
+	"dinq_message/storage"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// waveformBuckets 波形摘要的采样点数量
+	waveformBuckets = 64
+	// maxClientWaveformSamples 客户端上报波形的最大采样点数量
+	maxClientWaveformSamples = 4096
+)
+
+// VoiceService 语音消息服务：校验时长和大小、计算波形摘要、记录收听状态
+type VoiceService struct {
+	db     *gorm.DB
+	store  storage.Storage
+	sysSvc *SystemSettingsService
+}
+
+func NewVoiceService(db *gorm.DB, store storage.Storage, sysSvc *SystemSettingsService) *VoiceService {
+	return &VoiceService{
+		db:     db,
+		store:  store,
+		sysSvc: sysSvc,
+	}
+}
+
+// VoiceListenResult 标记收听结果
+type VoiceListenResult struct {
+	Message *model.Message     `json:"message"`
+	Listen  *model.VoiceListen `json:"listen"`
+	Created bool               `json:"-"` // 是否为首次收听（重复标记不再广播）
+}
+
+// audioInfo 音频解析结果
+type audioInfo struct {
+	DurationMS int
+	Waveform   []int // 服务端解码计算的波形（只有 WAV 可以解码，其他格式为空）
+}
+
+// prepareVoiceMessage 校验语音消息的格式、大小和时长，并把服务端解析的时长和波形写入 metadata
+// 时长由服务端从文件中解析：WAV (PCM) 解码计算时长和波形，Ogg (Opus/Vorbis) 和 MP4/M4A (AAC) 从容器头部读取时长，
+// 其他格式无法解析，直接拒绝。压缩编码的波形无法在服务端计算，使用客户端上报的采样（waveform_source 为 client）
+func (s *VoiceService) prepareVoiceMessage(req *SendMessageRequest, file *model.UploadedFile) error {
+	maxSizeMB := s.sysSvc.GetIntSetting("voice_max_size_mb", 5)
+	fileSizeMB := float64(file.Size) / (1024 * 1024)
+	if maxSizeMB > 0 && fileSizeMB > float64(maxSizeMB) {
+		return invalidError("voice file size exceeds limit: max %dMB, got %.2fMB", maxSizeMB, fileSizeMB)
+	}
+
+	data, err := s.readVoiceFile(file)
+	if err != nil {
+		return err
+	}
+	info, err := analyzeAudio(data)
+	if err != nil {
+		return err
+	}
+
+	if info.DurationMS <= 0 {
+		return invalidError("voice file has no audio")
+	}
+	maxDuration := s.sysSvc.GetIntSetting("voice_max_duration_seconds", 60)
+	if maxDuration > 0 && info.DurationMS > maxDuration*1000 {
+		return invalidError("voice duration exceeds limit: max %ds, got %.1fs", maxDuration, float64(info.DurationMS)/1000)
+	}
+
+	req.Metadata["duration_ms"] = info.DurationMS
+	req.Metadata["duration"] = (info.DurationMS + 999) / 1000
+
+	waveform, source := info.Waveform, "server"
+	if len(waveform) == 0 {
+		waveform, source = clientWaveform(req.Metadata), "client"
+	}
+	if len(waveform) > 0 {
+		req.Metadata["waveform"] = waveform
+		req.Metadata["waveform_source"] = source
+	} else {
+		delete(req.Metadata, "waveform")
+		delete(req.Metadata, "waveform_source")
+	}
+	return nil
+}
+
+// readVoiceFile 读取已上传的语音文件
+func (s *VoiceService) readVoiceFile(file *model.UploadedFile) ([]byte, error) {
+	reader, err := s.store.Get(context.Background(), file.StorageKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read voice file: %w", err)
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(io.LimitReader(reader, file.Size))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read voice file: %w", err)
+	}
+	return data, nil
+}
+
+// MarkListened 接收者标记语音消息已播放（重复标记保留首次收听时间）
+func (s *VoiceService) MarkListened(userID, messageID uuid.UUID) (*VoiceListenResult, error) {
+	var message model.Message
+	if err := s.db.Where("id = ?", messageID).First(&message).Error; err != nil {
+		return nil, notFoundError("message not found")
+	}
+	if message.MessageType != "voice" {
+		return nil, invalidError("message is not a voice message")
+	}
+	if message.IsRecalled {
+		return nil, invalidError("cannot listen to a recalled message")
+	}
+
+	var count int64
+	if err := s.db.Model(&model.ConversationMember{}).
+		Where("conversation_id = ? AND user_id = ? AND left_at IS NULL", message.ConversationID, userID).
+		Count(&count).Error; err != nil || count == 0 {
+		return nil, forbiddenError("user is not a member of this conversation")
+	}
+	if message.SenderID == userID {
+		return nil, invalidError("cannot mark your own voice message as listened")
+	}
+
+	listen := &model.VoiceListen{
+		MessageID:  messageID,
+		UserID:     userID,
+		ListenedAt: time.Now(),
+	}
+	result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(listen)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to mark voice message as listened: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		if err := s.db.Where("message_id = ? AND user_id = ?", messageID, userID).First(listen).Error; err != nil {
+			return nil, fmt.Errorf("failed to query listen state: %w", err)
+		}
+	}
+
+	return &VoiceListenResult{
+		Message: &message,
+		Listen:  listen,
+		Created: result.RowsAffected > 0,
+	}, nil
+}
+
+// loadVoiceListens 批量查询语音消息的收听记录（按收听时间排序）
+func loadVoiceListens(db *gorm.DB, messageIDs []uuid.UUID) (map[uuid.UUID][]model.VoiceListen, error) {
+	result := make(map[uuid.UUID][]model.VoiceListen)
+	if len(messageIDs) == 0 {
+		return result, nil
+	}
+
+	var listens []model.VoiceListen
+	if err := db.Where("message_id IN ?", messageIDs).
+		Order("listened_at ASC").
+		Find(&listens).Error; err != nil {
+		return nil, fmt.Errorf("failed to query voice listens: %w", err)
+	}
+	for _, listen := range listens {
+		result[listen.MessageID] = append(result[listen.MessageID], listen)
+	}
+	return result, nil
+}
+
+// attachVoiceListens 为消息列表中的语音消息补充收听记录
+func attachVoiceListens(db *gorm.DB, messages []model.Message) error {
+	var voiceMessageIDs []uuid.UUID
+	for _, msg := range messages {
+		if msg.MessageType == "voice" {
+			voiceMessageIDs = append(voiceMessageIDs, msg.ID)
+		}
+	}
+	listenMap, err := loadVoiceListens(db, voiceMessageIDs)
+	if err != nil {
+		return err
+	}
+	for i := range messages {
+		messages[i].VoiceListens = listenMap[messages[i].ID]
+	}
+	return nil
+}
+
+// analyzeAudio 按文件内容识别音频格式并解析时长（不依赖上传时的 MIME 类型）
+func analyzeAudio(data []byte) (*audioInfo, error) {
+	switch {
+	case len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WAVE":
+		return analyzeWAV(data)
+	case len(data) >= 4 && string(data[0:4]) == "OggS":
+		return analyzeOgg(data)
+	case len(data) >= 8 && string(data[4:8]) == "ftyp":
+		return analyzeMP4(data)
+	}
+	return nil, invalidError("unsupported voice format: supported formats are wav (PCM), ogg (Opus/Vorbis) and m4a (AAC)")
+}
+
+// clientWaveform 客户端上报的波形采样（振幅），归一化为固定数量的采样点
+func clientWaveform(metadata map[string]interface{}) []int {
+	samples, _ := metadata["waveform"].([]interface{})
+	if len(samples) > maxClientWaveformSamples {
+		samples = samples[:maxClientWaveformSamples]
+	}
+	values := make([]float64, 0, len(samples))
+	for _, sample := range samples {
+		if v, ok := sample.(float64); ok && v > 0 && !math.IsInf(v, 0) {
+			values = append(values, v)
+		} else {
+			values = append(values, 0)
+		}
+	}
+	return summarizeWaveform(values)
+}
+
+// oggPage Ogg 页头中用到的字段
+type oggPage struct {
+	granule    uint64
+	serial     uint32
+	payloadOff int // 页数据相对页起始的偏移
+}
+
+// parseOggPage 解析 data 开头的 Ogg 页头（data 不是完整的页头时返回 false）
+func parseOggPage(data []byte) (oggPage, bool) {
+	if len(data) < 27 || string(data[0:4]) != "OggS" || data[4] != 0 {
+		return oggPage{}, false
+	}
+	segments := int(data[26])
+	if len(data) < 27+segments {
+		return oggPage{}, false
+	}
+	return oggPage{
+		granule:    binary.LittleEndian.Uint64(data[6:14]),
+		serial:     binary.LittleEndian.Uint32(data[14:18]),
+		payloadOff: 27 + segments,
+	}, true
+}
+
+// analyzeOgg 从 Ogg 文件读取时长：最后一页的 granule position 为结束位置的采样数
+// Opus 的采样率固定为 48kHz（需要减去 pre-skip），Vorbis 的采样率在识别头中
+func analyzeOgg(data []byte) (*audioInfo, error) {
+	first, ok := parseOggPage(data)
+	if !ok {
+		return nil, invalidError("invalid ogg file")
+	}
+	header := data[first.payloadOff:]
+
+	var sampleRate, preSkip uint64
+	switch {
+	case len(header) >= 19 && string(header[0:8]) == "OpusHead":
+		sampleRate = 48000
+		preSkip = uint64(binary.LittleEndian.Uint16(header[10:12]))
+	case len(header) >= 16 && string(header[0:7]) == "\x01vorbis":
+		sampleRate = uint64(binary.LittleEndian.Uint32(header[12:16]))
+	default:
+		return nil, invalidError("unsupported ogg codec: only Opus and Vorbis are supported")
+	}
+	if sampleRate == 0 {
+		return nil, invalidError("invalid ogg file")
+	}
+
+	// 从文件末尾向前查找同一逻辑流中带 granule position 的最后一页
+	for offset := bytes.LastIndex(data, []byte("OggS")); offset > 0; offset = bytes.LastIndex(data[:offset], []byte("OggS")) {
+		page, ok := parseOggPage(data[offset:])
+		if !ok || page.serial != first.serial || page.granule == math.MaxUint64 {
+			continue
+		}
+		if page.granule <= preSkip {
+			return &audioInfo{}, nil
+		}
+		return &audioInfo{DurationMS: durationMS(page.granule-preSkip, sampleRate)}, nil
+	}
+	return nil, invalidError("invalid ogg file: no audio pages")
+}
+
+// analyzeMP4 从 MP4/M4A 文件的 moov/mvhd 读取时长
+func analyzeMP4(data []byte) (*audioInfo, error) {
+	moov, ok := findMP4Box(data, "moov")
+	if !ok {
+		return nil, invalidError("invalid mp4 file: moov box not found")
+	}
+	mvhd, ok := findMP4Box(moov, "mvhd")
+	if !ok || len(mvhd) < 20 {
+		return nil, invalidError("invalid mp4 file: mvhd box not found")
+	}
+
+	var timescale, duration uint64
+	if mvhd[0] == 1 { // version 1：创建/修改时间和时长为 64 位
+		if len(mvhd) < 32 {
+			return nil, invalidError("invalid mp4 file")
+		}
+		timescale = uint64(binary.BigEndian.Uint32(mvhd[20:24]))
+		duration = binary.BigEndian.Uint64(mvhd[24:32])
+	} else {
+		timescale = uint64(binary.BigEndian.Uint32(mvhd[12:16]))
+		duration = uint64(binary.BigEndian.Uint32(mvhd[16:20]))
+	}
+	if timescale == 0 || duration == math.MaxUint32 || duration == math.MaxUint64 {
+		// 时长未知（如分片 MP4），无法确定
+		return nil, invalidError("unable to determine voice duration")
+	}
+	return &audioInfo{DurationMS: durationMS(duration, timescale)}, nil
+}
+
+// findMP4Box 在同一层级的 box 中查找指定类型的 box，返回其内容
+func findMP4Box(data []byte, boxType string) ([]byte, bool) {
+	for len(data) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(data[0:4]))
+		headerSize := uint64(8)
+		switch size {
+		case 0: // 延伸到文件末尾
+			size = uint64(len(data))
+		case 1: // 64 位长度
+			if len(data) < 16 {
+				return nil, false
+			}
+			size = binary.BigEndian.Uint64(data[8:16])
+			headerSize = 16
+		}
+		if size < headerSize || size > uint64(len(data)) {
+			return nil, false
+		}
+		if string(data[4:8]) == boxType {
+			return data[headerSize:size], true
+		}
+		data = data[size:]
+	}
+	return nil, false
+}
+
+// durationMS 采样数换算为毫秒（超出范围时按最大值处理，由时长上限拒绝）
+func durationMS(samples, sampleRate uint64) int {
+	seconds := samples / sampleRate
+	if seconds > math.MaxInt32/1000 {
+		return math.MaxInt32
+	}
+	return int(seconds*1000 + samples%sampleRate*1000/sampleRate)
+}
+
+// analyzeWAV 解析 PCM 编码的 WAV 文件，计算时长和波形（每个采样点取该区间内的峰值）
+func analyzeWAV(data []byte) (*audioInfo, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, invalidError("invalid wav file")
+	}
+
+	var (
+		format        uint16
+		channels      int
+		sampleRate    int
+		bitsPerSample int
+		samples       []byte
+		hasFormat     bool
+	)
+	for offset := 12; offset+8 <= len(data); {
+		chunkID := string(data[offset : offset+4])
+		chunkSize := int(binary.LittleEndian.Uint32(data[offset+4 : offset+8]))
+		body := data[offset+8:]
+		if chunkSize < 0 || chunkSize > len(body) {
+			chunkSize = len(body) // 流式写入的文件 data 长度可能不正确，以实际字节数为准
+		}
+		body = body[:chunkSize]
+
+		switch chunkID {
+		case "fmt ":
+			if len(body) < 16 {
+				return nil, invalidError("invalid wav file")
+			}
+			format = binary.LittleEndian.Uint16(body[0:2])
+			channels = int(binary.LittleEndian.Uint16(body[2:4]))
+			sampleRate = int(binary.LittleEndian.Uint32(body[4:8]))
+			bitsPerSample = int(binary.LittleEndian.Uint16(body[14:16]))
+			// WAVE_FORMAT_EXTENSIBLE：实际编码在子格式 GUID 的前两个字节
+			if format == 0xFFFE && len(body) >= 26 {
+				format = binary.LittleEndian.Uint16(body[24:26])
+			}
+			hasFormat = true
+		case "data":
+			samples = body
+		}
+
+		offset += 8 + chunkSize + chunkSize%2 // chunk 按偶数字节对齐
+	}
+
+	if !hasFormat || samples == nil {
+		return nil, invalidError("invalid wav file")
+	}
+	if format != 1 {
+		return nil, invalidError("unsupported wav encoding: only PCM is supported")
+	}
+	bytesPerSample := bitsPerSample / 8
+	if channels <= 0 || sampleRate <= 0 || bytesPerSample < 1 || bytesPerSample > 4 || bitsPerSample%8 != 0 {
+		return nil, invalidError("unsupported wav format")
+	}
+
+	frameSize := channels * bytesPerSample
+	frameCount := len(samples) / frameSize
+	info := &audioInfo{
+		DurationMS: int(int64(frameCount) * 1000 / int64(sampleRate)),
+	}
+	if frameCount == 0 {
+		return info, nil
+	}
+
+	peaks := make([]float64, waveformBuckets)
+	for frame := 0; frame < frameCount; frame++ {
+		bucket := frame * waveformBuckets / frameCount
+		for ch := 0; ch < channels; ch++ {
+			start := frame*frameSize + ch*bytesPerSample
+			amplitude := pcmAmplitude(samples[start : start+bytesPerSample])
+			if amplitude > peaks[bucket] {
+				peaks[bucket] = amplitude
+			}
+		}
+	}
+	info.Waveform = summarizeWaveform(peaks)
+	return info, nil
+}
+
+// pcmAmplitude 单个 PCM 采样的绝对振幅（0-1）；8 位为无符号，其余为有符号小端
+func pcmAmplitude(sample []byte) float64 {
+	switch len(sample) {
+	case 1:
+		return math.Abs(float64(int(sample[0])-128)) / 128
+	case 2:
+		return math.Abs(float64(int16(binary.LittleEndian.Uint16(sample)))) / 32768
+	case 3:
+		v := int32(uint32(sample[0])<<8|uint32(sample[1])<<16|uint32(sample[2])<<24) >> 8
+		return math.Abs(float64(v)) / 8388608
+	default:
+		return math.Abs(float64(int32(binary.LittleEndian.Uint32(sample)))) / 2147483648
+	}
+}
+
+// summarizeWaveform 将任意数量的振幅采样压缩为固定数量的采样点（每段取峰值），并按最大值归一化到 0-100
+// 采样少于目标数量时保持原数量；全部为 0 时返回 nil
+func summarizeWaveform(values []float64) []int {
+	if len(values) == 0 {
+		return nil
+	}
+
+	buckets := waveformBuckets
+	if len(values) < buckets {
+		buckets = len(values)
+	}
+	peaks := make([]float64, buckets)
+	maxPeak := 0.0
+	for i, v := range values {
+		bucket := i * buckets / len(values)
+		if v > peaks[bucket] {
+			peaks[bucket] = v
+		}
+		if v > maxPeak {
+			maxPeak = v
+		}
+	}
+	if maxPeak == 0 {
+		return nil
+	}
+
+	waveform := make([]int, buckets)
+	for i, peak := range peaks {
+		waveform[i] = int(math.Round(peak / maxPeak * 100))
+	}
+	return waveform
+}
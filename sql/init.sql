@@ -4,6 +4,17 @@
 -- ============================================
 -- 删除现有表（如果存在）
 -- ============================================
+DROP TABLE IF EXISTS live_locations CASCADE;
+DROP TABLE IF EXISTS voice_listens CASCADE;
+DROP TABLE IF EXISTS uploaded_files CASCADE;
+DROP TABLE IF EXISTS poll_votes CASCADE;
+DROP TABLE IF EXISTS poll_options CASCADE;
+DROP TABLE IF EXISTS polls CASCADE;
+DROP TABLE IF EXISTS scheduled_messages CASCADE;
+DROP TABLE IF EXISTS pinned_messages CASCADE;
+DROP TABLE IF EXISTS thread_read_states CASCADE;
+DROP TABLE IF EXISTS message_edits CASCADE;
+DROP TABLE IF EXISTS message_reactions CASCADE;
 DROP TABLE IF EXISTS notification_templates CASCADE;
 DROP TABLE IF EXISTS notifications CASCADE;
 DROP TABLE IF EXISTS user_relationships CASCADE;
@@ -22,7 +33,9 @@ CREATE TABLE conversations (
     created_at TIMESTAMP DEFAULT NOW(),
     updated_at TIMESTAMP DEFAULT NOW(),
     last_message_at TIMESTAMP,
-    last_message_id UUID  -- 冗余最新消息ID,用于高性能查询最新消息内容
+    last_message_id UUID,  -- 冗余最新消息ID,用于高性能查询最新消息内容
+    last_seq BIGINT NOT NULL DEFAULT 0,  -- 已分配的最大消息序号
+    message_ttl_seconds INT DEFAULT 0  -- 消息保留时长（秒），0 表示不自动删除
 );
 
 CREATE INDEX idx_conv_type ON conversations(conversation_type);
@@ -34,23 +47,36 @@ CREATE INDEX idx_conv_last_message_at ON conversations(last_message_at DESC NULL
 CREATE TABLE messages (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     conversation_id UUID NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    seq BIGINT NOT NULL,  -- 会话内序号（发送时在事务中分配，严格递增）
     sender_id UUID NOT NULL,
     message_type VARCHAR(20) NOT NULL,
     content TEXT,
+    plain_text TEXT,  -- 富文本消息的纯文本（用于搜索和预览）
     metadata JSONB,
     status VARCHAR(20) DEFAULT 'sent',
+    client_msg_id VARCHAR(64),  -- 客户端生成的消息ID（重试去重）
     reply_to_message_id UUID,
+    thread_root_id UUID,  -- 所属话题的根消息ID
+    thread_reply_count INT DEFAULT 0,  -- 话题回复数（仅根消息）
+    thread_last_reply_at TIMESTAMP,  -- 话题最后回复时间（仅根消息）
     is_recalled BOOLEAN DEFAULT FALSE,
     recalled_at TIMESTAMP,
+    edited_at TIMESTAMP,
+    expires_at TIMESTAMP,  -- 阅后即焚过期时间
     created_at TIMESTAMP DEFAULT NOW()
 );
 
 CREATE INDEX idx_msg_conversation ON messages(conversation_id, created_at DESC);
+CREATE UNIQUE INDEX idx_msg_conversation_seq ON messages(conversation_id, seq);  -- 按序号分页和补齐缺失消息
+CREATE UNIQUE INDEX idx_msg_client_msg_id ON messages(sender_id, client_msg_id) WHERE client_msg_id IS NOT NULL;  -- 同一发送者的客户端消息ID只能创建一条消息
 CREATE INDEX idx_msg_sender ON messages(sender_id, created_at DESC);
 CREATE INDEX idx_msg_created ON messages(created_at DESC);
 CREATE INDEX idx_msg_conversation_covering ON messages(conversation_id, created_at DESC) INCLUDE (sender_id, message_type, status, is_recalled);
 CREATE INDEX idx_msg_recall_check ON messages(id, sender_id) INCLUDE (created_at, is_recalled);
-CREATE INDEX idx_msg_search ON messages USING GIN (to_tsvector('simple', content)) WHERE message_type = 'text' AND is_recalled = FALSE;
+CREATE INDEX idx_msg_expires ON messages(expires_at) WHERE expires_at IS NOT NULL;
+CREATE INDEX idx_msg_thread ON messages(thread_root_id, created_at) WHERE thread_root_id IS NOT NULL;
+CREATE INDEX idx_msg_status_pending ON messages(conversation_id, created_at) WHERE status != 'read';
+CREATE INDEX idx_msg_search ON messages USING GIN (to_tsvector('simple', COALESCE(plain_text, content))) WHERE message_type IN ('text', 'rich_text') AND is_recalled = FALSE;
 
 -- ============================================
 -- 3. 会话成员表
@@ -65,8 +91,11 @@ CREATE TABLE conversation_members (
     joined_at TIMESTAMP DEFAULT NOW(),
     left_at TIMESTAMP,
     unread_count INT DEFAULT 0,
+    unread_mention_count INT DEFAULT 0,  -- 未读@提及数
     last_read_message_id UUID,
+    last_read_seq BIGINT NOT NULL DEFAULT 0,  -- 已读进度：序号不超过该值的消息均已读
     last_read_at TIMESTAMP,
+    delivered_until_seq BIGINT NOT NULL DEFAULT 0,  -- 送达进度：序号不超过该值的消息均已送达
     UNIQUE(conversation_id, user_id)
 );
 
@@ -111,7 +140,18 @@ INSERT INTO system_settings (setting_key, setting_value, description) VALUES
     ('enable_online_status', 'true', '启用在线状态功能'),
     ('enable_first_message_limit', 'true', '启用首条消息限制功能'),
     ('enable_block_feature', 'false', '启用用户拉黑功能(默认关闭)'),
-    ('max_video_size_mb', '100', '视频文件最大大小(MB)');
+    ('max_video_size_mb', '100', '视频文件最大大小(MB)'),
+    ('message_edit_window_seconds', '900', '消息可编辑时间窗口(秒)，0表示不限制'),
+    ('recall_time_limit_seconds', '120', '消息可撤回时间窗口(秒)'),
+    ('voice_max_duration_seconds', '60', '语音消息最大时长(秒)'),
+    ('voice_max_size_mb', '5', '语音文件最大大小(MB)'),
+    ('live_location_max_duration_seconds', '28800', '实时位置共享最长时长(秒)'),
+    ('sync_max_age_hours', '168', '断线重连同步的检查点有效期(小时)，超过后客户端需要重新拉取'),
+    ('ws_ack_timeout_seconds', '2', '新消息推送等待客户端确认的时长(秒，1-60)，每次重发后翻倍'),
+    ('ws_ack_max_retries', '2', '新消息推送未确认时的最大重发次数(0-10)，用完后断开该设备并转入离线队列'),
+    ('enable_link_preview', 'true', '启用链接预览功能'),
+    ('link_preview_allowed_domains', '', '链接预览域名白名单(逗号分隔，包含子域名)，为空表示不限制'),
+    ('link_preview_blocked_domains', '', '链接预览域名黑名单(逗号分隔，包含子域名)，优先于白名单');
 
 CREATE INDEX idx_system_settings_key ON system_settings(setting_key);
 
@@ -138,6 +178,7 @@ CREATE INDEX idx_notification_templates_is_active ON notification_templates(is_a
 -- 插入默认模板（仅系统相关，消息通知已禁用）
 INSERT INTO notification_templates (type, title, content_template, priority, enable_push, enable_websocket, is_active, description)
 VALUES
+    ('mention', 'New Mention', '{{sender_name}} mentioned you in {{group_name}}: {{content}}', 1, true, true, true, '群聊@提及通知'),
     ('system', 'System Notification', '{{content}}', 1, true, true, true, '系统通知'),
     ('card_completed', 'Card Completed', 'Your card {{card_name}} is ready!', 0, true, true, true, '卡片生成完成通知');
 
@@ -161,3 +202,158 @@ CREATE TABLE notifications (
 CREATE INDEX idx_notif_user ON notifications(user_id, created_at DESC);
 CREATE INDEX idx_notif_unread ON notifications(user_id, is_read) WHERE is_read = FALSE;
 CREATE INDEX idx_notif_expires ON notifications(expires_at) WHERE expires_at IS NOT NULL;
+
+-- ============================================
+-- 8. 消息表情回应表
+-- ============================================
+CREATE TABLE message_reactions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL,
+    emoji VARCHAR(32) NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW(),
+    UNIQUE(message_id, user_id, emoji)
+);
+
+CREATE INDEX idx_reaction_message ON message_reactions(message_id, created_at);
+
+-- ============================================
+-- 9. 消息编辑历史表
+-- ============================================
+CREATE TABLE message_edits (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    editor_id UUID NOT NULL,
+    previous_content TEXT,
+    edited_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_message_edits_message ON message_edits(message_id, edited_at);
+
+-- ============================================
+-- 10. 话题已读状态表
+-- ============================================
+CREATE TABLE thread_read_states (
+    thread_root_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL,
+    last_read_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (thread_root_id, user_id)
+);
+
+-- ============================================
+-- 11. 置顶消息表
+-- ============================================
+CREATE TABLE pinned_messages (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    conversation_id UUID NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    pinned_by UUID NOT NULL,
+    pinned_at TIMESTAMP DEFAULT NOW(),
+    UNIQUE(conversation_id, message_id)
+);
+
+CREATE INDEX idx_pinned_conversation ON pinned_messages(conversation_id, pinned_at DESC);
+
+-- ============================================
+-- 12. 定时消息表
+-- ============================================
+CREATE TABLE scheduled_messages (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    sender_id UUID NOT NULL,
+    conversation_id UUID REFERENCES conversations(id) ON DELETE CASCADE,
+    receiver_id UUID,  -- 私聊时使用
+    message_type VARCHAR(20) NOT NULL,
+    content TEXT,
+    metadata JSONB,
+    reply_to_message_id UUID,
+    scheduled_at TIMESTAMP NOT NULL,
+    status VARCHAR(20) DEFAULT 'pending',  -- 'pending' | 'sending' | 'sent' | 'failed' | 'cancelled'
+    sent_message_id UUID,
+    error TEXT,
+    sent_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX idx_scheduled_sender ON scheduled_messages(sender_id, scheduled_at);
+CREATE INDEX idx_scheduled_due ON scheduled_messages(scheduled_at) WHERE status = 'pending';
+
+-- ============================================
+-- 13. 投票表（问题存储在 messages.content 中）
+-- ============================================
+CREATE TABLE polls (
+    message_id UUID PRIMARY KEY REFERENCES messages(id) ON DELETE CASCADE,
+    multiple_choice BOOLEAN DEFAULT FALSE,
+    anonymous BOOLEAN DEFAULT FALSE,
+    closes_at TIMESTAMP,  -- 自动截止时间
+    closed_at TIMESTAMP,  -- 手动关闭时间
+    closed_by UUID,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE poll_options (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    message_id UUID NOT NULL REFERENCES polls(message_id) ON DELETE CASCADE,
+    position INT NOT NULL,
+    text VARCHAR(100) NOT NULL,
+    UNIQUE(message_id, position)
+);
+
+CREATE TABLE poll_votes (
+    option_id UUID NOT NULL REFERENCES poll_options(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL,
+    message_id UUID NOT NULL REFERENCES polls(message_id) ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (option_id, user_id)
+);
+
+CREATE INDEX idx_poll_votes_message ON poll_votes(message_id, user_id);
+
+-- ============================================
+-- 14. 上传文件表（文件内容保存在 OSS/本地存储）
+-- ============================================
+CREATE TABLE uploaded_files (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    uploader_id UUID NOT NULL,
+    storage_key VARCHAR(512) NOT NULL,
+    file_name VARCHAR(255) NOT NULL,
+    mime_type VARCHAR(127) NOT NULL,
+    size BIGINT NOT NULL,  -- 实际上传的字节数
+    url TEXT NOT NULL,
+    status VARCHAR(20) DEFAULT 'pending',  -- 'pending' | 'uploaded'
+    width INT,  -- 图片宽高和缩略图（服务端异步生成）
+    height INT,
+    thumbnail_url TEXT,
+    created_at TIMESTAMP DEFAULT NOW(),
+    uploaded_at TIMESTAMP
+);
+
+CREATE INDEX idx_uploaded_files_uploader ON uploaded_files(uploader_id, created_at DESC);
+
+-- ============================================
+-- 15. 语音消息收听记录表
+-- ============================================
+CREATE TABLE voice_listens (
+    message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL,
+    listened_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (message_id, user_id)
+);
+
+-- ============================================
+-- 16. 实时位置共享表（location 消息的 live_period > 0 时创建）
+-- ============================================
+CREATE TABLE live_locations (
+    message_id UUID PRIMARY KEY REFERENCES messages(id) ON DELETE CASCADE,
+    conversation_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    latitude DOUBLE PRECISION NOT NULL,
+    longitude DOUBLE PRECISION NOT NULL,
+    accuracy DOUBLE PRECISION,
+    heading DOUBLE PRECISION,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP NOT NULL,
+    stopped_at TIMESTAMP  -- 结束时间（手动停止或到期）
+);
+
+CREATE INDEX idx_live_locations_expires ON live_locations(expires_at) WHERE stopped_at IS NULL;
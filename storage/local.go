@@ -0,0 +1,180 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LocalRoutePrefix 本地存储文件的访问和上传路由前缀
+const LocalRoutePrefix = "/files/local"
+
+// LocalStorage 本地文件系统存储（开发和测试环境使用）
+// 预签名上传地址指向本服务的 PUT /files/local/*key，使用 HMAC 签名防止伪造
+type LocalStorage struct {
+	dir     string
+	baseURL string
+	secret  []byte
+}
+
+func NewLocalStorage(dir, baseURL, secret string) (*LocalStorage, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create storage dir: %w", err)
+	}
+	return &LocalStorage{
+		dir:     dir,
+		baseURL: strings.TrimRight(baseURL, "/"),
+		secret:  []byte(secret),
+	}, nil
+}
+
+func (s *LocalStorage) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	filePath, err := s.filePath(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return fmt.Errorf("failed to create dir: %w", err)
+	}
+
+	// 先写临时文件再重命名，避免读到写了一半的文件
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	return os.Rename(tmp.Name(), filePath)
+}
+
+func (s *LocalStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	f, _, err := s.Open(key)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Open 打开对象文件（用于文件访问路由，目录视为不存在）
+func (s *LocalStorage) Open(key string) (*os.File, os.FileInfo, error) {
+	filePath, err := s.filePath(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := os.Open(filePath)
+	if os.IsNotExist(err) {
+		return nil, nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if info.IsDir() {
+		f.Close()
+		return nil, nil, ErrNotFound
+	}
+	return f, info, nil
+}
+
+func (s *LocalStorage) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	filePath, err := s.filePath(key)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(filePath)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ObjectInfo{
+		Size:        info.Size(),
+		ContentType: mime.TypeByExtension(path.Ext(key)),
+	}, nil
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	filePath, err := s.filePath(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *LocalStorage) PresignPut(ctx context.Context, key, contentType string, expires time.Duration) (*PresignedRequest, error) {
+	expiresAt := time.Now().Add(expires)
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expiresAt.Unix(), 10))
+	query.Set("signature", s.sign(key, contentType, expiresAt.Unix()))
+
+	headers := map[string]string{}
+	if contentType != "" {
+		headers["Content-Type"] = contentType
+	}
+	return &PresignedRequest{
+		Method:    "PUT",
+		URL:       s.URL(key) + "?" + query.Encode(),
+		Headers:   headers,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+func (s *LocalStorage) URL(key string) string {
+	return s.baseURL + LocalRoutePrefix + "/" + key
+}
+
+// VerifyUpload 校验预签名上传地址的签名和有效期（上传的 Content-Type 必须与签名时一致）
+func (s *LocalStorage) VerifyUpload(key, contentType, expires, signature string) error {
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid upload signature")
+	}
+	if time.Now().Unix() > expiresAt {
+		return fmt.Errorf("upload url expired")
+	}
+	if !hmac.Equal([]byte(s.sign(key, contentType, expiresAt)), []byte(signature)) {
+		return fmt.Errorf("invalid upload signature")
+	}
+	return nil
+}
+
+func (s *LocalStorage) sign(key, contentType string, expiresAt int64) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(key + "\n" + contentType + "\n" + strconv.FormatInt(expiresAt, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// filePath 将对象 key 转换为本地路径（拒绝跳出存储目录的 key）
+func (s *LocalStorage) filePath(key string) (string, error) {
+	cleaned := path.Clean("/" + key)
+	if cleaned == "/" || cleaned != "/"+key {
+		return "", fmt.Errorf("invalid object key")
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(cleaned)), nil
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"dinq_message/config"
+)
+
+// ErrNotFound 对象不存在
+var ErrNotFound = errors.New("object not found")
+
+// Storage 文件存储接口（OSS/S3 或本地文件系统）
+type Storage interface {
+	// Put 上传对象（服务端中转上传）
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+	// Get 读取对象内容（调用方负责关闭）
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Stat 查询对象的实际大小和类型（用于校验客户端直传的文件）
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	// Delete 删除对象
+	Delete(ctx context.Context, key string) error
+	// PresignPut 生成客户端直传使用的预签名上传请求
+	PresignPut(ctx context.Context, key, contentType string, expires time.Duration) (*PresignedRequest, error)
+	// URL 对象的访问地址
+	URL(key string) string
+}
+
+// ObjectInfo 对象信息
+type ObjectInfo struct {
+	Size        int64
+	ContentType string
+}
+
+// PresignedRequest 预签名上传请求（客户端按 method/url/headers 直接上传文件内容）
+type PresignedRequest struct {
+	Method    string            `json:"method"`
+	URL       string            `json:"url"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// New 根据配置创建存储后端
+func New(cfg *config.Config) (Storage, error) {
+	switch cfg.StorageBackend {
+	case "oss":
+		store, err := NewOSSStorage(OSSConfig{
+			Endpoint:        cfg.OSS.Endpoint,
+			Region:          cfg.OSS.Region,
+			AccessKeyID:     cfg.OSS.AccessKeyID,
+			AccessKeySecret: cfg.OSS.AccessKeySecret,
+			Bucket:          cfg.OSS.Bucket,
+			PublicURL:       cfg.OSS.PublicURL,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	case "local":
+		store, err := NewLocalStorage(cfg.LocalStorageDir, cfg.PublicBaseURL, cfg.JWTSecret)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %s", cfg.StorageBackend)
+	}
+}
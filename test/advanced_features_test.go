@@ -1,7 +1,9 @@
 package test
 
 import (
+	"context"
 	"fmt"
+	"sync"
 	"testing"
 	"time"
 
@@ -13,32 +15,48 @@ import (
 // 高级功能 - 消息撤回
 // ============================================
 
-// TestRecall_WithinTimeLimit 测试2分钟内撤回消息
+// TestRecall_WithinTimeLimit 测试撤回时间窗口内撤回消息
 //
 // 测试目标：
-// - 2分钟内可以成功撤回自己的消息
-// - 2分钟后不能撤回（返回400错误）
+// - 撤回时间窗口内可以成功撤回自己的消息
+// - 超过窗口后不能撤回（返回400错误）
 // - 对方收到撤回通知
 //
 // 验证闭环：
+// 0. 将撤回时间窗口（recall_time_limit_seconds）设置为10秒，缩短测试时间
 // 1. A发送第一条消息
 // 2. A立即撤回消息（成功，返回200）
 // 3. B收到撤回通知
 // 4. 查询消息历史，消息的is_recalled=true
 // 5. A发送第二条消息（用于测试超时撤回）
-// 6. 等待超过2分钟后尝试撤回（失败，返回400）
+// 6. 等待超过窗口后尝试撤回（失败，返回400）
 // 7. 查询消息历史，第二条消息is_recalled仍为false
+// 8. 恢复撤回时间窗口为默认的120秒
 func TestRecall_WithinTimeLimit(t *testing.T) {
 	userA := createTestUser()
 	userB := createTestUser()
 
+	// 0. 缩短撤回时间窗口
+	resp, _, err := httpRequest("POST", APIPrefix+"/admin/settings/recall_time_limit_seconds", userA.Token, map[string]interface{}{
+		"value": "10",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode, "设置撤回时间窗口应该成功")
+	httpRequest("POST", APIPrefix+"/admin/settings/reload", userA.Token, nil)
+	defer func() {
+		httpRequest("POST", APIPrefix+"/admin/settings/recall_time_limit_seconds", userA.Token, map[string]interface{}{
+			"value": "120",
+		})
+		httpRequest("POST", APIPrefix+"/admin/settings/reload", userA.Token, nil)
+	}()
+
 	wsA, _ := connectWebSocket(userA.Token)
 	defer wsA.Close()
 
 	wsB, _ := connectWebSocket(userB.Token)
 	defer wsB.Close()
 
-	// === 第一部分：测试2分钟内撤回成功 ===
+	// === 第一部分：测试时间窗口内撤回成功 ===
 
 	// 1. A发送第一条消息
 	wsSend(wsA, "message", map[string]interface{}{
@@ -53,9 +71,9 @@ func TestRecall_WithinTimeLimit(t *testing.T) {
 	wsReceive(wsB, 3*time.Second) // B收到消息
 
 	// 2. A立即撤回第一条消息
-	resp, _, err := httpRequest("POST", APIPrefix+"/messages/"+msgID1+"/recall", userA.Token, nil)
+	resp, _, err = httpRequest("POST", APIPrefix+"/messages/"+msgID1+"/recall", userA.Token, nil)
 	require.NoError(t, err)
-	assert.Equal(t, 200, resp.StatusCode, "2分钟内撤回应该成功")
+	assert.Equal(t, 200, resp.StatusCode, "时间窗口内撤回应该成功")
 
 	// 3. 验证闭环：B必须收到撤回通知（前端需要实时更新UI）
 	recallReceived := false
@@ -89,7 +107,7 @@ func TestRecall_WithinTimeLimit(t *testing.T) {
 		t.Error("recalled_at 字段缺失或为null，前端无法显示撤回时间")
 	}
 
-	// === 第二部分：测试2分钟后撤回失败 ===
+	// === 第二部分：测试超过时间窗口后撤回失败 ===
 
 	// 5. B回复，解除首条消息限制
 	wsSend(wsB, "message", map[string]interface{}{
@@ -104,7 +122,7 @@ func TestRecall_WithinTimeLimit(t *testing.T) {
 	wsSend(wsA, "message", map[string]interface{}{
 		"conversation_id": convID,
 		"message_type":    "text",
-		"content":         "Cannot recall after 2 minutes",
+		"content":         "Cannot recall after the window",
 	})
 
 	// 确保接收到的是 A 自己发送的消息（检查 sender_id）
@@ -136,7 +154,7 @@ func TestRecall_WithinTimeLimit(t *testing.T) {
 	}
 
 	wsReceive(wsB, 3*time.Second) // B收到第二条消息
-	t.Log("⏳ 等待2分钟零1秒后测试撤回失败...")
+	t.Log("⏳ 等待超过撤回时间窗口后测试撤回失败...")
 	// 倒计时显示
 	totalSeconds := 11
 	for i := totalSeconds; i > 0; i-- {
@@ -151,7 +169,7 @@ func TestRecall_WithinTimeLimit(t *testing.T) {
 	resp2, body2, err := httpRequest("POST", APIPrefix+"/messages/"+msgID2+"/recall", userA.Token, nil)
 	require.NoError(t, err)
 	t.Logf("撤回响应: status=%d, body=%s", resp2.StatusCode, string(body2))
-	assert.Equal(t, 400, resp2.StatusCode, "超过2分钟后撤回应该失败")
+	assert.Equal(t, 400, resp2.StatusCode, "超过撤回时间窗口后撤回应该失败")
 
 	// 8. 验证数据库状态：第二条消息is_recalled仍为false
 	messages2, _ := getMessages(userA.Token, convID)
@@ -236,6 +254,178 @@ func TestRecall_AlreadyRecalled(t *testing.T) {
 	assert.Equal(t, 400, resp.StatusCode, "重复撤回应该被拒绝")
 }
 
+// TestRecall_GroupOwnerRecallsMemberMessage 测试群主撤回成员消息
+//
+// 测试目标：
+// - 群聊 owner 可以撤回其他成员的消息
+// - 普通成员不能撤回他人消息
+//
+// 验证闭环：
+// 1. 创建群聊（owner + member1 + member2）
+// 2. member1发送消息
+// 3. member2尝试撤回（失败，返回403）
+// 4. owner撤回（成功），member1收到撤回通知，recalled_by为owner
+// 5. 查询消息历史，消息is_recalled=true
+func TestRecall_GroupOwnerRecallsMemberMessage(t *testing.T) {
+	owner := createTestUser()
+	member1 := createTestUser()
+	member2 := createTestUser()
+
+	// 1. 创建群聊
+	_, body, err := httpRequest("POST", APIPrefix+"/conversations/group", owner.Token, map[string]interface{}{
+		"group_name": "Recall Group",
+		"member_ids": []string{member1.ID.String(), member2.ID.String()},
+	})
+	require.NoError(t, err)
+	groupID := parseResponse(body)["id"].(string)
+
+	ws1, err := connectWebSocket(member1.Token)
+	require.NoError(t, err)
+	defer ws1.Close()
+
+	// 2. member1发送消息
+	wsSend(ws1, "message", map[string]interface{}{
+		"conversation_id": groupID,
+		"message_type":    "text",
+		"content":         "Inappropriate content",
+	})
+	msg, err := wsReceiveMessageType(ws1, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	msgID := msg["data"].(map[string]interface{})["id"].(string)
+
+	// 3. member2尝试撤回（失败）
+	resp, _, err := httpRequest("POST", APIPrefix+"/messages/"+msgID+"/recall", member2.Token, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 403, resp.StatusCode, "普通成员不能撤回他人消息")
+
+	// 4. owner撤回（成功）
+	resp, _, err = httpRequest("POST", APIPrefix+"/messages/"+msgID+"/recall", owner.Token, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode, "群主应该能撤回成员消息")
+
+	event, err := wsReceiveMessageType(ws1, "recalled", 3*time.Second, 5)
+	require.NoError(t, err, "member1应该收到撤回通知")
+	data := event["data"].(map[string]interface{})
+	assert.Equal(t, msgID, data["message_id"])
+	assert.Equal(t, owner.ID.String(), data["recalled_by"])
+
+	// 5. 验证闭环：消息已撤回
+	messages, _ := getMessages(owner.Token, groupID)
+	recalled := findMessageByID(messages, msgID)
+	require.NotNil(t, recalled)
+	assert.Equal(t, true, recalled["is_recalled"])
+}
+
+// TestRecall_RemovedFromOfflineQueue 测试撤回的消息从离线队列中移除
+//
+// 测试目标：
+// - 离线用户上线后不会收到已撤回消息的原始内容
+//
+// 验证闭环：
+// 1. B离线，A给B发送消息（进入B的离线队列）
+// 2. A撤回消息
+// 3. 检查Redis中B的离线队列不再包含该消息
+func TestRecall_RemovedFromOfflineQueue(t *testing.T) {
+	userA := createTestUser()
+	userB := createTestUser()
+
+	wsA, err := connectWebSocket(userA.Token)
+	require.NoError(t, err)
+	defer wsA.Close()
+
+	// 1. A给离线的B发送消息
+	wsSend(wsA, "message", map[string]interface{}{
+		"receiver_id":  userB.ID.String(),
+		"message_type": "text",
+		"content":      "Secret sent by mistake",
+	})
+	msg, err := wsReceiveMessageType(wsA, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	msgID := msg["data"].(map[string]interface{})["id"].(string)
+
+	// 2. A撤回消息
+	resp, _, err := httpRequest("POST", APIPrefix+"/messages/"+msgID+"/recall", userA.Token, nil)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+
+	// 3. 验证闭环：离线队列中不再包含该消息
+	rdb := getRedisClient()
+	defer rdb.Close()
+	items, err := rdb.LRange(context.Background(), "offline_msg:"+userB.ID.String(), 0, -1).Result()
+	require.NoError(t, err)
+	for _, item := range items {
+		assert.NotContains(t, item, msgID, "已撤回的消息不应留在离线队列中")
+	}
+}
+
+// TestRecall_ConcurrentRecallOnlyOnce 测试并发撤回同一条消息只成功一次
+//
+// 测试目标：
+// - 并发撤回时只有一个请求成功，其余返回 message already recalled，撤回事件只推送一次
+//
+// 验证闭环：
+// 1. A给B发送消息
+// 2. A并发发送5个撤回请求
+// 3. 只有1个请求返回200，其余返回400
+// 4. B只收到一次 recalled 事件
+func TestRecall_ConcurrentRecallOnlyOnce(t *testing.T) {
+	userA := createTestUser()
+	userB := createTestUser()
+
+	wsA, err := connectWebSocket(userA.Token)
+	require.NoError(t, err)
+	defer wsA.Close()
+	wsB, err := connectWebSocket(userB.Token)
+	require.NoError(t, err)
+	defer wsB.Close()
+
+	// 1. A给B发送消息
+	wsSend(wsA, "message", map[string]interface{}{
+		"receiver_id":  userB.ID.String(),
+		"message_type": "text",
+		"content":      "Recall me once",
+	})
+	msg, err := wsReceiveMessageType(wsB, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	msgID := msg["data"].(map[string]interface{})["id"].(string)
+
+	// 2. 并发撤回
+	const concurrency = 5
+	statuses := make([]int, concurrency)
+	bodies := make([]string, concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, body, err := httpRequest("POST", APIPrefix+"/messages/"+msgID+"/recall", userA.Token, nil)
+			if err == nil {
+				statuses[i] = resp.StatusCode
+				bodies[i] = string(body)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// 3. 只有一个成功
+	succeeded := 0
+	for i, status := range statuses {
+		if status == 200 {
+			succeeded++
+			continue
+		}
+		assert.Equal(t, 400, status, bodies[i])
+		assert.Contains(t, bodies[i], "message already recalled")
+	}
+	assert.Equal(t, 1, succeeded, "并发撤回应该只有一个成功")
+
+	// 4. 撤回事件只推送一次
+	_, err = wsReceiveMessageType(wsB, "recalled", 3*time.Second, 5)
+	require.NoError(t, err)
+	_, err = wsReceiveMessageType(wsB, "recalled", time.Second, 5)
+	assert.Error(t, err, "撤回事件不应重复推送")
+}
+
 // ============================================
 // 高级功能 - 群聊权限
 // ============================================
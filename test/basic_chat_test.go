@@ -202,7 +202,7 @@ func TestPrivateChat_ConcurrentCreate(t *testing.T) {
 //
 // 验证闭环：
 // 1. 发送text消息，验证content
-// 2. 发送image消息，验证metadata（url、尺寸等）
+// 2. 发送image消息，验证metadata（url；客户端提交的尺寸被丢弃，只使用服务端解析的结果）
 // 3. 发送video消息，验证metadata（url、时长、封面等）
 // 4. 发送emoji消息，验证metadata
 // 5. 查询消息历史，所有字段完整返回
@@ -254,7 +254,8 @@ func TestPrivateChat_MessageTypes(t *testing.T) {
 	if data["metadata"] != nil {
 		metadata := data["metadata"].(map[string]interface{})
 		assert.Equal(t, "https://example.com/image.jpg", metadata["image_url"])
-		assert.Equal(t, float64(800), metadata["width"])
+		assert.Nil(t, metadata["width"], "客户端提交的尺寸应该被丢弃")
+		assert.Nil(t, metadata["thumbnail_url"], "客户端提交的缩略图应该被丢弃")
 	} else {
 		t.Fatal("image消息的metadata为nil")
 	}
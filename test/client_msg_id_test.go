@@ -0,0 +1,172 @@
+package test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ============================================
+// 客户端消息ID（重试去重）
+// ============================================
+
+// TestClientMsgID_WebSocketRetry 测试通过 WebSocket 重试发送不会产生重复消息
+//
+// 测试目标：
+// - 同一发送者使用同一 client_msg_id 重试时，服务端返回第一次创建的消息
+// - 发送者收到的推送带有 client_msg_id，重试的回执带 duplicate=true
+// - 重试不会再推送给接收者，也不受首条消息限制影响
+//
+// 验证闭环：
+// 1. A给B发送带 client_msg_id 的消息，A和B收到的消息都带有 client_msg_id
+// 2. A用同一 client_msg_id 重试，A收到相同消息ID且 duplicate=true
+// 3. B没有收到第二条消息，消息历史中只有1条
+func TestClientMsgID_WebSocketRetry(t *testing.T) {
+	userA := createTestUser()
+	userB := createTestUser()
+
+	wsA, err := connectWebSocket(userA.Token)
+	require.NoError(t, err)
+	defer wsA.Close()
+	wsB, err := connectWebSocket(userB.Token)
+	require.NoError(t, err)
+	defer wsB.Close()
+
+	clientMsgID := fmt.Sprintf("local-%d", time.Now().UnixNano())
+	payload := map[string]interface{}{
+		"receiver_id":   userB.ID.String(),
+		"message_type":  "text",
+		"content":       "sent over a flaky network",
+		"client_msg_id": clientMsgID,
+	}
+
+	// 1. 第一次发送
+	wsSend(wsA, "message", payload)
+	ack, err := wsReceiveMessageType(wsA, "message", 3*time.Second, 10)
+	require.NoError(t, err)
+	ackData := ack["data"].(map[string]interface{})
+	msgID := ackData["id"].(string)
+	convID := ackData["conversation_id"].(string)
+	assert.Equal(t, clientMsgID, ackData["client_msg_id"])
+	assert.Nil(t, ackData["duplicate"])
+
+	msg, err := wsReceiveMessageType(wsB, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	assert.Equal(t, msgID, msg["data"].(map[string]interface{})["id"])
+
+	// 2. 重试
+	wsSend(wsA, "message", payload)
+	ack, err = wsReceiveMessageType(wsA, "message", 3*time.Second, 10)
+	require.NoError(t, err, "重试应该收到原消息而不是错误")
+	ackData = ack["data"].(map[string]interface{})
+	assert.Equal(t, msgID, ackData["id"], "重试应该返回第一次创建的消息")
+	assert.Equal(t, clientMsgID, ackData["client_msg_id"])
+	assert.Equal(t, true, ackData["duplicate"])
+
+	// 3. 接收者没有收到重复消息
+	_, err = wsReceiveMessageType(wsB, "message", 1*time.Second, 5)
+	assert.Error(t, err, "重试不应该再推送给接收者")
+
+	messages, err := getMessages(userB.Token, convID)
+	require.NoError(t, err)
+	assert.Len(t, messages, 1)
+}
+
+// TestClientMsgID_HTTPConcurrentRetries 测试通过 HTTP 并发重试只创建一条消息
+//
+// 测试目标：
+// - POST /api/v1/messages 发送消息，返回的消息带有 client_msg_id
+// - 同一 client_msg_id 的并发请求只创建一条消息，其余返回 duplicate=true
+// - 同一 client_msg_id 不能用于其他会话
+//
+// 验证闭环：
+// 1. owner并发5次用同一 client_msg_id 向群聊发送消息，全部返回200且消息ID相同
+// 2. 只有1个响应不是 duplicate，member只收到1条推送，消息历史中只有1条
+// 3. owner用同一 client_msg_id 向另一个群聊发送，返回409
+func TestClientMsgID_HTTPConcurrentRetries(t *testing.T) {
+	owner := createTestUser()
+	member := createTestUser()
+
+	resp, body, err := httpRequest("POST", APIPrefix+"/conversations/group", owner.Token, map[string]interface{}{
+		"group_name": "Retry Group",
+		"member_ids": []string{member.ID.String()},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode, string(body))
+	groupID := parseResponse(body)["id"].(string)
+
+	wsMember, err := connectWebSocket(member.Token)
+	require.NoError(t, err)
+	defer wsMember.Close()
+
+	clientMsgID := fmt.Sprintf("http-%d", time.Now().UnixNano())
+	payload := map[string]interface{}{
+		"conversation_id": groupID,
+		"message_type":    "text",
+		"content":         "retry me",
+		"client_msg_id":   clientMsgID,
+	}
+
+	// 1. 并发重试
+	const attempts = 5
+	results := make([]map[string]interface{}, attempts)
+	statuses := make([]int, attempts)
+	var wg sync.WaitGroup
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, body, err := httpRequest("POST", APIPrefix+"/messages", owner.Token, payload)
+			if err != nil {
+				return
+			}
+			statuses[i] = resp.StatusCode
+			results[i] = parseResponse(body)
+		}(i)
+	}
+	wg.Wait()
+
+	msgID := ""
+	created := 0
+	for i := 0; i < attempts; i++ {
+		require.Equal(t, 200, statuses[i], "第 %d 次请求应该成功", i+1)
+		if msgID == "" {
+			msgID = results[i]["id"].(string)
+		}
+		assert.Equal(t, msgID, results[i]["id"], "所有请求应该返回同一条消息")
+		assert.Equal(t, clientMsgID, results[i]["client_msg_id"])
+		if results[i]["duplicate"] != true {
+			created++
+		}
+	}
+	assert.Equal(t, 1, created, "只有一次请求创建了消息")
+
+	// 2. 只推送一次
+	msg, err := wsReceiveMessageType(wsMember, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	assert.Equal(t, msgID, msg["data"].(map[string]interface{})["id"])
+	_, err = wsReceiveMessageType(wsMember, "message", 1*time.Second, 5)
+	assert.Error(t, err, "重试不应该重复推送")
+
+	messages, err := getMessages(member.Token, groupID)
+	require.NoError(t, err)
+	assert.Len(t, messages, 1)
+
+	// 3. 不能用于其他会话
+	resp, body, err = httpRequest("POST", APIPrefix+"/conversations/group", owner.Token, map[string]interface{}{
+		"group_name": "Another Group",
+		"member_ids": []string{member.ID.String()},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode, string(body))
+	otherGroupID := parseResponse(body)["id"].(string)
+
+	payload["conversation_id"] = otherGroupID
+	resp, _, err = httpRequest("POST", APIPrefix+"/messages", owner.Token, payload)
+	require.NoError(t, err)
+	assert.Equal(t, 409, resp.StatusCode)
+}
@@ -0,0 +1,198 @@
+package test
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ============================================
+// 文件上传与文件消息
+// ============================================
+
+// uploadTestFile multipart 上传文件
+func uploadTestFile(token, fileName string, content []byte) (*http.Response, []byte, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", fileName)
+	if err != nil {
+		return nil, nil, err
+	}
+	part.Write(content)
+	writer.Close()
+
+	req, err := http.NewRequest("POST", BaseURL+APIPrefix+"/files", &body)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	resp, err := (&http.Client{Timeout: 30 * time.Second}).Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	return resp, respBody, err
+}
+
+// TestFile_UploadAndSendFileMessage 测试 multipart 上传并发送文件消息
+//
+// 测试目标：
+// - multipart 上传返回文件信息，类型根据内容识别，大小为实际字节数
+// - file 消息的 metadata 由服务端填充，忽略客户端声明的 file_size
+// - 不能发送其他用户上传的文件
+// - 下载时禁止浏览器嗅探类型，非图片和音视频的文件强制下载
+//
+// 验证闭环：
+// 1. A上传notes.txt
+// 2. A发送file消息（故意声明错误的file_size），B收到的metadata为实际信息
+// 3. 通过url下载文件，内容一致，响应带 nosniff 和 attachment
+// 4. B引用A的file_id发送消息，返回错误
+func TestFile_UploadAndSendFileMessage(t *testing.T) {
+	userA := createTestUser()
+	userB := createTestUser()
+	content := []byte("meeting notes: ship it")
+
+	// 1. 上传文件
+	resp, body, err := uploadTestFile(userA.Token, "notes.txt", content)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode, string(body))
+	file := parseResponse(body)["file"].(map[string]interface{})
+	fileID := file["id"].(string)
+	assert.Equal(t, "notes.txt", file["file_name"])
+	assert.Equal(t, "text/plain", file["mime_type"])
+	assert.Equal(t, float64(len(content)), file["size"])
+	assert.Equal(t, "uploaded", file["status"])
+
+	// 2. 发送文件消息
+	wsA, err := connectWebSocket(userA.Token)
+	require.NoError(t, err)
+	defer wsA.Close()
+	wsB, err := connectWebSocket(userB.Token)
+	require.NoError(t, err)
+	defer wsB.Close()
+
+	wsSend(wsA, "message", map[string]interface{}{
+		"receiver_id":  userB.ID.String(),
+		"message_type": "file",
+		"metadata": map[string]interface{}{
+			"file_id":   fileID,
+			"file_size": 1,
+		},
+	})
+	msg, err := wsReceiveMessageType(wsB, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	data := msg["data"].(map[string]interface{})
+	assert.Equal(t, "file", data["message_type"])
+	metadata := data["metadata"].(map[string]interface{})
+	assert.Equal(t, "notes.txt", metadata["file_name"])
+	assert.Equal(t, float64(len(content)), metadata["file_size"], "应使用实际上传的大小")
+	fileURL := metadata["url"].(string)
+
+	// 3. 下载文件
+	downloadResp, err := http.Get(fileURL)
+	require.NoError(t, err)
+	downloaded, _ := io.ReadAll(downloadResp.Body)
+	downloadResp.Body.Close()
+	assert.Equal(t, 200, downloadResp.StatusCode)
+	assert.Equal(t, content, downloaded)
+	assert.Equal(t, "nosniff", downloadResp.Header.Get("X-Content-Type-Options"))
+	assert.Equal(t, "attachment", downloadResp.Header.Get("Content-Disposition"), "非图片和音视频的文件应强制下载")
+
+	// 4. B不能发送A上传的文件
+	convID := data["conversation_id"].(string)
+	wsSend(wsB, "message", map[string]interface{}{
+		"conversation_id": convID,
+		"message_type":    "file",
+		"metadata":        map[string]interface{}{"file_id": fileID},
+	})
+	errMsg, err := wsReceiveMessageType(wsB, "error", 3*time.Second, 5)
+	require.NoError(t, err)
+	assert.Contains(t, errMsg["data"].(map[string]interface{})["message"], "file not found")
+}
+
+// TestFile_PresignedUploadEnforcesActualSize 测试预签名直传按实际字节数校验大小
+//
+// 验证闭环：
+// 1. 申请直传地址，按返回的method/url/headers上传文件，确认完成后大小为实际字节数
+// 2. 声明1KB的视频实际上传6MB（超过MAX_VIDEO_SIZE_MB=5），确认时返回413
+// 3. 被拒绝的文件不能用于发送消息
+// 4. 以 image/png 申请 page.html，实际上传 HTML，存储地址不使用 .html 扩展名，确认时返回400
+func TestFile_PresignedUploadEnforcesActualSize(t *testing.T) {
+	user := createTestUser()
+	receiver := createTestUser()
+
+	presignAndPut := func(fileName, mimeType string, declaredSize int, content []byte) map[string]interface{} {
+		resp, body, err := httpRequest("POST", APIPrefix+"/files/presign", user.Token, map[string]interface{}{
+			"file_name": fileName,
+			"mime_type": mimeType,
+			"size":      declaredSize,
+		})
+		require.NoError(t, err)
+		require.Equal(t, 200, resp.StatusCode, string(body))
+		result := parseResponse(body)
+		upload := result["upload"].(map[string]interface{})
+
+		req, err := http.NewRequest(upload["method"].(string), upload["url"].(string), bytes.NewReader(content))
+		require.NoError(t, err)
+		if headers, ok := upload["headers"].(map[string]interface{}); ok {
+			for key, value := range headers {
+				req.Header.Set(key, value.(string))
+			}
+		}
+		putResp, err := (&http.Client{Timeout: 30 * time.Second}).Do(req)
+		require.NoError(t, err)
+		putResp.Body.Close()
+		require.Equal(t, 200, putResp.StatusCode)
+
+		return result["file"].(map[string]interface{})
+	}
+
+	// 1. 正常直传
+	content := []byte(strings.Repeat("a", 2048))
+	fileID := presignAndPut("report.csv", "text/csv", len(content), content)["id"].(string)
+	resp, body, err := httpRequest("POST", APIPrefix+"/files/"+fileID+"/complete", user.Token, nil)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	file := parseResponse(body)["file"].(map[string]interface{})
+	assert.Equal(t, "uploaded", file["status"])
+	assert.Equal(t, float64(len(content)), file["size"])
+
+	// 2. 声明大小与实际不符的超大视频
+	videoID := presignAndPut("clip.mp4", "video/mp4", 1024, make([]byte, 6*1024*1024))["id"].(string)
+	resp, body, err = httpRequest("POST", APIPrefix+"/files/"+videoID+"/complete", user.Token, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 413, resp.StatusCode)
+	assert.Contains(t, string(body), "video file size exceeds limit")
+
+	// 3. 被拒绝的文件不能发送
+	wsUser, err := connectWebSocket(user.Token)
+	require.NoError(t, err)
+	defer wsUser.Close()
+	wsSend(wsUser, "message", map[string]interface{}{
+		"receiver_id":  receiver.ID.String(),
+		"message_type": "video",
+		"metadata":     map[string]interface{}{"file_id": videoID},
+	})
+	errMsg, err := wsReceiveMessageType(wsUser, "error", 3*time.Second, 5)
+	require.NoError(t, err)
+	assert.Contains(t, errMsg["data"].(map[string]interface{})["message"], "file not found")
+
+	// 4. 内容与申请的类型不符
+	html := []byte("<!DOCTYPE html><html><body><script>alert(1)</script></body></html>")
+	htmlFile := presignAndPut("page.html", "image/png", len(html), html)
+	assert.False(t, strings.HasSuffix(htmlFile["url"].(string), ".html"), "存储地址的扩展名应由文件类型决定")
+	resp, body, err = httpRequest("POST", APIPrefix+"/files/"+htmlFile["id"].(string)+"/complete", user.Token, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+	assert.Contains(t, string(body), "file content does not match")
+}
@@ -6,12 +6,14 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"reflect"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"github.com/redis/go-redis/v9"
+	"github.com/ugorji/go/codec"
 )
 
 // 测试配置
@@ -99,6 +101,45 @@ func connectWebSocket(token string) (*websocket.Conn, error) {
 	return conn, err
 }
 
+// connectWebSocketWithCheckpoint 使用同步协议建立 WebSocket 连接（连接后收到 type=sync 的同步结果）
+func connectWebSocketWithCheckpoint(token, checkpoint string) (*websocket.Conn, error) {
+	url := fmt.Sprintf("%s/ws?token=%s&checkpoint=%s", WSURL, token, checkpoint)
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	return conn, err
+}
+
+// connectWebSocketWithAck 建立需要确认新消息推送的 WebSocket 连接（收到 message 后需回复 ack）
+func connectWebSocketWithAck(token string) (*websocket.Conn, error) {
+	url := fmt.Sprintf("%s/ws?token=%s&ack=1", WSURL, token)
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	return conn, err
+}
+
+// connectWebSocketWithVersion 通过 query 参数 v 指定协议版本建立 WebSocket 连接
+func connectWebSocketWithVersion(token, version string) (*websocket.Conn, error) {
+	url := fmt.Sprintf("%s/ws?token=%s&v=%s", WSURL, token, version)
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	return conn, err
+}
+
+// connectWebSocketWithEncoding 通过 query 参数 encoding 指定帧编码建立 WebSocket 连接（json | msgpack）
+func connectWebSocketWithEncoding(token, encoding string) (*websocket.Conn, error) {
+	url := fmt.Sprintf("%s/ws?token=%s&encoding=%s", WSURL, token, encoding)
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	return conn, err
+}
+
+// connectWebSocketWithSubprotocols 通过子协议（dinq.vN）协商协议版本建立 WebSocket 连接
+func connectWebSocketWithSubprotocols(token string, subprotocols ...string) (*websocket.Conn, error) {
+	dialer := websocket.Dialer{
+		HandshakeTimeout: websocket.DefaultDialer.HandshakeTimeout,
+		Subprotocols:     subprotocols,
+	}
+	url := fmt.Sprintf("%s/ws?token=%s", WSURL, token)
+	conn, _, err := dialer.Dial(url, nil)
+	return conn, err
+}
+
 // wsSend WebSocket 发送消息
 func wsSend(conn *websocket.Conn, msgType string, data interface{}) error {
 	msg := map[string]interface{}{
@@ -108,6 +149,89 @@ func wsSend(conn *websocket.Conn, msgType string, data interface{}) error {
 	return conn.WriteJSON(msg)
 }
 
+// wsSendRequest WebSocket 发送带 request_id 的请求（服务端在 ack/error 中原样带回）
+func wsSendRequest(conn *websocket.Conn, msgType, requestID string, data interface{}) error {
+	msg := map[string]interface{}{
+		"type":       msgType,
+		"request_id": requestID,
+		"data":       data,
+	}
+	return conn.WriteJSON(msg)
+}
+
+// msgpackHandle 测试客户端使用的 MessagePack 编解码
+var msgpackHandle = func() *codec.MsgpackHandle {
+	h := &codec.MsgpackHandle{WriteExt: true}
+	h.RawToString = true
+	h.MapType = reflect.TypeOf(map[string]interface{}(nil))
+	return h
+}()
+
+// wsSendEncoded 按帧编码发送 WebSocket 消息（msgpack 使用二进制帧），返回写入的帧字节数
+func wsSendEncoded(conn *websocket.Conn, encoding, msgType string, data interface{}) (int, error) {
+	msg := map[string]interface{}{
+		"type": msgType,
+		"data": data,
+	}
+	if encoding != "msgpack" {
+		frame, err := json.Marshal(msg)
+		if err != nil {
+			return 0, err
+		}
+		return len(frame), conn.WriteMessage(websocket.TextMessage, frame)
+	}
+	var frame []byte
+	if err := codec.NewEncoderBytes(&frame, msgpackHandle).Encode(msg); err != nil {
+		return 0, err
+	}
+	return len(frame), conn.WriteMessage(websocket.BinaryMessage, frame)
+}
+
+// wsReceiveEncoded 按帧编码接收 WebSocket 消息（不跳过任何消息），返回消息和帧字节数
+// msgpack 消息转换为与 JSON 相同的结构（数字为 float64），便于复用同样的处理逻辑
+func wsReceiveEncoded(conn *websocket.Conn, encoding string, timeout time.Duration) (map[string]interface{}, int, error) {
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	frameType, frame, err := conn.ReadMessage()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	data := frame
+	if encoding == "msgpack" {
+		if frameType != websocket.BinaryMessage {
+			return nil, len(frame), fmt.Errorf("expected binary frame, got frame type %d", frameType)
+		}
+		var value interface{}
+		if err := codec.NewDecoderBytes(frame, msgpackHandle).Decode(&value); err != nil {
+			return nil, len(frame), err
+		}
+		if data, err = json.Marshal(value); err != nil {
+			return nil, len(frame), err
+		}
+	}
+
+	var msg map[string]interface{}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, len(frame), err
+	}
+	return msg, len(frame), nil
+}
+
+// wsReceiveEncodedType 按帧编码接收指定类型的 WebSocket 消息，返回消息和帧字节数
+// 跳过其他类型的消息，最多尝试 maxAttempts 次
+func wsReceiveEncodedType(conn *websocket.Conn, encoding, msgType string, timeout time.Duration, maxAttempts int) (map[string]interface{}, int, error) {
+	for i := 0; i < maxAttempts; i++ {
+		msg, frameBytes, err := wsReceiveEncoded(conn, encoding, timeout)
+		if err != nil {
+			return nil, 0, err
+		}
+		if msg["type"] == msgType {
+			return msg, frameBytes, nil
+		}
+	}
+	return nil, 0, fmt.Errorf("did not receive %s message after %d attempts", msgType, maxAttempts)
+}
+
 // wsReceiveRaw 原始接收 WebSocket 消息（不跳过任何消息）
 // 用于需要测试 unread_count_update、conversation_update 等系统推送消息的测试
 func wsReceiveRaw(conn *websocket.Conn, timeout time.Duration) (map[string]interface{}, error) {
@@ -0,0 +1,157 @@
+package test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "image/jpeg"
+)
+
+// ============================================
+// 图片宽高解析与缩略图
+// ============================================
+
+// generateTestPNG 生成指定尺寸的 PNG 图片
+func generateTestPNG(t *testing.T, width, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+// TestImage_UploadGeneratesThumbnail 测试上传图片后服务端生成宽高和缩略图，并覆盖客户端提交的宽高
+//
+// 测试目标：
+// - 上传图片后异步解析宽高并生成缩略图（最长边320）
+// - 发送图片消息时使用服务端解析的宽高，忽略客户端提交的值
+//
+// 验证闭环：
+// 1. A上传1000x500的PNG
+// 2. 轮询文件信息直到width/height/thumbnail_url就绪
+// 3. 下载缩略图，尺寸为320x160
+// 4. A发送图片消息（故意提交错误的宽高），B收到的宽高为1000x500
+func TestImage_UploadGeneratesThumbnail(t *testing.T) {
+	userA := createTestUser()
+	userB := createTestUser()
+
+	// 1. 上传图片
+	resp, body, err := uploadTestFile(userA.Token, "banner.png", generateTestPNG(t, 1000, 500))
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode, string(body))
+	fileID := parseResponse(body)["file"].(map[string]interface{})["id"].(string)
+
+	// 2. 等待异步处理完成
+	var file map[string]interface{}
+	require.Eventually(t, func() bool {
+		_, body, err := httpRequest("GET", APIPrefix+"/files/"+fileID, userA.Token, nil)
+		if err != nil {
+			return false
+		}
+		file = parseResponse(body)["file"].(map[string]interface{})
+		return file["thumbnail_url"] != nil
+	}, 5*time.Second, 200*time.Millisecond, "缩略图应该在5秒内生成")
+	assert.Equal(t, float64(1000), file["width"])
+	assert.Equal(t, float64(500), file["height"])
+
+	// 3. 缩略图尺寸
+	thumbResp, err := http.Get(file["thumbnail_url"].(string))
+	require.NoError(t, err)
+	defer thumbResp.Body.Close()
+	require.Equal(t, 200, thumbResp.StatusCode)
+	thumbConfig, _, err := image.DecodeConfig(thumbResp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, 320, thumbConfig.Width)
+	assert.Equal(t, 160, thumbConfig.Height)
+
+	// 4. 发送图片消息
+	wsA, err := connectWebSocket(userA.Token)
+	require.NoError(t, err)
+	defer wsA.Close()
+	wsB, err := connectWebSocket(userB.Token)
+	require.NoError(t, err)
+	defer wsB.Close()
+
+	wsSend(wsA, "message", map[string]interface{}{
+		"receiver_id":  userB.ID.String(),
+		"message_type": "image",
+		"metadata": map[string]interface{}{
+			"file_id": fileID,
+			"width":   1,
+			"height":  1,
+		},
+	})
+	msg, err := wsReceiveMessageType(wsB, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	metadata := msg["data"].(map[string]interface{})["metadata"].(map[string]interface{})
+	assert.Equal(t, float64(1000), metadata["width"], "应使用服务端解析的宽度")
+	assert.Equal(t, float64(500), metadata["height"])
+	assert.Equal(t, file["thumbnail_url"], metadata["thumbnail_url"])
+}
+
+// TestImage_MessageUpdatedWhenReady 测试图片处理完成后推送 message_updated 事件
+//
+// 验证闭环：
+// 1. A上传图片后立即发送图片消息
+// 2. 如果B收到的消息还没有服务端宽高，则等待message_updated事件
+// 3. 最终宽高为800x600，消息历史中的metadata一致
+func TestImage_MessageUpdatedWhenReady(t *testing.T) {
+	userA := createTestUser()
+	userB := createTestUser()
+
+	wsA, err := connectWebSocket(userA.Token)
+	require.NoError(t, err)
+	defer wsA.Close()
+	wsB, err := connectWebSocket(userB.Token)
+	require.NoError(t, err)
+	defer wsB.Close()
+
+	// 1. 上传后立即发送
+	resp, body, err := uploadTestFile(userA.Token, "photo.png", generateTestPNG(t, 800, 600))
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode, string(body))
+	fileID := parseResponse(body)["file"].(map[string]interface{})["id"].(string)
+
+	wsSend(wsA, "message", map[string]interface{}{
+		"receiver_id":  userB.ID.String(),
+		"message_type": "image",
+		"metadata":     map[string]interface{}{"file_id": fileID},
+	})
+	msg, err := wsReceiveMessageType(wsB, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	data := msg["data"].(map[string]interface{})
+	msgID := data["id"].(string)
+	convID := data["conversation_id"].(string)
+	metadata := data["metadata"].(map[string]interface{})
+
+	// 2. 处理尚未完成时等待 message_updated
+	if metadata["width"] == nil {
+		event, err := wsReceiveMessageType(wsB, "message_updated", 5*time.Second, 10)
+		require.NoError(t, err, "B应该收到message_updated事件")
+		assert.Equal(t, msgID, event["data"].(map[string]interface{})["message_id"])
+		metadata = event["data"].(map[string]interface{})["metadata"].(map[string]interface{})
+	}
+
+	// 3. 验证闭环
+	assert.Equal(t, float64(800), metadata["width"])
+	assert.Equal(t, float64(600), metadata["height"])
+	assert.NotEmpty(t, metadata["thumbnail_url"])
+
+	messages, err := getMessages(userB.Token, convID)
+	require.NoError(t, err)
+	stored := findMessageByID(messages, msgID)
+	require.NotNil(t, stored)
+	assert.Equal(t, float64(800), stored["metadata"].(map[string]interface{})["width"])
+}
@@ -0,0 +1,207 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ============================================
+// 链接预览
+// 需要以 LINK_PREVIEW_FETCHER=fake 启动服务（不访问网络，根据 URL 生成确定的预览）
+// ============================================
+
+// setSystemSetting 修改系统配置（修改立即生效）
+func setSystemSetting(t *testing.T, token, key, value string) {
+	resp, body, err := httpRequest("POST", "/api/admin/settings/"+key, token, map[string]interface{}{
+		"value": value,
+	})
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode, string(body))
+}
+
+// TestLinkPreview_UnfurlAndDomainLists 测试文本消息链接预览和域名黑名单
+//
+// 测试目标：
+// - 文本消息中的链接异步抓取预览，完成后推送 message_updated
+// - 预览写入消息 metadata.link_preview，消息历史可查询
+// - 黑名单域名（包括子域名）不生成预览
+//
+// 验证闭环：
+// 1. 设置黑名单 blocked.example
+// 2. A发送包含链接的文本，B先收到message，再收到带link_preview的message_updated
+// 3. B查询消息历史，metadata.link_preview与事件一致
+// 4. A发送黑名单子域名的链接，B不会收到message_updated
+func TestLinkPreview_UnfurlAndDomainLists(t *testing.T) {
+	userA := createTestUser()
+	userB := createTestUser()
+
+	// 1. 设置黑名单
+	setSystemSetting(t, userA.Token, "link_preview_blocked_domains", "blocked.example")
+	defer setSystemSetting(t, userA.Token, "link_preview_blocked_domains", "")
+
+	wsA, err := connectWebSocket(userA.Token)
+	require.NoError(t, err)
+	defer wsA.Close()
+	wsB, err := connectWebSocket(userB.Token)
+	require.NoError(t, err)
+	defer wsB.Close()
+
+	// 2. 发送带链接的消息（结尾的标点不属于链接）
+	wsSend(wsA, "message", map[string]interface{}{
+		"receiver_id":  userB.ID.String(),
+		"message_type": "text",
+		"content":      "Have you read https://news.example.com/story-1?",
+	})
+	msg, err := wsReceiveMessageType(wsB, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	msgData := msg["data"].(map[string]interface{})
+	msgID := msgData["id"].(string)
+	convID := msgData["conversation_id"].(string)
+
+	event, err := wsReceiveMessageType(wsB, "message_updated", 5*time.Second, 10)
+	require.NoError(t, err, "应该收到带链接预览的message_updated")
+	eventData := event["data"].(map[string]interface{})
+	assert.Equal(t, msgID, eventData["message_id"])
+	preview := eventData["metadata"].(map[string]interface{})["link_preview"].(map[string]interface{})
+	assert.Equal(t, "https://news.example.com/story-1", preview["url"])
+	assert.Equal(t, "Preview of news.example.com/story-1", preview["title"])
+	assert.Equal(t, "https://news.example.com/og-image.png", preview["image_url"])
+
+	// 3. 验证闭环：消息历史包含预览
+	messages, err := getMessages(userB.Token, convID)
+	require.NoError(t, err)
+	stored := findMessageByID(messages, msgID)
+	require.NotNil(t, stored)
+	storedPreview := stored["metadata"].(map[string]interface{})["link_preview"].(map[string]interface{})
+	assert.Equal(t, preview["title"], storedPreview["title"])
+
+	// 4. 黑名单子域名不生成预览
+	wsSend(wsA, "message", map[string]interface{}{
+		"conversation_id": convID,
+		"message_type":    "text",
+		"content":         "https://ads.blocked.example/offer",
+	})
+	_, err = wsReceiveMessageType(wsB, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	_, err = wsReceiveMessageType(wsB, "message_updated", 2*time.Second, 5)
+	assert.Error(t, err, "黑名单域名不应该生成预览")
+}
+
+// TestLinkPreview_GlobalToggle 测试关闭链接预览功能
+//
+// 验证闭环：
+// 1. 关闭 enable_link_preview
+// 2. A发送带链接的文本，B收到消息但不会收到message_updated，消息metadata中没有link_preview
+// 3. 恢复 enable_link_preview=true
+func TestLinkPreview_GlobalToggle(t *testing.T) {
+	userA := createTestUser()
+	userB := createTestUser()
+
+	// 1. 关闭功能
+	setSystemSetting(t, userA.Token, "enable_link_preview", "false")
+	defer setSystemSetting(t, userA.Token, "enable_link_preview", "true")
+
+	wsA, err := connectWebSocket(userA.Token)
+	require.NoError(t, err)
+	defer wsA.Close()
+	wsB, err := connectWebSocket(userB.Token)
+	require.NoError(t, err)
+	defer wsB.Close()
+
+	// 2. 发送带链接的消息
+	wsSend(wsA, "message", map[string]interface{}{
+		"receiver_id":  userB.ID.String(),
+		"message_type": "text",
+		"content":      "https://docs.example.org/guide",
+	})
+	msg, err := wsReceiveMessageType(wsB, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	msgData := msg["data"].(map[string]interface{})
+
+	_, err = wsReceiveMessageType(wsB, "message_updated", 2*time.Second, 5)
+	assert.Error(t, err, "功能关闭时不应该生成预览")
+
+	messages, err := getMessages(userB.Token, msgData["conversation_id"].(string))
+	require.NoError(t, err)
+	stored := findMessageByID(messages, msgData["id"].(string))
+	require.NotNil(t, stored)
+	if metadata, ok := stored["metadata"].(map[string]interface{}); ok {
+		assert.Nil(t, metadata["link_preview"])
+	}
+}
+
+// TestLinkPreview_EditRefreshesPreview 测试编辑消息后重新生成链接预览
+//
+// 测试目标：
+// - 编辑后原来的 link_preview 被移除，按新内容中的链接重新抓取
+// - 编辑后不再包含链接时，消息不再带预览
+//
+// 验证闭环：
+// 1. A发送带链接的文本，B收到带预览的message_updated
+// 2. A把链接改为另一个地址，B收到的edited事件中没有旧预览，随后收到新链接的message_updated
+// 3. A把内容改为不含链接的文本，B收到的edited事件中没有预览，也不会再收到message_updated
+// 4. 消息历史中的metadata没有link_preview
+func TestLinkPreview_EditRefreshesPreview(t *testing.T) {
+	userA := createTestUser()
+	userB := createTestUser()
+
+	wsA, err := connectWebSocket(userA.Token)
+	require.NoError(t, err)
+	defer wsA.Close()
+	wsB, err := connectWebSocket(userB.Token)
+	require.NoError(t, err)
+	defer wsB.Close()
+
+	// 1. 发送带链接的消息
+	wsSend(wsA, "message", map[string]interface{}{
+		"receiver_id":  userB.ID.String(),
+		"message_type": "text",
+		"content":      "see https://news.example.com/before",
+	})
+	msg, err := wsReceiveMessageType(wsB, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	msgData := msg["data"].(map[string]interface{})
+	msgID := msgData["id"].(string)
+	_, err = wsReceiveMessageType(wsB, "message_updated", 5*time.Second, 10)
+	require.NoError(t, err)
+
+	// 2. 修改链接
+	wsSend(wsA, "edit", map[string]interface{}{
+		"message_id": msgID,
+		"content":    "see https://news.example.com/after",
+	})
+	edited, err := wsReceiveMessageType(wsB, "edited", 3*time.Second, 10)
+	require.NoError(t, err)
+	if metadata, ok := edited["data"].(map[string]interface{})["metadata"].(map[string]interface{}); ok {
+		assert.Nil(t, metadata["link_preview"], "编辑后不应该保留旧链接的预览")
+	}
+	event, err := wsReceiveMessageType(wsB, "message_updated", 5*time.Second, 10)
+	require.NoError(t, err, "编辑后应该按新链接重新生成预览")
+	preview := event["data"].(map[string]interface{})["metadata"].(map[string]interface{})["link_preview"].(map[string]interface{})
+	assert.Equal(t, "https://news.example.com/after", preview["url"])
+
+	// 3. 去掉链接
+	wsSend(wsA, "edit", map[string]interface{}{
+		"message_id": msgID,
+		"content":    "never mind",
+	})
+	edited, err = wsReceiveMessageType(wsB, "edited", 3*time.Second, 10)
+	require.NoError(t, err)
+	if metadata, ok := edited["data"].(map[string]interface{})["metadata"].(map[string]interface{}); ok {
+		assert.Nil(t, metadata["link_preview"])
+	}
+	_, err = wsReceiveMessageType(wsB, "message_updated", 2*time.Second, 5)
+	assert.Error(t, err, "不含链接时不应该生成预览")
+
+	// 4. 验证闭环：消息历史
+	messages, err := getMessages(userB.Token, msgData["conversation_id"].(string))
+	require.NoError(t, err)
+	stored := findMessageByID(messages, msgID)
+	require.NotNil(t, stored)
+	if metadata, ok := stored["metadata"].(map[string]interface{}); ok {
+		assert.Nil(t, metadata["link_preview"])
+	}
+}
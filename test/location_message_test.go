@@ -0,0 +1,244 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ============================================
+// 位置消息和实时位置共享
+// ============================================
+
+// TestLocation_StaticMessage 测试发送静态位置消息
+//
+// 测试目标：
+// - 位置消息的坐标、精度和地点名称保存在 metadata 中
+// - 会话列表预览显示 [位置]
+// - 坐标超出范围时发送失败
+//
+// 验证闭环：
+// 1. A发送位置消息，B收到消息，metadata包含坐标和地点名称
+// 2. B的会话列表预览为 [位置]
+// 3. A发送纬度超出范围的位置消息，收到错误
+func TestLocation_StaticMessage(t *testing.T) {
+	userA := createTestUser()
+	userB := createTestUser()
+
+	wsA, err := connectWebSocket(userA.Token)
+	require.NoError(t, err)
+	defer wsA.Close()
+	wsB, err := connectWebSocket(userB.Token)
+	require.NoError(t, err)
+	defer wsB.Close()
+
+	// 1. 发送位置消息
+	wsSend(wsA, "message", map[string]interface{}{
+		"receiver_id":  userB.ID.String(),
+		"message_type": "location",
+		"metadata": map[string]interface{}{
+			"latitude":   31.2304,
+			"longitude":  121.4737,
+			"accuracy":   15,
+			"place_name": "  People's Square  ",
+		},
+	})
+	msg, err := wsReceiveMessageType(wsB, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	msgData := msg["data"].(map[string]interface{})
+	convID := msgData["conversation_id"].(string)
+	assert.Equal(t, "location", msgData["message_type"])
+	metadata := msgData["metadata"].(map[string]interface{})
+	assert.Equal(t, 31.2304, metadata["latitude"])
+	assert.Equal(t, 121.4737, metadata["longitude"])
+	assert.Equal(t, float64(15), metadata["accuracy"])
+	assert.Equal(t, "People's Square", metadata["place_name"])
+	assert.Nil(t, msgData["live_location"], "静态位置没有实时共享")
+
+	time.Sleep(200 * time.Millisecond)
+
+	// 2. 会话列表预览
+	conversations, err := getConversationList(userB.Token)
+	require.NoError(t, err)
+	conv := findConversationByID(conversations, convID)
+	require.NotNil(t, conv)
+	assert.Equal(t, "[位置]", conv["last_message_text"])
+
+	// 3. 坐标超出范围
+	wsSend(wsA, "message", map[string]interface{}{
+		"conversation_id": convID,
+		"message_type":    "location",
+		"metadata": map[string]interface{}{
+			"latitude":  95.0,
+			"longitude": 121.4737,
+		},
+	})
+	errMsg, err := wsReceiveMessageType(wsA, "error", 3*time.Second, 5)
+	require.NoError(t, err, "坐标超出范围应该返回错误")
+	assert.Contains(t, errMsg["data"].(map[string]interface{})["message"], "latitude must be between -90 and 90")
+}
+
+// TestLocation_LiveSharing 测试实时位置共享的更新、停止和到期
+//
+// 测试目标：
+// - live_period > 0 的位置消息开始实时共享，发送者通过 location_update 上报位置
+// - 会话成员收到 live_location_updated 事件，消息历史中的 live_location 为最新位置
+// - 发送者可以手动停止，到期后自动结束，结束后不能再上报
+//
+// 验证闭环：
+// 1. A发送 live_period=5 的位置消息，B收到的消息包含 live_location
+// 2. A上报新位置，B收到 live_location_updated，消息历史中的位置已更新
+// 3. B不能停止A的位置共享；A通过HTTP停止，B收到 reason=stopped 的 live_location_stopped
+// 4. A停止后再上报位置，收到错误
+// 5. A再发送一条实时位置，不停止，到期后B收到 reason=expired 的 live_location_stopped
+func TestLocation_LiveSharing(t *testing.T) {
+	userA := createTestUser()
+	userB := createTestUser()
+
+	wsA, err := connectWebSocket(userA.Token)
+	require.NoError(t, err)
+	defer wsA.Close()
+	wsB, err := connectWebSocket(userB.Token)
+	require.NoError(t, err)
+	defer wsB.Close()
+
+	// 1. 开始实时位置共享
+	wsSend(wsA, "message", map[string]interface{}{
+		"receiver_id":  userB.ID.String(),
+		"message_type": "location",
+		"metadata": map[string]interface{}{
+			"latitude":    39.9042,
+			"longitude":   116.4074,
+			"live_period": 5,
+		},
+	})
+	msg, err := wsReceiveMessageType(wsB, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	msgData := msg["data"].(map[string]interface{})
+	msgID := msgData["id"].(string)
+	convID := msgData["conversation_id"].(string)
+	liveLocation := msgData["live_location"].(map[string]interface{})
+	assert.Equal(t, true, liveLocation["is_active"])
+	assert.NotNil(t, liveLocation["expires_at"])
+
+	// 2. 上报新位置
+	wsSend(wsA, "location_update", map[string]interface{}{
+		"message_id": msgID,
+		"latitude":   39.9100,
+		"longitude":  116.4200,
+		"heading":    90,
+	})
+	event, err := wsReceiveMessageType(wsB, "live_location_updated", 3*time.Second, 5)
+	require.NoError(t, err, "B应该收到live_location_updated事件")
+	eventData := event["data"].(map[string]interface{})
+	assert.Equal(t, msgID, eventData["message_id"])
+	assert.Equal(t, 39.91, eventData["latitude"])
+	assert.Equal(t, 116.42, eventData["longitude"])
+	assert.Equal(t, float64(90), eventData["heading"])
+
+	messages, err := getMessages(userB.Token, convID)
+	require.NoError(t, err)
+	stored := findMessageByID(messages, msgID)
+	require.NotNil(t, stored)
+	storedLocation := stored["live_location"].(map[string]interface{})
+	assert.Equal(t, 39.91, storedLocation["latitude"])
+	assert.Equal(t, true, storedLocation["is_active"])
+
+	// 3. 只有发送者可以停止
+	resp, _, err := httpRequest("POST", APIPrefix+"/messages/"+msgID+"/live-location/stop", userB.Token, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 403, resp.StatusCode)
+
+	resp, body, err := httpRequest("POST", APIPrefix+"/messages/"+msgID+"/live-location/stop", userA.Token, nil)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode, string(body))
+
+	event, err = wsReceiveMessageType(wsB, "live_location_stopped", 3*time.Second, 5)
+	require.NoError(t, err, "B应该收到live_location_stopped事件")
+	eventData = event["data"].(map[string]interface{})
+	assert.Equal(t, msgID, eventData["message_id"])
+	assert.Equal(t, "stopped", eventData["reason"])
+
+	// 4. 停止后不能再上报
+	wsSend(wsA, "location_update", map[string]interface{}{
+		"message_id": msgID,
+		"latitude":   39.92,
+		"longitude":  116.43,
+	})
+	errMsg, err := wsReceiveMessageType(wsA, "error", 3*time.Second, 10)
+	require.NoError(t, err)
+	assert.Equal(t, "live location has ended", errMsg["data"].(map[string]interface{})["message"])
+
+	// 5. 到期自动结束
+	wsSend(wsA, "message", map[string]interface{}{
+		"conversation_id": convID,
+		"message_type":    "location",
+		"metadata": map[string]interface{}{
+			"latitude":    39.9042,
+			"longitude":   116.4074,
+			"live_period": 5,
+		},
+	})
+	msg, err = wsReceiveMessageType(wsB, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	expiringID := msg["data"].(map[string]interface{})["id"].(string)
+
+	event, err = wsReceiveMessageType(wsB, "live_location_stopped", 15*time.Second, 10)
+	require.NoError(t, err, "到期后B应该收到live_location_stopped事件")
+	eventData = event["data"].(map[string]interface{})
+	assert.Equal(t, expiringID, eventData["message_id"])
+	assert.Equal(t, "expired", eventData["reason"])
+}
+
+// TestLocation_RecallStopsSharing 测试撤回实时位置消息时结束共享
+//
+// 验证闭环：
+// 1. A发送 live_period=60 的位置消息，B收到消息
+// 2. A撤回消息，B收到 recalled 和 reason=stopped 的 live_location_stopped
+// 3. A再上报位置，收到错误
+func TestLocation_RecallStopsSharing(t *testing.T) {
+	userA := createTestUser()
+	userB := createTestUser()
+
+	wsA, err := connectWebSocket(userA.Token)
+	require.NoError(t, err)
+	defer wsA.Close()
+	wsB, err := connectWebSocket(userB.Token)
+	require.NoError(t, err)
+	defer wsB.Close()
+
+	// 1. 开始实时位置共享
+	wsSend(wsA, "message", map[string]interface{}{
+		"receiver_id":  userB.ID.String(),
+		"message_type": "location",
+		"metadata": map[string]interface{}{
+			"latitude":    39.9042,
+			"longitude":   116.4074,
+			"live_period": 60,
+		},
+	})
+	msg, err := wsReceiveMessageType(wsB, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	msgID := msg["data"].(map[string]interface{})["id"].(string)
+
+	// 2. 撤回
+	wsSend(wsA, "recall", map[string]interface{}{"message_id": msgID})
+	_, err = wsReceiveMessageType(wsB, "recalled", 3*time.Second, 10)
+	require.NoError(t, err, "B应该收到recalled事件")
+	event, err := wsReceiveMessageType(wsB, "live_location_stopped", 3*time.Second, 10)
+	require.NoError(t, err, "撤回后B应该收到live_location_stopped事件")
+	eventData := event["data"].(map[string]interface{})
+	assert.Equal(t, msgID, eventData["message_id"])
+	assert.Equal(t, "stopped", eventData["reason"])
+
+	// 3. 撤回后不能再上报
+	wsSend(wsA, "location_update", map[string]interface{}{
+		"message_id": msgID,
+		"latitude":   39.92,
+		"longitude":  116.43,
+	})
+	_, err = wsReceiveMessageType(wsA, "error", 3*time.Second, 10)
+	require.NoError(t, err, "撤回后上报位置应该返回错误")
+}
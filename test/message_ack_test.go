@@ -0,0 +1,177 @@
+package test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ============================================
+// 新消息推送确认和重发
+// ============================================
+
+// TestAck_DeliveredAfterAck 测试开启确认的设备收到确认后才记录送达
+//
+// 测试目标：
+// - 连接参数 ack=1 的设备收到 message 推送后，服务端等待确认，未确认前消息状态仍为 sent
+// - 设备回复 ack 后记录送达，发送者收到 delivered 事件
+// - 已确认的消息不再重发
+//
+// 验证闭环：
+// 1. B以 ack=1 连接，A给B发消息，B收到消息但不确认，消息状态为 sent
+// 2. B确认，A收到 delivered 事件，消息状态变为 delivered
+// 3. 超过确认超时时间后B没有再收到该消息
+func TestAck_DeliveredAfterAck(t *testing.T) {
+	userA := createTestUser()
+	userB := createTestUser()
+
+	wsA, err := connectWebSocket(userA.Token)
+	require.NoError(t, err)
+	defer wsA.Close()
+	wsB, err := connectWebSocketWithAck(userB.Token)
+	require.NoError(t, err)
+	defer wsB.Close()
+
+	// 1. 未确认前不记录送达
+	wsSend(wsA, "message", map[string]interface{}{
+		"receiver_id":  userB.ID.String(),
+		"message_type": "text",
+		"content":      "please ack",
+	})
+	msg, err := wsReceiveMessageType(wsB, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	msgData := msg["data"].(map[string]interface{})
+	msgID := msgData["id"].(string)
+	convID := msgData["conversation_id"].(string)
+
+	time.Sleep(500 * time.Millisecond)
+	messages, err := getMessages(userA.Token, convID)
+	require.NoError(t, err)
+	stored := findMessageByID(messages, msgID)
+	require.NotNil(t, stored)
+	assert.Equal(t, "sent", stored["status"], "B确认前消息状态为sent")
+
+	// 2. 确认后记录送达
+	wsSend(wsB, "ack", map[string]interface{}{
+		"message_ids": []string{msgID},
+	})
+	event, err := wsReceiveMessageType(wsA, "delivered", 3*time.Second, 10)
+	require.NoError(t, err, "B确认后A应该收到delivered事件")
+	eventData := event["data"].(map[string]interface{})
+	assert.Equal(t, msgID, eventData["message_id"])
+	assert.Equal(t, userB.ID.String(), eventData["user_id"])
+
+	messages, err = getMessages(userA.Token, convID)
+	require.NoError(t, err)
+	stored = findMessageByID(messages, msgID)
+	require.NotNil(t, stored)
+	assert.Equal(t, "delivered", stored["status"])
+
+	// 3. 已确认的消息不再重发
+	_, err = wsReceiveMessageType(wsB, "message", 4*time.Second, 10)
+	assert.Error(t, err, "已确认的消息不应该重发")
+}
+
+// TestAck_RetryThenOfflineFallback 测试未确认的消息重发，重试用完后转入离线路径
+//
+// 测试目标：
+// - 超时未确认的消息按退避重发（消息ID相同，客户端去重）
+// - 重试次数用完仍未确认时服务端断开该设备，消息不记录送达
+// - 设备重连后通过离线消息收到该消息，并记录送达
+//
+// 验证闭环：
+// 1. B以 ack=1 连接，A给B发消息，B收到消息后不确认
+// 2. B再次收到同一条消息（重发）
+// 3. 一直不确认，服务端断开B的连接，消息状态仍为 sent
+// 4. B重新连接，收到包含该消息的 offline_message，A收到 delivered 事件
+func TestAck_RetryThenOfflineFallback(t *testing.T) {
+	userA := createTestUser()
+	userB := createTestUser()
+
+	wsA, err := connectWebSocket(userA.Token)
+	require.NoError(t, err)
+	defer wsA.Close()
+	wsB, err := connectWebSocketWithAck(userB.Token)
+	require.NoError(t, err)
+	defer wsB.Close()
+
+	// 1. 发送消息，B不确认
+	wsSend(wsA, "message", map[string]interface{}{
+		"receiver_id":  userB.ID.String(),
+		"message_type": "text",
+		"content":      "are you still there?",
+	})
+	msg, err := wsReceiveMessageType(wsB, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	msgData := msg["data"].(map[string]interface{})
+	msgID := msgData["id"].(string)
+	convID := msgData["conversation_id"].(string)
+
+	// 2. 重发
+	retry, err := wsReceiveMessageType(wsB, "message", 5*time.Second, 10)
+	require.NoError(t, err, "未确认的消息应该重发")
+	assert.Equal(t, msgID, retry["data"].(map[string]interface{})["id"])
+
+	// 3. 重试用完后服务端断开连接
+	wsB.SetReadDeadline(time.Now().Add(30 * time.Second))
+	for {
+		if _, _, err = wsB.ReadMessage(); err != nil {
+			break
+		}
+	}
+	netErr, isNetErr := err.(net.Error)
+	require.False(t, isNetErr && netErr.Timeout(), "重试用完后服务端应该断开连接")
+
+	messages, err := getMessages(userA.Token, convID)
+	require.NoError(t, err)
+	stored := findMessageByID(messages, msgID)
+	require.NotNil(t, stored)
+	assert.Equal(t, "sent", stored["status"], "未确认的消息不记录送达")
+
+	// 4. 重连后通过离线消息收到
+	wsB2, err := connectWebSocket(userB.Token)
+	require.NoError(t, err)
+	defer wsB2.Close()
+
+	offline, err := wsReceiveMessageType(wsB2, "offline_message", 3*time.Second, 5)
+	require.NoError(t, err, "重连后应该收到离线消息")
+	assert.Equal(t, msgID, offline["data"].(map[string]interface{})["id"])
+
+	event, err := wsReceiveMessageType(wsA, "delivered", 3*time.Second, 10)
+	require.NoError(t, err, "B重连后A应该收到delivered事件")
+	assert.Equal(t, msgID, event["data"].(map[string]interface{})["message_id"])
+}
+
+// TestAck_SettingsRange 测试确认配置的取值范围
+//
+// 验证闭环：
+// 1. ws_ack_timeout_seconds 设为 0 或超过 60 返回400，设为 1 成功
+// 2. ws_ack_max_retries 超过 10 返回400，设为 0 成功
+// 3. 恢复默认值
+func TestAck_SettingsRange(t *testing.T) {
+	admin := createTestUser()
+
+	invalid := []struct{ key, value string }{
+		{"ws_ack_timeout_seconds", "0"},
+		{"ws_ack_timeout_seconds", "61"},
+		{"ws_ack_max_retries", "11"},
+		{"ws_ack_max_retries", "64"},
+	}
+	for _, tc := range invalid {
+		resp, body, err := httpRequest("POST", "/api/admin/settings/"+tc.key, admin.Token, map[string]interface{}{
+			"value": tc.value,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 400, resp.StatusCode, "%s=%s 应该被拒绝: %s", tc.key, tc.value, string(body))
+	}
+
+	setSystemSetting(t, admin.Token, "ws_ack_timeout_seconds", "1")
+	setSystemSetting(t, admin.Token, "ws_ack_max_retries", "0")
+
+	// 3. 恢复默认值
+	setSystemSetting(t, admin.Token, "ws_ack_timeout_seconds", "2")
+	setSystemSetting(t, admin.Token, "ws_ack_max_retries", "2")
+}
@@ -0,0 +1,121 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ============================================
+// 消息编辑
+// ============================================
+
+// TestEdit_SenderEditsMessage 测试发送者编辑消息
+//
+// 测试目标：
+// - 发送者可以通过 WebSocket 编辑自己的文本消息
+// - 所有成员收到 edited 事件
+// - 消息历史中内容已更新且带有 edited_at
+// - 编辑历史保留旧内容
+// - 会话列表预览同步更新（编辑的是最新消息）
+//
+// 验证闭环：
+// 1. A给B发送消息 "Helo"
+// 2. A编辑为 "Hello"
+// 3. B收到edited事件，content为新内容
+// 4. 查询消息历史，content已更新，edited_at有值
+// 5. 查询编辑历史，包含旧内容 "Helo"
+// 6. B的会话列表预览为新内容
+func TestEdit_SenderEditsMessage(t *testing.T) {
+	userA := createTestUser()
+	userB := createTestUser()
+
+	wsA, err := connectWebSocket(userA.Token)
+	require.NoError(t, err)
+	defer wsA.Close()
+
+	wsB, err := connectWebSocket(userB.Token)
+	require.NoError(t, err)
+	defer wsB.Close()
+
+	// 1. A给B发送消息
+	wsSend(wsA, "message", map[string]interface{}{
+		"receiver_id":  userB.ID.String(),
+		"message_type": "text",
+		"content":      "Helo",
+	})
+	msgA, err := wsReceiveMessageType(wsA, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	msgID := msgA["data"].(map[string]interface{})["id"].(string)
+	convID := msgA["data"].(map[string]interface{})["conversation_id"].(string)
+	wsReceiveMessageType(wsB, "message", 3*time.Second, 5)
+
+	// 2. A编辑消息
+	err = wsSend(wsA, "edit", map[string]interface{}{
+		"message_id": msgID,
+		"content":    "Hello",
+	})
+	require.NoError(t, err)
+
+	// 3. B收到edited事件
+	event, err := wsReceiveMessageType(wsB, "edited", 3*time.Second, 5)
+	require.NoError(t, err, "B应该收到edited事件")
+	data := event["data"].(map[string]interface{})
+	assert.Equal(t, msgID, data["message_id"])
+	assert.Equal(t, "Hello", data["content"])
+	assert.NotNil(t, data["edited_at"])
+
+	// 4. 验证闭环：消息历史已更新
+	messages, err := getMessages(userB.Token, convID)
+	require.NoError(t, err)
+	msg := findMessageByID(messages, msgID)
+	require.NotNil(t, msg)
+	assert.Equal(t, "Hello", msg["content"])
+	assert.NotNil(t, msg["edited_at"], "编辑后的消息应带有edited_at")
+
+	// 5. 编辑历史保留旧内容
+	resp, body, err := httpRequest("GET", APIPrefix+"/messages/"+msgID+"/edits", userB.Token, nil)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	edits := parseResponse(body)["edits"].([]interface{})
+	require.Len(t, edits, 1)
+	assert.Equal(t, "Helo", edits[0].(map[string]interface{})["previous_content"])
+
+	// 6. 会话列表预览同步更新
+	conversations, err := getConversationList(userB.Token)
+	require.NoError(t, err)
+	conv := findConversationByID(conversations, convID)
+	require.NotNil(t, conv)
+	assert.Equal(t, "Hello", conv["last_message_text"])
+}
+
+// TestEdit_OnlySenderCanEdit 测试只有发送者可以编辑消息
+//
+// 验证闭环：
+// 1. A给B发送消息
+// 2. B通过HTTP编辑A的消息，返回403
+func TestEdit_OnlySenderCanEdit(t *testing.T) {
+	userA := createTestUser()
+	userB := createTestUser()
+
+	wsA, err := connectWebSocket(userA.Token)
+	require.NoError(t, err)
+	defer wsA.Close()
+
+	wsSend(wsA, "message", map[string]interface{}{
+		"receiver_id":  userB.ID.String(),
+		"message_type": "text",
+		"content":      "Mine",
+	})
+	msgA, err := wsReceiveMessageType(wsA, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	msgID := msgA["data"].(map[string]interface{})["id"].(string)
+
+	resp, _, err := httpRequest("POST", APIPrefix+"/messages/"+msgID+"/edit", userB.Token, map[string]interface{}{
+		"content": "Not yours",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 403, resp.StatusCode, "编辑他人消息应返回403")
+}
@@ -0,0 +1,130 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ============================================
+// WebSocket 二进制编码（MessagePack）
+// ============================================
+
+// TestEncoding_MsgpackClient 测试 MessagePack 设备的收发
+//
+// 测试目标：
+// - encoding=msgpack 的连接收到二进制帧，事件结构与 JSON 一致（ID 为字符串）
+// - MessagePack 设备用二进制帧发送请求，服务端正常处理
+// - 请求错误同样以二进制帧返回错误码
+//
+// 验证闭环：
+// 1. B以 msgpack 连接，A（JSON）给B发消息，B收到二进制帧的 message，包含 id、content、can_send
+// 2. B用二进制帧回复，A收到文本帧的 message，内容一致
+// 3. B用二进制帧发送未知类型，收到 code=unknown_type 的 error
+func TestEncoding_MsgpackClient(t *testing.T) {
+	userA := createTestUser()
+	userB := createTestUser()
+
+	wsA, err := connectWebSocket(userA.Token)
+	require.NoError(t, err)
+	defer wsA.Close()
+	wsB, err := connectWebSocketWithEncoding(userB.Token, "msgpack")
+	require.NoError(t, err)
+	defer wsB.Close()
+
+	// 1. 接收二进制帧
+	wsSend(wsA, "message", map[string]interface{}{
+		"receiver_id":  userB.ID.String(),
+		"message_type": "text",
+		"content":      "hello msgpack",
+	})
+	msg, _, err := wsReceiveEncodedType(wsB, "msgpack", "message", 3*time.Second, 5)
+	require.NoError(t, err, "B应该收到二进制帧的消息")
+	data := msg["data"].(map[string]interface{})
+	assert.IsType(t, "", data["id"], "ID应该是字符串")
+	assert.Equal(t, "hello msgpack", data["content"])
+	assert.Equal(t, userA.ID.String(), data["sender_id"])
+	assert.NotNil(t, data["can_send"])
+	convID := data["conversation_id"].(string)
+
+	// 2. 发送二进制帧
+	_, err = wsSendEncoded(wsB, "msgpack", "message", map[string]interface{}{
+		"conversation_id": convID,
+		"message_type":    "text",
+		"content":         "reply from msgpack",
+	})
+	require.NoError(t, err)
+	reply, err := wsReceiveMessageType(wsA, "message", 3*time.Second, 10)
+	require.NoError(t, err, "A应该收到B的回复")
+	assert.Equal(t, "reply from msgpack", reply["data"].(map[string]interface{})["content"])
+
+	// 3. 错误同样使用二进制帧
+	_, err = wsSendEncoded(wsB, "msgpack", "no_such_type", map[string]interface{}{})
+	require.NoError(t, err)
+	errMsg, _, err := wsReceiveEncodedType(wsB, "msgpack", "error", 3*time.Second, 10)
+	require.NoError(t, err)
+	assert.Equal(t, "unknown_type", errMsg["data"].(map[string]interface{})["code"])
+}
+
+// TestEncoding_MixedDevicesAndUnsupported 测试同一用户混用编码的设备以及不支持的编码
+//
+// 测试目标：
+// - 同一用户的 JSON 设备和 MessagePack 设备都能收到同一条推送，内容一致
+// - MessagePack 帧比 JSON 帧小
+// - 不支持的编码以关闭码 4002 拒绝，关闭原因包含支持的编码
+//
+// 验证闭环：
+// 1. B的两个设备分别以 json、msgpack 连接，A给B发消息，两个设备收到相同的消息ID和内容
+// 2. msgpack 设备收到的帧字节数小于 json 设备
+// 3. 以 encoding=xml 连接，收到关闭码 4002
+func TestEncoding_MixedDevicesAndUnsupported(t *testing.T) {
+	userA := createTestUser()
+	userB := createTestUser()
+
+	wsA, err := connectWebSocket(userA.Token)
+	require.NoError(t, err)
+	defer wsA.Close()
+
+	// 1. 两种编码的设备
+	wsJSON, err := connectWebSocketWithEncoding(userB.Token, "json")
+	require.NoError(t, err)
+	defer wsJSON.Close()
+	wsMsgpack, err := connectWebSocketWithEncoding(userB.Token, "msgpack")
+	require.NoError(t, err)
+	defer wsMsgpack.Close()
+
+	wsSend(wsA, "message", map[string]interface{}{
+		"receiver_id":  userB.ID.String(),
+		"message_type": "text",
+		"content":      "same message, two encodings",
+	})
+	msgJSON, jsonBytes, err := wsReceiveEncodedType(wsJSON, "json", "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	msgMsgpack, msgpackBytes, err := wsReceiveEncodedType(wsMsgpack, "msgpack", "message", 3*time.Second, 5)
+	require.NoError(t, err)
+
+	dataJSON := msgJSON["data"].(map[string]interface{})
+	dataMsgpack := msgMsgpack["data"].(map[string]interface{})
+	assert.Equal(t, dataJSON["id"], dataMsgpack["id"])
+	assert.Equal(t, dataJSON["seq"], dataMsgpack["seq"])
+	assert.Equal(t, dataJSON["created_at"], dataMsgpack["created_at"])
+	assert.Equal(t, "same message, two encodings", dataMsgpack["content"])
+
+	// 2. 帧大小
+	assert.Less(t, msgpackBytes, jsonBytes, "MessagePack 帧应该比 JSON 帧小")
+
+	// 3. 不支持的编码
+	conn, err := connectWebSocketWithEncoding(userB.Token, "xml")
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	_, _, err = conn.ReadMessage()
+	require.Error(t, err)
+	closeErr, ok := err.(*websocket.CloseError)
+	require.True(t, ok, "应该收到关闭帧: %v", err)
+	assert.Equal(t, 4002, closeErr.Code)
+	assert.Contains(t, closeErr.Text, "supported encodings")
+}
@@ -0,0 +1,301 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ============================================
+// 消息转发
+// ============================================
+
+// TestForward_PreservesOriginalSender 测试转发消息保留原发送者和原会话
+//
+// 测试目标：
+// - 可以通过 HTTP 将他人发送的消息转发到自己所在的群聊
+// - 转发的消息由转发者发送，metadata.forwarded_from 记录原发送者和原会话
+// - 目标会话成员实时收到转发的消息
+//
+// 验证闭环：
+// 1. B给A发送消息
+// 2. A创建群聊（包含C）
+// 3. A将B的消息转发到群聊
+// 4. C收到新消息：sender_id=A，content相同，forwarded_from指向B和A-B私聊
+func TestForward_PreservesOriginalSender(t *testing.T) {
+	userA := createTestUser()
+	userB := createTestUser()
+	userC := createTestUser()
+
+	wsB, err := connectWebSocket(userB.Token)
+	require.NoError(t, err)
+	defer wsB.Close()
+
+	// 1. B给A发送消息
+	wsSend(wsB, "message", map[string]interface{}{
+		"receiver_id":  userA.ID.String(),
+		"message_type": "text",
+		"content":      "Worth sharing",
+	})
+	msgB, err := wsReceiveMessageType(wsB, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	srcData := msgB["data"].(map[string]interface{})
+	srcID := srcData["id"].(string)
+	srcConvID := srcData["conversation_id"].(string)
+
+	// 2. A创建群聊
+	_, body, err := httpRequest("POST", APIPrefix+"/conversations/group", userA.Token, map[string]interface{}{
+		"group_name": "Forward Group",
+		"member_ids": []string{userC.ID.String()},
+	})
+	require.NoError(t, err)
+	groupID := parseResponse(body)["id"].(string)
+
+	wsC, err := connectWebSocket(userC.Token)
+	require.NoError(t, err)
+	defer wsC.Close()
+
+	// 3. A转发B的消息到群聊
+	resp, body, err := httpRequest("POST", APIPrefix+"/messages/forward", userA.Token, map[string]interface{}{
+		"message_ids":      []string{srcID},
+		"conversation_ids": []string{groupID},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+
+	results := parseResponse(body)["results"].([]interface{})
+	require.Len(t, results, 1)
+	result := results[0].(map[string]interface{})
+	assert.Nil(t, result["error"])
+	assert.Len(t, result["messages"].([]interface{}), 1)
+
+	// 4. C收到转发的消息
+	msgC, err := wsReceiveMessageType(wsC, "message", 3*time.Second, 5)
+	require.NoError(t, err, "C应该收到转发的消息")
+	data := msgC["data"].(map[string]interface{})
+	assert.Equal(t, groupID, data["conversation_id"])
+	assert.Equal(t, userA.ID.String(), data["sender_id"])
+	assert.Equal(t, "Worth sharing", data["content"])
+
+	forwardedFrom := data["metadata"].(map[string]interface{})["forwarded_from"].(map[string]interface{})
+	assert.Equal(t, srcID, forwardedFrom["message_id"])
+	assert.Equal(t, userB.ID.String(), forwardedFrom["sender_id"])
+	assert.Equal(t, srcConvID, forwardedFrom["conversation_id"])
+}
+
+// TestForward_BlockedTargetReportsError 测试转发到拉黑自己的用户时该目标失败
+//
+// 测试目标：
+// - 转发遵守拉黑检查
+// - 单个目标失败不影响其他目标
+//
+// 验证闭环：
+// 1. A分别给B、C发送消息（建立私聊）
+// 2. C拉黑A
+// 3. A通过WebSocket把消息转发到A-B和A-C两个私聊
+// 4. forward_result中A-B成功，A-C返回拉黑错误
+func TestForward_BlockedTargetReportsError(t *testing.T) {
+	userA := createTestUser()
+	userB := createTestUser()
+	userC := createTestUser()
+
+	wsA, err := connectWebSocket(userA.Token)
+	require.NoError(t, err)
+	defer wsA.Close()
+
+	// 1. 建立私聊
+	wsSend(wsA, "message", map[string]interface{}{
+		"receiver_id":  userB.ID.String(),
+		"message_type": "text",
+		"content":      "Hi B",
+	})
+	msgAB, err := wsReceiveMessageType(wsA, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	abData := msgAB["data"].(map[string]interface{})
+	srcID := abData["id"].(string)
+	convAB := abData["conversation_id"].(string)
+
+	wsSend(wsA, "message", map[string]interface{}{
+		"receiver_id":  userC.ID.String(),
+		"message_type": "text",
+		"content":      "Hi C",
+	})
+	msgAC, err := wsReceiveMessageType(wsA, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	convAC := msgAC["data"].(map[string]interface{})["conversation_id"].(string)
+
+	// B回复A，解除首条消息限制
+	wsB, err := connectWebSocket(userB.Token)
+	require.NoError(t, err)
+	defer wsB.Close()
+	wsSend(wsB, "message", map[string]interface{}{
+		"conversation_id": convAB,
+		"message_type":    "text",
+		"content":         "Hi A",
+	})
+	_, err = wsReceiveMessageType(wsB, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+
+	// 2. C拉黑A
+	httpRequest("POST", APIPrefix+"/relationships/block", userC.Token, map[string]interface{}{
+		"target_user_id": userA.ID.String(),
+	})
+
+	// 3. A转发到两个私聊
+	wsSend(wsA, "forward", map[string]interface{}{
+		"message_ids":      []string{srcID},
+		"conversation_ids": []string{convAB, convAC},
+	})
+
+	// 4. 验证转发结果
+	event, err := wsReceiveMessageType(wsA, "forward_result", 3*time.Second, 10)
+	require.NoError(t, err, "应该收到forward_result")
+	results := event["data"].(map[string]interface{})["results"].([]interface{})
+	require.Len(t, results, 2)
+
+	for _, r := range results {
+		result := r.(map[string]interface{})
+		switch result["conversation_id"] {
+		case convAB:
+			assert.Nil(t, result["error"], "转发到A-B应该成功")
+			assert.Len(t, result["messages"].([]interface{}), 1)
+		case convAC:
+			assert.Contains(t, result["error"], "blocked", "转发到A-C应该因拉黑失败")
+			assert.Len(t, result["messages"].([]interface{}), 0)
+		}
+	}
+}
+
+// TestForward_DoesNotMention 测试转发的内容中的@不会提及目标会话成员
+//
+// 测试目标：
+// - 转发时不解析内容中的@提及，metadata 中没有 mentioned_user_ids
+// - 目标会话中被@的成员未读提及数不变
+//
+// 验证闭环：
+// 1. B给A发送包含 "@C" 的消息
+// 2. A创建群聊（包含C），把B的消息转发到群聊
+// 3. C收到的转发消息metadata中没有mentioned_user_ids
+// 4. C在群聊中的unread_mention_count=0
+func TestForward_DoesNotMention(t *testing.T) {
+	userA := createTestUser()
+	userB := createTestUser()
+	userC := createTestUser()
+
+	wsB, err := connectWebSocket(userB.Token)
+	require.NoError(t, err)
+	defer wsB.Close()
+
+	// 1. B给A发送包含@的消息
+	wsSend(wsB, "message", map[string]interface{}{
+		"receiver_id":  userA.ID.String(),
+		"message_type": "text",
+		"content":      "@" + userC.ID.String() + " should see this",
+	})
+	msgB, err := wsReceiveMessageType(wsB, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	srcID := msgB["data"].(map[string]interface{})["id"].(string)
+
+	// 2. A转发到群聊
+	_, body, err := httpRequest("POST", APIPrefix+"/conversations/group", userA.Token, map[string]interface{}{
+		"group_name": "Forward Mention Group",
+		"member_ids": []string{userC.ID.String()},
+	})
+	require.NoError(t, err)
+	groupID := parseResponse(body)["id"].(string)
+
+	wsC, err := connectWebSocket(userC.Token)
+	require.NoError(t, err)
+	defer wsC.Close()
+
+	resp, body, err := httpRequest("POST", APIPrefix+"/messages/forward", userA.Token, map[string]interface{}{
+		"message_ids":      []string{srcID},
+		"conversation_ids": []string{groupID},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode, string(body))
+
+	// 3. 转发的消息不带提及
+	msgC, err := wsReceiveMessageType(wsC, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	metadata := msgC["data"].(map[string]interface{})["metadata"].(map[string]interface{})
+	assert.Nil(t, metadata["mentioned_user_ids"], "转发的消息不应该解析@提及")
+
+	// 4. 未读提及数不变
+	assert.Equal(t, 0, getUnreadMentionCount(t, userC.Token, groupID))
+}
+
+// TestForward_IgnoresClientForwardedFrom 测试客户端不能伪造服务端生成的 metadata 字段
+//
+// 测试目标：
+// - 普通发送时客户端提供的 forwarded_from、mentioned_user_ids、mention_all、link_preview、reply_to_content 被丢弃
+// - 转发时 forwarded_from 总是指向实际被转发的消息
+//
+// 验证闭环：
+// 1. B给A发送带伪造字段的消息，A收到的消息 metadata 不包含这些字段，自定义字段保留
+// 2. A把该消息转发给C，forwarded_from 指向B的消息
+func TestForward_IgnoresClientForwardedFrom(t *testing.T) {
+	userA := createTestUser()
+	userB := createTestUser()
+	userC := createTestUser()
+
+	wsA, err := connectWebSocket(userA.Token)
+	require.NoError(t, err)
+	defer wsA.Close()
+	wsB, err := connectWebSocket(userB.Token)
+	require.NoError(t, err)
+	defer wsB.Close()
+
+	// 1. 带伪造字段发送
+	fakeOrigin := map[string]interface{}{
+		"message_id":      userC.ID.String(),
+		"sender_id":       userC.ID.String(),
+		"conversation_id": userC.ID.String(),
+	}
+	wsSend(wsB, "message", map[string]interface{}{
+		"receiver_id":  userA.ID.String(),
+		"message_type": "text",
+		"content":      "totally original",
+		"metadata": map[string]interface{}{
+			"forwarded_from":     fakeOrigin,
+			"mentioned_user_ids": []string{userA.ID.String()},
+			"mention_all":        true,
+			"link_preview":       map[string]interface{}{"title": "fake"},
+			"reply_to_content":   "fake quote",
+			"client_tag":         "kept",
+		},
+	})
+	msg, err := wsReceiveMessageType(wsA, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	srcData := msg["data"].(map[string]interface{})
+	srcID := srcData["id"].(string)
+	metadata := srcData["metadata"].(map[string]interface{})
+	for _, key := range []string{"forwarded_from", "mentioned_user_ids", "mention_all", "link_preview", "reply_to_content"} {
+		assert.NotContains(t, metadata, key, "客户端提供的 %s 应该被丢弃", key)
+	}
+	assert.Equal(t, "kept", metadata["client_tag"])
+
+	// 2. 转发
+	wsSend(wsA, "message", map[string]interface{}{
+		"receiver_id":  userC.ID.String(),
+		"message_type": "text",
+		"content":      "hi",
+	})
+	first, err := wsReceiveMessageType(wsA, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	targetConvID := first["data"].(map[string]interface{})["conversation_id"].(string)
+
+	resp, body, err := httpRequest("POST", APIPrefix+"/messages/forward", userA.Token, map[string]interface{}{
+		"message_ids":      []string{srcID},
+		"conversation_ids": []string{targetConvID},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode, string(body))
+	result := parseResponse(body)["results"].([]interface{})[0].(map[string]interface{})
+	forwarded := result["messages"].([]interface{})[0].(map[string]interface{})
+	forwardedFrom := forwarded["metadata"].(map[string]interface{})["forwarded_from"].(map[string]interface{})
+	assert.Equal(t, srcID, forwardedFrom["message_id"])
+	assert.Equal(t, userB.ID.String(), forwardedFrom["sender_id"])
+}
@@ -0,0 +1,150 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ============================================
+// @提及
+// ============================================
+
+// getUnreadMentionCount 从会话列表中获取指定会话的未读提及数
+func getUnreadMentionCount(t *testing.T, token, convID string) int {
+	conversations, err := getConversationList(token)
+	require.NoError(t, err)
+	conv := findConversationByID(conversations, convID)
+	require.NotNil(t, conv, "会话列表应包含该群聊")
+	return int(conv["unread_mention_count"].(float64))
+}
+
+// TestMention_NotifiesMentionedMember 测试@成员后的提及角标和通知
+//
+// 测试目标：
+// - 群聊文本消息中的 @<user_id> 被解析并保存到 metadata.mentioned_user_ids
+// - 被@的成员未读提及数+1，未被@的成员不变
+// - 被@的成员收到 mention 类型的通知
+// - 标记已读后未读提及数清零
+//
+// 验证闭环：
+// 1. owner创建群聊（member1、member2）
+// 2. owner发送 "@member1 ..." 消息
+// 3. 会话列表：member1的unread_mention_count=1，member2为0
+// 4. member1的通知列表包含mention通知
+// 5. member1标记已读后unread_mention_count=0
+func TestMention_NotifiesMentionedMember(t *testing.T) {
+	owner := createTestUser()
+	member1 := createTestUser()
+	member2 := createTestUser()
+
+	// 1. 创建群聊
+	_, body, err := httpRequest("POST", APIPrefix+"/conversations/group", owner.Token, map[string]interface{}{
+		"group_name": "Mention Group",
+		"member_ids": []string{member1.ID.String(), member2.ID.String()},
+	})
+	require.NoError(t, err)
+	groupID := parseResponse(body)["id"].(string)
+
+	wsOwner, err := connectWebSocket(owner.Token)
+	require.NoError(t, err)
+	defer wsOwner.Close()
+
+	// 2. owner @member1
+	wsSend(wsOwner, "message", map[string]interface{}{
+		"conversation_id": groupID,
+		"message_type":    "text",
+		"content":         "@" + member1.ID.String() + " please review",
+	})
+	msg, err := wsReceiveMessageType(wsOwner, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	msgData := msg["data"].(map[string]interface{})
+	msgID := msgData["id"].(string)
+	metadata := msgData["metadata"].(map[string]interface{})
+	assert.Contains(t, metadata["mentioned_user_ids"], member1.ID.String())
+
+	// 3. 验证提及角标
+	assert.Equal(t, 1, getUnreadMentionCount(t, member1.Token, groupID), "被@的成员未读提及数应为1")
+	assert.Equal(t, 0, getUnreadMentionCount(t, member2.Token, groupID), "未被@的成员未读提及数应为0")
+
+	// 4. 验证mention通知（异步发送，轮询等待）
+	foundMention := false
+	for i := 0; i < 10 && !foundMention; i++ {
+		_, body, _ := httpRequest("GET", APIPrefix+"/notifications", member1.Token, nil)
+		notifications, _ := parseResponse(body)["notifications"].([]interface{})
+		for _, n := range notifications {
+			if n.(map[string]interface{})["notification_type"] == "mention" {
+				foundMention = true
+				break
+			}
+		}
+		if !foundMention {
+			time.Sleep(200 * time.Millisecond)
+		}
+	}
+	assert.True(t, foundMention, "被@的成员应收到mention通知")
+
+	// 5. 标记已读后清零
+	wsMember1, err := connectWebSocket(member1.Token)
+	require.NoError(t, err)
+	defer wsMember1.Close()
+
+	wsSend(wsMember1, "read", map[string]interface{}{
+		"conversation_id": groupID,
+		"message_id":      msgID,
+	})
+	time.Sleep(500 * time.Millisecond)
+
+	assert.Equal(t, 0, getUnreadMentionCount(t, member1.Token, groupID), "标记已读后未读提及数应清零")
+}
+
+// TestMention_AllRestrictedToAdmins 测试 @all 仅群主/管理员可用
+//
+// 验证闭环：
+// 1. 普通成员发送 @all 消息，收到错误
+// 2. owner发送 @all 消息，所有其他成员的未读提及数+1
+func TestMention_AllRestrictedToAdmins(t *testing.T) {
+	owner := createTestUser()
+	member1 := createTestUser()
+	member2 := createTestUser()
+
+	_, body, err := httpRequest("POST", APIPrefix+"/conversations/group", owner.Token, map[string]interface{}{
+		"group_name": "Mention All Group",
+		"member_ids": []string{member1.ID.String(), member2.ID.String()},
+	})
+	require.NoError(t, err)
+	groupID := parseResponse(body)["id"].(string)
+
+	// 1. 普通成员 @all
+	wsMember1, err := connectWebSocket(member1.Token)
+	require.NoError(t, err)
+	defer wsMember1.Close()
+
+	wsSend(wsMember1, "message", map[string]interface{}{
+		"conversation_id": groupID,
+		"message_type":    "text",
+		"content":         "@all hello",
+	})
+	errMsg, err := wsReceiveMessageType(wsMember1, "error", 3*time.Second, 5)
+	require.NoError(t, err, "普通成员@all应该返回错误")
+	assert.Contains(t, errMsg["data"].(map[string]interface{})["message"], "mention all")
+
+	// 2. owner @all
+	wsOwner, err := connectWebSocket(owner.Token)
+	require.NoError(t, err)
+	defer wsOwner.Close()
+
+	wsSend(wsOwner, "message", map[string]interface{}{
+		"conversation_id": groupID,
+		"message_type":    "text",
+		"content":         "@all meeting at 3pm",
+	})
+	_, err = wsReceiveMessageType(wsOwner, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, getUnreadMentionCount(t, member1.Token, groupID))
+	assert.Equal(t, 1, getUnreadMentionCount(t, member2.Token, groupID))
+	assert.Equal(t, 0, getUnreadMentionCount(t, owner.Token, groupID), "发送者自己不计入提及")
+}
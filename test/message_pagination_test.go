@@ -0,0 +1,185 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ============================================
+// 消息历史游标分页
+// ============================================
+
+// sendGroupMessages 发送者在群聊中依次发送消息，通过接收者的连接确认每条消息已保存，返回消息ID
+func sendGroupMessages(t *testing.T, sender, receiver *websocket.Conn, groupID string, contents ...string) []string {
+	ids := make([]string, 0, len(contents))
+	for _, content := range contents {
+		wsSend(sender, "message", map[string]interface{}{
+			"conversation_id": groupID,
+			"message_type":    "text",
+			"content":         content,
+		})
+		msg, err := wsReceiveMessageType(receiver, "message", 3*time.Second, 10)
+		require.NoError(t, err)
+		ids = append(ids, msg["data"].(map[string]interface{})["id"].(string))
+	}
+	return ids
+}
+
+// messageIDs 提取消息列表中的ID
+func messageIDs(messages []interface{}) []string {
+	ids := make([]string, 0, len(messages))
+	for _, item := range messages {
+		ids = append(ids, item.(map[string]interface{})["id"].(string))
+	}
+	return ids
+}
+
+// TestPagination_CursorStable 测试 before/after 游标分页在新消息到达时保持稳定
+//
+// 测试目标：
+// - before 游标返回游标之前的消息，不会因为新消息到达而重复或遗漏
+// - after 游标只返回游标之后的新消息，用于增量同步
+// - has_more_before / has_more_after 正确反映两个方向是否还有消息
+//
+// 验证闭环：
+// 1. owner在群聊中发送6条消息，member以 limit=3 拉取最新一页（m4~m6）
+// 2. owner再发送2条新消息
+// 3. member以 before=m4 拉取上一页，得到 m1~m3，has_more_before=false、has_more_after=true
+// 4. member以 after=m6 增量同步，得到 n1、n2，has_more_after=false
+// 5. before 和 after 同时使用返回400，不存在的游标返回404
+func TestPagination_CursorStable(t *testing.T) {
+	owner := createTestUser()
+	member := createTestUser()
+
+	resp, body, err := httpRequest("POST", APIPrefix+"/conversations/group", owner.Token, map[string]interface{}{
+		"group_name": "Pagination Group",
+		"member_ids": []string{member.ID.String()},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode, string(body))
+	groupID := parseResponse(body)["id"].(string)
+
+	wsOwner, err := connectWebSocket(owner.Token)
+	require.NoError(t, err)
+	defer wsOwner.Close()
+	wsMember, err := connectWebSocket(member.Token)
+	require.NoError(t, err)
+	defer wsMember.Close()
+
+	// 1. 发送6条消息，拉取最新一页
+	sent := sendGroupMessages(t, wsOwner, wsMember, groupID, "m1", "m2", "m3", "m4", "m5", "m6")
+
+	resp, body, err = httpRequest("GET", APIPrefix+"/conversations/"+groupID+"/messages?limit=3", member.Token, nil)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode, string(body))
+	result := parseResponse(body)
+	assert.Equal(t, sent[3:6], messageIDs(result["messages"].([]interface{})), "最新一页按时间正序返回")
+	assert.Equal(t, true, result["has_more_before"])
+	assert.Equal(t, false, result["has_more_after"])
+
+	// 2. 新消息到达
+	newer := sendGroupMessages(t, wsOwner, wsMember, groupID, "n1", "n2")
+
+	// 3. 向前翻页不受新消息影响
+	resp, body, err = httpRequest("GET", APIPrefix+"/conversations/"+groupID+"/messages?limit=3&before="+sent[3], member.Token, nil)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode, string(body))
+	result = parseResponse(body)
+	assert.Equal(t, sent[0:3], messageIDs(result["messages"].([]interface{})), "before游标不应重复或遗漏消息")
+	assert.Equal(t, false, result["has_more_before"])
+	assert.Equal(t, true, result["has_more_after"])
+
+	// 4. 增量同步
+	resp, body, err = httpRequest("GET", APIPrefix+"/conversations/"+groupID+"/messages?limit=3&after="+sent[5], member.Token, nil)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode, string(body))
+	result = parseResponse(body)
+	assert.Equal(t, newer, messageIDs(result["messages"].([]interface{})))
+	assert.Equal(t, true, result["has_more_before"])
+	assert.Equal(t, false, result["has_more_after"])
+
+	// 5. 参数错误
+	resp, _, err = httpRequest("GET", APIPrefix+"/conversations/"+groupID+"/messages?before="+sent[3]+"&after="+sent[1], member.Token, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode, "游标互斥")
+
+	resp, _, err = httpRequest("GET", APIPrefix+"/conversations/"+groupID+"/messages?before=00000000-0000-0000-0000-000000000001", member.Token, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 404, resp.StatusCode, "游标消息不存在")
+}
+
+// TestPagination_AroundAndSearch 测试定位到指定消息和搜索结果的游标分页
+//
+// 测试目标：
+// - around 返回目标消息及其前后的消息（如从搜索结果跳转到上下文）
+// - 搜索结果支持 before 游标分页，并返回 has_more
+//
+// 验证闭环：
+// 1. owner在群聊中发送5条包含关键词的消息
+// 2. member以 around=第3条、limit=3 拉取，得到第2~4条，两个方向都还有消息
+// 3. member搜索关键词 limit=2，得到最新的2条，has_more=true
+// 4. 以最后一条结果为 before 继续搜索，直到 has_more=false，共得到5条且不重复
+func TestPagination_AroundAndSearch(t *testing.T) {
+	owner := createTestUser()
+	member := createTestUser()
+
+	resp, body, err := httpRequest("POST", APIPrefix+"/conversations/group", owner.Token, map[string]interface{}{
+		"group_name": "Around Group",
+		"member_ids": []string{member.ID.String()},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode, string(body))
+	groupID := parseResponse(body)["id"].(string)
+
+	wsOwner, err := connectWebSocket(owner.Token)
+	require.NoError(t, err)
+	defer wsOwner.Close()
+	wsMember, err := connectWebSocket(member.Token)
+	require.NoError(t, err)
+	defer wsMember.Close()
+
+	// 1. 发送5条消息
+	keyword := fmt.Sprintf("cursorkw%d", time.Now().UnixNano())
+	var contents []string
+	for i := 1; i <= 5; i++ {
+		contents = append(contents, fmt.Sprintf("%s item %d", keyword, i))
+	}
+	sent := sendGroupMessages(t, wsOwner, wsMember, groupID, contents...)
+
+	// 2. around 定位
+	resp, body, err = httpRequest("GET", APIPrefix+"/conversations/"+groupID+"/messages?limit=3&around="+sent[2], member.Token, nil)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode, string(body))
+	result := parseResponse(body)
+	assert.Equal(t, sent[1:4], messageIDs(result["messages"].([]interface{})), "目标消息位于中间")
+	assert.Equal(t, true, result["has_more_before"])
+	assert.Equal(t, true, result["has_more_after"])
+
+	time.Sleep(200 * time.Millisecond)
+
+	// 3. 搜索第一页
+	resp, body, err = httpRequest("GET", "/api/messages/search?q="+keyword+"&conversation_id="+groupID+"&limit=2", member.Token, nil)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode, string(body))
+	result = parseResponse(body)
+	page := messageIDs(result["messages"].([]interface{}))
+	assert.Equal(t, []string{sent[4], sent[3]}, page, "搜索结果按时间倒序")
+	assert.Equal(t, true, result["has_more"])
+
+	// 4. 以 before 游标继续搜索
+	found := append([]string{}, page...)
+	for result["has_more"] == true && len(found) < 10 {
+		before := found[len(found)-1]
+		resp, body, err = httpRequest("GET", "/api/messages/search?q="+keyword+"&conversation_id="+groupID+"&limit=2&before="+before, member.Token, nil)
+		require.NoError(t, err)
+		require.Equal(t, 200, resp.StatusCode, string(body))
+		result = parseResponse(body)
+		found = append(found, messageIDs(result["messages"].([]interface{}))...)
+	}
+	assert.Equal(t, []string{sent[4], sent[3], sent[2], sent[1], sent[0]}, found)
+}
@@ -0,0 +1,176 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ============================================
+// 置顶消息
+// ============================================
+
+// TestPin_GroupAdminPinsAndUnpins 测试群聊置顶权限、事件和会话详情
+//
+// 测试目标：
+// - 群聊中只有 owner/admin 可以置顶
+// - 置顶/取消置顶时所有成员收到 pinned/unpinned 事件
+// - 会话详情和置顶列表包含当前置顶的消息
+//
+// 验证闭环：
+// 1. owner创建群聊，member发送公告消息
+// 2. member尝试置顶，返回403
+// 3. owner置顶，member收到pinned事件
+// 4. 会话详情的pinned_messages包含该消息
+// 5. owner取消置顶，member收到unpinned事件，置顶列表为空
+func TestPin_GroupAdminPinsAndUnpins(t *testing.T) {
+	owner := createTestUser()
+	member := createTestUser()
+
+	// 1. 创建群聊并发送消息
+	_, body, err := httpRequest("POST", APIPrefix+"/conversations/group", owner.Token, map[string]interface{}{
+		"group_name": "Pin Group",
+		"member_ids": []string{member.ID.String()},
+	})
+	require.NoError(t, err)
+	groupID := parseResponse(body)["id"].(string)
+
+	wsMember, err := connectWebSocket(member.Token)
+	require.NoError(t, err)
+	defer wsMember.Close()
+
+	wsSend(wsMember, "message", map[string]interface{}{
+		"conversation_id": groupID,
+		"message_type":    "text",
+		"content":         "Release on Friday",
+	})
+	msg, err := wsReceiveMessageType(wsMember, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	msgID := msg["data"].(map[string]interface{})["id"].(string)
+
+	// 2. 普通成员不能置顶
+	resp, _, err := httpRequest("POST", APIPrefix+"/messages/"+msgID+"/pin", member.Token, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 403, resp.StatusCode, "群聊普通成员不能置顶")
+
+	// 3. owner置顶
+	resp, _, err = httpRequest("POST", APIPrefix+"/messages/"+msgID+"/pin", owner.Token, nil)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+
+	event, err := wsReceiveMessageType(wsMember, "pinned", 3*time.Second, 5)
+	require.NoError(t, err, "成员应该收到pinned事件")
+	data := event["data"].(map[string]interface{})
+	assert.Equal(t, msgID, data["message_id"])
+	assert.Equal(t, owner.ID.String(), data["pinned_by"])
+
+	// 4. 验证闭环：会话详情包含置顶消息
+	resp, body, err = httpRequest("GET", APIPrefix+"/conversations/"+groupID, member.Token, nil)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	detail := parseResponse(body)["conversation"].(map[string]interface{})
+	pins := detail["pinned_messages"].([]interface{})
+	require.Len(t, pins, 1)
+	assert.Equal(t, msgID, pins[0].(map[string]interface{})["message_id"])
+	pinnedMsg := pins[0].(map[string]interface{})["message"].(map[string]interface{})
+	assert.Equal(t, "Release on Friday", pinnedMsg["content"])
+
+	// 5. owner取消置顶
+	resp, _, err = httpRequest("POST", APIPrefix+"/messages/"+msgID+"/unpin", owner.Token, nil)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+
+	event, err = wsReceiveMessageType(wsMember, "unpinned", 3*time.Second, 5)
+	require.NoError(t, err, "成员应该收到unpinned事件")
+	assert.Equal(t, msgID, event["data"].(map[string]interface{})["message_id"])
+
+	_, body, _ = httpRequest("GET", APIPrefix+"/conversations/"+groupID+"/pins", member.Token, nil)
+	assert.Len(t, parseResponse(body)["pinned_messages"].([]interface{}), 0, "取消置顶后列表应为空")
+}
+
+// TestPin_PrivateChatEitherParty 测试私聊双方都可以置顶
+//
+// 验证闭环：
+// 1. A给B发送消息
+// 2. B置顶A的消息成功
+// 3. C（非成员）置顶返回403
+func TestPin_PrivateChatEitherParty(t *testing.T) {
+	userA := createTestUser()
+	userB := createTestUser()
+	userC := createTestUser()
+
+	wsA, err := connectWebSocket(userA.Token)
+	require.NoError(t, err)
+	defer wsA.Close()
+
+	wsSend(wsA, "message", map[string]interface{}{
+		"receiver_id":  userB.ID.String(),
+		"message_type": "text",
+		"content":      "Address: 221B Baker Street",
+	})
+	msg, err := wsReceiveMessageType(wsA, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	msgID := msg["data"].(map[string]interface{})["id"].(string)
+
+	resp, _, err := httpRequest("POST", APIPrefix+"/messages/"+msgID+"/pin", userB.Token, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode, "私聊双方都可以置顶")
+
+	resp, _, err = httpRequest("POST", APIPrefix+"/messages/"+msgID+"/pin", userC.Token, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 403, resp.StatusCode, "非成员不能置顶")
+}
+
+// TestPin_RecallUnpins 测试撤回置顶消息时推送取消置顶事件
+//
+// 验证闭环：
+// 1. A给B发送消息，B置顶该消息
+// 2. A撤回消息，B收到 recalled 和 unpinned 事件（unpinned_by 为A）
+// 3. 置顶列表为空
+func TestPin_RecallUnpins(t *testing.T) {
+	userA := createTestUser()
+	userB := createTestUser()
+
+	wsA, err := connectWebSocket(userA.Token)
+	require.NoError(t, err)
+	defer wsA.Close()
+	wsB, err := connectWebSocket(userB.Token)
+	require.NoError(t, err)
+	defer wsB.Close()
+
+	// 1. 发送并置顶
+	wsSend(wsA, "message", map[string]interface{}{
+		"receiver_id":  userB.ID.String(),
+		"message_type": "text",
+		"content":      "Meeting moved to 3pm",
+	})
+	msg, err := wsReceiveMessageType(wsB, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	msgData := msg["data"].(map[string]interface{})
+	msgID := msgData["id"].(string)
+	convID := msgData["conversation_id"].(string)
+
+	resp, _, err := httpRequest("POST", APIPrefix+"/messages/"+msgID+"/pin", userB.Token, nil)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	_, err = wsReceiveMessageType(wsB, "pinned", 3*time.Second, 10)
+	require.NoError(t, err)
+
+	// 2. 撤回
+	wsSend(wsA, "recall", map[string]interface{}{"message_id": msgID})
+	_, err = wsReceiveMessageType(wsB, "recalled", 3*time.Second, 10)
+	require.NoError(t, err, "B应该收到recalled事件")
+	event, err := wsReceiveMessageType(wsB, "unpinned", 3*time.Second, 10)
+	require.NoError(t, err, "撤回置顶消息后B应该收到unpinned事件")
+	eventData := event["data"].(map[string]interface{})
+	assert.Equal(t, msgID, eventData["message_id"])
+	assert.Equal(t, userA.ID.String(), eventData["unpinned_by"])
+
+	// 3. 置顶列表为空
+	resp, body, err := httpRequest("GET", APIPrefix+"/conversations/"+convID+"/pins", userB.Token, nil)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	assert.Len(t, parseResponse(body)["pinned_messages"].([]interface{}), 0, "撤回后不再置顶")
+}
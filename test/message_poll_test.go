@@ -0,0 +1,192 @@
+package test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ============================================
+// 投票消息
+// ============================================
+
+// TestPoll_VoteAndLiveCounts 测试投票消息的创建、投票和实时票数推送
+//
+// 测试目标：
+// - poll 类型消息带有选项，接收者收到的消息包含投票结果
+// - 投票后会话成员收到 poll_updated 事件，票数正确
+// - 单选投票重新投票会覆盖之前的选择
+// - 关闭后不能再投票
+//
+// 验证闭环：
+// 1. owner在群聊中发起单选投票
+// 2. member收到消息，包含2个选项
+// 3. member投第一个选项，owner收到poll_updated事件，第一个选项1票
+// 4. member改投第二个选项，第一个选项0票，第二个选项1票
+// 5. owner关闭投票，member再投票返回409
+// 6. 消息历史中的投票结果为已关闭，member的选择为第二个选项
+func TestPoll_VoteAndLiveCounts(t *testing.T) {
+	owner := createTestUser()
+	member := createTestUser()
+
+	_, body, err := httpRequest("POST", APIPrefix+"/conversations/group", owner.Token, map[string]interface{}{
+		"group_name": "Poll Group",
+		"member_ids": []string{member.ID.String()},
+	})
+	require.NoError(t, err)
+	groupID := parseResponse(body)["id"].(string)
+
+	wsOwner, err := connectWebSocket(owner.Token)
+	require.NoError(t, err)
+	defer wsOwner.Close()
+
+	wsMember, err := connectWebSocket(member.Token)
+	require.NoError(t, err)
+	defer wsMember.Close()
+
+	// 1. 发起投票
+	wsSend(wsOwner, "message", map[string]interface{}{
+		"conversation_id": groupID,
+		"message_type":    "poll",
+		"content":         "Lunch?",
+		"poll": map[string]interface{}{
+			"options": []string{"Pizza", "Sushi"},
+		},
+	})
+
+	// 2. member收到投票消息
+	msg, err := wsReceiveMessageType(wsMember, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	data := msg["data"].(map[string]interface{})
+	msgID := data["id"].(string)
+	assert.Equal(t, "poll", data["message_type"])
+	options := data["poll"].(map[string]interface{})["options"].([]interface{})
+	require.Len(t, options, 2)
+	pizzaID := options[0].(map[string]interface{})["id"].(string)
+	sushiID := options[1].(map[string]interface{})["id"].(string)
+
+	// 3. member投票
+	resp, _, err := httpRequest("POST", APIPrefix+"/messages/"+msgID+"/poll/vote", member.Token, map[string]interface{}{
+		"option_ids": []string{pizzaID},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+
+	event, err := wsReceiveMessageType(wsOwner, "poll_updated", 3*time.Second, 10)
+	require.NoError(t, err, "owner应该收到poll_updated事件")
+	poll := event["data"].(map[string]interface{})["poll"].(map[string]interface{})
+	assert.Equal(t, float64(1), poll["options"].([]interface{})[0].(map[string]interface{})["vote_count"])
+
+	// 单选投票不能选多个
+	resp, _, _ = httpRequest("POST", APIPrefix+"/messages/"+msgID+"/poll/vote", member.Token, map[string]interface{}{
+		"option_ids": []string{pizzaID, sushiID},
+	})
+	assert.Equal(t, 400, resp.StatusCode)
+
+	// 4. 改投
+	resp, body, _ = httpRequest("POST", APIPrefix+"/messages/"+msgID+"/poll/vote", member.Token, map[string]interface{}{
+		"option_ids": []string{sushiID},
+	})
+	require.Equal(t, 200, resp.StatusCode)
+	poll = parseResponse(body)["poll"].(map[string]interface{})
+	assert.Equal(t, float64(0), poll["options"].([]interface{})[0].(map[string]interface{})["vote_count"])
+	assert.Equal(t, float64(1), poll["options"].([]interface{})[1].(map[string]interface{})["vote_count"])
+	assert.Equal(t, float64(1), poll["total_voters"])
+
+	// 5. 关闭投票
+	resp, _, _ = httpRequest("POST", APIPrefix+"/messages/"+msgID+"/poll/close", member.Token, nil)
+	assert.Equal(t, 403, resp.StatusCode, "普通成员不能关闭他人的投票")
+
+	resp, _, _ = httpRequest("POST", APIPrefix+"/messages/"+msgID+"/poll/close", owner.Token, nil)
+	require.Equal(t, 200, resp.StatusCode)
+
+	resp, _, _ = httpRequest("POST", APIPrefix+"/messages/"+msgID+"/poll/vote", member.Token, map[string]interface{}{
+		"option_ids": []string{pizzaID},
+	})
+	assert.Equal(t, 409, resp.StatusCode, "已关闭的投票不能再投")
+
+	// 6. 验证闭环
+	messages, err := getMessages(member.Token, groupID)
+	require.NoError(t, err)
+	found := findMessageByID(messages, msgID)
+	require.NotNil(t, found)
+	poll = found["poll"].(map[string]interface{})
+	assert.Equal(t, true, poll["is_closed"])
+	assert.Equal(t, []interface{}{sushiID}, poll["my_option_ids"])
+}
+
+// TestPoll_ConcurrentVotesCountedOnce 测试并发投票时票数准确
+//
+// 验证闭环：
+// 1. owner在10人群中发起多选匿名投票
+// 2. 10个成员并发投两个选项
+// 3. 每个选项正好10票，投票人数为10，匿名投票不返回投票人
+func TestPoll_ConcurrentVotesCountedOnce(t *testing.T) {
+	owner := createTestUser()
+	members := make([]*TestUser, 10)
+	memberIDs := make([]string, len(members))
+	for i := range members {
+		members[i] = createTestUser()
+		memberIDs[i] = members[i].ID.String()
+	}
+
+	_, body, err := httpRequest("POST", APIPrefix+"/conversations/group", owner.Token, map[string]interface{}{
+		"group_name": "Concurrent Poll Group",
+		"member_ids": memberIDs,
+	})
+	require.NoError(t, err)
+	groupID := parseResponse(body)["id"].(string)
+
+	wsOwner, err := connectWebSocket(owner.Token)
+	require.NoError(t, err)
+	defer wsOwner.Close()
+
+	// 1. 发起多选匿名投票
+	wsSend(wsOwner, "message", map[string]interface{}{
+		"conversation_id": groupID,
+		"message_type":    "poll",
+		"content":         "Which days work?",
+		"poll": map[string]interface{}{
+			"options":         []string{"Mon", "Tue", "Wed"},
+			"multiple_choice": true,
+			"anonymous":       true,
+		},
+	})
+	msg, err := wsReceiveMessageType(wsOwner, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	data := msg["data"].(map[string]interface{})
+	msgID := data["id"].(string)
+	options := data["poll"].(map[string]interface{})["options"].([]interface{})
+	monID := options[0].(map[string]interface{})["id"].(string)
+	tueID := options[1].(map[string]interface{})["id"].(string)
+
+	// 2. 并发投票（每人重复提交两次）
+	var wg sync.WaitGroup
+	for _, member := range members {
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func(token string) {
+				defer wg.Done()
+				httpRequest("POST", APIPrefix+"/messages/"+msgID+"/poll/vote", token, map[string]interface{}{
+					"option_ids": []string{monID, tueID},
+				})
+			}(member.Token)
+		}
+	}
+	wg.Wait()
+
+	// 3. 验证闭环
+	resp, body, err := httpRequest("GET", APIPrefix+"/messages/"+msgID+"/poll", owner.Token, nil)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	poll := parseResponse(body)["poll"].(map[string]interface{})
+	assert.Equal(t, float64(10), poll["total_voters"])
+	result := poll["options"].([]interface{})
+	assert.Equal(t, float64(10), result[0].(map[string]interface{})["vote_count"])
+	assert.Equal(t, float64(10), result[1].(map[string]interface{})["vote_count"])
+	assert.Equal(t, float64(0), result[2].(map[string]interface{})["vote_count"])
+	assert.Nil(t, result[0].(map[string]interface{})["voter_ids"], "匿名投票不返回投票人")
+}
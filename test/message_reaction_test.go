@@ -0,0 +1,176 @@
+package test
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ============================================
+// 表情回应
+// ============================================
+
+// TestReaction_AddAndRemove 测试表情回应的添加、聚合和取消
+//
+// 测试目标：
+// - 会话成员可以通过 WebSocket 添加表情回应
+// - 所有成员收到 reaction 事件
+// - 消息历史中包含聚合后的表情回应
+// - 通过 HTTP 取消表情回应后，成员收到 remove 事件
+//
+// 验证闭环：
+// 1. A给B发送消息
+// 2. B通过WebSocket对该消息回应 👍
+// 3. A收到reaction事件（action=add，count=1）
+// 4. 查询消息历史，消息的reactions包含 👍 且user_ids包含B
+// 5. B通过HTTP（DELETE /messages/:id/reactions/:emoji）取消回应，A收到reaction事件（action=remove）
+// 6. 查询消息历史，消息不再包含reactions
+func TestReaction_AddAndRemove(t *testing.T) {
+	userA := createTestUser()
+	userB := createTestUser()
+
+	wsA, err := connectWebSocket(userA.Token)
+	require.NoError(t, err)
+	defer wsA.Close()
+
+	wsB, err := connectWebSocket(userB.Token)
+	require.NoError(t, err)
+	defer wsB.Close()
+
+	// 1. A给B发送消息
+	wsSend(wsA, "message", map[string]interface{}{
+		"receiver_id":  userB.ID.String(),
+		"message_type": "text",
+		"content":      "React to me",
+	})
+	msgA, err := wsReceiveMessageType(wsA, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	msgData := msgA["data"].(map[string]interface{})
+	msgID := msgData["id"].(string)
+	convID := msgData["conversation_id"].(string)
+	wsReceiveMessageType(wsB, "message", 3*time.Second, 5)
+
+	// 2. B对消息回应 👍
+	err = wsSend(wsB, "reaction", map[string]interface{}{
+		"message_id": msgID,
+		"emoji":      "👍",
+		"action":     "add",
+	})
+	require.NoError(t, err)
+
+	// 3. A收到reaction事件
+	event, err := wsReceiveMessageType(wsA, "reaction", 3*time.Second, 5)
+	require.NoError(t, err, "A应该收到reaction事件")
+	data := event["data"].(map[string]interface{})
+	assert.Equal(t, msgID, data["message_id"])
+	assert.Equal(t, userB.ID.String(), data["user_id"])
+	assert.Equal(t, "add", data["action"])
+
+	reactions := data["reactions"].([]interface{})
+	require.Len(t, reactions, 1)
+	reaction := reactions[0].(map[string]interface{})
+	assert.Equal(t, "👍", reaction["emoji"])
+	assert.Equal(t, float64(1), reaction["count"])
+
+	// 4. 验证闭环：消息历史包含聚合后的回应
+	messages, err := getMessages(userA.Token, convID)
+	require.NoError(t, err)
+	msg := findMessageByID(messages, msgID)
+	require.NotNil(t, msg)
+	historyReactions, ok := msg["reactions"].([]interface{})
+	require.True(t, ok, "消息历史应包含reactions字段")
+	require.Len(t, historyReactions, 1)
+	userIDs := historyReactions[0].(map[string]interface{})["user_ids"].([]interface{})
+	assert.Contains(t, userIDs, userB.ID.String())
+
+	// 5. B通过HTTP取消回应
+	resp, _, err := httpRequest("DELETE", APIPrefix+"/messages/"+msgID+"/reactions/"+url.PathEscape("👍"), userB.Token, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	event, err = wsReceiveMessageType(wsA, "reaction", 3*time.Second, 5)
+	require.NoError(t, err, "A应该收到取消回应事件")
+	assert.Equal(t, "remove", event["data"].(map[string]interface{})["action"])
+
+	// 6. 验证闭环：回应已移除
+	messages, _ = getMessages(userA.Token, convID)
+	msg = findMessageByID(messages, msgID)
+	require.NotNil(t, msg)
+	_, hasReactions := msg["reactions"]
+	assert.False(t, hasReactions, "取消后消息不应再包含reactions")
+}
+
+// TestReaction_NonMemberForbidden 测试非会话成员不能回应消息
+//
+// 验证闭环：
+// 1. A给B发送消息
+// 2. C（非成员）通过HTTP回应，返回403
+func TestReaction_NonMemberForbidden(t *testing.T) {
+	userA := createTestUser()
+	userB := createTestUser()
+	userC := createTestUser()
+
+	wsA, err := connectWebSocket(userA.Token)
+	require.NoError(t, err)
+	defer wsA.Close()
+
+	wsSend(wsA, "message", map[string]interface{}{
+		"receiver_id":  userB.ID.String(),
+		"message_type": "text",
+		"content":      "Private",
+	})
+	msgA, err := wsReceiveMessageType(wsA, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	msgID := msgA["data"].(map[string]interface{})["id"].(string)
+
+	resp, _, err := httpRequest("POST", APIPrefix+"/messages/"+msgID+"/reactions", userC.Token, map[string]interface{}{
+		"emoji": "😀",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 403, resp.StatusCode, "非成员回应应返回403")
+}
+
+// TestReaction_RejectsNonEmoji 测试表情回应只接受表情
+//
+// 验证闭环：
+// 1. A给B发送消息
+// 2. B用普通文字和HTML回应，返回400
+// 3. B用组合表情（肤色、国旗）回应，返回200
+func TestReaction_RejectsNonEmoji(t *testing.T) {
+	userA := createTestUser()
+	userB := createTestUser()
+
+	wsA, err := connectWebSocket(userA.Token)
+	require.NoError(t, err)
+	defer wsA.Close()
+
+	wsSend(wsA, "message", map[string]interface{}{
+		"receiver_id":  userB.ID.String(),
+		"message_type": "text",
+		"content":      "React to me",
+	})
+	msgA, err := wsReceiveMessageType(wsA, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	msgID := msgA["data"].(map[string]interface{})["id"].(string)
+
+	// 2. 非表情被拒绝
+	for _, emoji := range []string{"hello", "<b>x</b>", "👍 spam"} {
+		resp, body, err := httpRequest("POST", APIPrefix+"/messages/"+msgID+"/reactions", userB.Token, map[string]interface{}{
+			"emoji": emoji,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 400, resp.StatusCode, "%q 不是表情，应返回400: %s", emoji, string(body))
+	}
+
+	// 3. 组合表情可以使用
+	for _, emoji := range []string{"👍🏽", "🇨🇳"} {
+		resp, body, err := httpRequest("POST", APIPrefix+"/messages/"+msgID+"/reactions", userB.Token, map[string]interface{}{
+			"emoji": emoji,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 200, resp.StatusCode, string(body))
+	}
+}
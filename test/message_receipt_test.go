@@ -0,0 +1,347 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ============================================
+// 消息送达/已读回执
+// ============================================
+
+// TestReceipt_PrivateDeliveredAndRead 测试私聊消息的送达和已读状态
+//
+// 测试目标：
+// - 消息写入在线接收者的连接后记录送达，并向发送者推送 delivered 事件
+// - 接收者标记已读后消息状态变为 read
+// - 离线接收者上线拉取离线消息后记录送达
+//
+// 验证闭环：
+// 1. A给在线的B发消息，A收到 delivered 事件（user_id=B）
+// 2. 消息历史中的状态为 delivered
+// 3. B标记已读，A收到 read 事件，消息历史中的状态为 read
+// 4. A给离线的C发消息，状态为 sent；C上线后A收到 delivered 事件，状态变为 delivered
+func TestReceipt_PrivateDeliveredAndRead(t *testing.T) {
+	userA := createTestUser()
+	userB := createTestUser()
+	userC := createTestUser()
+
+	wsA, err := connectWebSocket(userA.Token)
+	require.NoError(t, err)
+	defer wsA.Close()
+	wsB, err := connectWebSocket(userB.Token)
+	require.NoError(t, err)
+	defer wsB.Close()
+
+	// 1. A给在线的B发消息
+	wsSend(wsA, "message", map[string]interface{}{
+		"receiver_id":  userB.ID.String(),
+		"message_type": "text",
+		"content":      "are you there?",
+	})
+	msg, err := wsReceiveMessageType(wsB, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	msgData := msg["data"].(map[string]interface{})
+	msgID := msgData["id"].(string)
+	convID := msgData["conversation_id"].(string)
+
+	event, err := wsReceiveMessageType(wsA, "delivered", 3*time.Second, 10)
+	require.NoError(t, err, "A应该收到delivered事件")
+	eventData := event["data"].(map[string]interface{})
+	assert.Equal(t, msgID, eventData["message_id"])
+	assert.Equal(t, convID, eventData["conversation_id"])
+	assert.Equal(t, userB.ID.String(), eventData["user_id"])
+
+	// 2. 状态为 delivered
+	messages, err := getMessages(userA.Token, convID)
+	require.NoError(t, err)
+	stored := findMessageByID(messages, msgID)
+	require.NotNil(t, stored)
+	assert.Equal(t, "delivered", stored["status"])
+
+	// 3. B标记已读
+	wsSend(wsB, "read", map[string]interface{}{
+		"conversation_id": convID,
+		"message_id":      msgID,
+	})
+	_, err = wsReceiveMessageType(wsA, "read", 3*time.Second, 10)
+	require.NoError(t, err, "A应该收到read事件")
+
+	messages, err = getMessages(userA.Token, convID)
+	require.NoError(t, err)
+	stored = findMessageByID(messages, msgID)
+	require.NotNil(t, stored)
+	assert.Equal(t, "read", stored["status"])
+
+	// 4. 离线接收者上线后送达
+	wsSend(wsA, "message", map[string]interface{}{
+		"receiver_id":  userC.ID.String(),
+		"message_type": "text",
+		"content":      "see you later",
+	})
+	sent, err := wsReceiveMessageType(wsA, "message", 3*time.Second, 10)
+	require.NoError(t, err)
+	offlineMsgID := sent["data"].(map[string]interface{})["id"].(string)
+	offlineConvID := sent["data"].(map[string]interface{})["conversation_id"].(string)
+
+	time.Sleep(300 * time.Millisecond)
+	messages, err = getMessages(userA.Token, offlineConvID)
+	require.NoError(t, err)
+	stored = findMessageByID(messages, offlineMsgID)
+	require.NotNil(t, stored)
+	assert.Equal(t, "sent", stored["status"], "接收者离线时消息状态为sent")
+
+	wsC, err := connectWebSocket(userC.Token)
+	require.NoError(t, err)
+	defer wsC.Close()
+	_, err = wsReceiveMessageType(wsC, "offline_message", 3*time.Second, 5)
+	require.NoError(t, err)
+
+	event, err = wsReceiveMessageType(wsA, "delivered", 3*time.Second, 10)
+	require.NoError(t, err, "C上线后A应该收到delivered事件")
+	eventData = event["data"].(map[string]interface{})
+	assert.Equal(t, offlineMsgID, eventData["message_id"])
+	assert.Equal(t, userC.ID.String(), eventData["user_id"])
+
+	messages, err = getMessages(userA.Token, offlineConvID)
+	require.NoError(t, err)
+	stored = findMessageByID(messages, offlineMsgID)
+	require.NotNil(t, stored)
+	assert.Equal(t, "delivered", stored["status"])
+}
+
+// TestReceipt_GroupPerRecipient 测试群聊消息的逐人回执
+//
+// 测试目标：
+// - 群聊消息的回执按接收者统计（如"3 人中 1 人已读"）
+// - 发送者的消息历史附带 receipts 统计，回执详情仅发送者可查看
+//
+// 验证闭环：
+// 1. owner创建3人群聊（member1、member2在线，member3离线），发送消息
+// 2. owner收到member1和member2的 delivered 事件
+// 3. member1标记已读
+// 4. owner查询回执：total=3、delivered=2、read=1，逐人状态正确
+// 5. owner的消息历史中 receipts 统计一致，群聊消息状态仍为 sent
+// 6. member1查询回执返回403
+func TestReceipt_GroupPerRecipient(t *testing.T) {
+	owner := createTestUser()
+	member1 := createTestUser()
+	member2 := createTestUser()
+	member3 := createTestUser()
+
+	// 1. 创建群聊
+	resp, body, err := httpRequest("POST", APIPrefix+"/conversations/group", owner.Token, map[string]interface{}{
+		"group_name": "Receipt Group",
+		"member_ids": []string{member1.ID.String(), member2.ID.String(), member3.ID.String()},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode, string(body))
+	groupID := parseResponse(body)["id"].(string)
+
+	wsOwner, err := connectWebSocket(owner.Token)
+	require.NoError(t, err)
+	defer wsOwner.Close()
+	ws1, err := connectWebSocket(member1.Token)
+	require.NoError(t, err)
+	defer ws1.Close()
+	ws2, err := connectWebSocket(member2.Token)
+	require.NoError(t, err)
+	defer ws2.Close()
+
+	wsSend(wsOwner, "message", map[string]interface{}{
+		"conversation_id": groupID,
+		"message_type":    "text",
+		"content":         "meeting at 3pm",
+	})
+	msg, err := wsReceiveMessageType(ws1, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	msgID := msg["data"].(map[string]interface{})["id"].(string)
+	_, err = wsReceiveMessageType(ws2, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+
+	// 2. owner收到两个 delivered 事件
+	deliveredBy := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		event, err := wsReceiveMessageType(wsOwner, "delivered", 3*time.Second, 10)
+		require.NoError(t, err)
+		deliveredBy[event["data"].(map[string]interface{})["user_id"].(string)] = true
+	}
+	assert.True(t, deliveredBy[member1.ID.String()])
+	assert.True(t, deliveredBy[member2.ID.String()])
+
+	// 3. member1标记已读
+	wsSend(ws1, "read", map[string]interface{}{
+		"conversation_id": groupID,
+		"message_id":      msgID,
+	})
+	_, err = wsReceiveMessageType(wsOwner, "read", 3*time.Second, 10)
+	require.NoError(t, err)
+
+	// 4. 查询回执详情
+	resp, body, err = httpRequest("GET", APIPrefix+"/messages/"+msgID+"/receipts", owner.Token, nil)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode, string(body))
+	result := parseResponse(body)
+	summary := result["summary"].(map[string]interface{})
+	assert.Equal(t, float64(3), summary["total"])
+	assert.Equal(t, float64(2), summary["delivered"])
+	assert.Equal(t, float64(1), summary["read"])
+
+	statusByUser := map[string]string{}
+	for _, item := range result["receipts"].([]interface{}) {
+		receipt := item.(map[string]interface{})
+		statusByUser[receipt["user_id"].(string)] = receipt["status"].(string)
+	}
+	assert.Equal(t, "read", statusByUser[member1.ID.String()])
+	assert.Equal(t, "delivered", statusByUser[member2.ID.String()])
+	assert.Equal(t, "sent", statusByUser[member3.ID.String()])
+
+	// 5. 消息历史中的统计
+	messages, err := getMessages(owner.Token, groupID)
+	require.NoError(t, err)
+	stored := findMessageByID(messages, msgID)
+	require.NotNil(t, stored)
+	assert.Equal(t, "sent", stored["status"], "还有成员未送达")
+	receipts := stored["receipts"].(map[string]interface{})
+	assert.Equal(t, float64(3), receipts["total"])
+	assert.Equal(t, float64(2), receipts["delivered"])
+	assert.Equal(t, float64(1), receipts["read"])
+
+	// 6. 非发送者不能查看回执详情
+	resp, _, err = httpRequest("GET", APIPrefix+"/messages/"+msgID+"/receipts", member1.Token, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 403, resp.StatusCode)
+}
+
+// TestReceipt_DeliveryCoalesced 测试连续消息的送达记录合并
+//
+// 测试目标：
+// - 同一接收者在同一会话中短时间内收到的多条消息合并记录送达
+// - 合并后最新一条消息的送达事件仍会推送，且之前的消息都变为 delivered
+//
+// 验证闭环：
+// 1. A连续给在线的B发3条消息，B收到3条 message 推送
+// 2. A收到的 delivered 事件少于3个，最后一个的 message_id 为第3条消息
+// 3. 消息历史中3条消息的状态都是 delivered
+func TestReceipt_DeliveryCoalesced(t *testing.T) {
+	userA := createTestUser()
+	userB := createTestUser()
+
+	wsA, err := connectWebSocket(userA.Token)
+	require.NoError(t, err)
+	defer wsA.Close()
+	wsB, err := connectWebSocket(userB.Token)
+	require.NoError(t, err)
+	defer wsB.Close()
+
+	// 1. A连续发3条消息
+	for i := 0; i < 3; i++ {
+		wsSend(wsA, "message", map[string]interface{}{
+			"receiver_id":  userB.ID.String(),
+			"message_type": "text",
+			"content":      "burst",
+		})
+	}
+	msgIDs := make([]string, 0, 3)
+	var convID string
+	for i := 0; i < 3; i++ {
+		msg, err := wsReceiveMessageType(wsB, "message", 3*time.Second, 5)
+		require.NoError(t, err)
+		msgData := msg["data"].(map[string]interface{})
+		msgIDs = append(msgIDs, msgData["id"].(string))
+		convID = msgData["conversation_id"].(string)
+	}
+
+	// 2. 收集A收到的 delivered 事件（直到1秒内没有新事件）
+	delivered := make([]string, 0)
+	for {
+		event, err := wsReceiveRaw(wsA, time.Second)
+		if err != nil {
+			break
+		}
+		if event["type"] == "delivered" {
+			delivered = append(delivered, event["data"].(map[string]interface{})["message_id"].(string))
+		}
+	}
+	require.NotEmpty(t, delivered, "A应该收到delivered事件")
+	assert.Less(t, len(delivered), 3, "连续消息的送达记录应该合并")
+	assert.Equal(t, msgIDs[2], delivered[len(delivered)-1])
+
+	// 3. 3条消息都已送达
+	messages, err := getMessages(userA.Token, convID)
+	require.NoError(t, err)
+	for _, msgID := range msgIDs {
+		stored := findMessageByID(messages, msgID)
+		require.NotNil(t, stored)
+		assert.Equal(t, "delivered", stored["status"])
+	}
+}
+
+// TestReceipt_ReadRejectsOtherConversationMessage 测试已读的消息必须属于该会话
+//
+// 验证闭环：
+// 1. B给A发消息（A-B私聊），C给A发一条更新的消息（A-C私聊）
+// 2. A在A-B私聊中用C的消息ID标记已读，收到 not_found 错误
+// 3. A-B私聊中B的消息仍为 delivered，A的未读数不变
+func TestReceipt_ReadRejectsOtherConversationMessage(t *testing.T) {
+	userA := createTestUser()
+	userB := createTestUser()
+	userC := createTestUser()
+
+	wsA, err := connectWebSocket(userA.Token)
+	require.NoError(t, err)
+	defer wsA.Close()
+	wsB, err := connectWebSocket(userB.Token)
+	require.NoError(t, err)
+	defer wsB.Close()
+	wsC, err := connectWebSocket(userC.Token)
+	require.NoError(t, err)
+	defer wsC.Close()
+
+	// 1. 两个会话各一条消息
+	wsSend(wsB, "message", map[string]interface{}{
+		"receiver_id":  userA.ID.String(),
+		"message_type": "text",
+		"content":      "from B",
+	})
+	msgB, err := wsReceiveMessageType(wsA, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	dataB := msgB["data"].(map[string]interface{})
+	convAB := dataB["conversation_id"].(string)
+	_, err = wsReceiveMessageType(wsB, "delivered", 3*time.Second, 10)
+	require.NoError(t, err, "B应该收到delivered事件")
+
+	wsSend(wsC, "message", map[string]interface{}{
+		"receiver_id":  userA.ID.String(),
+		"message_type": "text",
+		"content":      "from C",
+	})
+	msgC, err := wsReceiveMessageType(wsA, "message", 3*time.Second, 10)
+	require.NoError(t, err)
+	msgCID := msgC["data"].(map[string]interface{})["id"].(string)
+
+	// 2. 用其他会话的消息ID标记已读
+	wsSendRequest(wsA, "read", "r-1", map[string]interface{}{
+		"conversation_id": convAB,
+		"message_id":      msgCID,
+	})
+	errMsg, err := wsReceiveMessageType(wsA, "error", 3*time.Second, 10)
+	require.NoError(t, err, "应该返回错误")
+	assert.Equal(t, "not_found", errMsg["data"].(map[string]interface{})["code"])
+
+	// 3. A-B私聊的进度没有变化
+	conversations, err := getConversationList(userA.Token)
+	require.NoError(t, err)
+	conv := findConversationByID(conversations, convAB)
+	require.NotNil(t, conv)
+	assert.Equal(t, 1, getMemberUnreadCount(conv, userA.ID.String()))
+
+	messages, err := getMessages(userB.Token, convAB)
+	require.NoError(t, err)
+	stored := findMessageByID(messages, dataB["id"].(string))
+	require.NotNil(t, stored)
+	assert.Equal(t, "delivered", stored["status"])
+}
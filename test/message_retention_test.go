@@ -0,0 +1,139 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ============================================
+// 阅后即焚
+// ============================================
+
+// TestRetention_MessagesExpireAndArePurged 测试消息到期后被清理并推送 expired 事件
+//
+// 测试目标：
+// - 私聊任意一方可以设置消息保留时长，双方收到 retention_updated 事件
+// - 设置后发送的消息到期后被后台清理器删除
+// - 会话成员收到 expired 事件，消息历史中不再包含该消息
+// - 过期消息计入的未读数被扣减，会话的最后消息时间回退到剩余的最新消息
+//
+// 验证闭环：
+// 1. A给B发送消息建立私聊
+// 2. B设置保留时长为5秒，A收到retention_updated事件
+// 3. B发送消息
+// 4. A在清理周期内收到expired事件，包含该消息ID
+// 5. 消息历史中不再包含该消息
+// 6. A的会话未读数为0，last_message_at 为第1步消息的发送时间
+func TestRetention_MessagesExpireAndArePurged(t *testing.T) {
+	userA := createTestUser()
+	userB := createTestUser()
+
+	wsA, err := connectWebSocket(userA.Token)
+	require.NoError(t, err)
+	defer wsA.Close()
+
+	wsB, err := connectWebSocket(userB.Token)
+	require.NoError(t, err)
+	defer wsB.Close()
+
+	// 1. 建立私聊
+	wsSend(wsA, "message", map[string]interface{}{
+		"receiver_id":  userB.ID.String(),
+		"message_type": "text",
+		"content":      "Hi",
+	})
+	msg, err := wsReceiveMessageType(wsA, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	convID := msg["data"].(map[string]interface{})["conversation_id"].(string)
+	firstCreatedAt, err := time.Parse(time.RFC3339Nano, msg["data"].(map[string]interface{})["created_at"].(string))
+	require.NoError(t, err)
+
+	// 2. B设置保留时长
+	resp, body, err := httpRequest("POST", APIPrefix+"/conversations/"+convID+"/retention", userB.Token, map[string]interface{}{
+		"message_ttl_seconds": 5,
+	})
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, float64(5), parseResponse(body)["message_ttl_seconds"])
+
+	event, err := wsReceiveMessageType(wsA, "retention_updated", 3*time.Second, 5)
+	require.NoError(t, err, "A应该收到retention_updated事件")
+	assert.Equal(t, float64(5), event["data"].(map[string]interface{})["message_ttl_seconds"])
+
+	// 3. B发送消息
+	wsSend(wsB, "message", map[string]interface{}{
+		"conversation_id": convID,
+		"message_type":    "text",
+		"content":         "This message will self-destruct",
+	})
+	msg, err = wsReceiveMessageType(wsB, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	data := msg["data"].(map[string]interface{})
+	msgID := data["id"].(string)
+	assert.NotNil(t, data["expires_at"], "消息应该带有过期时间")
+
+	// 4. A收到expired事件（过期5秒 + 清理周期10秒）
+	event, err = wsReceiveMessageType(wsA, "expired", 20*time.Second, 20)
+	require.NoError(t, err, "A应该收到expired事件")
+	expired := event["data"].(map[string]interface{})
+	assert.Equal(t, convID, expired["conversation_id"])
+	assert.Contains(t, expired["message_ids"], msgID)
+
+	// 5. 验证闭环：消息历史中不再包含该消息
+	messages, err := getMessages(userA.Token, convID)
+	require.NoError(t, err)
+	assert.Nil(t, findMessageByID(messages, msgID), "过期消息应该已被删除")
+
+	// 6. 会话计数和最后消息时间
+	conversations, err := getConversationList(userA.Token)
+	require.NoError(t, err)
+	conv := findConversationByID(conversations, convID)
+	require.NotNil(t, conv)
+	assert.Equal(t, float64(0), conv["unread_count"], "过期消息不应该再计入未读数")
+	lastMessageAt, err := time.Parse(time.RFC3339Nano, conv["last_message_at"].(string))
+	require.NoError(t, err)
+	assert.WithinDuration(t, firstCreatedAt, lastMessageAt, time.Millisecond, "last_message_at 应该回退到剩余的最新消息")
+}
+
+// TestRetention_GroupRequiresAdmin 测试群聊只有 owner/admin 可以设置保留时长
+//
+// 验证闭环：
+// 1. owner创建群聊
+// 2. 普通成员设置保留时长，返回403
+// 3. 非法的保留时长返回400
+// 4. owner设置成功
+func TestRetention_GroupRequiresAdmin(t *testing.T) {
+	owner := createTestUser()
+	member := createTestUser()
+
+	// 1. 创建群聊
+	_, body, err := httpRequest("POST", APIPrefix+"/conversations/group", owner.Token, map[string]interface{}{
+		"group_name": "Retention Group",
+		"member_ids": []string{member.ID.String()},
+	})
+	require.NoError(t, err)
+	groupID := parseResponse(body)["id"].(string)
+
+	// 2. 普通成员不能设置
+	resp, _, err := httpRequest("POST", APIPrefix+"/conversations/"+groupID+"/retention", member.Token, map[string]interface{}{
+		"message_ttl_seconds": 86400,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 403, resp.StatusCode, "群聊普通成员不能设置保留时长")
+
+	// 3. 非法的保留时长
+	resp, _, _ = httpRequest("POST", APIPrefix+"/conversations/"+groupID+"/retention", owner.Token, map[string]interface{}{
+		"message_ttl_seconds": 1,
+	})
+	assert.Equal(t, 400, resp.StatusCode)
+
+	// 4. owner设置成功
+	resp, body, _ = httpRequest("POST", APIPrefix+"/conversations/"+groupID+"/retention", owner.Token, map[string]interface{}{
+		"message_ttl_seconds": 7 * 86400,
+	})
+	require.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, float64(7*86400), parseResponse(body)["message_ttl_seconds"])
+}
@@ -0,0 +1,197 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ============================================
+// 会话内消息序号
+// ============================================
+
+// TestSeq_ConcurrentSendersAcrossDevices 测试多人同时发送时序号严格递增且各设备一致
+//
+// 测试目标：
+// - 每条消息在发送事务中分配会话内序号，从 1 开始连续递增，不重复
+// - 同一用户的多个设备收到的消息序号一致，按序号排序即可得到确定的顺序
+// - 消息历史按序号排序，会话的 last_seq 为最新消息的序号；不同会话的序号互不影响
+//
+// 验证闭环：
+// 1. owner、member1 在群聊中同时各发送5条消息（不等待推送）
+// 2. member2 的两个设备各收到10条消息，序号为 1~10 且两个设备的 消息ID→序号 一致
+// 3. 消息历史按序号正序返回
+// 4. 会话列表中 last_seq=10；新群聊的第一条消息序号为 1
+func TestSeq_ConcurrentSendersAcrossDevices(t *testing.T) {
+	owner := createTestUser()
+	member1 := createTestUser()
+	member2 := createTestUser()
+
+	resp, body, err := httpRequest("POST", APIPrefix+"/conversations/group", owner.Token, map[string]interface{}{
+		"group_name": "Seq Group",
+		"member_ids": []string{member1.ID.String(), member2.ID.String()},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode, string(body))
+	groupID := parseResponse(body)["id"].(string)
+
+	wsOwner, err := connectWebSocket(owner.Token)
+	require.NoError(t, err)
+	defer wsOwner.Close()
+	ws1, err := connectWebSocket(member1.Token)
+	require.NoError(t, err)
+	defer ws1.Close()
+	device1, err := connectWebSocket(member2.Token)
+	require.NoError(t, err)
+	defer device1.Close()
+	device2, err := connectWebSocket(member2.Token)
+	require.NoError(t, err)
+	defer device2.Close()
+
+	// 1. 两个发送者交替发送，不等待推送
+	for i := 1; i <= 5; i++ {
+		wsSend(wsOwner, "message", map[string]interface{}{
+			"conversation_id": groupID,
+			"message_type":    "text",
+			"content":         fmt.Sprintf("owner %d", i),
+		})
+		wsSend(ws1, "message", map[string]interface{}{
+			"conversation_id": groupID,
+			"message_type":    "text",
+			"content":         fmt.Sprintf("member1 %d", i),
+		})
+	}
+
+	// 2. 两个设备收到的序号
+	receiveSeqs := func(device *websocket.Conn, label string) map[string]float64 {
+		seqByID := map[string]float64{}
+		for i := 0; i < 10; i++ {
+			msg, err := wsReceiveMessageType(device, "message", 5*time.Second, 20)
+			require.NoError(t, err, "%s 应该收到10条消息", label)
+			data := msg["data"].(map[string]interface{})
+			seqByID[data["id"].(string)] = data["seq"].(float64)
+		}
+		return seqByID
+	}
+	seqs1 := receiveSeqs(device1, "device1")
+	seqs2 := receiveSeqs(device2, "device2")
+	assert.Equal(t, seqs1, seqs2, "两个设备收到的序号应该一致")
+
+	seen := map[float64]bool{}
+	for _, seq := range seqs1 {
+		seen[seq] = true
+	}
+	for seq := 1; seq <= 10; seq++ {
+		assert.True(t, seen[float64(seq)], "序号 %d 应该存在（连续且不重复）", seq)
+	}
+
+	// 3. 消息历史按序号排序
+	messages, err := getMessages(member2.Token, groupID)
+	require.NoError(t, err)
+	require.Len(t, messages, 10)
+	for i, item := range messages {
+		msg := item.(map[string]interface{})
+		assert.Equal(t, float64(i+1), msg["seq"])
+		assert.Equal(t, seqs1[msg["id"].(string)], msg["seq"])
+	}
+
+	// 4. 会话的 last_seq；其他会话从 1 开始
+	conversations, err := getConversationList(member2.Token)
+	require.NoError(t, err)
+	conv := findConversationByID(conversations, groupID)
+	require.NotNil(t, conv)
+	assert.Equal(t, float64(10), conv["last_seq"])
+
+	resp, body, err = httpRequest("POST", APIPrefix+"/conversations/group", owner.Token, map[string]interface{}{
+		"group_name": "Seq Group 2",
+		"member_ids": []string{member2.ID.String()},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode, string(body))
+	otherGroupID := parseResponse(body)["id"].(string)
+
+	wsSend(wsOwner, "message", map[string]interface{}{
+		"conversation_id": otherGroupID,
+		"message_type":    "text",
+		"content":         "first",
+	})
+	msg, err := wsReceiveMessageType(device1, "message", 3*time.Second, 20)
+	require.NoError(t, err)
+	assert.Equal(t, otherGroupID, msg["data"].(map[string]interface{})["conversation_id"])
+	assert.Equal(t, float64(1), msg["data"].(map[string]interface{})["seq"])
+}
+
+// TestSeq_FetchMissingRange 测试按序号范围补齐缺失的消息
+//
+// 测试目标：
+// - 客户端发现序号不连续时，用 after_seq/before_seq 拉取缺失的范围
+// - 只指定 after_seq 时返回之后的消息，用于断线重连后同步
+// - 序号范围参数和其他游标互斥，范围无效时返回400
+//
+// 验证闭环：
+// 1. owner在群聊中发送5条消息
+// 2. member请求 after_seq=2&before_seq=5，得到序号 3、4，两侧都还有消息
+// 3. member请求 after_seq=3&limit=10，得到序号 4、5，has_more_after=false
+// 4. after_seq >= before_seq、after_seq 与 before 同时使用均返回400
+func TestSeq_FetchMissingRange(t *testing.T) {
+	owner := createTestUser()
+	member := createTestUser()
+
+	resp, body, err := httpRequest("POST", APIPrefix+"/conversations/group", owner.Token, map[string]interface{}{
+		"group_name": "Seq Range Group",
+		"member_ids": []string{member.ID.String()},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode, string(body))
+	groupID := parseResponse(body)["id"].(string)
+
+	wsOwner, err := connectWebSocket(owner.Token)
+	require.NoError(t, err)
+	defer wsOwner.Close()
+	wsMember, err := connectWebSocket(member.Token)
+	require.NoError(t, err)
+	defer wsMember.Close()
+
+	// 1. 发送5条消息
+	sent := sendGroupMessages(t, wsOwner, wsMember, groupID, "s1", "s2", "s3", "s4", "s5")
+
+	seqsOf := func(result map[string]interface{}) []float64 {
+		seqs := []float64{}
+		for _, item := range result["messages"].([]interface{}) {
+			seqs = append(seqs, item.(map[string]interface{})["seq"].(float64))
+		}
+		return seqs
+	}
+
+	// 2. 补齐缺失的范围
+	resp, body, err = httpRequest("GET", APIPrefix+"/conversations/"+groupID+"/messages?after_seq=2&before_seq=5", member.Token, nil)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode, string(body))
+	result := parseResponse(body)
+	assert.Equal(t, []float64{3, 4}, seqsOf(result))
+	assert.Equal(t, sent[2:4], messageIDs(result["messages"].([]interface{})))
+	assert.Equal(t, true, result["has_more_before"])
+	assert.Equal(t, true, result["has_more_after"])
+
+	// 3. 只指定 after_seq
+	resp, body, err = httpRequest("GET", APIPrefix+"/conversations/"+groupID+"/messages?after_seq=3&limit=10", member.Token, nil)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode, string(body))
+	result = parseResponse(body)
+	assert.Equal(t, []float64{4, 5}, seqsOf(result))
+	assert.Equal(t, true, result["has_more_before"])
+	assert.Equal(t, false, result["has_more_after"])
+
+	// 4. 无效参数
+	resp, _, err = httpRequest("GET", APIPrefix+"/conversations/"+groupID+"/messages?after_seq=4&before_seq=4", member.Token, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+
+	resp, _, err = httpRequest("GET", APIPrefix+"/conversations/"+groupID+"/messages?after_seq=1&before="+sent[4], member.Token, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode, "序号范围和其他游标互斥")
+}
@@ -0,0 +1,205 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ============================================
+// 话题（消息串）
+// ============================================
+
+// TestThread_ReplyAndSummary 测试话题回复、根消息摘要和话题未读数
+//
+// 测试目标：
+// - 回复消息会归入根消息的话题，回复的回复也归入同一话题
+// - 回复消息的 metadata 包含 reply_to_content
+// - 会话成员收到 thread_reply 事件（包含最新回复数）
+// - 消息历史中根消息包含回复数、最后回复时间和当前用户的话题未读数
+// - 话题标记已读后未读数清零
+//
+// 验证闭环：
+// 1. A发送根消息
+// 2. B回复根消息，A收到thread_reply事件（reply_count=1）
+// 3. B回复自己的回复，该回复的thread_root_id仍是根消息（reply_count=2）
+// 4. A查询消息历史：根消息thread_reply_count=2，thread_unread_count=2
+// 5. A获取话题：2条回复，unread_count=2
+// 6. A标记话题已读，再次获取话题unread_count=0
+func TestThread_ReplyAndSummary(t *testing.T) {
+	userA := createTestUser()
+	userB := createTestUser()
+
+	wsA, err := connectWebSocket(userA.Token)
+	require.NoError(t, err)
+	defer wsA.Close()
+
+	wsB, err := connectWebSocket(userB.Token)
+	require.NoError(t, err)
+	defer wsB.Close()
+
+	// 1. A发送根消息
+	wsSend(wsA, "message", map[string]interface{}{
+		"receiver_id":  userB.ID.String(),
+		"message_type": "text",
+		"content":      "Thread root",
+	})
+	msgA, err := wsReceiveMessageType(wsA, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	rootData := msgA["data"].(map[string]interface{})
+	rootID := rootData["id"].(string)
+	convID := rootData["conversation_id"].(string)
+	wsReceiveMessageType(wsB, "message", 3*time.Second, 5)
+
+	// 2. B回复根消息
+	wsSend(wsB, "message", map[string]interface{}{
+		"conversation_id":     convID,
+		"message_type":        "text",
+		"content":             "First reply",
+		"reply_to_message_id": rootID,
+	})
+	reply, err := wsReceiveMessageType(wsB, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	replyData := reply["data"].(map[string]interface{})
+	replyID := replyData["id"].(string)
+	assert.Equal(t, rootID, replyData["thread_root_id"])
+	metadata := replyData["metadata"].(map[string]interface{})
+	assert.Equal(t, "Thread root", metadata["reply_to_content"], "回复应包含被回复消息的预览")
+
+	event, err := wsReceiveMessageType(wsA, "thread_reply", 3*time.Second, 5)
+	require.NoError(t, err, "A应该收到thread_reply事件")
+	data := event["data"].(map[string]interface{})
+	assert.Equal(t, rootID, data["thread_root_id"])
+	assert.Equal(t, float64(1), data["thread_reply_count"])
+
+	// 3. B回复自己的回复（归入同一话题）
+	wsSend(wsB, "message", map[string]interface{}{
+		"conversation_id":     convID,
+		"message_type":        "text",
+		"content":             "Second reply",
+		"reply_to_message_id": replyID,
+	})
+	reply, err = wsReceiveMessageType(wsB, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	assert.Equal(t, rootID, reply["data"].(map[string]interface{})["thread_root_id"])
+
+	event, err = wsReceiveMessageType(wsA, "thread_reply", 3*time.Second, 5)
+	require.NoError(t, err)
+	assert.Equal(t, float64(2), event["data"].(map[string]interface{})["thread_reply_count"])
+
+	// 4. 验证闭环：消息历史中的根消息摘要
+	messages, err := getMessages(userA.Token, convID)
+	require.NoError(t, err)
+	root := findMessageByID(messages, rootID)
+	require.NotNil(t, root)
+	assert.Equal(t, float64(2), root["thread_reply_count"])
+	assert.NotNil(t, root["thread_last_reply_at"])
+	assert.Equal(t, float64(2), root["thread_unread_count"])
+
+	// 5. 获取话题
+	resp, body, err := httpRequest("GET", APIPrefix+"/messages/"+rootID+"/thread", userA.Token, nil)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	thread := parseResponse(body)
+	assert.Len(t, thread["replies"].([]interface{}), 2)
+	assert.Equal(t, float64(2), thread["unread_count"])
+
+	// 6. 标记已读
+	resp, _, err = httpRequest("POST", APIPrefix+"/messages/"+rootID+"/thread/read", userA.Token, nil)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+
+	_, body, _ = httpRequest("GET", APIPrefix+"/messages/"+rootID+"/thread", userA.Token, nil)
+	assert.Equal(t, float64(0), parseResponse(body)["unread_count"], "标记已读后未读数应清零")
+}
+
+// TestThread_RecallReplyDecrementsCount 测试撤回话题回复后根消息的回复数减少
+//
+// 验证闭环：
+// 1. A发送根消息，B回复两次
+// 2. B撤回第一条回复
+// 3. 消息历史中根消息 thread_reply_count=1
+func TestThread_RecallReplyDecrementsCount(t *testing.T) {
+	userA := createTestUser()
+	userB := createTestUser()
+
+	wsA, err := connectWebSocket(userA.Token)
+	require.NoError(t, err)
+	defer wsA.Close()
+	wsB, err := connectWebSocket(userB.Token)
+	require.NoError(t, err)
+	defer wsB.Close()
+
+	// 1. 根消息和两条回复
+	wsSend(wsA, "message", map[string]interface{}{
+		"receiver_id":  userB.ID.String(),
+		"message_type": "text",
+		"content":      "Thread root",
+	})
+	msgA, err := wsReceiveMessageType(wsA, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	rootID := msgA["data"].(map[string]interface{})["id"].(string)
+	convID := msgA["data"].(map[string]interface{})["conversation_id"].(string)
+	wsReceiveMessageType(wsB, "message", 3*time.Second, 5)
+
+	var replyIDs []string
+	for _, content := range []string{"First reply", "Second reply"} {
+		wsSend(wsB, "message", map[string]interface{}{
+			"conversation_id":     convID,
+			"message_type":        "text",
+			"content":             content,
+			"reply_to_message_id": rootID,
+		})
+		reply, err := wsReceiveMessageType(wsB, "message", 3*time.Second, 5)
+		require.NoError(t, err)
+		replyIDs = append(replyIDs, reply["data"].(map[string]interface{})["id"].(string))
+	}
+
+	// 2. 撤回第一条回复
+	resp, body, err := httpRequest("POST", APIPrefix+"/messages/"+replyIDs[0]+"/recall", userB.Token, nil)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode, string(body))
+
+	// 3. 验证闭环：根消息回复数
+	messages, err := getMessages(userA.Token, convID)
+	require.NoError(t, err)
+	root := findMessageByID(messages, rootID)
+	require.NotNil(t, root)
+	assert.Equal(t, float64(1), root["thread_reply_count"], "撤回的回复不应计入回复数")
+}
+
+// TestThread_ReplyTargetMustBeInConversation 测试不能回复其他会话的消息
+//
+// 验证闭环：
+// 1. A给B发送消息
+// 2. A在与C的私聊中回复该消息，收到错误
+func TestThread_ReplyTargetMustBeInConversation(t *testing.T) {
+	userA := createTestUser()
+	userB := createTestUser()
+	userC := createTestUser()
+
+	wsA, err := connectWebSocket(userA.Token)
+	require.NoError(t, err)
+	defer wsA.Close()
+
+	wsSend(wsA, "message", map[string]interface{}{
+		"receiver_id":  userB.ID.String(),
+		"message_type": "text",
+		"content":      "Message in A-B",
+	})
+	msgA, err := wsReceiveMessageType(wsA, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	msgID := msgA["data"].(map[string]interface{})["id"].(string)
+
+	wsSend(wsA, "message", map[string]interface{}{
+		"receiver_id":         userC.ID.String(),
+		"message_type":        "text",
+		"content":             "Cross-conversation reply",
+		"reply_to_message_id": msgID,
+	})
+	errMsg, err := wsReceiveMessageType(wsA, "error", 3*time.Second, 5)
+	require.NoError(t, err, "跨会话回复应该返回错误")
+	assert.Contains(t, errMsg["data"].(map[string]interface{})["message"], "reply target not found")
+}
@@ -0,0 +1,133 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ============================================
+// WebSocket 协议版本协商
+// ============================================
+
+// TestProtocol_VersionSpecificPayloads 测试不同协议版本的设备收到各自格式的推送
+//
+// 测试目标：
+// - 未指定版本的连接使用 v1，message/conversation_update 保持原有格式
+// - 通过 query 参数 v=2 或子协议 dinq.v2 协商 v2，握手响应带回选中的子协议
+// - v2 的 message 推送 {message, can_send}，conversation_update 使用 last_message_at
+//
+// 验证闭环：
+// 1. B的三个设备分别以默认（v1）、v=2、子协议 [dinq.v2, dinq.v1] 连接，子协议连接选中 dinq.v2
+// 2. A给B发消息，v1 设备收到 data.id，v2 设备收到 data.message.id 和 data.can_send，消息ID一致
+// 3. v1 设备的 conversation_update 包含 last_message_time，v2 设备包含 last_message_at
+func TestProtocol_VersionSpecificPayloads(t *testing.T) {
+	userA := createTestUser()
+	userB := createTestUser()
+
+	wsA, err := connectWebSocket(userA.Token)
+	require.NoError(t, err)
+	defer wsA.Close()
+
+	// 1. 三种方式连接
+	wsV1, err := connectWebSocket(userB.Token)
+	require.NoError(t, err)
+	defer wsV1.Close()
+	wsV2Query, err := connectWebSocketWithVersion(userB.Token, "2")
+	require.NoError(t, err)
+	defer wsV2Query.Close()
+	wsV2Sub, err := connectWebSocketWithSubprotocols(userB.Token, "dinq.v2", "dinq.v1")
+	require.NoError(t, err)
+	defer wsV2Sub.Close()
+	assert.Equal(t, "dinq.v2", wsV2Sub.Subprotocol(), "应该选中支持的最高版本")
+
+	// 2. message 推送
+	wsSend(wsA, "message", map[string]interface{}{
+		"receiver_id":  userB.ID.String(),
+		"message_type": "text",
+		"content":      "versioned hello",
+	})
+	msgV1, err := wsReceiveMessageType(wsV1, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	dataV1 := msgV1["data"].(map[string]interface{})
+	msgID := dataV1["id"].(string)
+	assert.Equal(t, "versioned hello", dataV1["content"])
+	assert.NotNil(t, dataV1["can_send"])
+
+	for _, conn := range []*websocket.Conn{wsV2Query, wsV2Sub} {
+		msgV2, err := wsReceiveMessageType(conn, "message", 3*time.Second, 5)
+		require.NoError(t, err)
+		dataV2 := msgV2["data"].(map[string]interface{})
+		assert.Nil(t, dataV2["id"], "v2 的消息字段在 data.message 中")
+		assert.NotNil(t, dataV2["can_send"])
+		message := dataV2["message"].(map[string]interface{})
+		assert.Equal(t, msgID, message["id"])
+		assert.Equal(t, "versioned hello", message["content"])
+		assert.NotNil(t, message["seq"])
+	}
+
+	// 3. conversation_update
+	updateV1, err := wsReceiveMessageType(wsV1, "conversation_update", 3*time.Second, 10)
+	require.NoError(t, err)
+	assert.Contains(t, updateV1["data"], "last_message_time")
+	assert.NotContains(t, updateV1["data"], "last_message_at")
+
+	for _, conn := range []*websocket.Conn{wsV2Query, wsV2Sub} {
+		updateV2, err := wsReceiveMessageType(conn, "conversation_update", 3*time.Second, 10)
+		require.NoError(t, err)
+		assert.Contains(t, updateV2["data"], "last_message_at")
+		assert.NotContains(t, updateV2["data"], "last_message_time")
+		assert.Equal(t, float64(1), updateV2["data"].(map[string]interface{})["unread_count"])
+	}
+}
+
+// TestProtocol_RejectUnsupportedVersion 测试不支持的协议版本被拒绝
+//
+// 测试目标：
+// - 请求不支持的版本时服务端以关闭码 4001 断开连接，关闭原因包含支持的版本范围
+// - 只提出不支持的子协议时，握手响应仍然回复其中一个（否则浏览器直接判定握手失败，收不到 4001）
+// - 显式指定 v=1 可以正常连接
+//
+// 验证闭环：
+// 1. 以 v=99、v=abc、子协议 dinq.v99 连接，均收到关闭码 4001；子协议连接的握手响应为 dinq.v99
+// 2. 以 v=1 连接，可以正常收发心跳
+func TestProtocol_RejectUnsupportedVersion(t *testing.T) {
+	user := createTestUser()
+
+	expectRejected := func(conn *websocket.Conn) {
+		defer conn.Close()
+		conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+		_, _, err := conn.ReadMessage()
+		require.Error(t, err)
+		closeErr, ok := err.(*websocket.CloseError)
+		require.True(t, ok, "应该收到关闭帧: %v", err)
+		assert.Equal(t, 4001, closeErr.Code)
+		assert.Contains(t, closeErr.Text, "supported versions")
+	}
+
+	// 1. 不支持的版本
+	conn, err := connectWebSocketWithVersion(user.Token, "99")
+	require.NoError(t, err)
+	expectRejected(conn)
+
+	conn, err = connectWebSocketWithVersion(user.Token, "abc")
+	require.NoError(t, err)
+	expectRejected(conn)
+
+	conn, err = connectWebSocketWithSubprotocols(user.Token, "dinq.v99")
+	require.NoError(t, err)
+	assert.Equal(t, "dinq.v99", conn.Subprotocol(), "握手响应应该回复客户端提出的子协议")
+	expectRejected(conn)
+
+	// 2. v1 正常连接
+	conn, err = connectWebSocketWithVersion(user.Token, "1")
+	require.NoError(t, err)
+	defer conn.Close()
+	wsSendRequest(conn, "heartbeat", "hb-v1", map[string]interface{}{})
+	ack, err := wsReceiveMessageType(conn, "ack", 3*time.Second, 5)
+	require.NoError(t, err)
+	assert.Equal(t, "hb-v1", ack["request_id"])
+}
@@ -1,10 +1,10 @@
 package test
 
 import (
-	"encoding/json"
 	"fmt"
 	"log"
 	"math/rand"
+	"os"
 	"runtime"
 	"sort"
 	"sync"
@@ -19,6 +19,11 @@ import (
 //
 // 使用方法：
 //   go test -v -run TestRealisticLoad ./test/ -timeout 10m
+//   LOAD_TEST_ENCODING=msgpack go test -v -run TestRealisticLoad ./test/ -timeout 10m
+//
+// 帧编码：
+//   默认使用 JSON 文本帧，LOAD_TEST_ENCODING=msgpack 时使用 MessagePack 二进制帧，
+//   两次运行的报告中「网络流量」按实际帧字节数统计，可以直接对比两种编码
 //
 // 配置参数：
 //   直接修改 TestRealisticLoad_10KUsers 函数开头的配置常量
@@ -123,6 +128,10 @@ func TestRealisticLoad_10KUsers(t *testing.T) {
 	msgCountMin := 2                   // 每人最少发送消息数
 	msgCountMax := 20                  // 每人最多发送消息数
 	validationSampleRate := 10         // 验证采样率（百分比，1-100）
+	encoding := "json"                 // 帧编码（json | msgpack），可通过环境变量 LOAD_TEST_ENCODING 指定
+	if env := os.Getenv("LOAD_TEST_ENCODING"); env != "" {
+		encoding = env
+	}
 	// ========================================
 
 	// 统计指标
@@ -168,6 +177,7 @@ func TestRealisticLoad_10KUsers(t *testing.T) {
 	t.Logf("单用户在线时长: %v", onlineDuration)
 	t.Logf("思考时间: %d-%d ms", thinkTimeMin, thinkTimeMax)
 	t.Logf("消息数量: %d-%d 条/人", msgCountMin, msgCountMax)
+	t.Logf("帧编码: %s", encoding)
 	t.Logf("Gateway URL: %s", BaseURL)
 	t.Logf("CPU 核心数: %d", runtime.NumCPU())
 	t.Log("========================================")
@@ -272,7 +282,7 @@ func TestRealisticLoad_10KUsers(t *testing.T) {
 			userPoolMu.Unlock()
 
 			// 2. 建立 WebSocket 连接
-			ws, err := connectWebSocket(user.Token)
+			ws, err := connectWebSocketWithEncoding(user.Token, encoding)
 			if err != nil {
 				atomic.AddInt64(&failedConnections, 1)
 				log.Printf("❌ [Connection Failed] User %d (%s) failed to connect: %v", userIdx, userCtx.ID, err)
@@ -304,7 +314,7 @@ func TestRealisticLoad_10KUsers(t *testing.T) {
 				}
 			}
 
-			// 3. 启动消息接收 goroutine（使用wsReceiveRaw接收所有消息）
+			// 3. 启动消息接收 goroutine（使用wsReceiveEncoded接收所有消息）
 			// confirmChan用于传递发送确认消息（避免主goroutine和接收goroutine竞争读取WebSocket）
 			confirmChan := make(chan map[string]interface{}, 10)
 			recvDone := make(chan struct{})
@@ -312,8 +322,8 @@ func TestRealisticLoad_10KUsers(t *testing.T) {
 				defer close(recvDone)
 				defer close(confirmChan)
 				for {
-					// 使用 wsReceiveRaw 接收所有消息（包括系统推送）
-					msg, err := wsReceiveRaw(ws, 20*time.Second)
+					// 使用 wsReceiveEncoded 接收所有消息（包括系统推送）
+					msg, frameBytes, err := wsReceiveEncoded(ws, encoding, 20*time.Second)
 					if err != nil {
 						// WebSocket 连接断开，立即标记用户离线（提高测试精度）
 						userCtx.mu.Lock()
@@ -323,10 +333,8 @@ func TestRealisticLoad_10KUsers(t *testing.T) {
 					}
 					atomic.AddInt64(&totalMessagesRecv, 1)
 
-					// 估算接收字节数（JSON 编码后）
-					if msgBytes, err := json.Marshal(msg); err == nil {
-						atomic.AddInt64(&totalBytesRecv, int64(len(msgBytes)))
-					}
+					// 接收字节数（实际帧大小）
+					atomic.AddInt64(&totalBytesRecv, int64(frameBytes))
 
 					// 处理不同类型的消息
 					msgType, _ := msg["type"].(string)
@@ -447,11 +455,12 @@ func TestRealisticLoad_10KUsers(t *testing.T) {
 					select {
 					case <-ticker.C:
 						userCtx.wsMutex.Lock()
-						err := wsSend(ws, "heartbeat", map[string]interface{}{})
+						sentBytes, err := wsSendEncoded(ws, encoding, "heartbeat", map[string]interface{}{})
 						userCtx.wsMutex.Unlock()
 						if err != nil {
 							return
 						}
+						atomic.AddInt64(&totalBytesSent, int64(sentBytes))
 						userCtx.mu.Lock()
 						userCtx.SentHeartbeats++
 						userCtx.mu.Unlock()
@@ -534,17 +543,16 @@ func TestRealisticLoad_10KUsers(t *testing.T) {
 
 					messageContent := fmt.Sprintf("Hello from user %d at %v. This is a test message with more content to simulate real-world usage patterns. The quick brown fox jumps over the lazy dog. Testing message delivery system with WebSocket and database persistence.", userIdx, time.Now().Format("15:04:05"))
 					userCtx.wsMutex.Lock()
-					err := wsSend(ws, "message", map[string]interface{}{
+					sentBytes, err := wsSendEncoded(ws, encoding, "message", map[string]interface{}{
 						"receiver_id":  target.ID,
 						"message_type": "text",
 						"content":      messageContent,
 					})
 					userCtx.wsMutex.Unlock()
 
-					// 估算发送字节数
+					// 发送字节数（实际帧大小）
 					if err == nil {
-						estimatedBytes := len(messageContent) + 200 // JSON overhead
-						atomic.AddInt64(&totalBytesSent, int64(estimatedBytes))
+						atomic.AddInt64(&totalBytesSent, int64(sentBytes))
 					}
 
 					if err != nil {
@@ -744,7 +752,7 @@ func TestRealisticLoad_10KUsers(t *testing.T) {
 				time.Sleep(2 * time.Second)
 
 				// 重新上线
-				ws2, err := connectWebSocket(user.Token)
+				ws2, err := connectWebSocketWithEncoding(user.Token, encoding)
 				if err != nil {
 					// 重连失败，不需要加回 activeUsers（因为已经下线了）
 					log.Printf("❌ [Reconnection Failed] User %d (%s) failed to reconnect: %v", userIdx, userCtx.ID, err)
@@ -768,7 +776,7 @@ func TestRealisticLoad_10KUsers(t *testing.T) {
 					defer close(recvDone2)
 					defer close(confirmChan2)
 					for {
-						msg, err := wsReceiveRaw(ws2, 20*time.Second)
+						msg, frameBytes, err := wsReceiveEncoded(ws2, encoding, 20*time.Second)
 						if err != nil {
 							// WebSocket 连接断开，立即标记用户离线（提高测试精度）
 							userCtx.mu.Lock()
@@ -778,10 +786,8 @@ func TestRealisticLoad_10KUsers(t *testing.T) {
 						}
 						atomic.AddInt64(&totalMessagesRecv, 1)
 
-						// 估算接收字节数
-						if msgBytes, err := json.Marshal(msg); err == nil {
-							atomic.AddInt64(&totalBytesRecv, int64(len(msgBytes)))
-						}
+						// 接收字节数（实际帧大小）
+						atomic.AddInt64(&totalBytesRecv, int64(frameBytes))
 
 						msgType, _ := msg["type"].(string)
 						data, _ := msg["data"].(map[string]interface{})
@@ -914,7 +920,7 @@ func TestRealisticLoad_10KUsers(t *testing.T) {
 						atomic.AddInt64(&totalMessagesSent, 1)
 						messageContent := fmt.Sprintf("Reconnected message from user %d at %v. This is a test message with more content to simulate real-world usage patterns. The quick brown fox jumps over the lazy dog. Testing reconnection and message delivery after going offline.", userIdx, time.Now().Format("15:04:05"))
 						userCtx.wsMutex.Lock()
-						err := wsSend(ws2, "message", map[string]interface{}{
+						sentBytes, err := wsSendEncoded(ws2, encoding, "message", map[string]interface{}{
 							"receiver_id":  target.ID,
 							"message_type": "text",
 							"content":      messageContent,
@@ -922,8 +928,7 @@ func TestRealisticLoad_10KUsers(t *testing.T) {
 						userCtx.wsMutex.Unlock()
 
 						if err == nil {
-							estimatedBytes := len(messageContent) + 200
-							atomic.AddInt64(&totalBytesSent, int64(estimatedBytes))
+							atomic.AddInt64(&totalBytesSent, int64(sentBytes))
 						}
 
 						if err != nil {
@@ -1173,7 +1178,7 @@ func TestRealisticLoad_10KUsers(t *testing.T) {
 	t.Logf("  P99 延迟:     %v", p99Latency)
 	t.Logf("  最大延迟:     %v", maxLatency)
 	t.Log("")
-	t.Log("📡 网络流量")
+	t.Logf("📡 网络流量（%s）", encoding)
 	t.Logf("  发送字节:     %.2f MB", float64(bytesSent)/1024/1024)
 	t.Logf("  接收字节:     %.2f MB", float64(bytesRecv)/1024/1024)
 	t.Logf("  总流量:       %.2f MB", float64(bytesSent+bytesRecv)/1024/1024)
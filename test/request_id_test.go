@@ -0,0 +1,176 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ============================================
+// WebSocket 请求ID和错误码
+// ============================================
+
+// TestRequestID_SendMessage 测试发送消息的 request_id 关联和错误码
+//
+// 测试目标：
+// - 带 request_id 的消息发送成功后收到 ack，包含相同的 request_id 和保存后的消息
+// - 发送失败时 error 事件带回 request_id，并包含机器可读的 code
+// - 不带 request_id 的请求不会收到 ack
+//
+// 验证闭环：
+// 1. A发送 request_id=send-1 的消息，收到 ack，data 为保存后的消息（与B收到的消息ID一致）
+// 2. A发送 content 类型错误的消息，收到 request_id=send-2、code=invalid_format 的错误
+// 3. A发送空内容消息，收到 request_id=send-3、code=invalid_request 的错误
+// 4. B回复前A再发一条，收到 request_id=send-4、code=first_message_limit 的错误
+// 5. A发送不带 request_id 的心跳，再发送 request_id=hb-1 的心跳，收到的第一个 ack 是 hb-1
+func TestRequestID_SendMessage(t *testing.T) {
+	userA := createTestUser()
+	userB := createTestUser()
+
+	wsA, err := connectWebSocket(userA.Token)
+	require.NoError(t, err)
+	defer wsA.Close()
+	wsB, err := connectWebSocket(userB.Token)
+	require.NoError(t, err)
+	defer wsB.Close()
+
+	// 1. 发送成功
+	wsSendRequest(wsA, "message", "send-1", map[string]interface{}{
+		"receiver_id":  userB.ID.String(),
+		"message_type": "text",
+		"content":      "hello with request id",
+	})
+	ack, err := wsReceiveMessageType(wsA, "ack", 3*time.Second, 10)
+	require.NoError(t, err, "A应该收到ack")
+	assert.Equal(t, "send-1", ack["request_id"])
+	ackData := ack["data"].(map[string]interface{})
+	assert.Equal(t, "hello with request id", ackData["content"])
+	assert.NotNil(t, ackData["seq"])
+	convID := ackData["conversation_id"].(string)
+
+	msg, err := wsReceiveMessageType(wsB, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	assert.Equal(t, ackData["id"], msg["data"].(map[string]interface{})["id"])
+
+	// 2. 格式错误
+	wsSendRequest(wsA, "message", "send-2", map[string]interface{}{
+		"conversation_id": convID,
+		"message_type":    "text",
+		"content":         12345,
+	})
+	errMsg, err := wsReceiveMessageType(wsA, "error", 3*time.Second, 10)
+	require.NoError(t, err)
+	assert.Equal(t, "send-2", errMsg["request_id"])
+	assert.Equal(t, "invalid_format", errMsg["data"].(map[string]interface{})["code"])
+
+	// 3. 参数校验失败
+	wsSendRequest(wsA, "message", "send-3", map[string]interface{}{
+		"conversation_id": convID,
+		"message_type":    "text",
+		"content":         "",
+	})
+	errMsg, err = wsReceiveMessageType(wsA, "error", 3*time.Second, 10)
+	require.NoError(t, err)
+	assert.Equal(t, "send-3", errMsg["request_id"])
+	assert.Equal(t, "invalid_request", errMsg["data"].(map[string]interface{})["code"])
+
+	// 4. 首条消息限制
+	wsSendRequest(wsA, "message", "send-4", map[string]interface{}{
+		"conversation_id": convID,
+		"message_type":    "text",
+		"content":         "second message before reply",
+	})
+	errMsg, err = wsReceiveMessageType(wsA, "error", 3*time.Second, 10)
+	require.NoError(t, err)
+	assert.Equal(t, "send-4", errMsg["request_id"])
+	assert.Equal(t, "first_message_limit", errMsg["data"].(map[string]interface{})["code"])
+
+	// 5. 不带 request_id 的请求没有 ack
+	wsSend(wsA, "heartbeat", map[string]interface{}{})
+	wsSendRequest(wsA, "heartbeat", "hb-1", map[string]interface{}{})
+	ack, err = wsReceiveMessageType(wsA, "ack", 3*time.Second, 10)
+	require.NoError(t, err)
+	assert.Equal(t, "hb-1", ack["request_id"], "不带request_id的心跳不应该收到ack")
+}
+
+// TestRequestID_OtherHandlers 测试其他请求类型的 request_id 关联
+//
+// 测试目标：
+// - 已读、撤回、同步等请求都带回 request_id（同步结果为 sync 事件）
+// - 权限错误和未知消息类型返回对应的错误码
+//
+// 验证闭环：
+// 1. A给B发消息，B发送 request_id=read-1 的已读，收到 ack（包含会话ID和消息ID）
+// 2. B撤回A的消息，收到 request_id=recall-1、code=forbidden 的错误
+// 3. A撤回消息，收到 request_id=recall-2 的 ack
+// 4. B发送未知类型，收到 request_id=unknown-1、code=unknown_type 的错误
+// 5. B发送 request_id=sync-1 的同步请求，收到带 request_id 的 sync 事件
+func TestRequestID_OtherHandlers(t *testing.T) {
+	userA := createTestUser()
+	userB := createTestUser()
+
+	wsA, err := connectWebSocket(userA.Token)
+	require.NoError(t, err)
+	defer wsA.Close()
+	wsB, err := connectWebSocket(userB.Token)
+	require.NoError(t, err)
+	defer wsB.Close()
+
+	wsSend(wsA, "message", map[string]interface{}{
+		"receiver_id":  userB.ID.String(),
+		"message_type": "text",
+		"content":      "read me",
+	})
+	msg, err := wsReceiveMessageType(wsB, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	msgID := msg["data"].(map[string]interface{})["id"].(string)
+	convID := msg["data"].(map[string]interface{})["conversation_id"].(string)
+
+	// 1. 已读
+	wsSendRequest(wsB, "read", "read-1", map[string]interface{}{
+		"conversation_id": convID,
+		"message_id":      msgID,
+	})
+	ack, err := wsReceiveMessageType(wsB, "ack", 3*time.Second, 10)
+	require.NoError(t, err)
+	assert.Equal(t, "read-1", ack["request_id"])
+	ackData := ack["data"].(map[string]interface{})
+	assert.Equal(t, convID, ackData["conversation_id"])
+	assert.Equal(t, msgID, ackData["message_id"])
+
+	// 2. 不能撤回别人的消息
+	wsSendRequest(wsB, "recall", "recall-1", map[string]interface{}{
+		"message_id": msgID,
+	})
+	errMsg, err := wsReceiveMessageType(wsB, "error", 3*time.Second, 10)
+	require.NoError(t, err)
+	assert.Equal(t, "recall-1", errMsg["request_id"])
+	assert.Equal(t, "forbidden", errMsg["data"].(map[string]interface{})["code"])
+
+	// 3. 撤回自己的消息
+	wsSendRequest(wsA, "recall", "recall-2", map[string]interface{}{
+		"message_id": msgID,
+	})
+	ack, err = wsReceiveMessageType(wsA, "ack", 3*time.Second, 10)
+	require.NoError(t, err)
+	assert.Equal(t, "recall-2", ack["request_id"])
+	assert.Equal(t, msgID, ack["data"].(map[string]interface{})["message_id"])
+
+	// 4. 未知消息类型
+	wsSendRequest(wsB, "no_such_type", "unknown-1", map[string]interface{}{})
+	errMsg, err = wsReceiveMessageType(wsB, "error", 3*time.Second, 10)
+	require.NoError(t, err)
+	assert.Equal(t, "unknown-1", errMsg["request_id"])
+	assert.Equal(t, "unknown_type", errMsg["data"].(map[string]interface{})["code"])
+
+	// 5. 同步结果带回 request_id
+	wsSendRequest(wsB, "sync", "sync-1", map[string]interface{}{
+		"checkpoint": "",
+	})
+	syncMsg, err := wsReceiveMessageType(wsB, "sync", 3*time.Second, 10)
+	require.NoError(t, err)
+	assert.Equal(t, "sync-1", syncMsg["request_id"])
+	assert.Equal(t, true, syncMsg["data"].(map[string]interface{})["reset"])
+}
@@ -0,0 +1,147 @@
+package test
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ============================================
+// 富文本消息（Markdown 子集）
+// ============================================
+
+// TestRichText_RenderPreviewAndSearch 测试富文本消息的规范化渲染、预览和搜索
+//
+// 测试目标：
+// - 服务端把 Markdown 规范化并生成 plain_text 和 metadata.html
+// - 会话列表预览使用纯文本（不包含 Markdown 符号）
+// - 搜索匹配纯文本，不匹配 Markdown 符号
+//
+// 验证闭环：
+// 1. A发送包含粗体、斜体、代码、链接、列表的富文本
+// 2. B收到的消息包含规范化的content、plain_text和html
+// 3. B的会话列表预览为单行纯文本
+// 4. B搜索纯文本中的词能找到消息，搜索"**release**"找不到
+func TestRichText_RenderPreviewAndSearch(t *testing.T) {
+	userA := createTestUser()
+	userB := createTestUser()
+
+	wsA, err := connectWebSocket(userA.Token)
+	require.NoError(t, err)
+	defer wsA.Close()
+	wsB, err := connectWebSocket(userB.Token)
+	require.NoError(t, err)
+	defer wsB.Close()
+
+	// 1. 发送富文本（"__"粗体会被规范化为"**"）
+	wsSend(wsA, "message", map[string]interface{}{
+		"receiver_id":  userB.ID.String(),
+		"message_type": "rich_text",
+		"content":      "Deploy *now* please: __release__ `v2` [notes](https://example.com/notes)\n\n- first\n- second",
+	})
+
+	// 2. B收到规范化后的消息
+	msg, err := wsReceiveMessageType(wsB, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	msgData := msg["data"].(map[string]interface{})
+	msgID := msgData["id"].(string)
+	convID := msgData["conversation_id"].(string)
+	assert.Equal(t, "rich_text", msgData["message_type"])
+	assert.Equal(t, "Deploy *now* please: **release** `v2` [notes](https://example.com/notes)\n\n- first\n- second", msgData["content"])
+	assert.Equal(t, "Deploy now please: release v2 notes\n- first\n- second", msgData["plain_text"])
+	html := msgData["metadata"].(map[string]interface{})["html"].(string)
+	assert.Contains(t, html, "<strong>release</strong>")
+	assert.Contains(t, html, "<em>now</em>")
+	assert.Contains(t, html, "<ul><li>first</li><li>second</li></ul>")
+	assert.Contains(t, html, `rel="nofollow noopener noreferrer"`)
+
+	time.Sleep(200 * time.Millisecond)
+
+	// 3. 会话列表预览为纯文本
+	conversations, err := getConversationList(userB.Token)
+	require.NoError(t, err)
+	conv := findConversationByID(conversations, convID)
+	require.NotNil(t, conv)
+	assert.Equal(t, "Deploy now please: release v2 notes - first - second", conv["last_message_text"])
+
+	// 4. 搜索匹配纯文本
+	resp, body, err := httpRequest("GET", "/api/messages/search?q="+url.QueryEscape("please: release"), userB.Token, nil)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode, string(body))
+	results := parseResponse(body)["messages"].([]interface{})
+	require.Len(t, results, 1)
+	assert.Equal(t, msgID, results[0].(map[string]interface{})["id"])
+
+	resp, body, err = httpRequest("GET", "/api/messages/search?q="+url.QueryEscape("**release**"), userB.Token, nil)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode, string(body))
+	assert.Empty(t, parseResponse(body)["messages"], "Markdown 符号不参与搜索")
+}
+
+// TestRichText_SanitizeAndEdit 测试富文本的安全过滤和编辑
+//
+// 测试目标：
+// - 不安全的链接（javascript:）只保留文本，HTML 标签被转义
+// - 编辑富文本消息会重新渲染 plain_text 和 html
+//
+// 验证闭环：
+// 1. A发送包含javascript:链接和<script>的富文本
+// 2. B收到的html中没有<a>和<script>标签
+// 3. A通过HTTP编辑消息，B收到edited事件，包含新的plain_text和html
+// 4. B查询消息历史，内容已更新
+func TestRichText_SanitizeAndEdit(t *testing.T) {
+	userA := createTestUser()
+	userB := createTestUser()
+
+	wsA, err := connectWebSocket(userA.Token)
+	require.NoError(t, err)
+	defer wsA.Close()
+	wsB, err := connectWebSocket(userB.Token)
+	require.NoError(t, err)
+	defer wsB.Close()
+
+	// 1. 发送带不安全内容的富文本
+	wsSend(wsA, "message", map[string]interface{}{
+		"receiver_id":  userB.ID.String(),
+		"message_type": "rich_text",
+		"content":      "Click [here](javascript:alert(1)) <script>alert(1)</script>",
+	})
+
+	// 2. 不安全内容被过滤
+	msg, err := wsReceiveMessageType(wsB, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	msgData := msg["data"].(map[string]interface{})
+	msgID := msgData["id"].(string)
+	convID := msgData["conversation_id"].(string)
+	html := msgData["metadata"].(map[string]interface{})["html"].(string)
+	assert.NotContains(t, html, "<a ")
+	assert.NotContains(t, html, "<script>")
+	assert.Contains(t, html, "&lt;script&gt;")
+	assert.NotContains(t, msgData["content"], "javascript:")
+	assert.Equal(t, "Click here <script>alert(1)</script>", msgData["plain_text"])
+
+	// 3. 编辑消息
+	resp, body, err := httpRequest("POST", APIPrefix+"/messages/"+msgID+"/edit", userA.Token, map[string]interface{}{
+		"content": "__updated__ text",
+	})
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode, string(body))
+
+	event, err := wsReceiveMessageType(wsB, "edited", 3*time.Second, 5)
+	require.NoError(t, err, "B应该收到edited事件")
+	eventData := event["data"].(map[string]interface{})
+	assert.Equal(t, "**updated** text", eventData["content"])
+	assert.Equal(t, "updated text", eventData["plain_text"])
+	assert.Equal(t, "<p><strong>updated</strong> text</p>", eventData["metadata"].(map[string]interface{})["html"])
+
+	// 4. 验证闭环：消息历史已更新
+	messages, err := getMessages(userB.Token, convID)
+	require.NoError(t, err)
+	stored := findMessageByID(messages, msgID)
+	require.NotNil(t, stored)
+	assert.Equal(t, "**updated** text", stored["content"])
+	assert.Equal(t, "updated text", stored["plain_text"])
+}
@@ -0,0 +1,115 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ============================================
+// 定时消息
+// ============================================
+
+// TestScheduled_DeliveredAtDueTime 测试定时消息到期后通过正常流程发送
+//
+// 测试目标：
+// - 定时消息创建后为 pending 状态
+// - 到期后调度器发送消息，接收者实时收到（scheduled_at 带时区偏移时按绝对时间计算）
+// - 发送的消息以定时消息ID作为 client_msg_id（重新发送不会重复创建）
+// - 发送后状态变为 sent 并记录 sent_message_id
+//
+// 验证闭环：
+// 1. A创建2秒后发给B的定时消息（scheduled_at 使用 +08:00 时区）
+// 2. B在调度周期内收到该消息，client_msg_id 为定时消息ID
+// 3. A查询定时消息列表，状态为sent，sent_message_id为B收到的消息ID
+func TestScheduled_DeliveredAtDueTime(t *testing.T) {
+	userA := createTestUser()
+	userB := createTestUser()
+
+	wsB, err := connectWebSocket(userB.Token)
+	require.NoError(t, err)
+	defer wsB.Close()
+
+	// 1. 创建定时消息
+	resp, body, err := httpRequest("POST", APIPrefix+"/scheduled-messages", userA.Token, map[string]interface{}{
+		"receiver_id":  userB.ID.String(),
+		"message_type": "text",
+		"content":      "Happy birthday!",
+		"scheduled_at": time.Now().Add(2 * time.Second).In(time.FixedZone("UTC+8", 8*3600)).Format(time.RFC3339Nano),
+	})
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	scheduled := parseResponse(body)["scheduled_message"].(map[string]interface{})
+	scheduledID := scheduled["id"].(string)
+	assert.Equal(t, "pending", scheduled["status"])
+
+	// 2. B收到消息（调度周期5秒）
+	msg, err := wsReceiveMessageType(wsB, "message", 15*time.Second, 10)
+	require.NoError(t, err, "B应该在到期后收到定时消息")
+	data := msg["data"].(map[string]interface{})
+	assert.Equal(t, "Happy birthday!", data["content"])
+	assert.Equal(t, userA.ID.String(), data["sender_id"])
+	assert.Equal(t, scheduledID, data["client_msg_id"])
+
+	// 3. 验证闭环：状态为sent
+	_, body, _ = httpRequest("GET", APIPrefix+"/scheduled-messages?status=sent", userA.Token, nil)
+	list := parseResponse(body)["scheduled_messages"].([]interface{})
+	require.Len(t, list, 1)
+	sent := list[0].(map[string]interface{})
+	assert.Equal(t, scheduledID, sent["id"])
+	assert.Equal(t, data["id"], sent["sent_message_id"])
+}
+
+// TestScheduled_EditAndCancel 测试修改和取消定时消息
+//
+// 验证闭环：
+// 1. A创建1小时后发送的定时消息
+// 2. 修改内容成功
+// 3. 取消成功，再次取消返回409
+// 4. 列表中状态为cancelled，内容为修改后的内容
+func TestScheduled_EditAndCancel(t *testing.T) {
+	userA := createTestUser()
+	userB := createTestUser()
+
+	// 1. 创建定时消息
+	_, body, err := httpRequest("POST", APIPrefix+"/scheduled-messages", userA.Token, map[string]interface{}{
+		"receiver_id":  userB.ID.String(),
+		"message_type": "text",
+		"content":      "Draft",
+		"scheduled_at": time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+	})
+	require.NoError(t, err)
+	scheduledID := parseResponse(body)["scheduled_message"].(map[string]interface{})["id"].(string)
+
+	// 2. 修改内容
+	resp, body, err := httpRequest("POST", APIPrefix+"/scheduled-messages/"+scheduledID, userA.Token, map[string]interface{}{
+		"content": "Final version",
+	})
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "Final version", parseResponse(body)["scheduled_message"].(map[string]interface{})["content"])
+
+	// 其他用户不能修改
+	resp, _, _ = httpRequest("POST", APIPrefix+"/scheduled-messages/"+scheduledID, userB.Token, map[string]interface{}{
+		"content": "Hijacked",
+	})
+	assert.Equal(t, 404, resp.StatusCode)
+
+	// 3. 取消
+	resp, _, err = httpRequest("POST", APIPrefix+"/scheduled-messages/"+scheduledID+"/cancel", userA.Token, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	resp, _, _ = httpRequest("POST", APIPrefix+"/scheduled-messages/"+scheduledID+"/cancel", userA.Token, nil)
+	assert.Equal(t, 409, resp.StatusCode, "已取消的定时消息不能再次取消")
+
+	// 4. 验证闭环
+	_, body, _ = httpRequest("GET", APIPrefix+"/scheduled-messages", userA.Token, nil)
+	list := parseResponse(body)["scheduled_messages"].([]interface{})
+	require.Len(t, list, 1)
+	item := list[0].(map[string]interface{})
+	assert.Equal(t, "cancelled", item["status"])
+	assert.Equal(t, "Final version", item["content"])
+}
@@ -0,0 +1,283 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ============================================
+// 断线重连同步
+// ============================================
+
+// findSyncItem 在同步结果的事件列表中查找指定字段值的事件
+func findSyncItem(items interface{}, field, value string) map[string]interface{} {
+	list, ok := items.([]interface{})
+	if !ok {
+		return nil
+	}
+	for _, item := range list {
+		entry := item.(map[string]interface{})
+		if entry[field] == value {
+			return entry
+		}
+	}
+	return nil
+}
+
+// TestSync_EachDeviceCatchesUp 测试多个设备各自从检查点同步断线期间的变化
+//
+// 测试目标：
+// - 带 checkpoint 参数连接时，服务端从数据库同步新消息、编辑、撤回和会话变化
+// - 同步不会消费数据，同一用户的第二个设备用同一检查点得到相同的结果
+// - 首次连接（检查点为空）返回 reset 和新的检查点
+//
+// 验证闭环：
+// 1. member首次以空检查点连接，收到 reset=true 和检查点，然后断开
+// 2. owner在群聊中发送3条消息，编辑第2条，撤回第3条
+// 3. member的设备1带检查点连接，收到的 sync 包含3条消息、编辑、撤回，会话的 last_seq=3、未读数=3
+// 4. member的设备2带同一检查点连接，收到同样的3条消息
+// 5. owner收到member的 delivered 事件
+func TestSync_EachDeviceCatchesUp(t *testing.T) {
+	owner := createTestUser()
+	member := createTestUser()
+
+	resp, body, err := httpRequest("POST", APIPrefix+"/conversations/group", owner.Token, map[string]interface{}{
+		"group_name": "Sync Group",
+		"member_ids": []string{member.ID.String()},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode, string(body))
+	groupID := parseResponse(body)["id"].(string)
+
+	// 1. 首次连接
+	wsFirst, err := connectWebSocketWithCheckpoint(member.Token, "")
+	require.NoError(t, err)
+	first, err := wsReceiveMessageType(wsFirst, "sync", 3*time.Second, 5)
+	require.NoError(t, err)
+	firstData := first["data"].(map[string]interface{})
+	assert.Equal(t, true, firstData["reset"])
+	checkpoint := firstData["checkpoint"].(string)
+	require.NotEmpty(t, checkpoint)
+	wsFirst.Close()
+	time.Sleep(200 * time.Millisecond)
+
+	// 2. 断线期间的变化
+	wsOwner, err := connectWebSocket(owner.Token)
+	require.NoError(t, err)
+	defer wsOwner.Close()
+
+	var sent []string
+	for _, content := range []string{"first", "second", "third"} {
+		wsSend(wsOwner, "message", map[string]interface{}{
+			"conversation_id": groupID,
+			"message_type":    "text",
+			"content":         content,
+		})
+		msg, err := wsReceiveMessageType(wsOwner, "message", 3*time.Second, 10)
+		require.NoError(t, err)
+		sent = append(sent, msg["data"].(map[string]interface{})["id"].(string))
+	}
+	wsSend(wsOwner, "edit", map[string]interface{}{
+		"message_id": sent[1],
+		"content":    "second (edited)",
+	})
+	_, err = wsReceiveMessageType(wsOwner, "edited", 3*time.Second, 10)
+	require.NoError(t, err)
+	wsSend(wsOwner, "recall", map[string]interface{}{
+		"message_id": sent[2],
+	})
+	_, err = wsReceiveMessageType(wsOwner, "recalled", 3*time.Second, 10)
+	require.NoError(t, err)
+
+	// 3. 设备1同步
+	device1, err := connectWebSocketWithCheckpoint(member.Token, checkpoint)
+	require.NoError(t, err)
+	defer device1.Close()
+	syncMsg, err := wsReceiveMessageType(device1, "sync", 3*time.Second, 5)
+	require.NoError(t, err)
+	data := syncMsg["data"].(map[string]interface{})
+	assert.Equal(t, false, data["reset"])
+	assert.NotEqual(t, checkpoint, data["checkpoint"], "应该返回新的检查点")
+	assert.Equal(t, sent, messageIDs(data["messages"].([]interface{})))
+
+	edited := findSyncItem(data["edited"], "message_id", sent[1])
+	require.NotNil(t, edited, "应该包含编辑事件")
+	assert.Equal(t, "second (edited)", edited["content"])
+	assert.NotNil(t, findSyncItem(data["recalled"], "message_id", sent[2]), "应该包含撤回事件")
+
+	conv := findSyncItem(data["conversations"], "conversation_id", groupID)
+	require.NotNil(t, conv, "应该包含变化的会话")
+	assert.Equal(t, float64(3), conv["last_seq"])
+	assert.Equal(t, float64(3), conv["unread_count"])
+	assert.Equal(t, false, conv["left"])
+
+	// 4. 设备2用同一检查点同步
+	device2, err := connectWebSocketWithCheckpoint(member.Token, checkpoint)
+	require.NoError(t, err)
+	defer device2.Close()
+	syncMsg, err = wsReceiveMessageType(device2, "sync", 3*time.Second, 5)
+	require.NoError(t, err)
+	assert.Equal(t, sent, messageIDs(syncMsg["data"].(map[string]interface{})["messages"].([]interface{})), "第二个设备应该同步到同样的消息")
+
+	// 5. 同步后记录送达
+	event, err := wsReceiveMessageType(wsOwner, "delivered", 3*time.Second, 10)
+	require.NoError(t, err, "同步后owner应该收到delivered事件")
+	assert.Equal(t, member.ID.String(), event["data"].(map[string]interface{})["user_id"])
+}
+
+// TestSync_ReadProgressAndCheckpoints 测试已读进度同步和检查点校验
+//
+// 测试目标：
+// - 一个设备标记已读后，另一个设备同步时收到自己的已读进度，会话未读数为0
+// - 通过 WebSocket 的 sync 消息和 HTTP GET /api/v1/sync 都可以同步
+// - 新消息按会话内序号同步：用上次返回的检查点再次同步，不会重复返回已同步的消息
+// - 无效的检查点返回错误，过期的检查点返回 reset
+//
+// 验证闭环：
+// 1. member的设备1以空检查点连接，得到检查点
+// 2. owner发送消息，设备1收到后标记已读
+// 3. 通过 HTTP 用检查点同步，read 中包含member自己的已读进度，会话未读数为0
+// 4. 设备1发送 sync 消息，得到同样的结果
+// 5. 用第3步返回的检查点同步，messages 为空
+// 6. 无效检查点返回400，很早以前的检查点返回 reset=true
+func TestSync_ReadProgressAndCheckpoints(t *testing.T) {
+	owner := createTestUser()
+	member := createTestUser()
+
+	resp, body, err := httpRequest("POST", APIPrefix+"/conversations/group", owner.Token, map[string]interface{}{
+		"group_name": "Sync Read Group",
+		"member_ids": []string{member.ID.String()},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode, string(body))
+	groupID := parseResponse(body)["id"].(string)
+
+	// 1. 获取检查点
+	device1, err := connectWebSocketWithCheckpoint(member.Token, "")
+	require.NoError(t, err)
+	defer device1.Close()
+	first, err := wsReceiveMessageType(device1, "sync", 3*time.Second, 5)
+	require.NoError(t, err)
+	checkpoint := first["data"].(map[string]interface{})["checkpoint"].(string)
+
+	// 2. 收到消息后标记已读
+	wsOwner, err := connectWebSocket(owner.Token)
+	require.NoError(t, err)
+	defer wsOwner.Close()
+	wsSend(wsOwner, "message", map[string]interface{}{
+		"conversation_id": groupID,
+		"message_type":    "text",
+		"content":         "read me",
+	})
+	msg, err := wsReceiveMessageType(device1, "message", 3*time.Second, 10)
+	require.NoError(t, err)
+	msgID := msg["data"].(map[string]interface{})["id"].(string)
+
+	wsSend(device1, "read", map[string]interface{}{
+		"conversation_id": groupID,
+		"message_id":      msgID,
+	})
+	time.Sleep(300 * time.Millisecond)
+
+	// 3. HTTP 同步
+	resp, body, err = httpRequest("GET", APIPrefix+"/sync?checkpoint="+checkpoint, member.Token, nil)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode, string(body))
+	data := parseResponse(body)
+	assert.Equal(t, []string{msgID}, messageIDs(data["messages"].([]interface{})))
+
+	read := findSyncItem(data["read"], "user_id", member.ID.String())
+	require.NotNil(t, read, "应该包含自己的已读进度")
+	assert.Equal(t, groupID, read["conversation_id"])
+	assert.Equal(t, msgID, read["message_id"])
+
+	conv := findSyncItem(data["conversations"], "conversation_id", groupID)
+	require.NotNil(t, conv)
+	assert.Equal(t, float64(0), conv["unread_count"])
+	nextCheckpoint := data["checkpoint"].(string)
+
+	// 4. WebSocket sync 消息
+	wsSend(device1, "sync", map[string]interface{}{
+		"checkpoint": checkpoint,
+	})
+	syncMsg, err := wsReceiveMessageType(device1, "sync", 3*time.Second, 10)
+	require.NoError(t, err)
+	syncData := syncMsg["data"].(map[string]interface{})
+	assert.Equal(t, []string{msgID}, messageIDs(syncData["messages"].([]interface{})))
+	assert.NotNil(t, findSyncItem(syncData["read"], "user_id", member.ID.String()))
+
+	// 5. 新的检查点不再返回已同步的消息
+	resp, body, err = httpRequest("GET", APIPrefix+"/sync?checkpoint="+nextCheckpoint, member.Token, nil)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode, string(body))
+	data = parseResponse(body)
+	assert.Equal(t, false, data["reset"])
+	assert.Empty(t, data["messages"], "已同步的消息不应该重复返回")
+
+	// 6. 检查点校验
+	resp, _, err = httpRequest("GET", APIPrefix+"/sync?checkpoint=not-a-checkpoint", member.Token, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+
+	resp, body, err = httpRequest("GET", APIPrefix+"/sync?checkpoint=1000000", member.Token, nil)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode, string(body))
+	assert.Equal(t, true, parseResponse(body)["reset"], "过期的检查点应该要求重新拉取")
+}
+
+// TestSync_ClearsOfflineQueue 测试同步后清空离线队列
+//
+// 测试目标：
+// - 使用同步协议的用户不会拉取 Redis 离线队列，同步结果送出后服务端清空该队列，队列不会一直增长
+//
+// 验证闭环：
+// 1. owner在群聊中发送2条消息，member不在线，离线队列中有2条消息
+// 2. member带检查点（空）连接，收到 sync
+// 3. member的离线队列已被清空
+func TestSync_ClearsOfflineQueue(t *testing.T) {
+	owner := createTestUser()
+	member := createTestUser()
+
+	resp, body, err := httpRequest("POST", APIPrefix+"/conversations/group", owner.Token, map[string]interface{}{
+		"group_name": "Sync Queue Group",
+		"member_ids": []string{member.ID.String()},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode, string(body))
+	groupID := parseResponse(body)["id"].(string)
+
+	// 1. member不在线时发送消息
+	for _, content := range []string{"first", "second"} {
+		resp, body, err := httpRequest("POST", APIPrefix+"/messages", owner.Token, map[string]interface{}{
+			"conversation_id": groupID,
+			"message_type":    "text",
+			"content":         content,
+		})
+		require.NoError(t, err)
+		require.Equal(t, 200, resp.StatusCode, string(body))
+	}
+
+	rdb := getRedisClient()
+	defer rdb.Close()
+	key := "offline_msg:" + member.ID.String()
+	queued, err := rdb.LLen(context.Background(), key).Result()
+	require.NoError(t, err)
+	require.Equal(t, int64(2), queued)
+
+	// 2. 带检查点连接
+	ws, err := connectWebSocketWithCheckpoint(member.Token, "")
+	require.NoError(t, err)
+	defer ws.Close()
+	_, err = wsReceiveMessageType(ws, "sync", 3*time.Second, 5)
+	require.NoError(t, err)
+
+	// 3. 离线队列已清空
+	time.Sleep(200 * time.Millisecond)
+	queued, err = rdb.LLen(context.Background(), key).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), queued, "同步后应该清空离线队列")
+}
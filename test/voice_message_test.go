@@ -0,0 +1,279 @@
+package test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ============================================
+// 语音消息
+// ============================================
+
+// generateTestWAV 生成指定时长的 8kHz 16位单声道 WAV（音量逐渐增大的正弦波）
+func generateTestWAV(seconds float64) []byte {
+	const sampleRate = 8000
+	frames := int(seconds * sampleRate)
+
+	var pcm bytes.Buffer
+	for i := 0; i < frames; i++ {
+		amplitude := float64(i) / float64(frames)
+		binary.Write(&pcm, binary.LittleEndian, int16(amplitude*30000*math.Sin(float64(i)/4)))
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(36+pcm.Len()))
+	buf.WriteString("WAVEfmt ")
+	binary.Write(&buf, binary.LittleEndian, uint32(16))
+	binary.Write(&buf, binary.LittleEndian, uint16(1)) // PCM
+	binary.Write(&buf, binary.LittleEndian, uint16(1)) // 单声道
+	binary.Write(&buf, binary.LittleEndian, uint32(sampleRate))
+	binary.Write(&buf, binary.LittleEndian, uint32(sampleRate*2))
+	binary.Write(&buf, binary.LittleEndian, uint16(2))
+	binary.Write(&buf, binary.LittleEndian, uint16(16))
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(pcm.Len()))
+	buf.Write(pcm.Bytes())
+	return buf.Bytes()
+}
+
+// oggPage 生成一个只包含一个段的 Ogg 页
+func oggPage(granule uint64, payload []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("OggS")
+	buf.WriteByte(0) // 版本
+	buf.WriteByte(0) // 页类型
+	binary.Write(&buf, binary.LittleEndian, granule)
+	binary.Write(&buf, binary.LittleEndian, uint32(1)) // 流序列号
+	binary.Write(&buf, binary.LittleEndian, uint32(0)) // 页序号
+	binary.Write(&buf, binary.LittleEndian, uint32(0)) // CRC（服务端不校验）
+	buf.WriteByte(1)
+	buf.WriteByte(byte(len(payload)))
+	buf.Write(payload)
+	return buf.Bytes()
+}
+
+// generateTestOpus 生成指定时长的 Ogg Opus 文件（只有头部和带 granule position 的最后一页，服务端只读取时长）
+func generateTestOpus(seconds int) []byte {
+	const preSkip = 312
+	head := []byte("OpusHead\x01\x01")
+	head = binary.LittleEndian.AppendUint16(head, preSkip)
+	head = binary.LittleEndian.AppendUint32(head, 48000)
+	head = append(head, 0, 0, 0)
+
+	var buf bytes.Buffer
+	buf.Write(oggPage(0, head))
+	buf.Write(oggPage(0, []byte("OpusTags")))
+	buf.Write(oggPage(uint64(seconds*48000+preSkip), make([]byte, 64)))
+	return buf.Bytes()
+}
+
+// TestVoice_SendAndMarkListened 测试语音消息的时长、波形和收听状态
+//
+// 测试目标：
+// - 服务端根据音频内容计算时长和波形，忽略客户端提交的时长
+// - 会话列表预览显示为 [语音]
+// - 接收者播放后发送者收到 voice_listened 事件，消息历史中记录收听者
+//
+// 验证闭环：
+// 1. A上传2秒的WAV，发送语音消息（故意提交错误的时长）
+// 2. B收到的消息 duration_ms=2000，波形为64个点且逐渐增大
+// 3. B的会话列表预览为[语音]
+// 4. B标记已播放，A收到voice_listened事件
+// 5. A查询消息历史，voice_listens包含B；A标记自己的消息返回400
+func TestVoice_SendAndMarkListened(t *testing.T) {
+	userA := createTestUser()
+	userB := createTestUser()
+
+	// 1. 上传并发送语音
+	resp, body, err := uploadTestFile(userA.Token, "note.wav", generateTestWAV(2))
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode, string(body))
+	fileID := parseResponse(body)["file"].(map[string]interface{})["id"].(string)
+
+	wsA, err := connectWebSocket(userA.Token)
+	require.NoError(t, err)
+	defer wsA.Close()
+	wsB, err := connectWebSocket(userB.Token)
+	require.NoError(t, err)
+	defer wsB.Close()
+
+	wsSend(wsA, "message", map[string]interface{}{
+		"receiver_id":  userB.ID.String(),
+		"message_type": "voice",
+		"metadata": map[string]interface{}{
+			"file_id":  fileID,
+			"duration": 30,
+		},
+	})
+
+	// 2. 服务端计算的时长和波形
+	msg, err := wsReceiveMessageType(wsB, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	data := msg["data"].(map[string]interface{})
+	msgID := data["id"].(string)
+	convID := data["conversation_id"].(string)
+	assert.Equal(t, "voice", data["message_type"])
+	metadata := data["metadata"].(map[string]interface{})
+	assert.Equal(t, float64(2000), metadata["duration_ms"], "应使用服务端计算的时长")
+	assert.Equal(t, float64(2), metadata["duration"])
+	waveform := metadata["waveform"].([]interface{})
+	require.Len(t, waveform, 64)
+	assert.Equal(t, float64(100), waveform[63], "波形按最大值归一化")
+	assert.Less(t, waveform[0].(float64), waveform[63].(float64), "音量逐渐增大")
+	assert.Equal(t, "server", metadata["waveform_source"])
+
+	// 3. 会话列表预览
+	conversations, err := getConversationList(userB.Token)
+	require.NoError(t, err)
+	conv := findConversationByID(conversations, convID)
+	require.NotNil(t, conv)
+	assert.Equal(t, "[语音]", conv["last_message_text"])
+
+	// 4. B标记已播放
+	resp, _, err = httpRequest("POST", APIPrefix+"/messages/"+msgID+"/listened", userB.Token, nil)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+
+	event, err := wsReceiveMessageType(wsA, "voice_listened", 3*time.Second, 10)
+	require.NoError(t, err, "发送者应该收到voice_listened事件")
+	eventData := event["data"].(map[string]interface{})
+	assert.Equal(t, msgID, eventData["message_id"])
+	assert.Equal(t, userB.ID.String(), eventData["user_id"])
+
+	// 5. 验证闭环：消息历史记录收听者
+	messages, err := getMessages(userA.Token, convID)
+	require.NoError(t, err)
+	voiceMsg := findMessageByID(messages, msgID)
+	require.NotNil(t, voiceMsg)
+	listens := voiceMsg["voice_listens"].([]interface{})
+	require.Len(t, listens, 1)
+	assert.Equal(t, userB.ID.String(), listens[0].(map[string]interface{})["user_id"])
+
+	resp, _, _ = httpRequest("POST", APIPrefix+"/messages/"+msgID+"/listened", userA.Token, nil)
+	assert.Equal(t, 400, resp.StatusCode, "发送者不能标记自己的语音消息")
+}
+
+// TestVoice_RejectsTooLongOrNonAudio 测试语音时长限制和文件类型校验
+//
+// 验证闭环：
+// 1. A上传70秒的WAV（超过默认60秒限制），发送语音返回error
+// 2. A上传文本文件，作为语音发送返回error
+// 3. 不带file_id发送语音返回error
+func TestVoice_RejectsTooLongOrNonAudio(t *testing.T) {
+	userA := createTestUser()
+	userB := createTestUser()
+
+	wsA, err := connectWebSocket(userA.Token)
+	require.NoError(t, err)
+	defer wsA.Close()
+
+	// 1. 超过时长限制
+	resp, body, err := uploadTestFile(userA.Token, "long.wav", generateTestWAV(70))
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode, string(body))
+	longFileID := parseResponse(body)["file"].(map[string]interface{})["id"].(string)
+
+	wsSend(wsA, "message", map[string]interface{}{
+		"receiver_id":  userB.ID.String(),
+		"message_type": "voice",
+		"metadata":     map[string]interface{}{"file_id": longFileID},
+	})
+	errMsg, err := wsReceiveMessageType(wsA, "error", 3*time.Second, 5)
+	require.NoError(t, err)
+	assert.Contains(t, errMsg["data"].(map[string]interface{})["message"], "voice duration exceeds limit")
+
+	// 2. 非音频文件
+	resp, body, err = uploadTestFile(userA.Token, "notes.txt", []byte("not audio"))
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	textFileID := parseResponse(body)["file"].(map[string]interface{})["id"].(string)
+
+	wsSend(wsA, "message", map[string]interface{}{
+		"receiver_id":  userB.ID.String(),
+		"message_type": "voice",
+		"metadata":     map[string]interface{}{"file_id": textFileID},
+	})
+	errMsg, err = wsReceiveMessageType(wsA, "error", 3*time.Second, 5)
+	require.NoError(t, err)
+	assert.Contains(t, errMsg["data"].(map[string]interface{})["message"], "file type does not match message type")
+
+	// 3. 缺少 file_id
+	wsSend(wsA, "message", map[string]interface{}{
+		"receiver_id":  userB.ID.String(),
+		"message_type": "voice",
+		"metadata":     map[string]interface{}{"duration": 3},
+	})
+	errMsg, err = wsReceiveMessageType(wsA, "error", 3*time.Second, 5)
+	require.NoError(t, err)
+	assert.Contains(t, errMsg["data"].(map[string]interface{})["message"], "file_id is required for voice messages")
+}
+
+// TestVoice_CompressedFormats 测试压缩编码的语音消息
+//
+// 测试目标：
+// - Ogg Opus 的时长由服务端从容器中读取，忽略客户端提交的时长
+// - 压缩编码的波形使用客户端上报的采样，并标记为 waveform_source=client
+// - 服务端无法解析时长的格式（如 MP3）直接拒绝
+//
+// 验证闭环：
+// 1. A上传3秒的 Ogg Opus，发送语音消息（提交错误的时长和3个波形采样）
+// 2. A收到的消息 duration_ms=3000，waveform 为归一化后的3个点，waveform_source=client
+// 3. A上传 MP3 文件，作为语音发送返回 unsupported voice format
+func TestVoice_CompressedFormats(t *testing.T) {
+	userA := createTestUser()
+	userB := createTestUser()
+
+	wsA, err := connectWebSocket(userA.Token)
+	require.NoError(t, err)
+	defer wsA.Close()
+
+	// 1. Ogg Opus
+	resp, body, err := uploadTestFile(userA.Token, "note.opus", generateTestOpus(3))
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode, string(body))
+	file := parseResponse(body)["file"].(map[string]interface{})
+	assert.Equal(t, "audio/ogg", file["mime_type"])
+
+	wsSend(wsA, "message", map[string]interface{}{
+		"receiver_id":  userB.ID.String(),
+		"message_type": "voice",
+		"metadata": map[string]interface{}{
+			"file_id":  file["id"],
+			"duration": 45,
+			"waveform": []float64{0.2, 0.5, 1},
+		},
+	})
+
+	// 2. 服务端读取的时长，客户端的波形
+	msg, err := wsReceiveMessageType(wsA, "message", 3*time.Second, 5)
+	require.NoError(t, err)
+	metadata := msg["data"].(map[string]interface{})["metadata"].(map[string]interface{})
+	assert.Equal(t, float64(3000), metadata["duration_ms"], "应使用服务端从文件中读取的时长")
+	assert.Equal(t, []interface{}{float64(20), float64(50), float64(100)}, metadata["waveform"])
+	assert.Equal(t, "client", metadata["waveform_source"])
+
+	// 3. 不支持的格式
+	resp, body, err = uploadTestFile(userA.Token, "note.mp3", append([]byte("ID3\x03\x00\x00\x00\x00\x00\x00"), make([]byte, 256)...))
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode, string(body))
+	mp3FileID := parseResponse(body)["file"].(map[string]interface{})["id"].(string)
+
+	wsSend(wsA, "message", map[string]interface{}{
+		"receiver_id":  userB.ID.String(),
+		"message_type": "voice",
+		"metadata": map[string]interface{}{
+			"file_id":  mp3FileID,
+			"duration": 3,
+		},
+	})
+	errMsg, err := wsReceiveMessageType(wsA, "error", 3*time.Second, 5)
+	require.NoError(t, err)
+	assert.Contains(t, errMsg["data"].(map[string]interface{})["message"], "unsupported voice format")
+}
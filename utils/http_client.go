@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// maxRedirects 外部链接最多跟随的重定向次数
+const maxRedirects = 5
+
+// redirectCheckKey 请求 context 中重定向校验函数的 key
+type redirectCheckKey struct{}
+
+// WithRedirectCheck 为请求附加重定向校验：每次重定向前用目标地址调用 check，返回错误时停止请求
+// （例如链接预览按域名白名单/黑名单校验重定向后的地址）
+func WithRedirectCheck(ctx context.Context, check func(target *url.URL) error) context.Context {
+	return context.WithValue(ctx, redirectCheckKey{}, check)
+}
+
+// NewPublicHTTPClient 创建只允许访问公网地址的 HTTP 客户端（用于下载用户提交的外部链接，避免访问内网服务）
+// 每次建立连接时校验解析后的 IP，重定向到内网地址同样会被拒绝；
+// 重定向最多跟随 maxRedirects 次，只允许 http/https，并执行请求 context 中的重定向校验（见 WithRedirectCheck）
+func NewPublicHTTPClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+				ip.IsLinkLocalMulticast() || ip.IsUnspecified() || ip.IsMulticast() {
+				return fmt.Errorf("host is not allowed")
+			}
+			return nil
+		},
+	}
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{DialContext: dialer.DialContext},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirect scheme is not allowed")
+			}
+			if check, ok := req.Context().Value(redirectCheckKey{}).(func(*url.URL) error); ok {
+				return check(req.URL)
+			}
+			return nil
+		},
+	}
+}